@@ -8,14 +8,26 @@ package config
 // Keys for project config file
 const K_ProjectIndexPrompt = "project_index_prompt"
 const K_ProjectIndexResponse = "project_index_response"
+const K_ProjectDirIndexPrompt = "dir_index_prompt"
+const K_ProjectDirSelectPrompt = "dir_select_prompt"
+const K_ProjectDirSummariesFileCount = "dir_summaries_file_count"
+const K_ProjectDirIndexMaxEntries = "dir_index_max_entries"
+const K_ProjectSymbolsRx = "symbols_rx"
+const K_ProjectSymbolsMaxCount = "symbols_max_count"
+const K_ProjectSymbolsHeader = "symbols_header"
 const K_ProjectDescriptionPrompt = "project_description_prompt"
 const K_ProjectDescriptionResponse = "project_description_response"
 const K_ProjectFilenameTags = "filename_tags"
 const K_ProjectFilenameTagsRx = "filename_tags_rx"
 const K_ProjectDeleteTags = "delete_tags"
 const K_ProjectDeleteTagsRx = "delete_tags_rx"
+const K_ProjectMoveTags = "move_tags"
+const K_ProjectMoveTagsRx = "move_tags_rx"
 const K_ProjectCodeTagsRx = "code_tags_rx"
 const K_ProjectNoUploadCommentsRx = "noupload_comments_rx"
+const K_ProjectSecretsRx = "secrets_rx"
+const K_ProjectSecretsEntropyThreshold = "secrets_entropy_threshold"
+const K_ProjectSecretsEntropyMinLength = "secrets_entropy_min_length"
 const K_ProjectMediumContextSavingFileCount = "medium_context_saving_file_count"
 const K_ProjectHighContextSavingFileCount = "high_context_saving_file_count"
 const K_ProjectMediumContextSavingSelectPercent = "medium_context_saving_select_percent"
@@ -24,10 +36,17 @@ const K_ProjectHighContextSavingSelectPercent = "high_context_saving_select_perc
 const K_ProjectHighContextSavingRandomPercent = "high_context_saving_random_percent"
 const K_ProjectFilesBlacklist = "project_files_blacklist"
 const K_ProjectFilesWhitelist = "project_files_whitelist"
+const K_ProjectFilesReadonly = "project_files_readonly"
 const K_ProjectTestFilesBlacklist = "project_test_files_blacklist"
 const K_ProjectMdCodeMappings = "files_to_md_code_mappings"
 const K_ProjectFilesIncrModeMinLen = "files_incremental_mode_min_length"
 const K_ProjectFilesIncrModeRx = "files_incremental_mode_rx"
+const K_ProjectStashKeepCount = "stash_keep_count"
+const K_ProjectStashMaxAgeDays = "stash_max_age_days"
+const K_ProjectStashMaxTotalSizeMB = "stash_max_total_size_mb"
+const K_ProjectStashCompression = "stash_compression"
+const K_ProjectGitMode = "git_mode"
+const K_ProjectGitBranchPrefix = "git_branch_prefix"
 
 // Keys present in multuple operations config files
 const K_SystemPrompt = "system_prompt"
@@ -42,10 +61,32 @@ const K_AnnotateTaskPrompt = "annotate_task_prompt"
 const K_AnnotateTaskResponse = "annotate_task_response"
 const K_AnnotateFilePrompts = "annotate_file_prompts"
 const K_AnnotateFileResponse = "annotate_file_response"
+const K_AnnotateDirPrompt = "annotate_dir_prompt"
+const K_AnnotateDirResponse = "annotate_dir_response"
+
+// Chunked annotation of large files
+const K_AnnotateChunkSizes = "annotate_chunk_sizes"
+const K_AnnotateChunkSplitRx = "annotate_chunk_split_rx"
+const K_AnnotateChunkPrompt = "annotate_chunk_prompt"
+const K_AnnotateChunkResponse = "annotate_chunk_response"
+const K_AnnotateMergePrompt = "annotate_merge_prompt"
+const K_AnnotateMergeResponse = "annotate_merge_response"
+
+// Annotation quality checks
+const K_AnnotateMinLength = "annotate_min_length"
+const K_AnnotateMaxLength = "annotate_max_length"
+const K_AnnotateRequiredRx = "annotate_required_rx"
+const K_AnnotateForbiddenRx = "annotate_forbidden_rx"
+const K_AnnotateLanguageRx = "annotate_language_rx"
+const K_AnnotateLanguageMinPercent = "annotate_language_min_percent"
+const K_AnnotateSymbolsRx = "annotate_symbols_rx"
+const K_AnnotateSymbolsMinPercent = "annotate_symbols_min_percent"
+const K_AnnotateNotesRx = "annotate_notes_rx"
 
 // Keys for implement operation config file
 const K_ImplementFilenameEmbedRx = "filename_embed_rx"
 const K_ImplementCommentsRx = "implement_comments_rx"
+const K_ImplementRegionTagsRx = "implement_region_tags_rx"
 
 // Implement stage 1
 const K_ImplementStage1AnalysisPrompt = "stage1_analysis_prompt"
@@ -58,6 +99,7 @@ const K_ImplementStage2ReasoningsPrompt = "stage2_reasonings_prompt"
 const K_ImplementStage2ReasoningsPromptFinal = "stage2_reasonings_prompt_final"
 const K_ImplementTaskStage2ReasoningsPrompt = "stage2_task_reasonings_prompt"
 const K_ImplementTaskStage2ReasoningsPromptFinal = "stage2_task_reasonings_prompt_final"
+const K_ImplementStage2RevisePrompt = "stage2_revise_prompt"
 
 // Implement stage 3, prompt to generate list of files that will be changed, continuation of stage 2 with reasonings - not attaching target files
 const K_ImplementStage3PlanningPrompt = "stage3_planning_prompt"
@@ -71,6 +113,7 @@ const K_ImplementStage4ChangesDoneResponse = "stage4_changes_done_response"
 const K_ImplementStage4ProcessPrompt = "stage4_process_prompt"
 const K_ImplementStage4ContinuePrompt = "stage4_continue_prompt"
 const K_ImplementStage4ProcessIncrPrompt = "stage4_process_incremental_prompt"
+const K_ImplementStage4ProcessRegionPrompt = "stage4_process_region_prompt"
 
 // Keys for doc operation config file
 const K_DocExamplePrompt = "example_doc_prompt"
@@ -88,6 +131,8 @@ const K_ExplainOutAnswerHeader = "output_answer_header"
 const K_ExplainOutQuestionHeader = "output_question_header"
 const K_ExplainStage1QuestionPrompt = "stage1_question_prompt"
 const K_ExplainStage2QuestionPrompt = "stage2_question_prompt"
+const K_ExplainSymbolsPrompt = "symbols_prompt"
+const K_ExplainSymbolsResponse = "symbols_response"
 
 // Keys for report operation config file
 const K_ReportBriefPrompt = "brief_prompt"
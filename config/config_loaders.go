@@ -95,6 +95,14 @@ func LoadProjectConfig(baseDir string, logger logging.ILogger) Config {
 	return &configStorage{cfgValues: storageObject, logger: logger, fileName: ProjectConfigFile}
 }
 
+// NewSecretRedactor creates redactor for secrets in project files, configured with project.json
+func NewSecretRedactor(projectConfig Config) *utils.SecretRedactor {
+	return utils.NewSecretRedactor(
+		projectConfig.RegexpArray(K_ProjectSecretsRx),
+		projectConfig.Float(K_ProjectSecretsEntropyThreshold),
+		projectConfig.Integer(K_ProjectSecretsEntropyMinLength))
+}
+
 func LoadOpDocConfig(baseDir string, logger logging.ILogger) Config {
 	storageObject := map[string]any{}
 	if err := utils.LoadJsonFile(filepath.Join(baseDir, OpDocConfigFile), &storageObject); err != nil {
@@ -162,12 +170,20 @@ func processOpImplementConfig(cfg map[string]any) error {
 	if err := validateNonEmptyStringArray(cfg[K_ImplementCommentsRx], K_ImplementCommentsRx); err != nil {
 		return err
 	}
+	if err := validateStringPair(cfg[K_ImplementRegionTagsRx], K_ImplementRegionTagsRx); err != nil {
+		return err
+	}
 	//precompile regexps
 	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ImplementCommentsRx]), K_ImplementCommentsRx); err != nil {
 		return err
 	} else {
 		cfg[K_ImplementCommentsRx] = rxArr
 	}
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ImplementRegionTagsRx]), K_ImplementRegionTagsRx); err != nil {
+		return err
+	} else {
+		cfg[K_ImplementRegionTagsRx] = rxArr
+	}
 	if rx, err := regexp.Compile(cfg[K_ImplementFilenameEmbedRx].(string)); err != nil {
 		return fmt.Errorf("%s must be a valid regexp: %s", K_ImplementFilenameEmbedRx, err)
 	} else {
@@ -211,6 +227,67 @@ func processOpAnnotateConfig(cfg map[string]any) error {
 	}
 	//write back converted value for direct acceess
 	cfg[K_AnnotateFilePrompts] = matcher
+	//convert K_AnnotateChunkSizes and K_AnnotateChunkSplitRx to matchers
+	chunkSizesMatcher, err := utils.NewRxMatcher[int](1, cfg[K_AnnotateChunkSizes])
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", K_AnnotateChunkSizes, err)
+	}
+	for i, el := range cfg[K_AnnotateChunkSizes].([]any) {
+		if el.([]any)[1].(float64) < 0 {
+			return fmt.Errorf("%s[%d] chunk size must not be negative", K_AnnotateChunkSizes, i)
+		}
+	}
+	cfg[K_AnnotateChunkSizes] = chunkSizesMatcher
+	chunkSplitMatcher, err := utils.NewRxMatcher[string](1, cfg[K_AnnotateChunkSplitRx])
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", K_AnnotateChunkSplitRx, err)
+	}
+	if err := validateRxMatcherRegexpValues(cfg[K_AnnotateChunkSplitRx], K_AnnotateChunkSplitRx); err != nil {
+		return err
+	}
+	cfg[K_AnnotateChunkSplitRx] = chunkSplitMatcher
+	//validate annotation quality checks
+	if cfg[K_AnnotateMinLength].(float64) < 1 {
+		return fmt.Errorf("%s must be at least 1", K_AnnotateMinLength)
+	}
+	if maxLength := cfg[K_AnnotateMaxLength].(float64); maxLength < 0 {
+		return fmt.Errorf("%s must not be negative", K_AnnotateMaxLength)
+	} else if maxLength > 0 && maxLength < cfg[K_AnnotateMinLength].(float64) {
+		return fmt.Errorf("%s must not be less than %s", K_AnnotateMaxLength, K_AnnotateMinLength)
+	}
+	if percent := cfg[K_AnnotateLanguageMinPercent].(float64); percent < 0 || percent > 100 {
+		return fmt.Errorf("%s must be in range 0-100", K_AnnotateLanguageMinPercent)
+	}
+	if percent := cfg[K_AnnotateSymbolsMinPercent].(float64); percent < 0 || percent > 100 {
+		return fmt.Errorf("%s must be in range 0-100", K_AnnotateSymbolsMinPercent)
+	}
+	//convert K_AnnotateRequiredRx and K_AnnotateSymbolsRx to matchers, regexps of matched values are compiled when used
+	for _, key := range []string{K_AnnotateRequiredRx, K_AnnotateSymbolsRx} {
+		matcher, err := utils.NewRxMatcher[string](1, cfg[key])
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", key, err)
+		}
+		if err := validateRxMatcherRegexpValues(cfg[key], key); err != nil {
+			return err
+		}
+		cfg[key] = matcher
+	}
+	//precompile regexps
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_AnnotateForbiddenRx]), K_AnnotateForbiddenRx); err != nil {
+		return err
+	} else {
+		cfg[K_AnnotateForbiddenRx] = rxArr
+	}
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_AnnotateNotesRx]), K_AnnotateNotesRx); err != nil {
+		return err
+	} else {
+		cfg[K_AnnotateNotesRx] = rxArr
+	}
+	if rx, err := regexp.Compile(cfg[K_AnnotateLanguageRx].(string)); err != nil {
+		return fmt.Errorf("%s must be a valid regexp: %s", K_AnnotateLanguageRx, err)
+	} else {
+		cfg[K_AnnotateLanguageRx] = rx
+	}
 	return nil
 }
 
@@ -266,6 +343,16 @@ func processProjectConfig(cfg map[string]any) error {
 	//write back converted value for direct acceess
 	cfg[K_ProjectFilesIncrModeMinLen] = fileLenMatcher
 
+	//convert and Validate K_ProjectSymbolsRx, regexps of matched values are compiled when used
+	symbolsMatcher, err := utils.NewRxMatcher[string](1, cfg[K_ProjectSymbolsRx])
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %v", K_ProjectSymbolsRx, err)
+	}
+	if err := validateRxMatcherRegexpValues(cfg[K_ProjectSymbolsRx], K_ProjectSymbolsRx); err != nil {
+		return err
+	}
+	cfg[K_ProjectSymbolsRx] = symbolsMatcher
+
 	//precompile regexps
 	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectFilesBlacklist]), K_ProjectFilesBlacklist); err != nil {
 		return err
@@ -277,6 +364,11 @@ func processProjectConfig(cfg map[string]any) error {
 	} else {
 		cfg[K_ProjectFilesWhitelist] = rxArr
 	}
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectFilesReadonly]), K_ProjectFilesReadonly); err != nil {
+		return err
+	} else {
+		cfg[K_ProjectFilesReadonly] = rxArr
+	}
 	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectTestFilesBlacklist]), K_ProjectTestFilesBlacklist); err != nil {
 		return err
 	} else {
@@ -301,9 +393,46 @@ func processProjectConfig(cfg map[string]any) error {
 	if err := validateEvenStringArray(cfg[K_ProjectDeleteTagsRx], K_ProjectDeleteTagsRx); err != nil {
 		return err
 	}
+	if err := validateEvenStringArray(cfg[K_ProjectMoveTags], K_ProjectMoveTags); err != nil {
+		return err
+	}
+	if err := validateEvenStringArray(cfg[K_ProjectMoveTagsRx], K_ProjectMoveTagsRx); err != nil {
+		return err
+	}
 	if err := validateNonEmptyStringArray(cfg[K_ProjectNoUploadCommentsRx], K_ProjectNoUploadCommentsRx); err != nil {
 		return err
 	}
+	//validate stash retention and compression settings
+	for _, key := range []string{K_ProjectStashKeepCount, K_ProjectStashMaxAgeDays, K_ProjectStashMaxTotalSizeMB} {
+		if cfg[key].(float64) < 0 {
+			return fmt.Errorf("%s must not be negative", key)
+		}
+	}
+	if compression := cfg[K_ProjectStashCompression].(string); compression != "none" && compression != "gzip" {
+		return fmt.Errorf("invalid %s value: %s, valid values: none, gzip", K_ProjectStashCompression, compression)
+	}
+	//validate secrets redaction settings
+	if cfg[K_ProjectSecretsEntropyThreshold].(float64) < 0 {
+		return fmt.Errorf("%s must not be negative", K_ProjectSecretsEntropyThreshold)
+	}
+	if cfg[K_ProjectSecretsEntropyMinLength].(float64) < 8 {
+		return fmt.Errorf("%s must be at least 8", K_ProjectSecretsEntropyMinLength)
+	}
+	//validate directory summaries settings
+	if cfg[K_ProjectDirSummariesFileCount].(float64) < 0 {
+		return fmt.Errorf("%s must not be negative", K_ProjectDirSummariesFileCount)
+	}
+	if cfg[K_ProjectDirIndexMaxEntries].(float64) < 2 {
+		return fmt.Errorf("%s must be at least 2", K_ProjectDirIndexMaxEntries)
+	}
+	//validate symbol index settings
+	if cfg[K_ProjectSymbolsMaxCount].(float64) < 0 {
+		return fmt.Errorf("%s must not be negative", K_ProjectSymbolsMaxCount)
+	}
+	//validate git integration settings
+	if gitMode := cfg[K_ProjectGitMode].(string); gitMode != "none" && gitMode != "commit" && gitMode != "branch" {
+		return fmt.Errorf("invalid %s value: %s, valid values: none, commit, branch", K_ProjectGitMode, gitMode)
+	}
 	if err := validateEvenStringArray(cfg[K_ProjectCodeTagsRx], K_ProjectCodeTagsRx); err != nil {
 		return err
 	}
@@ -318,11 +447,21 @@ func processProjectConfig(cfg map[string]any) error {
 	} else {
 		cfg[K_ProjectDeleteTagsRx] = rxArr
 	}
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectMoveTagsRx]), K_ProjectMoveTagsRx); err != nil {
+		return err
+	} else {
+		cfg[K_ProjectMoveTagsRx] = rxArr
+	}
 	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectNoUploadCommentsRx]), K_ProjectNoUploadCommentsRx); err != nil {
 		return err
 	} else {
 		cfg[K_ProjectNoUploadCommentsRx] = rxArr
 	}
+	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectSecretsRx]), K_ProjectSecretsRx); err != nil {
+		return err
+	} else {
+		cfg[K_ProjectSecretsRx] = rxArr
+	}
 	if rxArr, err := compileRegexArray(interfaceToStringArray(cfg[K_ProjectCodeTagsRx]), K_ProjectCodeTagsRx); err != nil {
 		return err
 	} else {
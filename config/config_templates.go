@@ -23,6 +23,26 @@ func GetAnnotateConfigTemplate() map[string]any {
 	// generate annotation for file
 	result[K_AnnotateFilePrompts] = templateString2DArray
 	result[K_AnnotateFileResponse] = templateString
+	// generate summary for directory
+	result[K_AnnotateDirPrompt] = templateString
+	result[K_AnnotateDirResponse] = templateString
+	// chunked annotation of large files
+	result[K_AnnotateChunkSizes] = templateString2DArray
+	result[K_AnnotateChunkSplitRx] = templateString2DArray
+	result[K_AnnotateChunkPrompt] = templateString
+	result[K_AnnotateChunkResponse] = templateString
+	result[K_AnnotateMergePrompt] = templateString
+	result[K_AnnotateMergeResponse] = templateString
+	// annotation quality checks
+	result[K_AnnotateMinLength] = templateInteger
+	result[K_AnnotateMaxLength] = templateInteger
+	result[K_AnnotateRequiredRx] = templateString2DArray
+	result[K_AnnotateForbiddenRx] = templateStringArray
+	result[K_AnnotateLanguageRx] = templateString
+	result[K_AnnotateLanguageMinPercent] = templateFloat
+	result[K_AnnotateSymbolsRx] = templateString2DArray
+	result[K_AnnotateSymbolsMinPercent] = templateFloat
+	result[K_AnnotateNotesRx] = templateStringArray
 	return result
 }
 
@@ -42,6 +62,7 @@ func GetImplementConfigTemplate() map[string]any {
 	result[K_ImplementStage2ReasoningsPromptFinal] = templateString
 	result[K_ImplementTaskStage2ReasoningsPrompt] = templateString
 	result[K_ImplementTaskStage2ReasoningsPromptFinal] = templateString
+	result[K_ImplementStage2RevisePrompt] = templateString
 	// stage 3
 	result[K_ImplementStage3ExtraFilesPrompt] = templateString
 	result[K_ImplementStage3PlanningPrompt] = templateString
@@ -51,9 +72,11 @@ func GetImplementConfigTemplate() map[string]any {
 	result[K_ImplementStage4ProcessPrompt] = templateString
 	result[K_ImplementStage4ContinuePrompt] = templateString
 	result[K_ImplementStage4ProcessIncrPrompt] = templateString
+	result[K_ImplementStage4ProcessRegionPrompt] = templateString
 	// tags for providing filenames to LLM, parsing filenames from response, parsing output code, etc
 	result[K_ImplementFilenameEmbedRx] = templateString
 	result[K_ImplementCommentsRx] = templateStringArray
+	result[K_ImplementRegionTagsRx] = templateStringArray
 	return result
 }
 
@@ -86,6 +109,9 @@ func GetExplainConfigTemplate() map[string]any {
 	result[K_ExplainOutQuestionHeader] = templateString
 	// stage 1
 	result[K_ExplainStage1QuestionPrompt] = templateString
+	// definitions of symbols mentioned in the question, found in local symbol index
+	result[K_ExplainSymbolsPrompt] = templateString
+	result[K_ExplainSymbolsResponse] = templateString
 	// stage 2
 	result[K_CodePrompt] = templateString
 	result[K_CodeResponse] = templateString
@@ -106,6 +132,7 @@ func GetProjectConfigTemplate() map[string]any {
 	result := map[string]any{}
 	result[K_ProjectFilesBlacklist] = templateStringArray
 	result[K_ProjectFilesWhitelist] = templateStringArray
+	result[K_ProjectFilesReadonly] = templateStringArray
 	result[K_ProjectTestFilesBlacklist] = templateStringArray
 	result[K_ProjectMdCodeMappings] = templateString2DArray
 	result[K_ProjectMediumContextSavingFileCount] = templateInteger
@@ -118,15 +145,37 @@ func GetProjectConfigTemplate() map[string]any {
 	result[K_ProjectDescriptionResponse] = templateString
 	result[K_ProjectIndexPrompt] = templateString
 	result[K_ProjectIndexResponse] = templateString
+	// hierarchical directory summaries used by stage 1 for large projects
+	result[K_ProjectDirIndexPrompt] = templateString
+	result[K_ProjectDirSelectPrompt] = templateString
+	result[K_ProjectDirSummariesFileCount] = templateInteger
+	result[K_ProjectDirIndexMaxEntries] = templateInteger
+	// local symbol index, added to the project index at stage 1
+	result[K_ProjectSymbolsRx] = templateString2DArray
+	result[K_ProjectSymbolsMaxCount] = templateInteger
+	result[K_ProjectSymbolsHeader] = templateString
 	// tags for providing filenames to LLM, parsing filenames and code-blocks from LLM response,
 	result[K_ProjectFilenameTags] = templateStringArray
 	result[K_ProjectFilenameTagsRx] = templateStringArray
 	result[K_ProjectDeleteTags] = templateStringArray
 	result[K_ProjectDeleteTagsRx] = templateStringArray
+	result[K_ProjectMoveTags] = templateStringArray
+	result[K_ProjectMoveTagsRx] = templateStringArray
 	result[K_ProjectCodeTagsRx] = templateStringArray
 	result[K_ProjectNoUploadCommentsRx] = templateStringArray
+	// secrets redaction before uploading file contents to LLM
+	result[K_ProjectSecretsRx] = templateStringArray
+	result[K_ProjectSecretsEntropyThreshold] = templateFloat
+	result[K_ProjectSecretsEntropyMinLength] = templateInteger
 	// settings for incremental file-change mode
 	result[K_ProjectFilesIncrModeMinLen] = templateStringInt2DArray
 	result[K_ProjectFilesIncrModeRx] = templateStringArray
+	// stash retention and compression settings
+	result[K_ProjectStashKeepCount] = templateInteger
+	result[K_ProjectStashMaxAgeDays] = templateFloat
+	result[K_ProjectStashMaxTotalSizeMB] = templateFloat
+	result[K_ProjectStashCompression] = templateString
+	result[K_ProjectGitMode] = templateString
+	result[K_ProjectGitBranchPrefix] = templateString
 	return result
 }
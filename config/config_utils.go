@@ -81,6 +81,29 @@ func validateEvenStringArray(value any, name string) error {
 	return nil
 }
 
+func validateStringPair(value any, name string) error {
+	arr, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("%s must be an array", name)
+	}
+
+	if len(arr) != 2 {
+		return fmt.Errorf("%s must contain exactly 2 elements", name)
+	}
+
+	for i, v := range arr {
+		str, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("%s[%d] must be a string", name, i)
+		}
+		if len(str) < 1 {
+			return fmt.Errorf("%s[%d] is empty", name, i)
+		}
+	}
+
+	return nil
+}
+
 func validateNonEmptyStringArray(value any, name string) error {
 	arr, ok := value.([]any)
 	if !ok {
@@ -116,6 +139,17 @@ func compileRegexArray(source []string, name string) ([]*regexp.Regexp, error) {
 	return result, nil
 }
 
+// validateRxMatcherRegexpValues checks that values of the 2d array with [regexp, value] pairs are valid regexps too,
+// array structure must be already validated by utils.NewRxMatcher
+func validateRxMatcherRegexpValues(source any, name string) error {
+	for i, el := range source.([]any) {
+		if _, err := regexp.Compile(el.([]any)[1].(string)); err != nil {
+			return fmt.Errorf("failed to compile %s[%d] value regexp: %s", name, i, err)
+		}
+	}
+	return nil
+}
+
 func interfaceToStringArray(source any) []string {
 	sourceArray := source.([]any)
 	target := make([]string, len(sourceArray), cap(sourceArray))
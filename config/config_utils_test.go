@@ -318,6 +318,31 @@ func TestValidateEvenStringArray(t *testing.T) {
 	}
 }
 
+func TestValidateStringPair(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   any
+		wantErr bool
+	}{
+		{name: "not an array", value: "string", wantErr: true},
+		{name: "empty array", value: []any{}, wantErr: true},
+		{name: "single element", value: []any{"begin"}, wantErr: true},
+		{name: "two pairs", value: []any{"begin", "end", "begin2", "end2"}, wantErr: true},
+		{name: "non-string element", value: []any{"begin", 1}, wantErr: true},
+		{name: "empty element", value: []any{"begin", ""}, wantErr: true},
+		{name: "valid pair", value: []any{"begin", "end"}, wantErr: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStringPair(tt.value, "test")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateStringPair() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestValidateNonEmptyStringArray(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -416,3 +441,36 @@ func TestCompileRegexArray(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateRxMatcherRegexpValues(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  any
+		wantErr bool
+	}{
+		{
+			name:    "valid value regexps",
+			source:  []any{[]any{`^.*\.go$`, `(?m)^func ([A-Z]\w*)`}, []any{`^.*$`, `Package`}},
+			wantErr: false,
+		},
+		{
+			name:    "invalid value regexp",
+			source:  []any{[]any{`^.*\.go$`, `([A-Z`}},
+			wantErr: true,
+		},
+		{
+			name:    "empty array",
+			source:  []any{},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRxMatcherRegexpValues(tt.source, "test")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateRxMatcherRegexpValues() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"slices"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/DarkCaster/Perpetual/langchaingo/llms"
 	"github.com/DarkCaster/Perpetual/langchaingo/llms/anthropic"
@@ -33,6 +32,7 @@ type AnthropicLLMConnector struct {
 	MaxTokensSegments     int
 	MaxRequestSize        int
 	OnFailRetries         int
+	Concurrency           int
 	RawMessageLogger      func(v ...any)
 	Options               []llms.CallOption
 	FieldsToRemove        []string
@@ -123,6 +123,17 @@ func NewAnthropicLLMConnectorFromEnv(
 	}
 	debug.Add("retries", onFailRetries)
 
+	concurrency, err := utils.GetEnvInt(fmt.Sprintf("%s_CONCURRENCY_OP_%s", prefix, operation), fmt.Sprintf("%s_CONCURRENCY", prefix))
+	if err != nil {
+		concurrency = 1
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency provided for %s operation must be greater than 0: %d", operation, concurrency)
+	}
+	if concurrency > 1 {
+		debug.Add("concurrency", concurrency)
+	}
+
 	customBaseURL, err := utils.GetEnvString(fmt.Sprintf("%s_BASE_URL", prefix))
 	if err == nil && customBaseURL != "" {
 		debug.Add("base url", customBaseURL)
@@ -203,6 +214,7 @@ func NewAnthropicLLMConnectorFromEnv(
 		MaxTokensSegments:     maxTokensSegments,
 		MaxRequestSize:        maxRequestSize,
 		OnFailRetries:         onFailRetries,
+		Concurrency:           concurrency,
 		RawMessageLogger:      llmRawMessageLogger,
 		Options:               extraOptions,
 		FieldsToRemove:        fieldsToRemove,
@@ -217,6 +229,10 @@ func (p *AnthropicLLMConnector) GetEmbedScoreThreshold() float32 {
 	return 0
 }
 
+func (p *AnthropicLLMConnector) GetEmbedChunkRanges(mode EmbedMode, content string) [][2]int {
+	return [][2]int{}
+}
+
 func (p *AnthropicLLMConnector) CreateEmbeddings(mode EmbedMode, tag, content string) ([][]float32, QueryStatus, error) {
 	return [][]float32{}, QueryInitFailed, errors.New("anthropic provider do not have support for embedding models and cannot create embeddings")
 }
@@ -336,9 +352,7 @@ func (p *AnthropicLLMConnector) Query(allowCaching bool, messages ...Message) (s
 	}
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	finalOptions := utils.NewSlice(p.Options...)
 	finalOptions = append(finalOptions, llms.WithStreamingFunc(streamFunc), llms.WithStreamingReasoningFunc(streamReasoningFunc))
@@ -349,6 +363,9 @@ func (p *AnthropicLLMConnector) Query(allowCaching bool, messages ...Message) (s
 		llmMessages,
 		finalOptions...,
 	)
+	if err == nil && responses != nil && len(responses.Choices) > 0 {
+		recordTokenUsage(responses.Choices[0].GenerationInfo)
+	}
 	choices := []*llms.ContentChoice{}
 	if responses != nil && responses.Choices != nil {
 		for _, choice := range responses.Choices {
@@ -469,6 +486,10 @@ func (p *AnthropicLLMConnector) GetOnFailureRetryLimit() int {
 	return p.OnFailRetries
 }
 
+func (p *AnthropicLLMConnector) GetConcurrency() int {
+	return p.Concurrency
+}
+
 func (p *AnthropicLLMConnector) GetIncrModeTryCount() int {
 	return p.IncrModeTries
 }
@@ -31,6 +31,21 @@ func (p *llmDebug) Format() string {
 	return sb.String()
 }
 
+// getEmbedChunkRanges returns rune offsets of content chunks for embedding, when prefix is added before chunking,
+// offsets are still relative to the content and the first chunk is extended to cover the prefix
+func getEmbedChunkRanges(content, prefix string, chunk, overlap int) [][2]int {
+	if len(content) < 1 {
+		return [][2]int{}
+	}
+	prefixLen := utf8.RuneCountInString(prefix)
+	ranges := utils.GetTextChunksRanges(prefixLen+utf8.RuneCountInString(content), chunk, overlap)
+	for i := range ranges {
+		ranges[i][0] = max(ranges[i][0]-prefixLen, 0)
+		ranges[i][1] = max(ranges[i][1]-prefixLen, 0)
+	}
+	return ranges
+}
+
 func getMarkdownCodeBlockType(filesToMdLangMappings utils.TextMatcher[string], fileName string) string {
 	if filesToMdLangMappings != nil {
 		if matched, values, _ := filesToMdLangMappings.TryMatch(fileName); matched {
@@ -501,3 +501,24 @@ func TestProviderMaxRequestSizeConfiguration(t *testing.T) {
 		}
 	}
 }
+
+func TestGetEmbedChunkRanges(t *testing.T) {
+	content := "0123456789abcdefghij"
+	// Prefix of 4 runes shifts chunks to the left, first chunk covers the prefix
+	ranges := getEmbedChunkRanges(content, "doc:", 10, 2)
+	chunks := utils.SplitTextToChunks("doc:"+content, 10, 2)
+	if len(ranges) != len(chunks) {
+		t.Fatalf("Expected %d ranges, got %d", len(chunks), len(ranges))
+	}
+	if ranges[0] != [2]int{0, 6} || ranges[len(ranges)-1][1] != len(content) {
+		t.Errorf("Unexpected ranges: %v", ranges)
+	}
+	for i := 1; i < len(ranges); i++ {
+		if got := content[ranges[i][0]:ranges[i][1]]; got != chunks[i] {
+			t.Errorf("Range %d mismatch: expected %q, got %q", i, chunks[i], got)
+		}
+	}
+	if ranges := getEmbedChunkRanges("", "doc:", 10, 2); len(ranges) != 0 {
+		t.Errorf("Expected no ranges for empty content, got %v", ranges)
+	}
+}
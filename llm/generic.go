@@ -9,7 +9,6 @@ import (
 	"regexp"
 	"slices"
 	"strings"
-	"time"
 
 	"github.com/DarkCaster/Perpetual/langchaingo/llms"
 	"github.com/DarkCaster/Perpetual/langchaingo/llms/openai"
@@ -47,6 +46,7 @@ type GenericLLMConnector struct {
 	MaxTokensSegments     int
 	MaxRequestSize        int
 	OnFailRetries         int
+	Concurrency           int
 	Seed                  int
 	RawMessageLogger      func(v ...any)
 	Options               []llms.CallOption
@@ -152,6 +152,17 @@ func NewGenericLLMConnectorFromEnv(
 	}
 	debug.Add("retries", onFailRetries)
 
+	concurrency, err := utils.GetEnvInt(fmt.Sprintf("%s_CONCURRENCY_OP_%s", prefix, operation), fmt.Sprintf("%s_CONCURRENCY", prefix))
+	if err != nil {
+		concurrency = 1
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency provided for %s operation must be greater than 0: %d", operation, concurrency)
+	}
+	if concurrency > 1 {
+		debug.Add("concurrency", concurrency)
+	}
+
 	baseURL, err := utils.GetEnvString(fmt.Sprintf("%s_BASE_URL", prefix))
 	if err != nil || baseURL == "" {
 		return nil, fmt.Errorf("%s_BASE_URL env var missing or empty", prefix)
@@ -463,6 +474,7 @@ func NewGenericLLMConnectorFromEnv(
 		MaxTokensSegments:     maxTokensSegments,
 		MaxRequestSize:        maxRequestSize,
 		OnFailRetries:         onFailRetries,
+		Concurrency:           concurrency,
 		Seed:                  seed,
 		RawMessageLogger:      llmRawMessageLogger,
 		Options:               extraOptions,
@@ -493,6 +505,15 @@ func (p *GenericLLMConnector) GetEmbedScoreThreshold() float32 {
 	return p.EmbedThreshold
 }
 
+func (p *GenericLLMConnector) GetEmbedChunkRanges(mode EmbedMode, content string) [][2]int {
+	switch mode {
+	case SearchEmbed:
+		return getEmbedChunkRanges(content, p.EmbedSearchPrefix, p.EmbedSearchChunk, p.EmbedSearchOverlap)
+	default:
+		return getEmbedChunkRanges(content, p.EmbedDocPrefix, p.EmbedDocChunk, p.EmbedDocOverlap)
+	}
+}
+
 func (p *GenericLLMConnector) CreateEmbeddings(mode EmbedMode, tag, content string) ([][]float32, QueryStatus, error) {
 	if len(content) < 1 {
 		//return no embeddings for empty content
@@ -561,9 +582,7 @@ func (p *GenericLLMConnector) CreateEmbeddings(mode EmbedMode, tag, content stri
 	chunks := utils.SplitTextToChunks(content, chunk, overlap)
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	if p.RawMessageLogger != nil {
 		switch mode {
@@ -779,9 +798,7 @@ func (p *GenericLLMConnector) Query(allowCaching bool, messages ...Message) (str
 	}
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	finalOptions := utils.NewSlice(p.Options...)
 	if p.Streaming {
@@ -793,6 +810,9 @@ func (p *GenericLLMConnector) Query(allowCaching bool, messages ...Message) (str
 
 	// Perform LLM query
 	response, err := model.GenerateContent(context.Background(), llmMessages, finalOptions...)
+	if err == nil && response != nil && len(response.Choices) > 0 {
+		recordTokenUsage(response.Choices[0].GenerationInfo)
+	}
 
 	// Process status codes
 	switch statusCodeCollector.StatusCode {
@@ -931,6 +951,10 @@ func (p *GenericLLMConnector) GetOnFailureRetryLimit() int {
 	return p.OnFailRetries
 }
 
+func (p *GenericLLMConnector) GetConcurrency() int {
+	return p.Concurrency
+}
+
 func (p *GenericLLMConnector) GetIncrModeTryCount() int {
 	return p.IncrModeTries
 }
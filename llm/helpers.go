@@ -12,6 +12,50 @@ import (
 var sourceFileCacheLock sync.Mutex //just in case, for possible future multi-threaded access
 var sourceFileCache map[string]string = make(map[string]string)
 
+var secretRedactorLock sync.Mutex
+var secretRedactor *utils.SecretRedactor
+
+// SetSecretRedactor sets redactor used to hide secrets in source files attached to LLM messages, nil disables redaction
+func SetSecretRedactor(redactor *utils.SecretRedactor) {
+	secretRedactorLock.Lock()
+	defer secretRedactorLock.Unlock()
+	secretRedactor = redactor
+}
+
+// InitSecretRedactor sets redactor used to hide secrets in source files attached to LLM messages, if it is not set yet.
+// Internally invoked operations keep redactor of the top-level operation with all secrets registered so far,
+// so placeholders generated by LLM can be restored after any of them
+func InitSecretRedactor(redactor *utils.SecretRedactor) {
+	secretRedactorLock.Lock()
+	defer secretRedactorLock.Unlock()
+	if secretRedactor == nil {
+		secretRedactor = redactor
+	}
+}
+
+func getSecretRedactor() *utils.SecretRedactor {
+	secretRedactorLock.Lock()
+	defer secretRedactorLock.Unlock()
+	return secretRedactor
+}
+
+// RedactSecrets replaces secrets in text with placeholders, returns redacted text and number of replaced secrets
+func RedactSecrets(text string) (string, int) {
+	return getSecretRedactor().Redact(text)
+}
+
+// RedactSecretsWithMapping replaces secrets in text with placeholders, returns redacted text and positions of replaced secrets,
+// used to map offsets in redacted text back to the original text
+func RedactSecretsWithMapping(text string) (string, []utils.RedactedSecret) {
+	return getSecretRedactor().RedactWithMapping(text)
+}
+
+// RestoreSecrets replaces placeholders in text generated by LLM with original secrets,
+// returns restored text and list of placeholders that cannot be restored
+func RestoreSecrets(text string) (string, []string) {
+	return getSecretRedactor().Restore(text)
+}
+
 func ComposeMessageWithSourceFiles(projectRootDir, prompt string, targetFiles []string, filenameTags utils.TagPair, logger logging.ILogger) Message {
 	// Create message fragment with prompt
 	result := AddPlainTextFragment(NewMessage(UserRequest), prompt)
@@ -30,6 +74,11 @@ func AppendSourceFileToMessage(message Message, projectRootDir, file string, fil
 	sourceFileCacheLock.Lock()
 	sourceFileCache[file] = text
 	sourceFileCacheLock.Unlock()
+	// Cache keeps original contents, only the text sent to LLM is redacted
+	text, redacted := RedactSecrets(text)
+	if redacted > 0 {
+		logger.Warnf("Redacted %d secret(s) in file: %s", redacted, file)
+	}
 	return AddFileFragment(message, file, text, filenameTags)
 }
 
@@ -39,10 +88,19 @@ func PrecacheSourceFile(projectRootDir, file string) {
 	if _, exist := sourceFileCache[file]; !exist {
 		if text, _, err := utils.LoadTextFile(filepath.Join(projectRootDir, file)); err == nil {
 			sourceFileCache[file] = text
+			getSecretRedactor().Register(text)
 		}
 	}
 }
 
+// RegisterSourceFileSecrets remembers secrets from the file previously sent to LLM, best effort,
+// so placeholders generated from it can be restored in the LLM output
+func RegisterSourceFileSecrets(projectRootDir, file string) {
+	if text, _, err := utils.LoadTextFile(filepath.Join(projectRootDir, file)); err == nil {
+		getSecretRedactor().Register(text)
+	}
+}
+
 func GetSourceFileFromCache(file string) (string, int, error) {
 	sourceFileCacheLock.Lock()
 	defer sourceFileCacheLock.Unlock()
@@ -52,6 +110,13 @@ func GetSourceFileFromCache(file string) (string, int, error) {
 	return "", 0, fmt.Errorf("file %s not found in cache", file)
 }
 
+// Drop all cached source files, next request will read them from disk again
+func ClearSourceFileCache() {
+	sourceFileCacheLock.Lock()
+	defer sourceFileCacheLock.Unlock()
+	sourceFileCache = make(map[string]string)
+}
+
 func ComposeMessageWithAnnotations(prompt string, targetFiles []string, filenameTags utils.TagPair, annotations map[string]string, logger logging.ILogger) Message {
 	request := AddPlainTextFragment(NewMessage(UserRequest), prompt)
 	for _, item := range targetFiles {
@@ -0,0 +1,57 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func TestAppendSourceFileToMessageRedactsSecrets(t *testing.T) {
+	logger, err := logging.NewSimpleLogger(logging.ErrorLevel)
+	if err != nil {
+		t.Fatalf("failed to create test logger: %v", err)
+	}
+	projectRootDir := t.TempDir()
+	source := "DB_PASSWORD=hunter2hunter2\n"
+	if err := os.WriteFile(filepath.Join(projectRootDir, "config.env"), []byte(source), 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+
+	SetSecretRedactor(utils.NewSecretRedactor([]*regexp.Regexp{regexp.MustCompile(`PASSWORD=(\S+)`)}, 0, 32))
+	defer SetSecretRedactor(nil)
+	defer ClearSourceFileCache()
+
+	message := AppendSourceFileToMessage(NewMessage(UserRequest), projectRootDir, "config.env", utils.TagPair{}, logger)
+	if len(message.Fragments) != 1 || strings.Contains(message.Fragments[0].Contents, "hunter2hunter2") {
+		t.Fatalf("secret is sent to LLM: %+v", message.Fragments)
+	}
+
+	// Cached contents are used for stash backups, so they must not be redacted
+	if cached, _, err := GetSourceFileFromCache("config.env"); err != nil || cached != source {
+		t.Errorf("GetSourceFileFromCache() = %q, %v", cached, err)
+	}
+
+	if restored, unknown := RestoreSecrets(message.Fragments[0].Contents); restored != source || len(unknown) != 0 {
+		t.Errorf("RestoreSecrets() = %q, unknown %v", restored, unknown)
+	}
+}
+
+func TestInitSecretRedactorKeepsExistingSecrets(t *testing.T) {
+	defer SetSecretRedactor(nil)
+	InitSecretRedactor(utils.NewSecretRedactor([]*regexp.Regexp{regexp.MustCompile(`PASSWORD=(\S+)`)}, 0, 32))
+	redacted, count := RedactSecrets("DB_PASSWORD=hunter2hunter2")
+	if count != 1 {
+		t.Fatalf("secret is not redacted: %q", redacted)
+	}
+
+	// Internally invoked operation must not replace redactor with registered secrets
+	InitSecretRedactor(utils.NewSecretRedactor(nil, 0, 32))
+	if restored, unknown := RestoreSecrets(redacted); restored != "DB_PASSWORD=hunter2hunter2" || len(unknown) != 0 {
+		t.Errorf("RestoreSecrets() = %q, unknown %v", restored, unknown)
+	}
+}
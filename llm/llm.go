@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/DarkCaster/Perpetual/utils"
 )
@@ -49,6 +50,8 @@ type LLMConnector interface {
 	// Generate embeddings
 	CreateEmbeddings(mode EmbedMode, tag, content string) ([][]float32, QueryStatus, error)
 	GetEmbedScoreThreshold() float32
+	// Rune offsets of content chunks, one per vector returned by CreateEmbeddings for the same content
+	GetEmbedChunkRanges(mode EmbedMode, content string) [][2]int
 	// Generate text messages
 	Query(allowCaching bool, messages ...Message) (string, QueryStatus, error)
 	GetMinPrefixRepsForCaching() int
@@ -56,6 +59,8 @@ type LLMConnector interface {
 	// When response bumps max token limit, try to continue generating next segment, until reaching this limit
 	GetMaxTokensSegments() int
 	GetOnFailureRetryLimit() int
+	// Max number of requests that operation may run in parallel with this connector
+	GetConcurrency() int
 	GetDebugString() string
 	GetPerfString() string
 	GetIncrModeTryCount() int // 0 - do not use increment mode at all
@@ -137,6 +142,11 @@ func NewLLMConnector(
 			systemPromptAck,
 			filesToMdLangMappings,
 			llmRawMessageLogger)
+	case "LOCAL":
+		return NewLocalLLMConnectorFromEnv(
+			subProfile,
+			operation,
+			llmRawMessageLogger)
 	default:
 		return nil, fmt.Errorf("unsupported LLM provider: %s", provider)
 	}
@@ -153,7 +163,49 @@ func GetSimpleRawMessageLogger(perpetualDir string) func(v ...any) {
 	return logFunc
 }
 
+// GetBufferedRawMessageLogger returns message logger that collects messages in memory,
+// until flush is called, so messages of requests running concurrently do not interleave in the log file
+func GetBufferedRawMessageLogger(perpetualDir string) (func(v ...any), func()) {
+	var lock sync.Mutex
+	var buffer strings.Builder
+	logFunc := func(v ...any) {
+		if len(v) < 1 {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		buffer.WriteString(fmt.Sprintf(v[0].(string), v[1:]...))
+	}
+	flushFunc := func() {
+		lock.Lock()
+		defer lock.Unlock()
+		if buffer.Len() > 0 {
+			utils.AppendToTextFile(filepath.Join(perpetualDir, LLMRawLogFile), buffer.String())
+			buffer.Reset()
+		}
+	}
+	return logFunc, flushFunc
+}
+
+// RotateLLMRawLogFile rotates log file when operation starts. Log is appended by every running operation,
+// so it is not rotated if other operation is still running, new messages are appended to the current log instead
 func RotateLLMRawLogFile(perpetualDir string) error {
+	unlock, err := utils.TryLockProjectResource(perpetualDir, utils.LockResourceMessageLog, true)
+	if errors.Is(err, utils.ErrLockBusy) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	logFilePath := filepath.Join(perpetualDir, LLMRawLogFile)
-	return utils.RotateFiles(logFilePath, LLMRawLogFileRotationCount)
+	err = utils.RotateFiles(logFilePath, LLMRawLogFileRotationCount)
+	unlock()
+	if err != nil {
+		return err
+	}
+	// Shared lock is held until operation completes, so other operations will not rotate the log in the meantime
+	if _, err := utils.TryLockProjectResource(perpetualDir, utils.LockResourceMessageLog, false); err != nil && !errors.Is(err, utils.ErrLockBusy) {
+		return err
+	}
+	return nil
 }
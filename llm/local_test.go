@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"testing"
+)
+
+func localCosine(x, y []float32) float32 {
+	var dot float32
+	for i := range x {
+		dot += x[i] * y[i]
+	}
+	return dot
+}
+
+func TestNewLocalLLMConnector(t *testing.T) {
+	t.Setenv("LLM_PROVIDER_OP_EMBED", "local")
+	t.Setenv("LLM_PROVIDER", "local")
+	t.Setenv("LOCAL_EMBED_DIMENSIONS", "256")
+
+	connector, err := NewLLMConnector("embed", "", "", nil, func(v ...any) {})
+	if err != nil {
+		t.Fatalf("NewLLMConnector() error = %v", err)
+	}
+	if local, ok := connector.(*LocalLLMConnector); !ok || local.Dimensions != 256 {
+		t.Errorf("unexpected connector: %#v", connector)
+	}
+	if _, err := NewLLMConnector("explain_stage1", "system", "ack", nil, func(v ...any) {}); err == nil {
+		t.Errorf("local provider must not be available for text generation")
+	}
+
+	t.Setenv("LOCAL_EMBED_DOC_CHUNK_OVERLAP", "2048")
+	if _, err := NewLLMConnector("embed", "", "", nil, func(v ...any) {}); err == nil {
+		t.Errorf("expected error for chunk overlap larger than chunk size")
+	}
+}
+
+func TestLocalEmbeddings(t *testing.T) {
+	connector := &LocalLLMConnector{Dimensions: 512, EmbedDocChunk: 1024, EmbedDocOverlap: 64, EmbedSearchChunk: 4096, EmbedSearchOverlap: 128}
+	documents := []string{
+		"func LoadProjectConfig(perpetualDir string) Config { /* loads project configuration from json file */ }",
+		"func RotateLogFile(path string) error { /* rotates raw message log files */ }",
+		"SELECT name, price FROM products WHERE price > 100 ORDER BY name",
+	}
+	var vectors [][]float32
+	for _, document := range documents {
+		result, status, err := connector.CreateEmbeddings(DocEmbed, "doc", document)
+		if err != nil || status != QueryOk || len(result) != 1 || len(result[0]) != 512 {
+			t.Fatalf("CreateEmbeddings() = %v, %v, %v", len(result), status, err)
+		}
+		vectors = append(vectors, result[0])
+	}
+	query, _, _ := connector.CreateEmbeddings(SearchEmbed, "query", "where is project config loaded?")
+	if len(query) != 1 {
+		t.Fatalf("unexpected query vector count: %d", len(query))
+	}
+	best := 0
+	for i := range vectors {
+		if localCosine(query[0], vectors[i]) > localCosine(query[0], vectors[best]) {
+			best = i
+		}
+	}
+	if best != 0 {
+		t.Errorf("unexpected best match: %d", best)
+	}
+	if score := localCosine(vectors[0], vectors[0]); score < 0.999 || score > 1.001 {
+		t.Errorf("vector is not normalized: %f", score)
+	}
+	// Vectors are deterministic
+	again, _, _ := connector.CreateEmbeddings(DocEmbed, "doc", documents[0])
+	if localCosine(again[0], vectors[0]) < 0.999 {
+		t.Errorf("embeddings are not deterministic")
+	}
+	if empty, status, err := connector.CreateEmbeddings(DocEmbed, "empty", ""); len(empty) != 0 || status != QueryOk || err != nil {
+		t.Errorf("unexpected result for empty content: %v, %v, %v", empty, status, err)
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"math"
 	"regexp"
 	"strings"
-	"time"
 	"unicode/utf8"
 
 	"github.com/DarkCaster/Perpetual/langchaingo/llms"
@@ -48,6 +47,7 @@ type OllamaLLMConnector struct {
 	MaxTokensSegments     int
 	MaxRequestSize        int
 	OnFailRetries         int
+	Concurrency           int
 	Seed                  int
 	RawMessageLogger      func(v ...any)
 	Options               []llms.CallOption
@@ -145,6 +145,17 @@ func NewOllamaLLMConnectorFromEnv(
 	}
 	debug.Add("retries", onFailRetries)
 
+	concurrency, err := utils.GetEnvInt(fmt.Sprintf("%s_CONCURRENCY_OP_%s", prefix, operation), fmt.Sprintf("%s_CONCURRENCY", prefix))
+	if err != nil {
+		concurrency = 1
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency provided for %s operation must be greater than 0: %d", operation, concurrency)
+	}
+	if concurrency > 1 {
+		debug.Add("concurrency", concurrency)
+	}
+
 	customBaseURL, err := utils.GetEnvString(fmt.Sprintf("%s_BASE_URL", prefix))
 	if err == nil && customBaseURL != "" {
 		debug.Add("base url", customBaseURL)
@@ -457,6 +468,7 @@ func NewOllamaLLMConnectorFromEnv(
 		MaxTokens:             maxTokens,
 		MaxRequestSize:        maxRequestSize,
 		OnFailRetries:         onFailRetries,
+		Concurrency:           concurrency,
 		Seed:                  seed,
 		RawMessageLogger:      llmRawMessageLogger,
 		Options:               extraOptions,
@@ -483,6 +495,15 @@ func (p *OllamaLLMConnector) GetEmbedScoreThreshold() float32 {
 	return p.EmbedThreshold
 }
 
+func (p *OllamaLLMConnector) GetEmbedChunkRanges(mode EmbedMode, content string) [][2]int {
+	switch mode {
+	case SearchEmbed:
+		return getEmbedChunkRanges(content, p.EmbedSearchPrefix, p.EmbedSearchChunk, p.EmbedSearchOverlap)
+	default:
+		return getEmbedChunkRanges(content, p.EmbedDocPrefix, p.EmbedDocChunk, p.EmbedDocOverlap)
+	}
+}
+
 func (p *OllamaLLMConnector) CreateEmbeddings(mode EmbedMode, tag string, content string) ([][]float32, QueryStatus, error) {
 	if len(content) < 1 {
 		//return no embeddings for empty content
@@ -536,9 +557,7 @@ func (p *OllamaLLMConnector) CreateEmbeddings(mode EmbedMode, tag string, conten
 	chunks := utils.SplitTextToChunks(content, chunk, overlap)
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	if p.RawMessageLogger != nil {
 		switch mode {
@@ -766,9 +785,7 @@ func (p *OllamaLLMConnector) Query(allowCaching bool, messages ...Message) (stri
 	var perfLineBuilder strings.Builder
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	finalOptions := utils.NewSlice(p.Options...)
 
@@ -786,6 +803,9 @@ func (p *OllamaLLMConnector) Query(allowCaching bool, messages ...Message) (stri
 		llmMessages,
 		finalOptions...,
 	)
+	if err == nil && response != nil && len(response.Choices) > 0 {
+		recordTokenUsage(response.Choices[0].GenerationInfo)
+	}
 
 	// Process status codes, probably not applicable for private ollama instances
 	// but still may be used with public instances wrapped with https reverse-proxy
@@ -970,6 +990,10 @@ func (p *OllamaLLMConnector) GetOnFailureRetryLimit() int {
 	return p.OnFailRetries
 }
 
+func (p *OllamaLLMConnector) GetConcurrency() int {
+	return p.Concurrency
+}
+
 func (p *OllamaLLMConnector) GetIncrModeTryCount() int {
 	return p.IncrModeTries
 }
@@ -38,6 +38,7 @@ type OpenAILLMConnector struct {
 	MaxTokensSegments            int
 	MaxRequestSize               int
 	OnFailRetries                int
+	Concurrency                  int
 	RawMessageLogger             func(v ...any)
 	Options                      []llms.CallOption
 	FieldsToRemove               []string
@@ -123,6 +124,17 @@ func NewOpenAILLMConnectorFromEnv(
 	}
 	debug.Add("retries", onFailRetries)
 
+	concurrency, err := utils.GetEnvInt(fmt.Sprintf("%s_CONCURRENCY_OP_%s", prefix, operation), fmt.Sprintf("%s_CONCURRENCY", prefix))
+	if err != nil {
+		concurrency = 1
+	}
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency provided for %s operation must be greater than 0: %d", operation, concurrency)
+	}
+	if concurrency > 1 {
+		debug.Add("concurrency", concurrency)
+	}
+
 	customBaseURL, err := utils.GetEnvString(fmt.Sprintf("%s_BASE_URL", prefix))
 	if err == nil && customBaseURL != "" {
 		debug.Add("base url", customBaseURL)
@@ -302,6 +314,7 @@ func NewOpenAILLMConnectorFromEnv(
 		MaxTokensSegments:            maxTokensSegments,
 		MaxRequestSize:               maxRequestSize,
 		OnFailRetries:                onFailRetries,
+		Concurrency:                  concurrency,
 		RawMessageLogger:             llmRawMessageLogger,
 		Options:                      extraOptions,
 		FieldsToRemove:               fieldsToRemove,
@@ -335,6 +348,15 @@ func (p *OpenAILLMConnector) GetEmbedScoreThreshold() float32 {
 	return p.EmbedThreshold
 }
 
+func (p *OpenAILLMConnector) GetEmbedChunkRanges(mode EmbedMode, content string) [][2]int {
+	switch mode {
+	case SearchEmbed:
+		return getEmbedChunkRanges(content, "", p.EmbedSearchChunk, p.EmbedSearchOverlap)
+	default:
+		return getEmbedChunkRanges(content, "", p.EmbedDocChunk, p.EmbedDocOverlap)
+	}
+}
+
 func (p *OpenAILLMConnector) CreateEmbeddings(mode EmbedMode, tag, content string) ([][]float32, QueryStatus, error) {
 	if len(content) < 1 {
 		//return no embeddings for empty content
@@ -389,9 +411,7 @@ func (p *OpenAILLMConnector) CreateEmbeddings(mode EmbedMode, tag, content strin
 	chunks := utils.SplitTextToChunks(content, chunk, overlap)
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	if p.RawMessageLogger != nil {
 		p.RawMessageLogger("OpenAI: creating embeddings for %s, chunk/vector count: %d", tag, len(chunks))
@@ -671,15 +691,16 @@ func (p *OpenAILLMConnector) Query(allowCaching bool, messages ...Message) (stri
 	}
 
 	//make a pause, if we need to wait to recover from previous error
-	if p.RateLimitDelayS > 0 {
-		time.Sleep(time.Duration(p.RateLimitDelayS) * time.Second)
-	}
+	waitForRateLimit(p.RateLimitDelayS)
 
 	response, err := model.GenerateContent(
 		context.Background(),
 		llmMessages,
 		finalOptions...,
 	)
+	if err == nil && response != nil && len(response.Choices) > 0 {
+		recordTokenUsage(response.Choices[0].GenerationInfo)
+	}
 
 	// Process status codes for rate limiting
 	switch statusCodeCollector.StatusCode {
@@ -791,6 +812,10 @@ func (p *OpenAILLMConnector) GetOnFailureRetryLimit() int {
 	return p.OnFailRetries
 }
 
+func (p *OpenAILLMConnector) GetConcurrency() int {
+	return p.Concurrency
+}
+
 func (p *OpenAILLMConnector) GetIncrModeTryCount() int {
 	return p.IncrModeTries
 }
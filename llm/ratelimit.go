@@ -0,0 +1,35 @@
+package llm
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimitGate delays requests of all connectors running concurrently (for example, by annotation workers),
+// so when one of the requests hits provider's rate limit, other requests are also paused and do not make it worse
+type rateLimitGate struct {
+	lock     sync.Mutex
+	deadline time.Time
+}
+
+var globalRateLimitGate rateLimitGate
+
+// getWaitTime extends the pause until now+delayS (if delay is requested), returns time left until the end of the pause
+func (g *rateLimitGate) getWaitTime(delayS int, now time.Time) time.Duration {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if delayS > 0 {
+		if deadline := now.Add(time.Duration(delayS) * time.Second); deadline.After(g.deadline) {
+			g.deadline = deadline
+		}
+	}
+	return g.deadline.Sub(now)
+}
+
+// waitForRateLimit makes a pause before sending request if we need to wait to recover from previous error,
+// requested by this or any other connector
+func waitForRateLimit(delayS int) {
+	if waitTime := globalRateLimitGate.getWaitTime(delayS, time.Now()); waitTime > 0 {
+		time.Sleep(waitTime)
+	}
+}
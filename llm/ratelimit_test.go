@@ -0,0 +1,27 @@
+package llm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimitGate(t *testing.T) {
+	var gate rateLimitGate
+	now := time.Now()
+	if wait := gate.getWaitTime(0, now); wait > 0 {
+		t.Errorf("unexpected wait without rate limit: %v", wait)
+	}
+	if wait := gate.getWaitTime(10, now); wait != 10*time.Second {
+		t.Errorf("getWaitTime(10) = %v", wait)
+	}
+	// Other requests wait until the end of the pause, shorter delay does not reduce it
+	if wait := gate.getWaitTime(0, now.Add(4*time.Second)); wait != 6*time.Second {
+		t.Errorf("getWaitTime(0) = %v", wait)
+	}
+	if wait := gate.getWaitTime(2, now.Add(5*time.Second)); wait != 5*time.Second {
+		t.Errorf("getWaitTime(2) = %v", wait)
+	}
+	if wait := gate.getWaitTime(0, now.Add(11*time.Second)); wait > 0 {
+		t.Errorf("unexpected wait after the pause: %v", wait)
+	}
+}
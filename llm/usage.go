@@ -0,0 +1,61 @@
+package llm
+
+import "sync"
+
+// TokenUsage holds number of tokens used by LLM queries
+type TokenUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+func (u TokenUsage) Add(other TokenUsage) TokenUsage {
+	return TokenUsage{
+		InputTokens:  u.InputTokens + other.InputTokens,
+		OutputTokens: u.OutputTokens + other.OutputTokens,
+	}
+}
+
+var tokenUsage TokenUsage
+var tokenUsageLock sync.Mutex //just in case, for possible future multi-threaded access
+
+func getGenerationInfoInt(generationInfo map[string]any, keys ...string) int {
+	for _, key := range keys {
+		switch value := generationInfo[key].(type) {
+		case int:
+			return value
+		case int32:
+			return int(value)
+		case int64:
+			return int(value)
+		case float64:
+			return int(value)
+		}
+	}
+	return 0
+}
+
+// recordTokenUsage adds token counts reported by the provider for the LLM query to the total usage,
+// generation-info fields are named differently for different providers
+func recordTokenUsage(generationInfo map[string]any) {
+	if generationInfo == nil {
+		return
+	}
+	tokenUsageLock.Lock()
+	defer tokenUsageLock.Unlock()
+	tokenUsage.InputTokens += getGenerationInfoInt(generationInfo, "InputTokens", "PromptTokens")
+	tokenUsage.OutputTokens += getGenerationInfoInt(generationInfo, "OutputTokens", "CompletionTokens")
+}
+
+// GetTokenUsage returns total number of tokens used by LLM queries since start or last reset
+func GetTokenUsage() TokenUsage {
+	tokenUsageLock.Lock()
+	defer tokenUsageLock.Unlock()
+	return tokenUsage
+}
+
+// ResetTokenUsage resets total number of tokens used by LLM queries
+func ResetTokenUsage() {
+	tokenUsageLock.Lock()
+	tokenUsage = TokenUsage{}
+	tokenUsageLock.Unlock()
+}
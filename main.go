@@ -18,6 +18,7 @@ import (
 	"github.com/DarkCaster/Perpetual/op_onboard"
 	"github.com/DarkCaster/Perpetual/op_project"
 	"github.com/DarkCaster/Perpetual/op_report"
+	"github.com/DarkCaster/Perpetual/op_snapshot"
 	"github.com/DarkCaster/Perpetual/op_stash"
 	"github.com/DarkCaster/Perpetual/usage"
 	"github.com/DarkCaster/Perpetual/utils"
@@ -31,6 +32,7 @@ func getOperations() map[string]string {
 		op_embed.OpName:     op_embed.OpDesc,
 		op_implement.OpName: op_implement.OpDesc,
 		op_stash.OpName:     op_stash.OpDesc,
+		op_snapshot.OpName:  op_snapshot.OpDesc,
 		op_report.OpName:    op_report.OpDesc,
 		op_doc.OpName:       op_doc.OpDesc,
 		op_explain.OpName:   op_explain.OpDesc,
@@ -85,9 +87,11 @@ func main() {
 	case op_embed.OpName:
 		op_embed.Run(args, false, stdErrLogger)
 	case op_implement.OpName:
-		op_implement.Run(args, stdErrLogger)
+		op_implement.Run(Version, args, stdErrLogger)
 	case op_stash.OpName:
 		op_stash.Run(args, false, stdErrLogger)
+	case op_snapshot.OpName:
+		op_snapshot.Run(Version, args, stdErrLogger)
 	case op_report.OpName:
 		op_report.Run(args, stdErrLogger)
 	case op_explain.OpName:
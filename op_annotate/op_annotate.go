@@ -3,11 +3,14 @@ package op_annotate
 import (
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/DarkCaster/Perpetual/config"
 	"github.com/DarkCaster/Perpetual/llm"
@@ -20,24 +23,34 @@ import (
 const OpName = "annotate"
 const OpDesc = "Generate annotations for project files"
 
+// Overlap between fragments of large file that cannot be split at syntactic boundaries, as a fraction of fragment size
+const annotationChunkOverlapDivider = 20
+
+// Files are not split into fragments smaller than this size (in characters), when LLM request size limit is reached
+const annotationMinChunkSize = 1000
+
 func annotateFlags() *flag.FlagSet {
 	return flag.NewFlagSet(OpName, flag.ExitOnError)
 }
 
 func Run(args []string, innerCall bool, logger logging.ILogger) {
 	// Setup
-	var help, verbose, trace bool
+	var help, verbose, trace, reannotate bool
+	var jobs int
 	var descFile, inputFile, userFilterFile, contextSaving, mode string
 
 	flags := annotateFlags()
 	flags.StringVar(&contextSaving, "c", "auto", "Context saving mode, reduce LLM context use for large projects (valid values: auto|off|medium|high)")
 	flags.StringVar(&descFile, "df", "", "Optional path to project description file for adding into LLM context (valid values: file-path|disabled)")
 	flags.BoolVar(&help, "h", false, "This help message")
+	flags.IntVar(&jobs, "j", 0, "Number of files to annotate concurrently (default: use LLM provider's concurrency setting, 1 if not set)")
 	flags.StringVar(&inputFile, "i", "", "Forcefully (re)annotate a single file (after whitelist/blacklist and user-filter processing)")
-	flags.StringVar(&mode, "m", "", "Select operation mode (valid values: normal|dryrun|full).\n"+
+	flags.StringVar(&mode, "m", "", "Select operation mode (valid values: normal|dryrun|full|audit).\n"+
 		"normal: reannotate only changed files.\n"+
 		"dryrun: do not generate annotations, just list files that would be annotated.\n"+
-		"full:   reannotate all files, even those with up-to-date annotations.")
+		"full:   reannotate all files, even those with up-to-date annotations.\n"+
+		"audit:  check existing annotations with quality rules and list suspicious ones.")
+	flags.BoolVar(&reannotate, "r", false, "Reannotate files with suspicious annotations found in audit mode")
 	flags.StringVar(&userFilterFile, "x", "", "Path to user-supplied regex filter-file for filtering out certain files from processing")
 	flags.BoolVar(&verbose, "v", false, "Enable debug logging")
 	flags.BoolVar(&trace, "vv", false, "Enable debug and trace logging")
@@ -45,16 +58,25 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 
 	mode = strings.ToUpper(mode)
 	if mode == "" {
-		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: normal|dryrun|full)", flags)
+		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: normal|dryrun|full|audit)", flags)
 	}
 
-	if mode != "NORMAL" && mode != "DRYRUN" && mode != "FULL" {
+	if mode != "NORMAL" && mode != "DRYRUN" && mode != "FULL" && mode != "AUDIT" {
 		logger.Errorln("Invalid mode:", mode)
-		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: normal|dryrun|full)", flags)
+		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: normal|dryrun|full|audit)", flags)
+	}
+
+	if jobs < 0 {
+		usage.PrintOperationUsage("Number of concurrent jobs provided with the '-j' flag must not be negative", flags)
+	}
+
+	if reannotate && mode != "AUDIT" {
+		usage.PrintOperationUsage("The '-r' flag can only be used in audit mode", flags)
 	}
 
 	dryRun := mode == "DRYRUN"
 	force := mode == "FULL"
+	audit := mode == "AUDIT"
 
 	if verbose {
 		logger.EnableLevel(logging.DebugLevel)
@@ -100,7 +122,10 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	}
 
 	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	// Hide secrets in file contents sent to LLM
+	llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 	annotateConfig := config.LoadOpAnnotateConfig(perpetualDir, logger)
+	validator := newAnnotationValidator(annotateConfig)
 
 	// Load project description
 	projectDesc := ""
@@ -172,9 +197,34 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		logger.Panicln("Error getting project-files checksums:", err)
 	}
 
+	// Annotations are updated by this operation, other operations must not read or write them until it completes
+	unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, true, logger)
+	defer unlockAnnotations()
+
 	annotationsFilePath := filepath.Join(perpetualDir, utils.AnnotationsFileName)
 	var filesToAnnotate []string
-	if inputFile != "" {
+	if audit {
+		// Check existing annotations of files not filtered out by user-blacklist
+		auditFiles, _ := utils.FilterFilesWithBlacklist(fileNames, userBlacklist)
+		annotations, err := utils.GetAnnotations(annotationsFilePath, auditFiles)
+		if err != nil {
+			logger.Panicln("Failed to read annotations:", err)
+		}
+		logger.Infoln("Auditing annotations, count:", len(annotations))
+		problems := auditAnnotations(projectRootDir, auditFiles, annotations, validator, contextSavingMode == 0, logger)
+		logger.Infoln("Suspicious annotations:", len(problems))
+		for _, file := range auditFiles {
+			for _, problem := range problems[file] {
+				fmt.Printf("%s: %s\n", file, problem)
+			}
+			if len(problems[file]) > 0 {
+				filesToAnnotate = append(filesToAnnotate, file)
+			}
+		}
+		if !reannotate {
+			return
+		}
+	} else if inputFile != "" {
 		// Check if requested file is within fileNames array
 		requestedFile, err := utils.MakePathRelative(projectRootDir, inputFile, false)
 		if err != nil {
@@ -207,6 +257,15 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		logger.Debugln("Filtered-out:", file)
 	}
 
+	// Only suspicious files are reannotated in audit mode, other changed files must be reannotated next time
+	if audit {
+		for _, file := range fileNames {
+			if !slices.Contains(filesToAnnotate, file) {
+				fileChecksums[file] = oldChecksums[file]
+			}
+		}
+	}
+
 	if dryRun {
 		logger.Infoln("Files to annotate:")
 		for _, file := range filesToAnnotate {
@@ -291,137 +350,421 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		fileGroups = utils.NewSlice(filesToAnnotate)
 	}
 
+	// Get annotations for files listed in fileChecksums
+	annotations, err := utils.GetAnnotations(annotationsFilePath, fileNames)
+	if err != nil {
+		logger.Panicln("Failed to read old annotations:", err)
+	}
+
+	// Progress is saved while annotating, files not annotated yet keep old checksums, so they are reannotated next time
+	savedChecksums := maps.Clone(fileChecksums)
+	for _, filePath := range filesToAnnotate {
+		savedChecksums[filePath] = oldChecksums[filePath]
+	}
+	saver := newAnnotationsSaver(annotationsFilePath, savedChecksums, annotations, annotationsSaveInterval)
+
+	// Create LLM connectors for concurrent workers, every worker logs its messages separately
+	concurrency := jobs
+	if concurrency < 1 {
+		concurrency = connector.GetConcurrency()
+	}
+	concurrency = max(concurrency, 1)
+	connectors := []llm.LLMConnector{connector}
+	rawMessageLoggers := []func(v ...any){llm.GetSimpleRawMessageLogger(perpetualDir)}
+	rawMessageFlushers := []func(){func() {}}
+	if concurrency > 1 {
+		logger.Infoln("Concurrent annotation workers:", concurrency)
+		connectors = nil
+		rawMessageLoggers = nil
+		rawMessageFlushers = nil
+		for range concurrency {
+			rawMessageLogger, rawMessageFlusher := llm.GetBufferedRawMessageLogger(perpetualDir)
+			workerConnector, err := llm.NewLLMConnector(OpName,
+				annotateConfig.String(config.K_SystemPrompt),
+				annotateConfig.String(config.K_SystemPromptAck),
+				projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+				rawMessageLogger)
+			if err != nil {
+				logger.Panicln("Failed to create LLM connector:", err)
+			}
+			connectors = append(connectors, workerConnector)
+			rawMessageLoggers = append(rawMessageLoggers, rawMessageLogger)
+			rawMessageFlushers = append(rawMessageFlushers, rawMessageFlusher)
+		}
+	}
+
+	// Build message chain with project description if available
+	newMessages := func() []llm.Message {
+		var messages []llm.Message
+		if projectDesc != "" {
+			projectDescPrompt := llm.AddPlainTextFragment(
+				llm.NewMessage(llm.UserRequest),
+				projectConfig.String(config.K_ProjectDescriptionPrompt))
+			projectDescPrompt = llm.AddPlainTextFragment(projectDescPrompt, projectDesc)
+			projectDescResponse := llm.AddPlainTextFragment(
+				llm.NewMessage(llm.SimulatedAIResponse),
+				projectConfig.String(config.K_ProjectDescriptionResponse))
+			messages = append(messages, projectDescPrompt, projectDescResponse)
+		}
+		return messages
+	}
+
+	// Query annotation for file or directory with retries
+	// Annotation that fails quality checks is regenerated, last one is accepted when out of retries
+	queryAnnotation := func(worker int, job annotationJob, messages []llm.Message, validate func(annotation string) []string) annotationResult {
+		workerConnector := connectors[worker]
+		result := annotationResult{filePath: job.filePath}
+		var problems []string
+		rawMessageLoggers[worker](fmt.Sprintf("=== Annotate: %s\n\n\n", job.filePath))
+		onFailRetriesLeft := max(workerConnector.GetOnFailureRetryLimit(), 1)
+		for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
+			logger.Infof("%d: %s", job.index+1, job.filePath)
+			// Perform actual query, caching may be beneficial if annotating more than 1 file
+			annotationResponse, status, err := workerConnector.Query(job.allowCaching, messages...)
+			if perfString := workerConnector.GetPerfString(); perfString != "" {
+				logger.Traceln(perfString)
+			}
+			// Request-size violations are configuration or input errors and
+			// cannot be resolved by retrying the same request.
+			if status == llm.QueryRequestTooLarge {
+				result.failed = true
+				result.tooLarge = true
+				result.fatalErr = fmt.Errorf("LLM request size limit reached while annotating %s: %v", job.filePath, err)
+				return result
+			}
+			// Check for general error on query
+			if err != nil {
+				logger.Errorf("LLM query failed with status %d, error: %s", status, err)
+				if onFailRetriesLeft < 1 && result.annotation == "" {
+					result.failed = true
+				}
+				continue
+			}
+			// Check for hitting token limit - there are no responses below token limit, we will try to regenerate from scratch if possible
+			if status == llm.QueryMaxTokens {
+				logger.Errorln("LLM response reached max tokens, consider increasing the limit")
+				//TODO: find out do we have seed parameter set, because regenerating with same seed will fail again, so if true -> make onFailRetriesLeft = 0
+				if onFailRetriesLeft < 1 && result.annotation == "" {
+					result.failed = true
+				}
+				continue
+			}
+			// Some final filtering and preparations of produced annotation response
+			finalResponse := utils.FilterAndTrimResponse(annotationResponse, projectConfig.RegexpArray(config.K_ProjectCodeTagsRx), logger)
+			// Stop there if no responses available for further processing
+			if len(finalResponse) < 1 {
+				logger.Errorln("No LLM response available")
+				if onFailRetriesLeft < 1 && result.annotation == "" {
+					result.failed = true
+				}
+				continue
+			}
+
+			result.annotation = finalResponse
+			if problems = validate(finalResponse); len(problems) > 0 {
+				for _, problem := range problems {
+					logger.Warnf("%s: %s", job.filePath, problem)
+				}
+				continue
+			}
+			break
+		}
+		if result.annotation != "" && len(problems) > 0 {
+			logger.Warnln("Accepting annotation that failed quality checks:", job.filePath)
+		}
+		return result
+	}
+
+	// Summarize every fragment of a large file, then merge fragment summaries into annotation of the whole file
+	annotateChunkedFile := func(worker int, job annotationJob, annotatePrompt, fileContents string, chunkSize int) annotationResult {
+		filenameTags := projectConfig.Tags(config.K_ProjectFilenameTags)
+		var splitRx *regexp.Regexp
+		if matched, values, _ := annotateConfig.TextMatcherString(config.K_AnnotateChunkSplitRx).TryMatch(job.filePath); matched && values[0] != "" {
+			splitRx = regexp.MustCompile(values[0])
+		}
+		chunks := utils.SplitTextAtBoundaries(fileContents, splitRx, chunkSize, chunkSize/annotationChunkOverlapDivider)
+		logger.Infof("%d: %s: file is too large, annotating %d fragments", job.index+1, job.filePath, len(chunks))
+
+		var summaries []string
+		chunkJob := job
+		chunkJob.allowCaching = job.allowCaching || len(chunks) >= connectors[worker].GetMinPrefixRepsForCaching()
+		for i, chunk := range chunks {
+			chunkJob.filePath = fmt.Sprintf("%s (fragment %d/%d)", job.filePath, i+1, len(chunks))
+			messages := newMessages()
+			chunkRequest := llm.AddPlainTextFragment(
+				llm.NewMessage(llm.UserRequest),
+				annotateConfig.String(config.K_AnnotateChunkPrompt))
+			chunkSimulatedResponse := llm.AddPlainTextFragment(
+				llm.NewMessage(llm.SimulatedAIResponse),
+				annotateConfig.String(config.K_AnnotateChunkResponse))
+			chunkSimulatedResponse.CacheBreakpoint = true
+			chunkContentsRequest := llm.AddFileFragment(llm.NewMessage(llm.UserRequest), job.filePath, chunk, filenameTags)
+			messages = append(messages, chunkRequest, chunkSimulatedResponse, chunkContentsRequest)
+			chunkResult := queryAnnotation(worker, chunkJob, messages, func(annotation string) []string {
+				return validator.validate(job.filePath, "", annotation, false)
+			})
+			if chunkResult.failed || chunkResult.fatalErr != nil || chunkResult.annotation == "" {
+				return annotationResult{filePath: job.filePath, failed: true, fatalErr: chunkResult.fatalErr, tooLarge: chunkResult.tooLarge}
+			}
+			summaries = append(summaries, chunkResult.annotation)
+		}
+
+		messages := newMessages()
+		mergeRequest := llm.AddPlainTextFragment(
+			llm.NewMessage(llm.UserRequest),
+			annotateConfig.String(config.K_AnnotateMergePrompt))
+		mergeRequest = llm.AddPlainTextFragment(mergeRequest, annotatePrompt)
+		mergeSimulatedResponse := llm.AddPlainTextFragment(
+			llm.NewMessage(llm.SimulatedAIResponse),
+			annotateConfig.String(config.K_AnnotateMergeResponse))
+		mergeSimulatedResponse.CacheBreakpoint = true
+		summariesRequest := llm.AddIndexFragment(llm.NewMessage(llm.UserRequest), job.filePath, filenameTags)
+		for _, summary := range summaries {
+			summariesRequest = llm.AddPlainTextFragment(summariesRequest, summary)
+		}
+		messages = append(messages, mergeRequest, mergeSimulatedResponse, summariesRequest)
+		return queryAnnotation(worker, job, messages, func(annotation string) []string {
+			return validator.validate(job.filePath, fileContents, annotation, contextSavingMode == 0)
+		})
+	}
+
+	annotateFile := func(worker int, job annotationJob) annotationResult {
+		defer rawMessageFlushers[worker]()
+		filePath := job.filePath
+		result := annotationResult{filePath: filePath}
+
+		// Detect actual prompt for annotating this particular file
+		annotatePrompt := ""
+		if matched, values, _ := annotateConfig.TextMatcherString(config.K_AnnotateFilePrompts).TryMatch(filePath); matched {
+			annotatePrompt = values[contextSavingMode]
+		} else {
+			logger.Errorln("Failed to detect annotation prompt for file:", filePath)
+			return result
+		}
+
+		// Read file contents and generate annotation
+		fileBytes, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, filePath))
+		if err != nil {
+			logger.Errorf("Failed to read file %s: %s", filePath, err)
+			return result
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", filePath, wrn)
+		}
+		fileContents, redacted := llm.RedactSecrets(string(fileBytes))
+		if redacted > 0 {
+			logger.Warnf("Redacted %d secret(s) in file: %s", redacted, filePath)
+		}
+
+		// Files larger than chunk size are summarized by fragments
+		fileLength := utf8.RuneCountInString(fileContents)
+		chunkSize := fileLength
+		if matched, values, _ := annotateConfig.TextMatcherInteger(config.K_AnnotateChunkSizes).TryMatch(filePath); matched && values[0] > 0 {
+			chunkSize = values[0]
+		}
+		// Fragments are made smaller while requests exceed size limit of the LLM
+		annotateByFragments := func(result annotationResult) annotationResult {
+			for result.tooLarge && chunkSize/2 >= annotationMinChunkSize {
+				chunkSize /= 2
+				logger.Warnf("%s: request size limit reached, annotating by fragments of %d characters", filePath, chunkSize)
+				result = annotateChunkedFile(worker, job, annotatePrompt, fileContents, chunkSize)
+			}
+			return result
+		}
+		if fileLength > chunkSize {
+			return annotateByFragments(annotateChunkedFile(worker, job, annotatePrompt, fileContents, chunkSize))
+		}
+		chunkSize = fileLength
+
+		// Build message chain with project description if available
+		messages := newMessages()
+
+		// Add annotation prompt and simulated response
+		annotateRequest := llm.AddPlainTextFragment(
+			llm.NewMessage(llm.UserRequest),
+			annotatePrompt)
+		annotateSimulatedResponse := llm.AddPlainTextFragment(
+			llm.NewMessage(llm.SimulatedAIResponse),
+			annotateConfig.String(config.K_AnnotateFileResponse))
+		// we can benefit from caching here, all messages up to this should be the same
+		annotateSimulatedResponse.CacheBreakpoint = true
+
+		// Add file contents
+		fileContentsRequest := llm.AddFileFragment(
+			llm.NewMessage(llm.UserRequest),
+			filePath,
+			fileContents,
+			projectConfig.Tags(config.K_ProjectFilenameTags))
+
+		// Combine all messages
+		messages = append(messages, annotateRequest, annotateSimulatedResponse, fileContentsRequest)
+
+		return annotateByFragments(queryAnnotation(worker, job, messages, func(annotation string) []string {
+			return validator.validate(filePath, fileContents, annotation, contextSavingMode == 0)
+		}))
+	}
+
 	errorFlag := false
-	newAnnotations := make(map[string]string)
+	var fatalErr error
+	onResult := func(result annotationResult) bool {
+		if result.failed {
+			fileChecksums[result.filePath] = oldChecksums[result.filePath]
+			errorFlag = true
+		}
+		if result.fatalErr != nil {
+			if fatalErr == nil {
+				fatalErr = result.fatalErr
+			}
+			return false
+		}
+		if result.annotation != "" {
+			if err := saver.add(result.filePath, fileChecksums[result.filePath], result.annotation); err != nil {
+				logger.Errorln("Failed to save annotations:", err)
+			}
+		}
+		return true
+	}
+
 	for gi, fileGroup := range fileGroups {
 		if len(fileGroups) > 1 {
 			logger.Infof("Annotating file group %d/%d", gi+1, len(fileGroups))
 		}
 
+		var groupJobs []annotationJob
+		allowCaching := len(fileGroup) >= connector.GetMinPrefixRepsForCaching()
 		for i, filePath := range fileGroup {
-			// Detect actual prompt for annotating this particular file
-			annotatePrompt := ""
-			if matched, values, _ := annotateConfig.TextMatcherString(config.K_AnnotateFilePrompts).TryMatch(filePath); matched {
-				annotatePrompt = values[contextSavingMode]
+			groupJobs = append(groupJobs, annotationJob{index: i, filePath: filePath, allowCaching: allowCaching})
+		}
+
+		var skippedJobs []annotationJob
+		if fatalErr != nil {
+			skippedJobs = groupJobs
+		} else if concurrency > 1 && allowCaching && connector.GetCachingEnabled() && len(groupJobs) > 1 {
+			// Annotate first file of the group alone to populate prompt cache, before other files use the same prefix
+			skippedJobs = runAnnotationWorkers(groupJobs[:1], 1, annotateFile, onResult)
+			if fatalErr != nil {
+				skippedJobs = groupJobs
 			} else {
-				logger.Errorln("Failed to detect annotation prompt for file:", filePath)
-				continue
+				skippedJobs = runAnnotationWorkers(groupJobs[1:], concurrency, annotateFile, onResult)
 			}
+		} else {
+			skippedJobs = runAnnotationWorkers(groupJobs, concurrency, annotateFile, onResult)
+		}
 
-			// Read file contents and generate annotation
-			fileBytes, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, filePath))
-			if err != nil {
-				logger.Errorf("Failed to read file %s: %s", filePath, err)
-				continue
-			}
-			if wrn != "" {
-				logger.Warnf("%s: %s", filePath, wrn)
-			}
-			fileContents := string(fileBytes)
-
-			// Build message chain with project description if available
-			var messages []llm.Message
-
-			// Add project description if available
-			if projectDesc != "" {
-				projectDescPrompt := llm.AddPlainTextFragment(
-					llm.NewMessage(llm.UserRequest),
-					projectConfig.String(config.K_ProjectDescriptionPrompt))
-				projectDescPrompt = llm.AddPlainTextFragment(projectDescPrompt, projectDesc)
-				projectDescResponse := llm.AddPlainTextFragment(
-					llm.NewMessage(llm.SimulatedAIResponse),
-					projectConfig.String(config.K_ProjectDescriptionResponse))
-				messages = append(messages, projectDescPrompt, projectDescResponse)
-			}
+		// Files not annotated after fatal error must be reannotated next time
+		for _, job := range skippedJobs {
+			fileChecksums[job.filePath] = oldChecksums[job.filePath]
+		}
+	}
+
+	// Save updated annotations
+	logger.Infoln("Saving annotations")
+	if err := saver.save(fileChecksums); err != nil {
+		logger.Panicln("Failed to save annotations:", err)
+	}
 
-			// Add annotation prompt and simulated response
+	if fatalErr != nil {
+		logger.Panicln(fatalErr)
+	}
+
+	// Generate summaries of project directories, used at stage 1 of other operations to select relevant directories first for large projects
+	if dirSummariesFileCount := projectConfig.Integer(config.K_ProjectDirSummariesFileCount); dirSummariesFileCount > 0 && len(fileNames) >= dirSummariesFileCount {
+		dirSummariesFilePath := filepath.Join(perpetualDir, utils.DirSummariesFileName)
+		dirSummaries, oldDirChecksums := utils.LoadDirSummaries(dirSummariesFilePath)
+		dirChecksums := map[string]string{}
+		dirTree := utils.NewDirTree(fileNames)
+
+		annotateDir := func(worker int, job annotationJob) annotationResult {
+			defer rawMessageFlushers[worker]()
+			filenameTags := projectConfig.Tags(config.K_ProjectFilenameTags)
+			messages := newMessages()
+			// Add directory summary prompt and simulated response
 			annotateRequest := llm.AddPlainTextFragment(
 				llm.NewMessage(llm.UserRequest),
-				annotatePrompt)
+				annotateConfig.String(config.K_AnnotateDirPrompt))
 			annotateSimulatedResponse := llm.AddPlainTextFragment(
 				llm.NewMessage(llm.SimulatedAIResponse),
-				annotateConfig.String(config.K_AnnotateFileResponse))
-			// we can benefit from caching here, all messages up to this should be the same
+				annotateConfig.String(config.K_AnnotateDirResponse))
 			annotateSimulatedResponse.CacheBreakpoint = true
-
-			// Add file contents
-			fileContentsRequest := llm.AddFileFragment(
-				llm.NewMessage(llm.UserRequest),
-				filePath,
-				fileContents,
-				projectConfig.Tags(config.K_ProjectFilenameTags))
-
-			// Combine all messages
-			messages = append(messages, annotateRequest, annotateSimulatedResponse, fileContentsRequest)
-
-			llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== Annotate: %s\n\n\n", filePath))
-
-			onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
-			allowCaching := len(fileGroup) >= connector.GetMinPrefixRepsForCaching()
-			for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
-				logger.Infof("%d: %s", i+1, filePath)
-				// Perform actual query, caching may be beneficial if annotating more than 1 file
-				annotationResponse, status, err := connector.Query(allowCaching, messages...)
-				if perfString := connector.GetPerfString(); perfString != "" {
-					logger.Traceln(perfString)
+			// Add directory name, followed by annotations of its files and summaries of its subdirectories
+			dirContentsRequest := llm.AddIndexFragment(llm.NewMessage(llm.UserRequest), job.filePath+string(filepath.Separator), filenameTags)
+			for _, file := range dirTree.Files[job.filePath] {
+				dirContentsRequest = llm.AddIndexFragment(dirContentsRequest, file, filenameTags)
+				if annotation := annotations[file]; annotation != "" {
+					dirContentsRequest = llm.AddPlainTextFragment(dirContentsRequest, annotation)
 				}
-				// Request-size violations are configuration or input errors and
-				// cannot be resolved by retrying the same request.
-				if status == llm.QueryRequestTooLarge {
-					logger.Panicf("LLM request size limit reached while annotating %s: %v", filePath, err)
+			}
+			for _, subdir := range dirTree.Dirs[job.filePath] {
+				dirContentsRequest = llm.AddIndexFragment(dirContentsRequest, subdir+string(filepath.Separator), filenameTags)
+				if summary := dirSummaries[subdir]; summary != "" {
+					dirContentsRequest = llm.AddPlainTextFragment(dirContentsRequest, summary)
 				}
-				// Check for general error on query
-				if err != nil {
-					logger.Errorf("LLM query failed with status %d, error: %s", status, err)
-					if onFailRetriesLeft < 1 {
-						fileChecksums[filePath] = oldChecksums[filePath]
-						errorFlag = true
-					}
-					continue
+			}
+			messages = append(messages, annotateRequest, annotateSimulatedResponse, dirContentsRequest)
+			return queryAnnotation(worker, job, messages, func(annotation string) []string {
+				return validator.validate(job.filePath, "", annotation, false)
+			})
+		}
+
+		// Summaries are read by workers, so new summaries are merged after all directories of the same level are processed
+		newDirSummaries := map[string]string{}
+		onDirResult := func(result annotationResult) bool {
+			if result.failed {
+				dirChecksums[result.filePath] = oldDirChecksums[result.filePath]
+				errorFlag = true
+			}
+			if result.fatalErr != nil {
+				if fatalErr == nil {
+					fatalErr = result.fatalErr
 				}
-				// Check for hitting token limit - there are no responses below token limit, we will try to regenerate from scratch if possible
-				if status == llm.QueryMaxTokens {
-					logger.Errorln("LLM response reached max tokens, consider increasing the limit")
-					//TODO: find out do we have seed parameter set, because regenerating with same seed will fail again, so if true -> make onFailRetriesLeft = 0
-					if onFailRetriesLeft < 1 {
-						fileChecksums[filePath] = oldChecksums[filePath]
-						errorFlag = true
-					}
-					continue
+				return false
+			}
+			if result.annotation != "" {
+				newDirSummaries[result.filePath] = result.annotation
+			}
+			return true
+		}
+
+		// Subdirectories are summarized before their parents, summary is regenerated when contents of directory changes
+		dirLevels := dirTree.GetDirsByDepth()
+		for li, dirs := range dirLevels {
+			if fatalErr != nil {
+				// Directories not processed after fatal error keep old summaries, so they are regenerated next time
+				for _, dir := range dirs {
+					dirChecksums[dir] = oldDirChecksums[dir]
 				}
-				// Some final filtering and preparations of produced annotation response
-				finalResponse := utils.FilterAndTrimResponse(annotationResponse, projectConfig.RegexpArray(config.K_ProjectCodeTagsRx), logger)
-				// Stop there if no responses available for further processing
-				if len(finalResponse) < 1 {
-					logger.Errorln("No LLM response available")
-					if onFailRetriesLeft < 1 {
-						fileChecksums[filePath] = oldChecksums[filePath]
-						errorFlag = true
-					}
+				continue
+			}
+			var dirJobs []annotationJob
+			for _, dir := range dirs {
+				dirChecksums[dir] = dirTree.GetDirChecksum(dir, annotations, dirSummaries)
+				if _, exist := dirSummaries[dir]; exist && !force && dirChecksums[dir] == oldDirChecksums[dir] {
 					continue
 				}
-
-				newAnnotations[filePath] = finalResponse
-				break
+				dirJobs = append(dirJobs, annotationJob{index: len(dirJobs), filePath: dir})
 			}
+			if len(dirJobs) < 1 {
+				continue
+			}
+			logger.Infof("Generating directory summaries, level %d/%d, count: %d", li+1, len(dirLevels), len(dirJobs))
+			allowCaching := len(dirJobs) >= connector.GetMinPrefixRepsForCaching()
+			for i := range dirJobs {
+				dirJobs[i].allowCaching = allowCaching
+			}
+			for _, job := range runAnnotationWorkers(dirJobs, concurrency, annotateDir, onDirResult) {
+				dirChecksums[job.filePath] = oldDirChecksums[job.filePath]
+			}
+			maps.Copy(dirSummaries, newDirSummaries)
 		}
-	}
 
-	// Get annotations for files listed in fileChecksums
-	annotations, err := utils.GetAnnotations(annotationsFilePath, fileNames)
-	if err != nil {
-		logger.Panicln("Failed to read old annotations:", err)
-	}
-
-	// Copy new annotations back to old annotations
-	for element := range newAnnotations {
-		annotations[element] = newAnnotations[element]
-	}
+		logger.Infoln("Saving directory summaries")
+		if err := utils.SaveDirSummaries(dirSummariesFilePath, dirChecksums, dirSummaries); err != nil {
+			logger.Panicln("Failed to save directory summaries:", err)
+		}
 
-	// Save updated annotations
-	logger.Infoln("Saving annotations")
-	if err := utils.SaveAnnotations(annotationsFilePath, fileChecksums, annotations); err != nil {
-		logger.Panicln("Failed to save annotations:", err)
+		if fatalErr != nil {
+			logger.Panicln(fatalErr)
+		}
 	}
 
 	if errorFlag {
@@ -0,0 +1,141 @@
+package op_annotate
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// annotationValidator checks generated annotations for common signs of poor quality:
+// too short or too long text, missing required sections, refusals, wrong language, missing key symbols
+type annotationValidator struct {
+	minLength          int
+	maxLength          int
+	requiredRx         utils.TextMatcher[string]
+	forbiddenRx        []*regexp.Regexp
+	languageRx         *regexp.Regexp
+	languageMinPercent float64
+	symbolsRx          utils.TextMatcher[string]
+	symbolsMinPercent  float64
+	notesRx            []*regexp.Regexp
+}
+
+func newAnnotationValidator(annotateConfig config.Config) *annotationValidator {
+	return &annotationValidator{
+		minLength:          annotateConfig.Integer(config.K_AnnotateMinLength),
+		maxLength:          annotateConfig.Integer(config.K_AnnotateMaxLength),
+		requiredRx:         annotateConfig.TextMatcherString(config.K_AnnotateRequiredRx),
+		forbiddenRx:        annotateConfig.RegexpArray(config.K_AnnotateForbiddenRx),
+		languageRx:         annotateConfig.Regexp(config.K_AnnotateLanguageRx),
+		languageMinPercent: annotateConfig.Float(config.K_AnnotateLanguageMinPercent),
+		symbolsRx:          annotateConfig.TextMatcherString(config.K_AnnotateSymbolsRx),
+		symbolsMinPercent:  annotateConfig.Float(config.K_AnnotateSymbolsMinPercent),
+		notesRx:            annotateConfig.RegexpArray(config.K_AnnotateNotesRx),
+	}
+}
+
+// validate returns the list of problems found in annotation, empty list if annotation looks good.
+// Checks depending on the file contents (required sections, symbols) are skipped when fileContents is empty,
+// or when the file contains notes that override annotation template
+func (v *annotationValidator) validate(filePath, fileContents, annotation string, checkSymbols bool) []string {
+	var problems []string
+	length := utf8.RuneCountInString(annotation)
+	if length < v.minLength {
+		problems = append(problems, fmt.Sprintf("annotation is too short: %d characters, minimum is %d", length, v.minLength))
+	}
+	if v.maxLength > 0 && length > v.maxLength {
+		problems = append(problems, fmt.Sprintf("annotation is too long: %d characters, maximum is %d", length, v.maxLength))
+	}
+	for _, rx := range v.forbiddenRx {
+		if match := rx.FindString(annotation); match != "" {
+			problems = append(problems, fmt.Sprintf("annotation contains forbidden phrase: %q", match))
+		}
+	}
+	if v.languageMinPercent > 0 {
+		letters, matched := 0, 0
+		for _, r := range annotation {
+			if unicode.IsLetter(r) {
+				letters++
+				if v.languageRx.MatchString(string(r)) {
+					matched++
+				}
+			}
+		}
+		if letters > 0 {
+			if percent := float64(matched) * 100 / float64(letters); percent < v.languageMinPercent {
+				problems = append(problems, fmt.Sprintf("annotation has wrong language: %.0f%% of letters match expected alphabet, minimum is %.0f%%", percent, v.languageMinPercent))
+			}
+		}
+	}
+	if fileContents == "" {
+		return problems
+	}
+	for _, rx := range v.notesRx {
+		if rx.MatchString(fileContents) {
+			return problems
+		}
+	}
+	if matched, values, _ := v.requiredRx.TryMatch(filePath); matched && values[0] != "" {
+		if !regexp.MustCompile(values[0]).MatchString(annotation) {
+			problems = append(problems, fmt.Sprintf("annotation is missing required section matching: %s", values[0]))
+		}
+	}
+	if matched, values, _ := v.symbolsRx.TryMatch(filePath); checkSymbols && v.symbolsMinPercent > 0 && matched && values[0] != "" {
+		symbols := map[string]bool{}
+		for _, match := range regexp.MustCompile(values[0]).FindAllStringSubmatch(fileContents, -1) {
+			if len(match) > 1 && match[1] != "" {
+				symbols[match[1]] = true
+			}
+		}
+		mentioned := 0
+		for symbol := range symbols {
+			if strings.Contains(annotation, symbol) {
+				mentioned++
+			}
+		}
+		if len(symbols) > 0 {
+			if percent := float64(mentioned) * 100 / float64(len(symbols)); percent < v.symbolsMinPercent {
+				problems = append(problems, fmt.Sprintf("annotation mentions only %.0f%% of %d key symbols, minimum is %.0f%%", percent, len(symbols), v.symbolsMinPercent))
+			}
+		}
+	}
+	return problems
+}
+
+// auditAnnotations validates existing annotations against current contents of the project files,
+// returns problems found for each file with suspicious annotation
+func auditAnnotations(
+	projectRootDir string,
+	fileNames []string,
+	annotations map[string]string,
+	validator *annotationValidator,
+	checkSymbols bool,
+	logger logging.ILogger) map[string][]string {
+
+	result := map[string][]string{}
+	for _, filePath := range fileNames {
+		annotation, exist := annotations[filePath]
+		if !exist {
+			continue
+		}
+		fileContents, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, filePath))
+		if err != nil {
+			logger.Errorf("Failed to read file %s: %s", filePath, err)
+			continue
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", filePath, wrn)
+		}
+		if problems := validator.validate(filePath, fileContents, annotation, checkSymbols); len(problems) > 0 {
+			result[filePath] = problems
+		}
+	}
+	return result
+}
@@ -0,0 +1,123 @@
+package op_annotate
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func newTestAnnotationValidator(t *testing.T) *annotationValidator {
+	requiredRx, err := utils.NewRxMatcher[string](1, []any{[]any{`^.*\.go$`, "Package: `"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	symbolsRx, err := utils.NewRxMatcher[string](1, []any{
+		[]any{`^.*_test\.go$`, ""},
+		[]any{`^.*\.go$`, `(?m)^(?:func(?: \([^)]*\))? |type )([A-Z]\w*)`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &annotationValidator{
+		minLength:          10,
+		maxLength:          200,
+		requiredRx:         requiredRx,
+		forbiddenRx:        []*regexp.Regexp{regexp.MustCompile(`(?i)\bI (?:cannot|can't)\b`)},
+		languageRx:         regexp.MustCompile(`\p{Latin}`),
+		languageMinPercent: 70,
+		symbolsRx:          symbolsRx,
+		symbolsMinPercent:  50,
+		notesRx:            []*regexp.Regexp{regexp.MustCompile(`(?i)\bNOTE\s+for\s+summarization\b`)},
+	}
+}
+
+func TestAnnotationValidator(t *testing.T) {
+	validator := newTestAnnotationValidator(t)
+	source := "package main\n\ntype Config struct{}\n\nfunc (c *Config) Load() {}\n\nfunc NewConfig() *Config { return nil }\n\nfunc helper() {}\n"
+
+	tests := []struct {
+		name         string
+		filePath     string
+		contents     string
+		annotation   string
+		checkSymbols bool
+		problems     []string
+	}{
+		{
+			name:         "good annotation",
+			filePath:     "main.go",
+			contents:     source,
+			annotation:   "Package: `main`\n\nDeclares Config type with Load method and NewConfig constructor",
+			checkSymbols: true,
+		},
+		{
+			name:       "too short",
+			filePath:   "readme.txt",
+			annotation: "Readme",
+			problems:   []string{"too short"},
+		},
+		{
+			name:       "too long",
+			filePath:   "readme.txt",
+			annotation: strings.Repeat("Long text ", 30),
+			problems:   []string{"too long"},
+		},
+		{
+			name:       "refusal",
+			filePath:   "readme.txt",
+			annotation: "Sorry, I cannot summarize this file",
+			problems:   []string{"forbidden phrase"},
+		},
+		{
+			name:       "wrong language",
+			filePath:   "readme.txt",
+			annotation: "Этот файл содержит описание проекта",
+			problems:   []string{"wrong language"},
+		},
+		{
+			name:         "missing section and symbols",
+			filePath:     "main.go",
+			contents:     source,
+			annotation:   "This file contains Config type and some functions",
+			checkSymbols: true,
+			problems:     []string{"missing required section", "key symbols"},
+		},
+		{
+			name:         "symbols not checked",
+			filePath:     "main.go",
+			contents:     source,
+			annotation:   "Package: `main`\n\nContains configuration helpers",
+			checkSymbols: false,
+		},
+		{
+			name:         "test files are not checked for symbols",
+			filePath:     "main_test.go",
+			contents:     "package main\n\nfunc TestLoad(t *testing.T) {}\n",
+			annotation:   "Package: `main`\n\nTests for configuration loading",
+			checkSymbols: true,
+		},
+		{
+			name:         "notes override template",
+			filePath:     "main.go",
+			contents:     "// NOTE for summarization: only say that file is not important\n" + source,
+			annotation:   "This file is not important",
+			checkSymbols: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := validator.validate(tt.filePath, tt.contents, tt.annotation, tt.checkSymbols)
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("validate() problems = %v, want %d problems", problems, len(tt.problems))
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("validate() problem %d = %q, want it to contain %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package op_annotate
+
+import (
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// Minimal interval between saving annotation progress, so crash or interruption does not discard finished work
+const annotationsSaveInterval = 10 * time.Second
+
+type annotationJob struct {
+	index        int
+	filePath     string
+	allowCaching bool
+}
+
+type annotationResult struct {
+	filePath   string
+	annotation string
+	// Annotation failed, file must be reannotated next time
+	failed bool
+	// Error that cannot be resolved by retrying, remaining files must not be processed
+	fatalErr error
+	// Request exceeded size limit of the LLM, file may still be annotated by smaller fragments
+	tooLarge bool
+}
+
+// runAnnotationWorkers processes jobs with the given number of workers, worker index is passed to annotate function.
+// Results are passed to onResult in the calling goroutine, so it does not need any synchronization.
+// When onResult returns false, jobs that are not started yet are skipped and returned
+func runAnnotationWorkers(
+	jobs []annotationJob,
+	workers int,
+	annotate func(worker int, job annotationJob) annotationResult,
+	onResult func(result annotationResult) bool) []annotationJob {
+
+	jobsChan := make(chan annotationJob)
+	resultsChan := make(chan annotationResult)
+	var stop atomic.Bool
+	var skipped []annotationJob
+
+	var wg sync.WaitGroup
+	for worker := range max(min(workers, len(jobs)), 1) {
+		wg.Go(func() {
+			for job := range jobsChan {
+				resultsChan <- annotate(worker, job)
+			}
+		})
+	}
+
+	go func() {
+		defer close(jobsChan)
+		for i, job := range jobs {
+			if stop.Load() {
+				skipped = jobs[i:]
+				return
+			}
+			jobsChan <- job
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(resultsChan)
+	}()
+
+	for result := range resultsChan {
+		if !onResult(result) {
+			stop.Store(true)
+		}
+	}
+	return skipped
+}
+
+// annotationsSaver periodically saves annotations generated so far
+type annotationsSaver struct {
+	annotationsFilePath string
+	checksums           map[string]string
+	annotations         map[string]string
+	saveInterval        time.Duration
+	lastSaveTime        time.Time
+}
+
+// newAnnotationsSaver creates saver for the current annotations, checksums of files yet to annotate
+// must be the old ones, so these files are reannotated next time if operation is interrupted
+func newAnnotationsSaver(annotationsFilePath string, checksums, annotations map[string]string, saveInterval time.Duration) *annotationsSaver {
+	return &annotationsSaver{
+		annotationsFilePath: annotationsFilePath,
+		checksums:           maps.Clone(checksums),
+		annotations:         annotations,
+		saveInterval:        saveInterval,
+		lastSaveTime:        time.Now(),
+	}
+}
+
+// add remembers new annotation, saves annotations if save interval has passed since last save
+func (s *annotationsSaver) add(filePath, checksum, annotation string) error {
+	s.checksums[filePath] = checksum
+	s.annotations[filePath] = annotation
+	if time.Since(s.lastSaveTime) < s.saveInterval {
+		return nil
+	}
+	return s.save(s.checksums)
+}
+
+// save writes annotations collected so far with the given checksums
+func (s *annotationsSaver) save(checksums map[string]string) error {
+	s.lastSaveTime = time.Now()
+	return utils.SaveAnnotations(s.annotationsFilePath, checksums, s.annotations)
+}
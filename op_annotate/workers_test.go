@@ -0,0 +1,96 @@
+package op_annotate
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func TestRunAnnotationWorkers(t *testing.T) {
+	var jobs []annotationJob
+	for i, file := range []string{"a.go", "b.go", "c.go", "d.go", "e.go"} {
+		jobs = append(jobs, annotationJob{index: i, filePath: file})
+	}
+
+	var running, maxRunning atomic.Int32
+	var annotated []string
+	skipped := runAnnotationWorkers(jobs, 3, func(worker int, job annotationJob) annotationResult {
+		if worker < 0 || worker >= 3 {
+			t.Errorf("invalid worker index: %d", worker)
+		}
+		current := running.Add(1)
+		defer running.Add(-1)
+		for {
+			prev := maxRunning.Load()
+			if current <= prev || maxRunning.CompareAndSwap(prev, current) {
+				break
+			}
+		}
+		return annotationResult{filePath: job.filePath, annotation: "annotation of " + job.filePath}
+	}, func(result annotationResult) bool {
+		annotated = append(annotated, result.filePath)
+		return true
+	})
+
+	slices.Sort(annotated)
+	if len(skipped) != 0 || !slices.Equal(annotated, []string{"a.go", "b.go", "c.go", "d.go", "e.go"}) {
+		t.Errorf("annotated %v, skipped %v", annotated, skipped)
+	}
+	if maxRunning.Load() > 3 {
+		t.Errorf("workers limit exceeded: %d", maxRunning.Load())
+	}
+
+	// Jobs not started after fatal error are skipped
+	annotated = nil
+	skipped = runAnnotationWorkers(jobs, 1, func(worker int, job annotationJob) annotationResult {
+		if job.filePath == "b.go" {
+			return annotationResult{filePath: job.filePath, failed: true, fatalErr: errors.New("request too large")}
+		}
+		return annotationResult{filePath: job.filePath, annotation: "annotation"}
+	}, func(result annotationResult) bool {
+		annotated = append(annotated, result.filePath)
+		return result.fatalErr == nil
+	})
+	if len(annotated)+len(skipped) != len(jobs) || !slices.Contains(annotated, "b.go") || len(skipped) < 1 {
+		t.Errorf("annotated %v, skipped %v", annotated, skipped)
+	}
+}
+
+func TestAnnotationsSaver(t *testing.T) {
+	annotationsFilePath := filepath.Join(t.TempDir(), utils.AnnotationsFileName)
+	files := []string{"a.go", "b.go"}
+	checksums := map[string]string{"a.go": "old-a", "b.go": "old-b"}
+
+	// Progress is saved on every new annotation with zero interval
+	saver := newAnnotationsSaver(annotationsFilePath, checksums, map[string]string{"a.go": "old annotation", "b.go": "old annotation"}, 0)
+	if err := saver.add("a.go", "new-a", "new annotation"); err != nil {
+		t.Fatalf("add() failed: %v", err)
+	}
+	saved := utils.GetChecksumsFromAnnotations(annotationsFilePath, files)
+	if saved["a.go"] != "new-a" || saved["b.go"] != "old-b" {
+		t.Errorf("saved checksums = %v", saved)
+	}
+	if checksums["a.go"] != "old-a" {
+		t.Errorf("saver must not modify checksums passed to it")
+	}
+
+	// Annotations are not saved until interval passes
+	saver = newAnnotationsSaver(annotationsFilePath, checksums, map[string]string{"a.go": "old annotation", "b.go": "old annotation"}, annotationsSaveInterval)
+	if err := saver.add("b.go", "new-b", "new annotation"); err != nil {
+		t.Fatalf("add() failed: %v", err)
+	}
+	if saved := utils.GetChecksumsFromAnnotations(annotationsFilePath, files); saved["b.go"] != "old-b" {
+		t.Errorf("annotations saved before interval: %v", saved)
+	}
+	if err := saver.save(map[string]string{"a.go": "new-a", "b.go": "new-b"}); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+	annotations, err := utils.GetAnnotations(annotationsFilePath, files)
+	if err != nil || annotations["b.go"] != "new annotation" {
+		t.Errorf("GetAnnotations() = %v, %v", annotations, err)
+	}
+}
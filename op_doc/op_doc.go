@@ -138,6 +138,8 @@ func Run(args []string, logger logging.ILogger) {
 	} else {
 		docConfig := config.LoadOpDocConfig(perpetualDir, logger)
 		projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+		// Hide secrets in file contents sent to LLM
+		llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 
 		projectFilesBlacklist := projectConfig.RegexpArray(config.K_ProjectFilesBlacklist)
 
@@ -222,10 +224,15 @@ func Run(args []string, logger logging.ILogger) {
 		}
 
 		// Load annotations needed for stage1
+		unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
 		annotations, err := utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
+		unlockAnnotations()
 		if err != nil {
 			logger.Panicln("Error reading annotations:", err)
 		}
+		// Add symbols from local symbol index to file descriptions for the project index at stage1
+		symbols := shared.UpdateSymbols(projectRootDir, perpetualDir, projectConfig, fileNames, logger)
+		indexAnnotations := shared.AddSymbolsToAnnotations(annotations, symbols, projectConfig)
 
 		var docPrompt string
 		switch mode {
@@ -250,6 +257,24 @@ func Run(args []string, logger logging.ILogger) {
 			annotations,
 			selectionPasses,
 			logger)
+		// Select relevant directories once for all passes, for large projects only
+		preselectedFileNames = shared.Stage1SelectDirs(
+			OpName,
+			projectRootDir,
+			perpetualDir,
+			projectConfig,
+			docConfig,
+			projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+			preselectedFileNames,
+			projectDesc,
+			indexAnnotations,
+			[]string{docConfig.String(config.K_DocExamplePrompt)},
+			[]string{docExampleContent},
+			[]string{docConfig.String(config.K_DocExampleResponse)},
+			docPrompt,
+			docContent,
+			[]string{},
+			logger)
 		// Prepare for multi-pass stage 1
 		selectionPasses = len(preselectedFileNames)
 		stage1Logger := logger.Clone()
@@ -269,7 +294,7 @@ func Run(args []string, logger logging.ILogger) {
 				preselectedFileNames[pass],
 				fileNames,
 				projectDesc,
-				annotations,
+				indexAnnotations,
 				[]string{docConfig.String(config.K_DocExamplePrompt)},
 				[]string{docExampleContent},
 				[]string{docConfig.String(config.K_DocExampleResponse)},
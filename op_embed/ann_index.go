@@ -0,0 +1,638 @@
+package op_embed
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// Approximate nearest neighbour index for embeddings: HNSW graph (https://arxiv.org/abs/1603.09320)
+// with cosine similarity of vectors. Index is stored next to the embeddings and used by local similarity search
+// instead of brute-force search when it is up to date. Only the graph is stored, nodes refer to vectors
+// by file name and chunk number, vectors are taken from embeddings loaded when the index is used
+
+const annIndexVersion = 2
+
+// Max connections of the node per graph layer (doubled for the layer 0)
+const hnswM = 16
+
+// Candidate list sizes used when building the graph and when searching it
+const hnswEfConstruction = 100
+const hnswEfSearch = 64
+
+// Files may have several vectors, so request more nodes than the number of files needed
+const annCandidatesPerFile = 2
+
+// Index is not built for small projects, brute-force search is fast enough and exact
+const annIndexMinVectors = 2000
+
+// Index is rebuilt from scratch when the share of nodes removed since the build becomes too large,
+// links repaired after removal are worse than the links created when building the graph
+const annIndexMaxRemovedPercent = 30
+
+type annNode struct {
+	File      string    `msgpack:"file"`
+	Chunk     int32     `msgpack:"chunk"`
+	Neighbors [][]int32 `msgpack:"neighbors"`
+}
+
+type annIndex struct {
+	Version         int               `msgpack:"version"`
+	EmbeddingsStamp string            `msgpack:"embeddings_stamp"`
+	Dimensions      int               `msgpack:"dimensions"`
+	EntryPoint      int32             `msgpack:"entry_point"`
+	MaxLevel        int               `msgpack:"max_level"`
+	Checksums       map[string]string `msgpack:"checksums"`
+	Nodes           []annNode         `msgpack:"nodes"`
+	RemovedCount    int               `msgpack:"removed_count"`
+	// Runtime state: vectors of the nodes with inverse norms, and state used while searching the graph
+	vectors    [][]float32
+	invNorms   []float32
+	rng        *rand.Rand
+	visited    []uint32
+	visitedGen uint32
+}
+
+type annCandidate struct {
+	id    int32
+	score float32
+}
+
+// annMaxHeap pops the candidate with the highest score first
+type annMaxHeap []annCandidate
+
+func (h annMaxHeap) Len() int           { return len(h) }
+func (h annMaxHeap) Less(i, j int) bool { return h[i].score > h[j].score }
+func (h annMaxHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *annMaxHeap) Push(x any)        { *h = append(*h, x.(annCandidate)) }
+func (h *annMaxHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// annMinHeap pops the candidate with the lowest score first
+type annMinHeap []annCandidate
+
+func (h annMinHeap) Len() int           { return len(h) }
+func (h annMinHeap) Less(i, j int) bool { return h[i].score < h[j].score }
+func (h annMinHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *annMinHeap) Push(x any)        { *h = append(*h, x.(annCandidate)) }
+func (h *annMinHeap) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+func newANNIndex(dimensions int) *annIndex {
+	return &annIndex{
+		Version:    annIndexVersion,
+		Dimensions: dimensions,
+		EntryPoint: -1,
+		Checksums:  map[string]string{},
+		rng:        rand.New(rand.NewPCG(1, 1)),
+	}
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	result := make([]float32, len(vector))
+	if norm == 0 {
+		return result
+	}
+	norm = math.Sqrt(norm)
+	for i, v := range vector {
+		result[i] = float32(float64(v) / norm)
+	}
+	return result
+}
+
+func dotProduct(x, y []float32) float32 {
+	var result float32
+	for i := range x {
+		result += x[i] * y[i]
+	}
+	return result
+}
+
+func inverseNorm(vector []float32) float32 {
+	norm := math.Sqrt(float64(dotProduct(vector, vector)))
+	if norm == 0 {
+		return 0
+	}
+	return float32(1 / norm)
+}
+
+// querySimilarity returns cosine similarity of the normalized query and the node vector
+func (ix *annIndex) querySimilarity(query []float32, id int32) float32 {
+	return dotProduct(query, ix.vectors[id]) * ix.invNorms[id]
+}
+
+// nodeSimilarity returns cosine similarity of the vectors of two nodes
+func (ix *annIndex) nodeSimilarity(x, y int32) float32 {
+	return dotProduct(ix.vectors[x], ix.vectors[y]) * ix.invNorms[x] * ix.invNorms[y]
+}
+
+func maxConnections(level int) int {
+	if level == 0 {
+		return hnswM * 2
+	}
+	return hnswM
+}
+
+// attachVectors sets vectors of the nodes from embeddings, nodes of skipped files are left without vectors.
+// Returns error if embeddings do not contain vectors referenced by the index
+func (ix *annIndex) attachVectors(embeddings map[string][][]float32, skipFiles []string) error {
+	skip := make(map[string]bool, len(skipFiles))
+	for _, file := range skipFiles {
+		skip[file] = true
+	}
+	ix.vectors = make([][]float32, len(ix.Nodes))
+	ix.invNorms = make([]float32, len(ix.Nodes))
+	for id, node := range ix.Nodes {
+		if skip[node.File] {
+			continue
+		}
+		vectors := embeddings[node.File]
+		if int(node.Chunk) >= len(vectors) || len(vectors[node.Chunk]) != ix.Dimensions {
+			return fmt.Errorf("embeddings index does not match embeddings for file: %s", node.File)
+		}
+		ix.vectors[id] = vectors[node.Chunk]
+		ix.invNorms[id] = inverseNorm(vectors[node.Chunk])
+	}
+	return nil
+}
+
+// getEmbeddingsStamp identifies the state of embeddings file the index was built for,
+// returns empty string if embeddings file is missing
+func getEmbeddingsStamp(embeddingsFilePath string) string {
+	info, err := os.Stat(embeddingsFilePath)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+func (ix *annIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-ix.rng.Float64()) / math.Log(hnswM)))
+}
+
+func (ix *annIndex) newVisitedGeneration() {
+	if len(ix.visited) < len(ix.Nodes) {
+		ix.visited = append(ix.visited, make([]uint32, len(ix.Nodes)-len(ix.visited))...)
+	}
+	ix.visitedGen++
+	if ix.visitedGen == 0 {
+		clear(ix.visited)
+		ix.visitedGen = 1
+	}
+}
+
+// searchLayer returns up to ef nodes closest to the query at the graph layer, sorted by descending score.
+// All nodes are used for traversal, but only nodes accepted by the filter are returned
+func (ix *annIndex) searchLayer(query []float32, entryPoints []int32, ef, level int, accept func(id int32) bool) []annCandidate {
+	ix.newVisitedGeneration()
+	candidates := &annMaxHeap{}
+	results := &annMinHeap{}
+	for _, id := range entryPoints {
+		ix.visited[id] = ix.visitedGen
+		candidate := annCandidate{id: id, score: ix.querySimilarity(query, id)}
+		heap.Push(candidates, candidate)
+		if accept == nil || accept(id) {
+			heap.Push(results, candidate)
+		}
+	}
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(annCandidate)
+		if results.Len() >= ef && current.score < (*results)[0].score {
+			break
+		}
+		for _, neighbor := range ix.Nodes[current.id].Neighbors[level] {
+			if ix.visited[neighbor] == ix.visitedGen {
+				continue
+			}
+			ix.visited[neighbor] = ix.visitedGen
+			score := ix.querySimilarity(query, neighbor)
+			if results.Len() < ef || score > (*results)[0].score {
+				heap.Push(candidates, annCandidate{id: neighbor, score: score})
+				if accept == nil || accept(neighbor) {
+					heap.Push(results, annCandidate{id: neighbor, score: score})
+					if results.Len() > ef {
+						heap.Pop(results)
+					}
+				}
+			}
+		}
+	}
+	sorted := make([]annCandidate, results.Len())
+	for i := len(sorted) - 1; i >= 0; i-- {
+		sorted[i] = heap.Pop(results).(annCandidate)
+	}
+	return sorted
+}
+
+// selectNeighbors picks up to maxCount candidates (sorted by descending score) using HNSW heuristic:
+// candidate is preferred when it is closer to the base node than to already selected neighbors
+func (ix *annIndex) selectNeighbors(candidates []annCandidate, maxCount int) []int32 {
+	if len(candidates) <= maxCount {
+		result := make([]int32, len(candidates))
+		for i, candidate := range candidates {
+			result[i] = candidate.id
+		}
+		return result
+	}
+	var selected, pruned []int32
+	for _, candidate := range candidates {
+		if len(selected) >= maxCount {
+			break
+		}
+		good := true
+		for _, id := range selected {
+			if ix.nodeSimilarity(candidate.id, id) > candidate.score {
+				good = false
+				break
+			}
+		}
+		if good {
+			selected = append(selected, candidate.id)
+		} else {
+			pruned = append(pruned, candidate.id)
+		}
+	}
+	for _, id := range pruned {
+		if len(selected) >= maxCount {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// selectNodeNeighbors picks up to maxCount links of the node from candidate node ids
+func (ix *annIndex) selectNodeNeighbors(id int32, candidateIDs []int32, maxCount int) []int32 {
+	candidates := make([]annCandidate, len(candidateIDs))
+	for i, candidateID := range candidateIDs {
+		candidates[i] = annCandidate{id: candidateID, score: ix.nodeSimilarity(id, candidateID)}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+	return ix.selectNeighbors(candidates, maxCount)
+}
+
+// add inserts vector of the file chunk into the graph
+func (ix *annIndex) add(file string, chunk int32, vector []float32) {
+	id := int32(len(ix.Nodes))
+	level := ix.randomLevel()
+	ix.Nodes = append(ix.Nodes, annNode{File: file, Chunk: chunk, Neighbors: make([][]int32, level+1)})
+	ix.vectors = append(ix.vectors, vector)
+	ix.invNorms = append(ix.invNorms, inverseNorm(vector))
+	if ix.EntryPoint < 0 {
+		ix.EntryPoint = id
+		ix.MaxLevel = level
+		return
+	}
+	query := normalizeVector(vector)
+	entryPoints := []int32{ix.EntryPoint}
+	for lc := ix.MaxLevel; lc > level; lc-- {
+		entryPoints = []int32{ix.searchLayer(query, entryPoints, 1, lc, nil)[0].id}
+	}
+	for lc := min(level, ix.MaxLevel); lc >= 0; lc-- {
+		candidates := ix.searchLayer(query, entryPoints, hnswEfConstruction, lc, nil)
+		neighbors := ix.selectNeighbors(candidates, hnswM)
+		ix.Nodes[id].Neighbors[lc] = neighbors
+		for _, neighbor := range neighbors {
+			links := append(ix.Nodes[neighbor].Neighbors[lc], id)
+			if len(links) > maxConnections(lc) {
+				links = ix.selectNodeNeighbors(neighbor, links, maxConnections(lc))
+			}
+			ix.Nodes[neighbor].Neighbors[lc] = links
+		}
+		entryPoints = entryPoints[:0]
+		for _, candidate := range candidates {
+			entryPoints = append(entryPoints, candidate.id)
+		}
+	}
+	if level > ix.MaxLevel {
+		ix.MaxLevel = level
+		ix.EntryPoint = id
+	}
+}
+
+// addFile inserts all vectors of the file into the graph
+func (ix *annIndex) addFile(file, checksum string, vectors [][]float32) {
+	for i, vector := range vectors {
+		ix.add(file, int32(i), vector)
+	}
+	ix.Checksums[file] = checksum
+}
+
+// removeFiles removes nodes of the files from the graph. Links of remaining nodes to removed nodes are replaced
+// with links to neighbours of removed nodes, so the graph stays connected. Vectors must be attached for remaining nodes
+func (ix *annIndex) removeFiles(files []string) {
+	filesToRemove := make(map[string]bool)
+	for _, file := range files {
+		if _, exist := ix.Checksums[file]; exist {
+			filesToRemove[file] = true
+			delete(ix.Checksums, file)
+		}
+	}
+	if len(filesToRemove) < 1 {
+		return
+	}
+	removed := make([]bool, len(ix.Nodes))
+	for id, node := range ix.Nodes {
+		removed[id] = filesToRemove[node.File]
+	}
+
+	// Repair links of remaining nodes
+	for id := range ix.Nodes {
+		if removed[id] {
+			continue
+		}
+		for lc, links := range ix.Nodes[id].Neighbors {
+			if !slices.ContainsFunc(links, func(link int32) bool { return removed[link] }) {
+				continue
+			}
+			var candidateIDs []int32
+			for _, link := range links {
+				if !removed[link] {
+					candidateIDs = append(candidateIDs, link)
+					continue
+				}
+				for _, next := range ix.Nodes[link].Neighbors[lc] {
+					if !removed[next] && next != int32(id) && !slices.Contains(candidateIDs, next) {
+						candidateIDs = append(candidateIDs, next)
+					}
+				}
+			}
+			ix.Nodes[id].Neighbors[lc] = ix.selectNodeNeighbors(int32(id), candidateIDs, maxConnections(lc))
+		}
+	}
+
+	// Compact nodes, remaining links and entry point are remapped to new node ids
+	newIDs := make([]int32, len(ix.Nodes))
+	var nodes []annNode
+	var vectors [][]float32
+	var invNorms []float32
+	for id, node := range ix.Nodes {
+		if removed[id] {
+			newIDs[id] = -1
+			continue
+		}
+		newIDs[id] = int32(len(nodes))
+		nodes = append(nodes, node)
+		vectors = append(vectors, ix.vectors[id])
+		invNorms = append(invNorms, ix.invNorms[id])
+	}
+	for _, node := range nodes {
+		for _, links := range node.Neighbors {
+			for i, link := range links {
+				links[i] = newIDs[link]
+			}
+		}
+	}
+	ix.RemovedCount += len(ix.Nodes) - len(nodes)
+	if ix.EntryPoint >= 0 && removed[ix.EntryPoint] {
+		// New entry point is the first node with the highest level
+		ix.EntryPoint = -1
+		ix.MaxLevel = 0
+		for id, node := range nodes {
+			if ix.EntryPoint < 0 || len(node.Neighbors)-1 > ix.MaxLevel {
+				ix.EntryPoint = int32(id)
+				ix.MaxLevel = len(node.Neighbors) - 1
+			}
+		}
+	} else if ix.EntryPoint >= 0 {
+		ix.EntryPoint = newIDs[ix.EntryPoint]
+	}
+	ix.Nodes = nodes
+	ix.vectors = vectors
+	ix.invNorms = invNorms
+}
+
+func (ix *annIndex) removedPercent() float64 {
+	if len(ix.Nodes) < 1 {
+		return 100
+	}
+	return float64(ix.RemovedCount) * 100 / float64(len(ix.Nodes))
+}
+
+// search returns best scores of files whose vectors are among ef nearest neighbours of the query,
+// only files accepted by the filter are considered
+func (ix *annIndex) search(query []float32, ef int, acceptFile func(file string) bool) map[string]float32 {
+	scores := make(map[string]float32)
+	if ix.EntryPoint < 0 {
+		return scores
+	}
+	query = normalizeVector(query)
+	entryPoints := []int32{ix.EntryPoint}
+	for lc := ix.MaxLevel; lc > 0; lc-- {
+		entryPoints = []int32{ix.searchLayer(query, entryPoints, 1, lc, nil)[0].id}
+	}
+	accept := func(id int32) bool {
+		return acceptFile(ix.Nodes[id].File)
+	}
+	for _, candidate := range ix.searchLayer(query, entryPoints, ef, 0, accept) {
+		file := ix.Nodes[candidate.id].File
+		if oldScore, ok := scores[file]; !ok || oldScore < candidate.score {
+			scores[file] = candidate.score
+		}
+	}
+	return scores
+}
+
+// buildANNIndex creates index for all vectors of the files, files are added in sorted order to make the result reproducible
+func buildANNIndex(embeddings map[string][][]float32, checksums map[string]string, dimensions int) *annIndex {
+	ix := newANNIndex(dimensions)
+	files := make([]string, 0, len(embeddings))
+	for file := range embeddings {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		ix.addFile(file, checksums[file], embeddings[file])
+	}
+	return ix
+}
+
+func loadANNIndex(indexFilePath string) (*annIndex, error) {
+	ix := &annIndex{}
+	if err := utils.LoadMsgPackFile(indexFilePath, ix); err != nil {
+		return nil, err
+	}
+	if ix.Version != annIndexVersion {
+		return nil, fmt.Errorf("unsupported embeddings index version: %d", ix.Version)
+	}
+	if ix.Checksums == nil {
+		ix.Checksums = map[string]string{}
+	}
+	ix.rng = rand.New(rand.NewPCG(uint64(len(ix.Nodes)), 1))
+	return ix, nil
+}
+
+// updateANNIndex brings the index in sync with the embeddings saved by the embed operation. Existing index is updated
+// incrementally, when it was built for the embeddings file state provided by oldEmbeddingsStamp and rebuild is not requested.
+// Must be called with exclusive lock on embeddings held
+func updateANNIndex(
+	perpetualDir string,
+	oldEmbeddingsStamp string,
+	embeddings map[string][][]float32,
+	checksums map[string]string,
+	embeddedFiles []string,
+	vectorDimensions int,
+	rebuild bool,
+	logger logging.ILogger) {
+
+	indexFilePath := filepath.Join(perpetualDir, utils.EmbeddingsIndexFileName)
+	embeddingsFilePath := filepath.Join(perpetualDir, utils.EmbeddingsFileName)
+
+	// Embeddings in the same state as saved to embeddings file
+	savedEmbeddings := make(map[string][][]float32)
+	vectorCount := 0
+	for file, checksum := range checksums {
+		if vectors, ok := embeddings[file]; ok && checksum != "error" {
+			savedEmbeddings[file] = vectors
+			vectorCount += len(vectors)
+		}
+	}
+	if vectorCount < annIndexMinVectors || vectorDimensions < 1 {
+		logger.Debugln("Embeddings index is not needed, vector count:", vectorCount)
+		if err := utils.RemoveFile(indexFilePath); err != nil {
+			logger.Warnln("Failed to remove embeddings index:", err)
+		}
+		return
+	}
+
+	embeddedSet := make(map[string]bool)
+	for _, file := range embeddedFiles {
+		embeddedSet[file] = true
+	}
+	var ix *annIndex
+	var filesToRemove []string
+	if !rebuild {
+		if loaded, err := loadANNIndex(indexFilePath); err != nil {
+			logger.Debugln("Failed to load embeddings index:", err)
+		} else if loaded.EmbeddingsStamp != oldEmbeddingsStamp || loaded.Dimensions != vectorDimensions {
+			logger.Debugln("Embeddings index is outdated")
+		} else {
+			for file, checksum := range loaded.Checksums {
+				if newChecksum, ok := checksums[file]; !ok || newChecksum != checksum || embeddedSet[file] || savedEmbeddings[file] == nil {
+					filesToRemove = append(filesToRemove, file)
+				}
+			}
+			sort.Strings(filesToRemove)
+			// Vectors of the files to remove are already replaced or deleted from embeddings
+			if err := loaded.attachVectors(savedEmbeddings, filesToRemove); err != nil {
+				logger.Debugln("Failed to use embeddings index:", err)
+			} else {
+				ix = loaded
+			}
+		}
+	}
+
+	changed := false
+	if ix != nil {
+		var filesToAdd []string
+		for file := range savedEmbeddings {
+			if oldChecksum, ok := ix.Checksums[file]; !ok || oldChecksum != checksums[file] || embeddedSet[file] {
+				filesToAdd = append(filesToAdd, file)
+			}
+		}
+		sort.Strings(filesToAdd)
+		ix.removeFiles(filesToRemove)
+		if ix.removedPercent() > annIndexMaxRemovedPercent {
+			logger.Debugf("Too many nodes removed from embeddings index: %0.1f%%", ix.removedPercent())
+			ix = nil
+		} else {
+			for _, file := range filesToAdd {
+				ix.addFile(file, checksums[file], savedEmbeddings[file])
+			}
+			changed = len(filesToRemove) > 0 || len(filesToAdd) > 0
+			if changed {
+				logger.Infof("Updating embeddings index, files removed: %d, added: %d", len(filesToRemove), len(filesToAdd))
+			}
+		}
+	}
+	if ix == nil {
+		logger.Infoln("Building embeddings index, vector count:", vectorCount)
+		ix = buildANNIndex(savedEmbeddings, checksums, vectorDimensions)
+		changed = true
+	}
+
+	newEmbeddingsStamp := getEmbeddingsStamp(embeddingsFilePath)
+	if !changed && ix.EmbeddingsStamp == newEmbeddingsStamp {
+		logger.Debugln("Embeddings index unchanged")
+		return
+	}
+	ix.EmbeddingsStamp = newEmbeddingsStamp
+	if err := utils.SaveMsgPackFile(indexFilePath, ix); err != nil {
+		logger.Panicln("Failed to save embeddings index:", err)
+	}
+}
+
+// annSimilaritySearch performs similarity search with embeddings index, returns nil if index is missing or outdated,
+// or when it cannot provide requested number of files for every search vector, so exact search must be used instead.
+// Vectors of all indexed files are loaded, not only sourceFiles, because graph traversal may pass through any node.
+// Must be called with lock on embeddings held
+func annSimilaritySearch(perpetualDir string, searchVectors [][]float32, sourceFiles []string, filesPerVector int, logger logging.ILogger) []map[string]float32 {
+	ix, err := loadANNIndex(filepath.Join(perpetualDir, utils.EmbeddingsIndexFileName))
+	if err != nil {
+		logger.Traceln("Embeddings index not available:", err)
+		return nil
+	}
+	if ix.EmbeddingsStamp != getEmbeddingsStamp(filepath.Join(perpetualDir, utils.EmbeddingsFileName)) {
+		logger.Debugln("Embeddings index is outdated, using exact similarity search")
+		return nil
+	}
+	for _, vector := range searchVectors {
+		if len(vector) != ix.Dimensions {
+			logger.Debugln("Search vector dimensions do not match embeddings index, using exact similarity search")
+			return nil
+		}
+	}
+	ef := max(hnswEfSearch, filesPerVector*annCandidatesPerFile)
+	if ef >= len(ix.Nodes)/2 {
+		logger.Debugln("Too many results requested for embeddings index, using exact similarity search")
+		return nil
+	}
+	indexFiles := make([]string, 0, len(ix.Checksums))
+	for file := range ix.Checksums {
+		indexFiles = append(indexFiles, file)
+	}
+	embeddings, _, _, err := utils.GetEmbeddings(filepath.Join(perpetualDir, utils.EmbeddingsFileName), indexFiles)
+	if err == nil {
+		err = ix.attachVectors(embeddings, nil)
+	}
+	if err != nil {
+		logger.Debugln("Failed to use embeddings index, using exact similarity search:", err)
+		return nil
+	}
+	sourceFilesSet := make(map[string]bool, len(sourceFiles))
+	for _, file := range sourceFiles {
+		sourceFilesSet[file] = true
+	}
+	acceptFile := func(file string) bool { return sourceFilesSet[file] }
+	logger.Debugln("Performing local similarity search with embeddings index")
+	var results []map[string]float32
+	for _, vector := range searchVectors {
+		scores := ix.search(vector, ef, acceptFile)
+		if len(scores) < filesPerVector && len(scores) < len(ix.Checksums) {
+			logger.Debugln("Embeddings index returned too few files, using exact similarity search")
+			return nil
+		}
+		results = append(results, scores)
+	}
+	return results
+}
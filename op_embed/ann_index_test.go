@@ -0,0 +1,256 @@
+package op_embed
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// generateTestEmbeddings creates clustered random vectors, so the data resembles real embeddings
+func generateTestEmbeddings(rng *rand.Rand, fileCount, vectorsPerFile, dimensions int) map[string][][]float32 {
+	centers := make([][]float32, 20)
+	for i := range centers {
+		centers[i] = make([]float32, dimensions)
+		for d := range centers[i] {
+			centers[i][d] = float32(rng.NormFloat64())
+		}
+	}
+	embeddings := make(map[string][][]float32)
+	for f := 0; f < fileCount; f++ {
+		center := centers[rng.IntN(len(centers))]
+		for v := 0; v < vectorsPerFile; v++ {
+			vector := make([]float32, dimensions)
+			for d := range vector {
+				vector[d] = center[d] + float32(rng.NormFloat64())*0.7
+			}
+			embeddings[fmt.Sprintf("dir/file%04d.go", f)] = append(embeddings[fmt.Sprintf("dir/file%04d.go", f)], vector)
+		}
+	}
+	return embeddings
+}
+
+func generateTestChecksums(embeddings map[string][][]float32) map[string]string {
+	checksums := make(map[string]string)
+	for file := range embeddings {
+		checksums[file] = "sum:" + file
+	}
+	return checksums
+}
+
+func acceptAllFiles(file string) bool { return true }
+
+func TestANNIndexRecall(t *testing.T) {
+	rng := rand.New(rand.NewPCG(42, 42))
+	embeddings := generateTestEmbeddings(rng, 1500, 2, 32)
+	ix := buildANNIndex(embeddings, generateTestChecksums(embeddings), 32)
+
+	const topN = 10
+	queries := 50
+	found := 0
+	for q := 0; q < queries; q++ {
+		query := make([]float32, 32)
+		for d := range query {
+			query[d] = float32(rng.NormFloat64())
+		}
+		exact := sortFilesByScore(similaritySearch([][]float32{query}, embeddings)[0])[:topN]
+		approx := ix.search(query, hnswEfSearch, acceptAllFiles)
+		for _, file := range exact {
+			if _, ok := approx[file]; ok {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(queries*topN); recall < 0.9 {
+		t.Errorf("ANN index recall is too low: %f", recall)
+	}
+}
+
+func TestANNIndexRemoveAndFilter(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	embeddings := generateTestEmbeddings(rng, 300, 1, 16)
+	ix := buildANNIndex(embeddings, generateTestChecksums(embeddings), 16)
+
+	query := embeddings["dir/file0007.go"][0]
+	if scores := ix.search(query, hnswEfSearch, acceptAllFiles); len(scores) < 1 || sortFilesByScore(scores)[0] != "dir/file0007.go" {
+		t.Fatalf("nearest file is not found: %v", sortFilesByScore(scores))
+	}
+
+	ix.removeFiles([]string{"dir/file0007.go"})
+	if _, ok := ix.search(query, hnswEfSearch, acceptAllFiles)["dir/file0007.go"]; ok {
+		t.Errorf("removed file returned by search")
+	}
+	if ix.RemovedCount != 1 || len(ix.Nodes) != 299 || len(ix.vectors) != 299 || ix.Checksums["dir/file0007.go"] != "" {
+		t.Errorf("unexpected index state after removal: removed %d, nodes %d", ix.RemovedCount, len(ix.Nodes))
+	}
+	for id, node := range ix.Nodes {
+		for _, links := range node.Neighbors {
+			for _, link := range links {
+				if link < 0 || int(link) >= len(ix.Nodes) || int(link) == id || ix.Nodes[link].File == "dir/file0007.go" {
+					t.Fatalf("invalid link of node %d: %d", id, link)
+				}
+			}
+		}
+	}
+
+	// Re-added file is found again with the new vector
+	ix.addFile("dir/file0007.go", "new-sum", [][]float32{embeddings["dir/file0100.go"][0]})
+	scores := ix.search(embeddings["dir/file0100.go"][0], hnswEfSearch, acceptAllFiles)
+	if _, ok := scores["dir/file0007.go"]; !ok {
+		t.Errorf("re-added file is not found")
+	}
+
+	// Filtered-out files are not returned
+	scores = ix.search(query, hnswEfSearch, func(file string) bool { return file != "dir/file0100.go" })
+	if _, ok := scores["dir/file0100.go"]; ok {
+		t.Errorf("filtered-out file returned by search")
+	}
+}
+
+func TestANNIndexRecallAfterRemoval(t *testing.T) {
+	rng := rand.New(rand.NewPCG(7, 8))
+	embeddings := generateTestEmbeddings(rng, 1500, 1, 32)
+	ix := buildANNIndex(embeddings, generateTestChecksums(embeddings), 32)
+	var filesToRemove []string
+	for file := range embeddings {
+		if rng.IntN(4) == 0 {
+			filesToRemove = append(filesToRemove, file)
+		}
+	}
+	ix.removeFiles(filesToRemove)
+	for _, file := range filesToRemove {
+		delete(embeddings, file)
+	}
+
+	const topN = 10
+	queries := 50
+	found := 0
+	for q := 0; q < queries; q++ {
+		query := make([]float32, 32)
+		for d := range query {
+			query[d] = float32(rng.NormFloat64())
+		}
+		exact := sortFilesByScore(similaritySearch([][]float32{query}, embeddings)[0])[:topN]
+		approx := ix.search(query, hnswEfSearch, acceptAllFiles)
+		for _, file := range exact {
+			if _, ok := approx[file]; ok {
+				found++
+			}
+		}
+	}
+	if recall := float64(found) / float64(queries*topN); recall < 0.9 {
+		t.Errorf("ANN index recall after removal is too low: %f", recall)
+	}
+}
+
+func TestANNIndexSaveLoad(t *testing.T) {
+	rng := rand.New(rand.NewPCG(3, 4))
+	embeddings := generateTestEmbeddings(rng, 50, 2, 8)
+	ix := buildANNIndex(embeddings, generateTestChecksums(embeddings), 8)
+	ix.removeFiles([]string{"dir/file0001.go"})
+	ix.EmbeddingsStamp = "stamp"
+
+	indexFilePath := filepath.Join(t.TempDir(), utils.EmbeddingsIndexFileName)
+	if err := utils.SaveMsgPackFile(indexFilePath, ix); err != nil {
+		t.Fatalf("failed to save index: %v", err)
+	}
+	loaded, err := loadANNIndex(indexFilePath)
+	if err != nil {
+		t.Fatalf("failed to load index: %v", err)
+	}
+	if err := loaded.attachVectors(embeddings, nil); err != nil {
+		t.Fatalf("failed to attach vectors: %v", err)
+	}
+	// Vectors are not stored in the index, so index does not match embeddings with missing vectors
+	if err := loaded.attachVectors(map[string][][]float32{}, nil); err == nil {
+		t.Errorf("index attached to missing vectors")
+	}
+	if err := loaded.attachVectors(embeddings, nil); err != nil {
+		t.Fatal(err)
+	}
+	query := embeddings["dir/file0002.go"][0]
+	if !reflect.DeepEqual(ix.search(query, 20, acceptAllFiles), loaded.search(query, 20, acceptAllFiles)) {
+		t.Errorf("loaded index returns different results")
+	}
+	if loaded.EmbeddingsStamp != "stamp" || loaded.RemovedCount != ix.RemovedCount || !reflect.DeepEqual(loaded.Checksums, ix.Checksums) {
+		t.Errorf("loaded index state differs")
+	}
+}
+
+func TestUpdateANNIndex(t *testing.T) {
+	logger, err := logging.NewSimpleLogger(logging.ErrorLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	perpetualDir := t.TempDir()
+	embeddingsFilePath := filepath.Join(perpetualDir, utils.EmbeddingsFileName)
+	indexFilePath := filepath.Join(perpetualDir, utils.EmbeddingsIndexFileName)
+	rng := rand.New(rand.NewPCG(5, 6))
+	embeddings := generateTestEmbeddings(rng, annIndexMinVectors+10, 1, 8)
+	checksums := generateTestChecksums(embeddings)
+
+	save := func() string {
+		oldStamp := getEmbeddingsStamp(embeddingsFilePath)
+		if err := utils.SaveEmbeddings(embeddingsFilePath, checksums, embeddings, nil); err != nil {
+			t.Fatal(err)
+		}
+		// Make sure modification time changes on file systems with coarse timestamps
+		modTime := time.Now().Add(time.Duration(rng.IntN(1000000)+1) * time.Second)
+		if err := os.Chtimes(embeddingsFilePath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		return oldStamp
+	}
+
+	oldStamp := save()
+	updateANNIndex(perpetualDir, oldStamp, embeddings, checksums, nil, 8, false, logger)
+	ix, err := loadANNIndex(indexFilePath)
+	if err != nil {
+		t.Fatalf("index is not created: %v", err)
+	}
+	if ix.EmbeddingsStamp != getEmbeddingsStamp(embeddingsFilePath) || len(ix.Checksums) != annIndexMinVectors+10 {
+		t.Fatalf("unexpected index state: stamp %s, files %d", ix.EmbeddingsStamp, len(ix.Checksums))
+	}
+
+	// Incremental update
+	embeddings["dir/file0003.go"] = [][]float32{{1, 0, 0, 0, 0, 0, 0, 0}}
+	checksums["dir/file0003.go"] = "changed"
+	delete(embeddings, "dir/file0004.go")
+	delete(checksums, "dir/file0004.go")
+	oldStamp = save()
+	updateANNIndex(perpetualDir, oldStamp, embeddings, checksums, []string{"dir/file0003.go"}, 8, false, logger)
+	ix, err = loadANNIndex(indexFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ix.RemovedCount != 2 || len(ix.Nodes) != annIndexMinVectors+9 || ix.Checksums["dir/file0003.go"] != "changed" || ix.Checksums["dir/file0004.go"] != "" {
+		t.Errorf("unexpected index state after update: removed %d, nodes %d", ix.RemovedCount, len(ix.Nodes))
+	}
+	results := annSimilaritySearch(perpetualDir, [][]float32{{1, 0, 0, 0, 0, 0, 0, 0}}, []string{"dir/file0003.go"}, 1, logger)
+	if len(results) != 1 || results[0]["dir/file0003.go"] < 0.99 {
+		t.Errorf("updated file is not found: %v", results)
+	}
+
+	// Index not matching embeddings file is not used
+	oldStamp = save()
+	if results := annSimilaritySearch(perpetualDir, [][]float32{{1, 0, 0, 0, 0, 0, 0, 0}}, []string{"dir/file0003.go"}, 1, logger); results != nil {
+		t.Errorf("outdated index used for search")
+	}
+
+	// Index is removed when there are not enough vectors
+	for file := range embeddings {
+		if file != "dir/file0003.go" {
+			delete(embeddings, file)
+		}
+	}
+	updateANNIndex(perpetualDir, oldStamp, embeddings, checksums, nil, 8, false, logger)
+	if _, err := os.Stat(indexFilePath); !os.IsNotExist(err) {
+		t.Errorf("index is not removed for small embeddings")
+	}
+}
@@ -0,0 +1,137 @@
+package op_embed
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// Number of best matching chunks reported for each file found by query
+const chunkMatchesPerFile = 3
+
+// Snippets of large chunks are cut to this number of lines
+const chunkSnippetMaxLines = 20
+
+type ChunkMatch struct {
+	StartLine int     `json:"start_line"`
+	EndLine   int     `json:"end_line"`
+	Score     float32 `json:"score"`
+	Snippet   string  `json:"snippet"`
+}
+
+type FileMatch struct {
+	File   string       `json:"file"`
+	Score  float32      `json:"score"`
+	Chunks []ChunkMatch `json:"chunks"`
+}
+
+// matchFileChunks scores each chunk of the file against search vectors, and returns up to maxChunks best matching chunks
+// sorted by score. Chunks are only returned when their line ranges are known
+func matchFileChunks(searchVectors [][]float32, fileVectors [][]float32, chunkLines [][2]int, maxChunks int) (float32, []ChunkMatch) {
+	var fileScore float32
+	fileFound := false
+	chunks := []ChunkMatch{}
+	for i, fileVector := range fileVectors {
+		found := false
+		var chunkScore float32
+		for _, searchVector := range searchVectors {
+			if score, ok := cosineSearch(searchVector, fileVector); ok && (!found || score > chunkScore) {
+				chunkScore = score
+				found = true
+			}
+		}
+		if !found {
+			continue
+		}
+		if !fileFound || chunkScore > fileScore {
+			fileScore = chunkScore
+			fileFound = true
+		}
+		if len(chunkLines) == len(fileVectors) {
+			chunks = append(chunks, ChunkMatch{StartLine: chunkLines[i][0], EndLine: chunkLines[i][1], Score: chunkScore})
+		}
+	}
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].Score > chunks[j].Score
+	})
+	if len(chunks) > maxChunks {
+		chunks = chunks[:maxChunks]
+	}
+	return fileScore, chunks
+}
+
+// getSnippet returns text of the lines from startLine to endLine (1-based, inclusive), limited to maxLines
+func getSnippet(lines []string, startLine, endLine, maxLines int) string {
+	start := min(max(startLine-1, 0), len(lines))
+	end := min(max(endLine, start), len(lines), start+maxLines)
+	var snippet []string
+	for _, line := range lines[start:end] {
+		snippet = append(snippet, strings.TrimSuffix(line, "\r"))
+	}
+	return strings.Join(snippet, "\n")
+}
+
+// GetChunkMatches finds best matching chunks of the files selected by similarity search for the query,
+// results for files are returned in the same order as requested files
+func GetChunkMatches(projectRootDir, perpetualDir, query string, files []string, logger logging.ILogger) []FileMatch {
+	result := make([]FileMatch, len(files))
+	for i, file := range files {
+		result[i] = FileMatch{File: file, Chunks: []ChunkMatch{}}
+	}
+	if len(files) < 1 {
+		return result
+	}
+
+	// Query vectors are normally taken from cache populated by preceding similarity search
+	searchVectors, _, err := generateEmbeddings("question", query, logger)
+	if err != nil {
+		logger.Errorln("Failed to generate embeddings for search query:", err)
+		return result
+	}
+
+	unlockEmbeddings := utils.LockProjectResource(perpetualDir, utils.LockResourceEmbeddings, false, logger)
+	embeddingsFilePath := filepath.Join(perpetualDir, utils.EmbeddingsFileName)
+	embeddings, _, _, err := utils.GetEmbeddings(embeddingsFilePath, files)
+	var chunkLines map[string][][2]int
+	if err == nil {
+		chunkLines, err = utils.GetEmbeddingsChunkLines(embeddingsFilePath, files)
+	}
+	unlockEmbeddings()
+	if err != nil {
+		logger.Panicln("Failed to load embeddings:", err)
+	}
+
+	for i, file := range files {
+		vectors, ok := embeddings[file]
+		if !ok {
+			logger.Debugln("No embeddings for file:", file)
+			continue
+		}
+		lines, ok := chunkLines[file]
+		if !ok {
+			logger.Debugln("No chunk line ranges for file, run embed operation with '-m full' flag to create them:", file)
+		}
+		result[i].Score, result[i].Chunks = matchFileChunks(searchVectors, vectors, lines, chunkMatchesPerFile)
+		if len(result[i].Chunks) < 1 {
+			continue
+		}
+		fileContents, _, err := utils.LoadTextFile(filepath.Join(projectRootDir, file))
+		if err != nil {
+			logger.Errorf("Failed to read file %s: %s", file, err)
+			continue
+		}
+		fileLines := strings.Split(fileContents, "\n")
+		for j := range result[i].Chunks {
+			chunk := &result[i].Chunks[j]
+			// Line ranges refer to the original file contents and cover whole secrets, text of the whole chunk is redacted
+			// before the snippet is cut, so secrets crossing the snippet line limit are redacted too
+			chunkText, _ := llm.RedactSecrets(getSnippet(fileLines, chunk.StartLine, chunk.EndLine, chunk.EndLine-chunk.StartLine+1))
+			chunk.Snippet = getSnippet(strings.Split(chunkText, "\n"), 1, chunkSnippetMaxLines, chunkSnippetMaxLines)
+		}
+	}
+	return result
+}
@@ -0,0 +1,36 @@
+package op_embed
+
+import (
+	"testing"
+)
+
+func TestMatchFileChunks(t *testing.T) {
+	searchVectors := [][]float32{{1, 0}}
+	fileVectors := [][]float32{{0, 1}, {1, 0}, {1, 1}, {-1, 0}}
+	chunkLines := [][2]int{{1, 10}, {8, 20}, {18, 30}, {28, 35}}
+	score, chunks := matchFileChunks(searchVectors, fileVectors, chunkLines, 2)
+	if score < 0.999 {
+		t.Errorf("Unexpected file score: %f", score)
+	}
+	if len(chunks) != 2 || chunks[0].StartLine != 8 || chunks[0].EndLine != 20 || chunks[1].StartLine != 18 {
+		t.Errorf("Unexpected chunks: %v", chunks)
+	}
+	// Without line ranges only file score is available
+	score, chunks = matchFileChunks(searchVectors, fileVectors, nil, 2)
+	if score < 0.999 || len(chunks) != 0 {
+		t.Errorf("Unexpected result without line ranges: %f, %v", score, chunks)
+	}
+}
+
+func TestGetSnippet(t *testing.T) {
+	lines := []string{"one\r", "two", "three", "four"}
+	if snippet := getSnippet(lines, 1, 3, 10); snippet != "one\ntwo\nthree" {
+		t.Errorf("Unexpected snippet: %q", snippet)
+	}
+	if snippet := getSnippet(lines, 2, 4, 2); snippet != "two\nthree" {
+		t.Errorf("Unexpected limited snippet: %q", snippet)
+	}
+	if snippet := getSnippet(lines, 4, 10, 10); snippet != "four" {
+		t.Errorf("Unexpected snippet for range past the end: %q", snippet)
+	}
+}
@@ -0,0 +1,248 @@
+package op_embed
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// Keyword index for lexical search with BM25 ranking over file contents and annotations.
+// Embeddings often miss exact identifiers, error strings or config keys mentioned in a query,
+// so keyword search results are fused with similarity search results using reciprocal rank fusion
+
+const keywordIndexVersion = 1
+
+// BM25 parameters
+const bm25K1 = 1.2
+const bm25B = 0.75
+
+// Rank constant for reciprocal rank fusion, the usual value from the original RRF paper
+const rrfK = 60
+
+// Files found only by keyword search are considered only if ranked high enough,
+// and when their score is close enough to the best keyword search score for the query
+const keywordSearchMaxRank = 10
+const keywordSearchMinRelativeScore = 0.5
+
+type keywordDocument struct {
+	Checksum string         `msgpack:"checksum"`
+	Length   int            `msgpack:"length"`
+	Terms    map[string]int `msgpack:"terms"`
+}
+
+type keywordIndex struct {
+	Version   int                        `msgpack:"version"`
+	Documents map[string]keywordDocument `msgpack:"documents"`
+}
+
+func newKeywordDocument(checksum, text string) keywordDocument {
+	terms := utils.TokenizeKeywords(text)
+	document := keywordDocument{Checksum: checksum, Length: len(terms), Terms: make(map[string]int)}
+	for _, term := range terms {
+		document.Terms[term]++
+	}
+	return document
+}
+
+// getKeywordsChecksum calculates checksum of the index entry from the file checksum and the annotation,
+// so the entry is updated when either of them changes
+func getKeywordsChecksum(fileChecksum, annotation string) string {
+	hash := sha256.Sum256([]byte(fileChecksum + "\x00" + annotation))
+	return hex.EncodeToString(hash[:])
+}
+
+func loadKeywordIndex(indexFilePath string) (*keywordIndex, error) {
+	ix := &keywordIndex{}
+	if err := utils.LoadMsgPackFile(indexFilePath, ix); err != nil {
+		return nil, err
+	}
+	if ix.Version != keywordIndexVersion {
+		return nil, fmt.Errorf("unsupported keyword index version: %d", ix.Version)
+	}
+	if ix.Documents == nil {
+		ix.Documents = map[string]keywordDocument{}
+	}
+	return ix, nil
+}
+
+// updateKeywordIndex updates index entries for project files with changed contents or annotations,
+// and removes entries of files no longer in the project. Must be called with exclusive lock on embeddings held
+func updateKeywordIndex(
+	projectRootDir string,
+	perpetualDir string,
+	fileNames []string,
+	fileChecksums map[string]string,
+	annotations map[string]string,
+	rebuild bool,
+	logger logging.ILogger) {
+
+	indexFilePath := filepath.Join(perpetualDir, utils.KeywordsIndexFileName)
+	ix, err := loadKeywordIndex(indexFilePath)
+	if err != nil || rebuild {
+		if err != nil {
+			logger.Debugln("Failed to load keyword index:", err)
+		}
+		ix = &keywordIndex{Version: keywordIndexVersion, Documents: map[string]keywordDocument{}}
+	}
+
+	changed := false
+	fileNamesSet := make(map[string]bool, len(fileNames))
+	for _, file := range fileNames {
+		fileNamesSet[file] = true
+		checksum := getKeywordsChecksum(fileChecksums[file], annotations[file])
+		if document, ok := ix.Documents[file]; ok && document.Checksum == checksum {
+			continue
+		}
+		fileContents, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, file))
+		if err != nil {
+			logger.Errorf("Failed to read file %s: %s", file, err)
+			delete(ix.Documents, file)
+			changed = true
+			continue
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", file, wrn)
+		}
+		// Index is not sent anywhere, but secrets must not be stored outside of the source files anyway
+		fileContents, _ = llm.RedactSecrets(fileContents)
+		ix.Documents[file] = newKeywordDocument(checksum, fileContents+"\n"+annotations[file])
+		logger.Traceln("Updated keyword index for file:", file)
+		changed = true
+	}
+	for file := range ix.Documents {
+		if !fileNamesSet[file] {
+			delete(ix.Documents, file)
+			changed = true
+		}
+	}
+
+	if !changed {
+		logger.Debugln("Keyword index unchanged")
+		return
+	}
+	logger.Debugln("Saving keyword index, file count:", len(ix.Documents))
+	if err := utils.SaveMsgPackFile(indexFilePath, ix); err != nil {
+		logger.Panicln("Failed to save keyword index:", err)
+	}
+}
+
+// search returns BM25 scores of source files matching the query, statistics are calculated only for source files
+func (ix *keywordIndex) search(queries []string, sourceFiles []string) []map[string]float32 {
+	var documents []keywordDocument
+	var files []string
+	totalLength := 0
+	for _, file := range sourceFiles {
+		if document, ok := ix.Documents[file]; ok {
+			documents = append(documents, document)
+			files = append(files, file)
+			totalLength += document.Length
+		}
+	}
+	results := make([]map[string]float32, len(queries))
+	if len(documents) < 1 {
+		for i := range results {
+			results[i] = map[string]float32{}
+		}
+		return results
+	}
+	avgLength := math.Max(float64(totalLength)/float64(len(documents)), 1)
+	for q, query := range queries {
+		scores := make(map[string]float32)
+		queryTerms := make(map[string]bool)
+		for _, term := range utils.TokenizeKeywords(query) {
+			queryTerms[term] = true
+		}
+		for term := range queryTerms {
+			documentFrequency := 0
+			for _, document := range documents {
+				if document.Terms[term] > 0 {
+					documentFrequency++
+				}
+			}
+			if documentFrequency < 1 {
+				continue
+			}
+			idf := math.Log(1 + (float64(len(documents)-documentFrequency)+0.5)/(float64(documentFrequency)+0.5))
+			for i, document := range documents {
+				termFrequency := float64(document.Terms[term])
+				if termFrequency == 0 {
+					continue
+				}
+				norm := bm25K1 * (1 - bm25B + bm25B*float64(document.Length)/avgLength)
+				scores[files[i]] += float32(idf * termFrequency * (bm25K1 + 1) / (termFrequency + norm))
+			}
+		}
+		results[q] = scores
+	}
+	return results
+}
+
+func rankFilesByScore(scores map[string]float32) map[string]int {
+	sorted := make([]string, 0, len(scores))
+	for file := range scores {
+		sorted = append(sorted, file)
+	}
+	// Sort by name on equal scores to make ranks reproducible
+	sort.Slice(sorted, func(i, j int) bool {
+		if scores[sorted[i]] != scores[sorted[j]] {
+			return scores[sorted[i]] > scores[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	ranks := make(map[string]int, len(sorted))
+	for i, file := range sorted {
+		ranks[file] = i
+	}
+	return ranks
+}
+
+// fuseSearchResults combines similarity search and keyword search scores with reciprocal rank fusion.
+// Result includes files with similarity score not lower than the threshold, and files ranked high by keyword search.
+// Fused scores are always positive
+func fuseSearchResults(similarityScores, keywordScores map[string]float32, similarityThreshold float32) map[string]float32 {
+	similarityRanks := rankFilesByScore(similarityScores)
+	keywordRanks := rankFilesByScore(keywordScores)
+	var bestKeywordScore float32
+	for _, score := range keywordScores {
+		bestKeywordScore = max(bestKeywordScore, score)
+	}
+	result := make(map[string]float32)
+	for file, score := range similarityScores {
+		if score >= similarityThreshold {
+			result[file] = 0
+		}
+	}
+	for file, score := range keywordScores {
+		if keywordRanks[file] < keywordSearchMaxRank && score > 0 && score >= bestKeywordScore*keywordSearchMinRelativeScore {
+			result[file] = 0
+		}
+	}
+	for file := range result {
+		if rank, ok := similarityRanks[file]; ok {
+			result[file] += 1 / float32(rrfK+rank+1)
+		}
+		if rank, ok := keywordRanks[file]; ok {
+			result[file] += 1 / float32(rrfK+rank+1)
+		}
+	}
+	return result
+}
+
+// keywordSimilaritySearch performs keyword search for the queries, returns nil if keyword index is not available.
+// Must be called with lock on embeddings held
+func keywordSimilaritySearch(perpetualDir string, queries []string, sourceFiles []string, logger logging.ILogger) []map[string]float32 {
+	ix, err := loadKeywordIndex(filepath.Join(perpetualDir, utils.KeywordsIndexFileName))
+	if err != nil {
+		logger.Debugln("Keyword index not available:", err)
+		return nil
+	}
+	logger.Debugln("Performing local keyword search")
+	return ix.search(queries, sourceFiles)
+}
@@ -0,0 +1,92 @@
+package op_embed
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func TestKeywordIndexSearch(t *testing.T) {
+	ix := &keywordIndex{Version: keywordIndexVersion, Documents: map[string]keywordDocument{
+		"config.go":  newKeywordDocument("1", "func LoadProjectConfig() { panic(\"invalid project_files_whitelist value\") }"),
+		"project.go": newKeywordDocument("2", "project files and project settings, project helpers"),
+		"main.go":    newKeywordDocument("3", "func main() { run the program }"),
+		"other.go":   newKeywordDocument("4", "invalid value"),
+	}}
+	results := ix.search([]string{"Why do I get 'invalid project_files_whitelist value' error?", "nothing matches"}, []string{"config.go", "project.go", "main.go"})
+	if len(results) != 2 {
+		t.Fatalf("unexpected result count: %d", len(results))
+	}
+	if ranked := sortFilesByScore(results[0]); len(ranked) < 2 || ranked[0] != "config.go" {
+		t.Errorf("unexpected ranking: %v", results[0])
+	}
+	if _, ok := results[0]["other.go"]; ok {
+		t.Errorf("file not in source files returned")
+	}
+	if len(results[1]) != 0 {
+		t.Errorf("unexpected results for unrelated query: %v", results[1])
+	}
+}
+
+func TestFuseSearchResults(t *testing.T) {
+	similarityScores := map[string]float32{"a.go": 0.9, "b.go": 0.8, "c.go": 0.3, "d.go": 0.2}
+	keywordScores := map[string]float32{"d.go": 10, "b.go": 8, "c.go": 1}
+	fused := fuseSearchResults(similarityScores, keywordScores, 0.5)
+	// c.go passes neither similarity threshold nor keyword relative score
+	if _, ok := fused["c.go"]; ok || len(fused) != 3 {
+		t.Errorf("unexpected fused files: %v", fused)
+	}
+	if ranked := sortFilesByScore(fused); !reflect.DeepEqual(ranked, []string{"b.go", "d.go", "a.go"}) {
+		t.Errorf("unexpected fused ranking: %v (%v)", ranked, fused)
+	}
+	for file, score := range fused {
+		if score <= 0 {
+			t.Errorf("non-positive fused score for %s: %f", file, score)
+		}
+	}
+}
+
+func TestUpdateKeywordIndex(t *testing.T) {
+	logger, err := logging.NewSimpleLogger(logging.ErrorLevel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projectRootDir := t.TempDir()
+	perpetualDir := t.TempDir()
+	files := map[string]string{"a.go": "func LoadConfig() {}", "b.go": "func SaveState() {}"}
+	for file, contents := range files {
+		if err := os.WriteFile(filepath.Join(projectRootDir, file), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fileNames := []string{"a.go", "b.go"}
+	checksums := map[string]string{"a.go": "sum-a", "b.go": "sum-b"}
+	annotations := map[string]string{"a.go": "Loads settings"}
+
+	updateKeywordIndex(projectRootDir, perpetualDir, fileNames, checksums, annotations, false, logger)
+	ix, err := loadKeywordIndex(filepath.Join(perpetualDir, utils.KeywordsIndexFileName))
+	if err != nil {
+		t.Fatalf("keyword index is not created: %v", err)
+	}
+	if ix.Documents["a.go"].Terms["settings"] != 1 || ix.Documents["b.go"].Terms["savestate"] != 1 {
+		t.Errorf("unexpected index documents: %v", ix.Documents)
+	}
+
+	// Changed annotation updates the entry with current file contents, removed file is dropped
+	if err := os.WriteFile(filepath.Join(projectRootDir, "a.go"), []byte("func Other() {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	annotations["a.go"] = "Loads options"
+	updateKeywordIndex(projectRootDir, perpetualDir, []string{"a.go"}, checksums, annotations, false, logger)
+	ix, err = loadKeywordIndex(filepath.Join(perpetualDir, utils.KeywordsIndexFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ix.Documents["b.go"]; ok || ix.Documents["a.go"].Terms["options"] != 1 || ix.Documents["a.go"].Terms["other"] != 1 {
+		t.Errorf("unexpected index documents after update: %v", ix.Documents)
+	}
+}
@@ -1,6 +1,7 @@
 package op_embed
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -25,7 +26,7 @@ func embedFlags() *flag.FlagSet {
 }
 
 func Run(args []string, innerCall bool, logger logging.ILogger) {
-	var help, verbose, trace, excludeTests bool
+	var help, verbose, trace, excludeTests, showRegions, jsonOutput bool
 	var inputFile, userFilterFile, mode string
 	var searchLimit int
 
@@ -39,6 +40,8 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	flags.StringVar(&inputFile, "i", "", "Input file. For normal|dryrun|full modes: forcefully (re)embed a single project file.\n"+
 		"For query mode: path to any text/markdown file with the question, or '-' to read the question from stdin")
 	flags.IntVar(&searchLimit, "s", 5, "Limit on the number of files returned that are relevant to the question")
+	flags.BoolVar(&showRegions, "r", false, "For query mode: also print best matching regions of the files with line ranges and snippets")
+	flags.BoolVar(&jsonOutput, "j", false, "For query mode: print results in JSON format, including best matching regions of the files")
 	flags.BoolVar(&excludeTests, "u", false, "Exclude unit-tests source files from processing with '-m query' (unit-tests are included by default)")
 	flags.StringVar(&userFilterFile, "x", "", "Path to user-supplied regex filter-file for filtering out certain files from processing")
 	flags.BoolVar(&verbose, "v", false, "Enable debug logging")
@@ -100,6 +103,8 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	}
 
 	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	// Hide secrets in file contents sent to LLM
+	llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 
 	// Create llm connector for generating embeddings early
 	// So we can stop right here if embeddings not supported or disabled
@@ -184,7 +189,24 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		logger.Panicln("Error getting project-files checksums:", err)
 	}
 
+	// Annotations are indexed for keyword search together with file contents
+	var annotations map[string]string
+	if !dryRun {
+		unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
+		annotations, err = utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
+		unlockAnnotations()
+		if err != nil {
+			logger.Panicln("Error reading annotations:", err)
+		}
+	}
+
+	// Embeddings are updated by this operation, other operations must not read or write them until it completes
+	unlockEmbeddings := utils.LockProjectResource(perpetualDir, utils.LockResourceEmbeddings, true, logger)
+	defer unlockEmbeddings()
+
 	embeddingsFilePath := filepath.Join(perpetualDir, utils.EmbeddingsFileName)
+	// Embeddings index is updated incrementally only if it was built for the current state of embeddings file
+	oldEmbeddingsStamp := getEmbeddingsStamp(embeddingsFilePath)
 
 	//load old embeddings file
 	logger.Traceln("Loading embeddings")
@@ -192,6 +214,10 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	if err != nil {
 		logger.Panicln("Failed to load embeddings:", err)
 	}
+	chunkLines, err := utils.GetEmbeddingsChunkLines(embeddingsFilePath, fileNames)
+	if err != nil {
+		logger.Panicln("Failed to load embeddings:", err)
+	}
 	logger.Traceln("Done loading embeddings")
 
 	var filesToEmbed []string
@@ -215,6 +241,7 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		sort.Strings(filesToEmbed)
 		//clear-out previously loaded embeddings
 		embeddings = make(map[string][][]float32)
+		chunkLines = make(map[string][][2]int)
 		vectorDimensions = 0
 	} else {
 		logger.Traceln("Detecting changes")
@@ -230,6 +257,11 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		logger.Panicln("Vectors dimensions inconsistency detected for existing embeddings, check your LLM embeddings configuration and rebuild all embeddings by running embed operation with -f flag")
 	}
 
+	// Keyword index is built locally, so it is updated for all project files before checksums of files not embedded are reverted
+	if !dryRun {
+		updateKeywordIndex(projectRootDir, perpetualDir, fileNames, fileChecksums, annotations, force, logger)
+	}
+
 	//filter with user-blacklist, revert checksum for dropped files, so they can be reevaluated next time
 	filesToEmbed, droppedFiles := utils.FilterFilesWithBlacklist(filesToEmbed, userBlacklist)
 	if len(droppedFiles) > 0 {
@@ -265,6 +297,7 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 
 	errorFlag := false
 	changedFlag := false
+	var embeddedFiles []string
 	for i, filePath := range filesToEmbed {
 		// Read file contents and generate embedding
 		fileBytes, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, filePath))
@@ -275,7 +308,10 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		if wrn != "" {
 			logger.Warnf("%s: %s", filePath, wrn)
 		}
-		fileContents := string(fileBytes)
+		fileContents, redactedSecrets := llm.RedactSecretsWithMapping(string(fileBytes))
+		if len(redactedSecrets) > 0 {
+			logger.Warnf("Redacted %d secret(s) in file: %s", len(redactedSecrets), filePath)
+		}
 		onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
 		for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
 			logger.Infof("%d: %s", i+1, filePath)
@@ -319,6 +355,14 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 			}
 
 			embeddings[filePath] = vectors
+			// Line ranges of chunks used to show matched regions of the file in search results,
+			// chunks of redacted text are mapped to the original file contents
+			if chunkRanges := connector.GetEmbedChunkRanges(llm.DocEmbed, fileContents); len(chunkRanges) == len(vectors) && len(vectors) > 0 {
+				chunkLines[filePath] = utils.GetLineRanges(string(fileBytes), utils.MapRedactedRanges(chunkRanges, redactedSecrets))
+			} else {
+				delete(chunkLines, filePath)
+			}
+			embeddedFiles = append(embeddedFiles, filePath)
 			changedFlag = true
 			break
 		}
@@ -327,7 +371,7 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	// Save updated embeddings
 	if changedFlag {
 		logger.Infoln("Saving embeddings")
-		if err := utils.SaveEmbeddings(embeddingsFilePath, fileChecksums, embeddings); err != nil {
+		if err := utils.SaveEmbeddings(embeddingsFilePath, fileChecksums, embeddings, chunkLines); err != nil {
 			logger.Panicln("Failed to save embeddings:", err)
 		}
 		logger.Traceln("Done saving embeddings")
@@ -335,6 +379,9 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		logger.Infoln("Embeddings unchanged")
 	}
 
+	// Update approximate nearest neighbour index used for similarity search on large projects
+	updateANNIndex(perpetualDir, oldEmbeddingsStamp, embeddings, fileChecksums, embeddedFiles, vectorDimensions, force, logger)
+
 	if errorFlag {
 		logger.Panicln("Not all files were successfully processed. Run embed again to process failed files.")
 	}
@@ -361,8 +408,30 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		fileNames,
 		[]string{},
 		logger)
-	for _, file := range results {
-		fmt.Println(file)
+	if !showRegions && !jsonOutput {
+		for _, file := range results {
+			fmt.Println(file)
+		}
+		return
+	}
+
+	matches := GetChunkMatches(projectRootDir, perpetualDir, question, results, logger)
+	if jsonOutput {
+		data, err := json.MarshalIndent(matches, "", "  ")
+		if err != nil {
+			logger.Panicln("Failed to format results:", err)
+		}
+		fmt.Println(string(data))
+		return
+	}
+	for _, match := range matches {
+		fmt.Println(match.File)
+		for _, chunk := range match.Chunks {
+			fmt.Printf("  lines %d-%d, score: %.4f\n", chunk.StartLine, chunk.EndLine, chunk.Score)
+			for _, line := range strings.Split(chunk.Snippet, "\n") {
+				fmt.Println("    " + line)
+			}
+		}
 	}
 }
 
@@ -55,6 +55,7 @@ func SimilaritySearchStage(
 
 	//generate embeddings for search queries
 	searchVectors := [][]float32{}
+	searchVectorQueries := []string{}
 	var similarityThreshold float32 = math.MaxFloat32
 	for i, query := range searchQueries {
 		vectors, threshold, err := generateEmbeddings(searchTags[i], query, logger)
@@ -70,32 +71,59 @@ func SimilaritySearchStage(
 			logger.Warnf("Embeddings for %s contain more than one vector (%d), this may negatively affect search results", searchTags[i], len(vectors))
 		}
 		searchVectors = append(searchVectors, vectors...)
+		for range vectors {
+			searchVectorQueries = append(searchVectorQueries, query)
+		}
 	}
 
-	logger.Traceln("Loading embeddings")
-	embeddings, _, vectorDimensions, err := utils.GetEmbeddings(filepath.Join(perpetualDir, utils.EmbeddingsFileName), sourceFiles)
-	if err != nil {
-		logger.Panicln("Failed to load embeddings:", err)
+	unlockEmbeddings := utils.LockProjectResource(perpetualDir, utils.LockResourceEmbeddings, false, logger)
+	//try approximate search with embeddings index first, number of files requested per search vector
+	//is enough for both selection modes even when all preselected files are among the results
+	similarityResults := annSimilaritySearch(perpetualDir, searchVectors, sourceFiles, 2*limit+len(preSelectedFiles), logger)
+	var embeddings map[string][][]float32
+	var vectorDimensions int
+	var err error
+	if similarityResults == nil {
+		logger.Traceln("Loading embeddings")
+		embeddings, _, vectorDimensions, err = utils.GetEmbeddings(filepath.Join(perpetualDir, utils.EmbeddingsFileName), sourceFiles)
 	}
-	logger.Traceln("Done loading embeddings")
+	keywordResults := keywordSimilaritySearch(perpetualDir, searchVectorQueries, sourceFiles, logger)
+	unlockEmbeddings()
 
-	if vectorDimensions < 0 {
-		logger.Panicln("Vectors dimensions inconsistency detected for existing embeddings, check your LLM embeddings configuration and rebuild all embeddings by running embed operation with -f flag")
-	}
+	if similarityResults == nil {
+		if err != nil {
+			logger.Panicln("Failed to load embeddings:", err)
+		}
+		logger.Traceln("Done loading embeddings")
+
+		if vectorDimensions < 0 {
+			logger.Panicln("Vectors dimensions inconsistency detected for existing embeddings, check your LLM embeddings configuration and rebuild all embeddings by running embed operation with -f flag")
+		}
 
-	//check searchVectors have corresponding dimensions
-	for i, vector := range searchVectors {
-		if len(vector) != vectorDimensions {
-			logger.Panicf(
-				"Vector dimensions mismatch for vector %d: expected %d, got %d, please check your LLM configuration and rebuild all embeddings if needed by running embed operation with -f flag",
-				i, vectorDimensions, len(vector))
+		//check searchVectors have corresponding dimensions
+		for i, vector := range searchVectors {
+			if len(vector) != vectorDimensions {
+				logger.Panicf(
+					"Vector dimensions mismatch for vector %d: expected %d, got %d, please check your LLM configuration and rebuild all embeddings if needed by running embed operation with -f flag",
+					i, vectorDimensions, len(vector))
+			}
 		}
+
+		//get similarity results for search queries
+		logger.Debugln("Performing local similarity search")
+		similarityResults = similaritySearch(searchVectors, embeddings)
+		logger.Traceln("Done local similarity search")
 	}
 
-	//get similarity results for search queries
-	logger.Debugln("Performing local similarity search")
-	similarityResults := similaritySearch(searchVectors, embeddings)
-	logger.Traceln("Done local similarity search")
+	//combine similarity search results with keyword search results, so files with exact identifiers,
+	//error strings or config keys mentioned in the queries are not missed
+	if keywordResults != nil {
+		for i := range similarityResults {
+			similarityResults[i] = fuseSearchResults(similarityResults[i], keywordResults[i], similarityThreshold)
+		}
+		//only files passed similarity threshold or ranked high by keyword search are left, all with positive scores
+		similarityThreshold = 0
+	}
 
 	//calculate result limit
 	resultsDistribution := make([]int, len(similarityResults))
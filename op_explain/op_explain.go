@@ -21,6 +21,9 @@ import (
 const OpName = "explain"
 const OpDesc = "Getting answers to questions and clarifications on the project (based on source code analysis)"
 
+// Symbol names defined in more places are too generic to point at relevant files
+const symbolDefinitionsMaxPerName = 5
+
 func docFlags() *flag.FlagSet {
 	flags := flag.NewFlagSet(OpName, flag.ExitOnError)
 	return flags
@@ -137,6 +140,8 @@ func Run(args []string, logger logging.ILogger) {
 
 	explainConfig := config.LoadOpExplainConfig(perpetualDir, logger)
 	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	// Hide secrets in file contents sent to LLM
+	llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 
 	projectFilesBlacklist := projectConfig.RegexpArray(config.K_ProjectFilesBlacklist)
 
@@ -235,11 +240,29 @@ func Run(args []string, logger logging.ILogger) {
 	}
 
 	// Load annotations
+	unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
 	annotations, err := utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
+	unlockAnnotations()
 	if err != nil {
 		logger.Panicln("Error loading annotations:", err)
 	}
 
+	// Add symbols from local symbol index to file descriptions, and find definitions of symbols mentioned in the question
+	symbols := shared.UpdateSymbols(projectRootDir, perpetualDir, projectConfig, fileNames, logger)
+	indexAnnotations := shared.AddSymbolsToAnnotations(annotations, symbols, projectConfig)
+	symbolDefinitions := utils.FindSymbolDefinitions(symbols, question, symbolDefinitionsMaxPerName)
+	symbolsPrompts, symbolsBodies, symbolsResponses := []string{}, []string{}, []string{}
+	if len(symbolDefinitions) > 0 {
+		logger.Infoln("Definitions of symbols mentioned in the question found:", len(symbolDefinitions))
+		symbolsPrompts = append(symbolsPrompts, explainConfig.String(config.K_ExplainSymbolsPrompt))
+		symbolsBodies = append(symbolsBodies, shared.FormatSymbolDefinitions(symbolDefinitions))
+		symbolsResponses = append(symbolsResponses, explainConfig.String(config.K_ExplainSymbolsResponse))
+	}
+	stage2SymbolsBodies := make([]any, len(symbolsBodies))
+	for i, body := range symbolsBodies {
+		stage2SymbolsBodies[i] = body
+	}
+
 	// Perform context saving measures - use local search to pre-select only some percentage of the most relevant project files
 	filesPercent, randomizePercent := shared.GetLocalSearchLimitsForContextSaving(contextSaving, len(fileNames), projectConfig)
 	preselectedFileNames, sameFilesForAllPasses := shared.Stage1Preselect(
@@ -253,6 +276,22 @@ func Run(args []string, logger logging.ILogger) {
 		annotations,
 		selectionPasses,
 		logger)
+	// Select relevant directories once for all passes, for large projects only
+	preselectedFileNames = shared.Stage1SelectDirs(
+		OpName,
+		projectRootDir,
+		perpetualDir,
+		projectConfig,
+		explainConfig,
+		projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+		preselectedFileNames,
+		projectDesc,
+		indexAnnotations,
+		symbolsPrompts, symbolsBodies, symbolsResponses,
+		explainConfig.String(config.K_ExplainStage1QuestionPrompt),
+		stage1query,
+		[]string{},
+		logger)
 	// Prepare for multi-pass stage 1
 	selectionPasses = len(preselectedFileNames)
 	stage1Logger := logger.Clone()
@@ -272,8 +311,8 @@ func Run(args []string, logger logging.ILogger) {
 			preselectedFileNames[pass],
 			fileNames,
 			projectDesc,
-			annotations,
-			[]string{}, []string{}, []string{},
+			indexAnnotations,
+			symbolsPrompts, symbolsBodies, symbolsResponses,
 			explainConfig.String(config.K_ExplainStage1QuestionPrompt),
 			stage1query,
 			[]string{},
@@ -303,6 +342,13 @@ func Run(args []string, logger logging.ILogger) {
 		stage1Logger.DisableLevel(logging.InfoLevel)
 	}
 	requestedFiles := shared.MergeFileLists(fileLists, stage1Logger)
+	// Files with definitions of symbols mentioned in the question are always relevant
+	for _, definition := range symbolDefinitions {
+		if !slices.Contains(requestedFiles, definition.File) {
+			logger.Debugln("Adding file with symbol definition:", definition.File)
+			requestedFiles = append(requestedFiles, definition.File)
+		}
+	}
 
 	if listFilesOnly {
 		// for this mode, just list files one file per line for easier parsing with 3-rd party tool
@@ -351,11 +397,11 @@ func Run(args []string, logger logging.ILogger) {
 		fileNames,
 		filteredRequestedFiles,
 		projectDesc,
-		annotations,
+		indexAnnotations,
 		addAnnotations,
-		[]string{},
-		[]any{},
-		[]string{},
+		symbolsPrompts,
+		stage2SymbolsBodies,
+		symbolsResponses,
 		explainConfig.String(config.K_ExplainStage2QuestionPrompt),
 		"",
 		question,
@@ -2,10 +2,12 @@ package op_implement
 
 import (
 	"flag"
+	"maps"
 	"os"
 	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/DarkCaster/Perpetual/config"
 	"github.com/DarkCaster/Perpetual/llm"
@@ -26,9 +28,9 @@ func implementFlags() *flag.FlagSet {
 	return flags
 }
 
-func Run(args []string, logger logging.ILogger) {
-	var forceUpload, help, noAnnotate, noIncrMode, verbose, trace, excludeTests bool
-	var mode, descFile, inputFile, userFilterFile, contextSaving, stepMode, outputFile string
+func Run(version string, args []string, logger logging.ILogger) {
+	var forceUpload, help, noAnnotate, noIncrMode, verbose, trace, excludeTests, queueStopOnFail, queueNoReannotate, gitAllowDirty bool
+	var mode, descFile, inputFile, userFilterFile, contextSaving, stepMode, outputFile, queueFile, planAddFiles, planDeleteFiles, planRemoveFiles string
 	var searchLimit, selectionPasses int
 
 	// Parse flags for the "implement" operation
@@ -38,14 +40,24 @@ func Run(args []string, logger logging.ILogger) {
 		"task:         Implement code based on a task read from a text file or stdin (see '-i' flag). Uses planning, can affect any project files.\n"+
 		"comment:      Generate code marked with ###IMPLEMENT### comments in the source code. Uses planning, can affect any project files.\n"+
 		"comment-fast: Generate code marked with ###IMPLEMENT### comments, works only inside that files and skips planning (stage 2 and 3)")
-	flags.StringVar(&stepMode, "p", "", "Managed step-by-step execution (not available in 'comment-fast' mode). Valid values: start|finish.\n"+
+	flags.StringVar(&stepMode, "p", "", "Managed step-by-step execution (not available in 'comment-fast' mode). Valid values: start|revise|finish|resume.\n"+
 		"start:  Perform preparation stages 1-3, display task planning and scheduled file changes, and save intermediate state for later completion.\n"+
+		"revise: Revise previously saved task planning with feedback read from a text file or stdin (see '-i' flag), re-run stage 3, update saved state and display updated report.\n"+
+		"        Scheduled file changes can also be edited manually with '-pa', '-pd' and '-pr' flags, feedback is not read in that case unless '-i' flag is provided.\n"+
 		"finish: Complete a previously started step-by-step implementation by performing stage 4 (actual code changes).\n"+
+		"resume: Resume interrupted stage 4 of any previous implement run from the first unfinished file, reusing already generated files.\n"+
 		"If not provided, any pending state is silently removed and a normal full-scale implementation is performed.")
-	flags.StringVar(&outputFile, "o", "", "File path for saving report with task planning and scheduled changes (used with '-p start'). Write to stdout if set to '-', not provided or empty")
+	flags.StringVar(&planAddFiles, "pa", "", "Comma-separated list of files to add to scheduled files to modify or create (used with '-p revise')")
+	flags.StringVar(&planDeleteFiles, "pd", "", "Comma-separated list of files to add to scheduled files to delete (used with '-p revise')")
+	flags.StringVar(&planRemoveFiles, "pr", "", "Comma-separated list of files to remove from scheduled file changes (used with '-p revise')")
+	flags.StringVar(&outputFile, "o", "", "File path for saving report with task planning and scheduled changes (used with '-p start' or '-p revise'), or JSON report with task-queue results (used with '-q'). Write to stdout if set to '-', not provided or empty")
 	flags.StringVar(&contextSaving, "c", "auto", "Context saving mode, reduce LLM context use for large projects (valid values: auto|off|medium|high)")
 	flags.StringVar(&descFile, "df", "", "Optional path to project description file for adding into LLM context (valid values: file-path|disabled)")
-	flags.StringVar(&inputFile, "i", "", "Path to a text file (plain text or Markdown) with task to implement for task mode ('-m task'). If empty or '-' then read task from stdin")
+	flags.StringVar(&inputFile, "i", "", "Path to a text file (plain text or Markdown) with task to implement for task mode ('-m task'), or with feedback for '-p revise'. If empty or '-' then read from stdin")
+	flags.StringVar(&queueFile, "q", "", "Path to a task-queue file (Markdown with a separate section for each task, or JSONL) with multiple tasks to implement sequentially in task mode ('-m task')")
+	flags.BoolVar(&queueStopOnFail, "qs", false, "Stop processing the task-queue (see '-q' flag) on first failed task, remaining tasks are skipped")
+	flags.BoolVar(&queueNoReannotate, "qn", false, "Do not re-annotate changed files between tasks from the task-queue (see '-q' flag), later tasks will not see annotations for changes made by earlier tasks")
+	flags.BoolVar(&gitAllowDirty, "gd", false, "Allow running with git integration enabled ('git_mode' in project.json) when git working tree has uncommitted changes, only files changed by the operation will be committed")
 	flags.BoolVar(&noAnnotate, "n", false, "No annotate mode: skip re-annotating of changed files and use current annotations if any")
 	flags.BoolVar(&noIncrMode, "ni", false, "No incremental mode: disable using incremental 'search-and-replace' mode when generating file changes")
 	flags.BoolVar(&forceUpload, "f", false, "Disable 'no-upload' file-filter and upload such files for review and processing if reqested")
@@ -75,10 +87,16 @@ func Run(args []string, logger logging.ILogger) {
 	switch stepMode {
 	case "":
 	case "start":
+	case "revise":
 	case "finish":
+	case "resume":
 		break
 	default:
-		usage.PrintOperationUsage("You must provide valid managed execution step-mode value (valid values: start|finish)", flags)
+		usage.PrintOperationUsage("You must provide valid managed execution step-mode value (valid values: start|revise|finish|resume)", flags)
+	}
+
+	if stepMode != "revise" && (planAddFiles != "" || planDeleteFiles != "" || planRemoveFiles != "") {
+		usage.PrintOperationUsage("The '-pa', '-pd' and '-pr' flags can be only used with '-p revise'", flags)
 	}
 
 	contextSaving = shared.ValidateContextSavingValue(contextSaving, logger)
@@ -97,12 +115,15 @@ func Run(args []string, logger logging.ILogger) {
 		logger.Infoln("Running in task-implement mode")
 		planningMode = true
 	case "comment":
-		if inputFile != "" {
-			usage.PrintOperationUsage("The '-i' flag can be only used in task mode ('-m task')", flags)
+		if inputFile != "" && stepMode != "revise" {
+			usage.PrintOperationUsage("The '-i' flag can be only used in task mode ('-m task') or with '-p revise'", flags)
 		}
 		logger.Infoln("Running in direct-implement mode with extra planning")
 		planningMode = true
 	case "comment-fast":
+		if stepMode == "revise" {
+			usage.PrintOperationUsage("The '-p revise' flag cannot be used in 'comment-fast' mode", flags)
+		}
 		if inputFile != "" {
 			usage.PrintOperationUsage("The '-i' flag can be only used in task mode ('-m task')", flags)
 		}
@@ -115,12 +136,29 @@ func Run(args []string, logger logging.ILogger) {
 		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: task|comment|comment-fast)", flags)
 	}
 
+	if queueFile != "" {
+		if mode != "task" {
+			usage.PrintOperationUsage("The '-q' flag can be only used in task mode ('-m task')", flags)
+		}
+		if inputFile != "" {
+			usage.PrintOperationUsage("The '-q' and '-i' flags cannot be used together", flags)
+		}
+		if stepMode != "" {
+			usage.PrintOperationUsage("The '-q' flag cannot be used with managed step-by-step execution ('-p' flag)", flags)
+		}
+	} else if queueStopOnFail || queueNoReannotate {
+		usage.PrintOperationUsage("The '-qs' and '-qn' flags can be only used with task-queue ('-q' flag)", flags)
+	}
+
 	// Initialize: detect work directories, load .env file with LLM settings, load file filtering regexps
 	projectRootDir, perpetualDir, err := utils.FindProjectRoot(logger, false)
 	if err != nil {
 		logger.Panicln("Error finding project root directory:", err)
 	}
 
+	// Only one implement operation can use the state file at a time, lock is released when operation completes
+	utils.LockProjectResource(perpetualDir, utils.LockResourceImplementState, true, logger)
+
 	projectDesc := ""
 	wrn := ""
 	if descFile == "" {
@@ -159,6 +197,8 @@ func Run(args []string, logger logging.ILogger) {
 
 	implementConfig := config.LoadOpImplementConfig(perpetualDir, logger)
 	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	// Hide secrets in file contents sent to LLM
+	llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 
 	projectFilesBlacklist := projectConfig.RegexpArray(config.K_ProjectFilesBlacklist)
 
@@ -173,406 +213,634 @@ func Run(args []string, logger logging.ILogger) {
 		projectFilesBlacklist = append(projectFilesBlacklist, projectConfig.RegexpArray(config.K_ProjectTestFilesBlacklist)...)
 	}
 
-	// Get project files, which names selected with whitelist regexps and filtered with blacklist regexps
-	logger.Infoln("Fetching project files")
-	fileNames, allFileNames, err := utils.GetProjectFileList(
-		projectRootDir,
-		perpetualDir,
-		projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
-		projectFilesBlacklist)
+	projectFilesReadonly := projectConfig.RegexpArray(config.K_ProjectFilesReadonly)
 
-	if err != nil {
-		logger.Panicln("Error getting project file-list:", err)
+	// Git integration commits changes made by the operation, uncommitted changes made by user must not be mixed with them.
+	// Steps that only plan changes do not touch the working tree and may run anyway.
+	// Checked before every task from the task-queue, because previous task may leave uncommitted changes
+	gitMode := projectConfig.String(config.K_ProjectGitMode)
+	checkGitWorkingTree := func() {
+		if gitMode == utils.GitModeNone || gitAllowDirty || stepMode == "start" || stepMode == "revise" {
+			return
+		}
+		dirtyFiles, err := utils.GitGetDirtyFiles(projectRootDir, filepath.Base(perpetualDir))
+		if err != nil {
+			logger.Panicln("Error checking git working tree:", err)
+		}
+		if len(dirtyFiles) > 0 {
+			for _, file := range dirtyFiles {
+				logger.Errorln("Uncommitted change:", file)
+			}
+			logger.Panicln("Git working tree has uncommitted changes, commit them first or use '-gd' flag to proceed anyway")
+		}
 	}
+	checkGitWorkingTree()
 
-	// Check fileNames array for case collisions
-	if !utils.CheckFilenameCaseCollisions(fileNames) {
-		logger.Panicln("Filename case collisions detected in project files")
-	}
-	// File names and dir-names must not contain path separators characters
-	if !utils.CheckForPathSeparatorsInFilenames(fileNames) {
-		logger.Panicln("Invalid characters detected in project filenames or directories: / and \\ characters are not allowed!")
+	// Get project files, which names selected with whitelist regexps and filtered with blacklist regexps.
+	// Tasks from the task-queue may create or delete files, so file-list is re-fetched for every task
+	fetchProjectFiles := func() ([]string, []string) {
+		logger.Infoln("Fetching project files")
+		fileNames, allFileNames, err := utils.GetProjectFileList(
+			projectRootDir,
+			perpetualDir,
+			projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
+			projectFilesBlacklist)
+
+		if err != nil {
+			logger.Panicln("Error getting project file-list:", err)
+		}
+
+		// Check fileNames array for case collisions
+		if !utils.CheckFilenameCaseCollisions(fileNames) {
+			logger.Panicln("Filename case collisions detected in project files")
+		}
+		// File names and dir-names must not contain path separators characters
+		if !utils.CheckForPathSeparatorsInFilenames(fileNames) {
+			logger.Panicln("Invalid characters detected in project filenames or directories: / and \\ characters are not allowed!")
+		}
+		return fileNames, allFileNames
 	}
 
-	if stepMode != "finish" {
+	if stepMode != "finish" && stepMode != "revise" && stepMode != "resume" {
 		if rmErr := removeState(perpetualDir); rmErr != nil {
 			logger.Panicln("Failed to remove stale state file:", rmErr)
 		}
 	}
 
-	var state = state{}
-	if stepMode == "" || stepMode == "start" {
-		// Read input from file or stdin
-		var task string
-		if mode == "task" {
-			if inputFile == "" || inputFile == "-" {
-				logger.Infoln("Reading task from stdin")
-				data, wrn, err := utils.LoadTextStdin()
-				if err != nil {
-					logger.Panicln("Error reading from stdin:", err)
-				}
-				if wrn != "" {
-					logger.Warnf("stdin: %s", wrn)
-				}
-				task = string(data)
+	// Perform all implementation stages for a single task (or for files with implement-comments if task is empty),
+	// return name of created stash (empty if processing stopped before stage 4) and final state
+	logRotated := false
+	implementTask := func(task string) (string, state) {
+		fileNames, allFileNames := fetchProjectFiles()
+
+		var state = state{}
+		if stepMode == "" || stepMode == "start" {
+			// Count tokens used for each task separately
+			llm.ResetTokenUsage()
+			state.StartedAt = time.Now()
+			state.Mode = mode
+			var targetFiles []string
+			if task != "" {
+				logger.Debugln("Skipping search of source files with implement comment")
 			} else {
-				logger.Infoln("Reading task from file")
-				data, wrn, err := utils.LoadTextFile(inputFile)
-				if err != nil {
-					logger.Panicln("Error reading task from input file:", err)
+				// Find files for operation. Select files that contains implement-mark
+				logger.Debugln("Searching project files for implement comment")
+				for _, filePath := range fileNames {
+					logger.Traceln(filePath)
+					found, _, err := utils.FindInFile(
+						filepath.Join(projectRootDir, filePath),
+						append(utils.NewSlice(implementConfig.RegexpArray(config.K_ImplementCommentsRx)...), implementConfig.RegexpArray(config.K_ImplementRegionTagsRx)[0]))
+					if err != nil {
+						logger.Panicf("Failed to search 'implement' comment in file %s: %v", filePath, err)
+					}
+					if found {
+						targetFiles = append(targetFiles, filePath)
+					}
 				}
-				if wrn != "" {
-					logger.Warnf("%s: %s", inputFile, wrn)
-				}
-				task = data
-			}
-			// Trim excess line breaks at both sides of task, and stop on empty input
-			task = strings.Trim(task, "\n")
-			if len(task) < 1 {
-				logger.Panicln("Task is empty, cannot continue")
-			}
-		}
-
-		var targetFiles []string
-		if task != "" {
-			logger.Debugln("Skipping search of source files with implement comment")
-		} else {
-			// Find files for operation. Select files that contains implement-mark
-			logger.Debugln("Searching project files for implement comment")
-			for _, filePath := range fileNames {
-				logger.Traceln(filePath)
-				found, _, err := utils.FindInFile(
-					filepath.Join(projectRootDir, filePath),
-					implementConfig.RegexpArray(config.K_ImplementCommentsRx))
-				if err != nil {
-					logger.Panicf("Failed to search 'implement' comment in file %s: %v", filePath, err)
+				// Log files to process
+				if len(targetFiles) < 1 {
+					logger.Panicln("No files found for processing")
 				}
-				if found {
-					targetFiles = append(targetFiles, filePath)
+				logger.Infoln("Files for processing:")
+				for _, targetFile := range targetFiles {
+					logger.Infoln(targetFile)
 				}
 			}
-			// Log files to process
-			if len(targetFiles) < 1 {
-				logger.Panicln("No files found for processing")
-			}
-			logger.Infoln("Files for processing:")
-			for _, targetFile := range targetFiles {
-				logger.Infoln(targetFile)
-			}
-		}
-
-		logger.Debugln("Rotating log file")
-		if err := llm.RotateLLMRawLogFile(perpetualDir); err != nil {
-			logger.Panicln("Failed to rotate log file:", err)
-		}
-
-		// Check if target files includes all project files, and run annotate if needed
-		skipStage1 := false
-		if len(targetFiles) == len(fileNames) {
-			logger.Warnln("All project files selected for processing, no need to run annotate and stage1")
-			skipStage1 = true
-		} else if !noAnnotate {
-			logger.Debugln("Running 'annotate' operation to update file annotations")
-			op_annotate_params, op_embed_params := shared.GetAnnotateAndEmbedCmdLineFlags(userFilterFile, contextSaving, descFile)
-			op_annotate.Run(op_annotate_params, true, logger)
-			op_embed.Run(op_embed_params, true, logger)
-		} else {
-			logger.Warnln("File-annotations update disabled, this may worsen the final result")
-		}
 
-		var filesToReview []string
-		if !skipStage1 {
-			// Load annotations needed for stage1
-			annotations, err := utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
-			if err != nil {
-				logger.Panicln("Error reading annotations:", err)
-			}
-			// Find out do we have annotations for files not in targetFiles
-			nonTargetFilesAnnotationsCount := 0
-			for filename := range annotations {
-				found := slices.Contains(targetFiles, filename)
-				if !found {
-					nonTargetFilesAnnotationsCount++
+			// Rotate log file only once, so logs for all tasks from the task-queue are kept together
+			if !logRotated {
+				logger.Debugln("Rotating log file")
+				if err := llm.RotateLLMRawLogFile(perpetualDir); err != nil {
+					logger.Panicln("Failed to rotate log file:", err)
 				}
+				logRotated = true
 			}
-			var prompt string
-			if task != "" {
-				prompt = implementConfig.String(config.K_ImplementTaskStage1AnalysisPrompt)
-			} else if len(targetFiles) > 0 {
-				prompt = implementConfig.String(config.K_ImplementStage1AnalysisPrompt)
+
+			// Check if target files includes all project files, and run annotate if needed
+			skipStage1 := false
+			if len(targetFiles) == len(fileNames) {
+				logger.Warnln("All project files selected for processing, no need to run annotate and stage1")
+				skipStage1 = true
+			} else if !noAnnotate {
+				logger.Debugln("Running 'annotate' operation to update file annotations")
+				op_annotate_params, op_embed_params := shared.GetAnnotateAndEmbedCmdLineFlags(userFilterFile, contextSaving, descFile)
+				op_annotate.Run(op_annotate_params, true, logger)
+				op_embed.Run(op_embed_params, true, logger)
 			} else {
-				logger.Panicln("No task or files with implement-comments provided for processing, cannot continue!")
+				logger.Warnln("File-annotations update disabled, this may worsen the final result")
 			}
 
-			if nonTargetFilesAnnotationsCount > 0 {
-				// Perform context saving measures - use local search to pre-select only some percentage of the most relevant project files
-				filesPercent, randomizePercent := shared.GetLocalSearchLimitsForContextSaving(contextSaving, len(fileNames), projectConfig)
-				preselectedFileNames, sameFilesForAllPasses := shared.Stage1Preselect(
-					perpetualDir,
-					projectRootDir,
-					filesPercent,
-					randomizePercent,
-					fileNames,
-					task,
-					targetFiles,
-					annotations,
-					selectionPasses,
-					logger)
-				// Prepare for multi-pass stage 1
-				selectionPasses = len(preselectedFileNames)
-				stage1Logger := logger.Clone()
-				if selectionPasses > 1 {
-					stage1Logger.DisableLevel(logging.InfoLevel)
+			var filesToReview []string
+			if !skipStage1 {
+				state.recordStageModel("stage1", implementConfig)
+				// Load annotations needed for stage1
+				unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
+				annotations, err := utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
+				unlockAnnotations()
+				if err != nil {
+					logger.Panicln("Error reading annotations:", err)
+				}
+				// Add symbols from local symbol index to file descriptions for the project index at stage1
+				symbols := shared.UpdateSymbols(projectRootDir, perpetualDir, projectConfig, fileNames, logger)
+				indexAnnotations := shared.AddSymbolsToAnnotations(annotations, symbols, projectConfig)
+				// Find out do we have annotations for files not in targetFiles
+				nonTargetFilesAnnotationsCount := 0
+				for filename := range indexAnnotations {
+					found := slices.Contains(targetFiles, filename)
+					if !found {
+						nonTargetFilesAnnotationsCount++
+					}
+				}
+				var prompt string
+				if task != "" {
+					prompt = implementConfig.String(config.K_ImplementTaskStage1AnalysisPrompt)
+				} else if len(targetFiles) > 0 {
+					prompt = implementConfig.String(config.K_ImplementStage1AnalysisPrompt)
+				} else {
+					logger.Panicln("No task or files with implement-comments provided for processing, cannot continue!")
 				}
-				fileLists := make([][]string, selectionPasses)
-				for pass := range selectionPasses {
-					// Run stage 1
-					fileLists[pass] = shared.Stage1(
+
+				if nonTargetFilesAnnotationsCount > 0 {
+					// Perform context saving measures - use local search to pre-select only some percentage of the most relevant project files
+					filesPercent, randomizePercent := shared.GetLocalSearchLimitsForContextSaving(contextSaving, len(fileNames), projectConfig)
+					preselectedFileNames, sameFilesForAllPasses := shared.Stage1Preselect(
+						perpetualDir,
+						projectRootDir,
+						filesPercent,
+						randomizePercent,
+						fileNames,
+						task,
+						targetFiles,
+						annotations,
+						selectionPasses,
+						logger)
+					// Select relevant directories once for all passes, for large projects only
+					preselectedFileNames = shared.Stage1SelectDirs(
 						OpName,
 						projectRootDir,
 						perpetualDir,
 						projectConfig,
 						implementConfig,
 						projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
-						preselectedFileNames[pass],
-						fileNames,
+						preselectedFileNames,
 						projectDesc,
-						annotations,
+						indexAnnotations,
 						[]string{}, []string{}, []string{},
 						prompt,
 						task,
 						targetFiles,
-						pass+1,
-						selectionPasses,
-						sameFilesForAllPasses,
-						stage1Logger)
-					// Prepare for local similarity search
-					searchQueries, searchTags := op_embed.GetQueriesForSimilaritySearch(task, targetFiles, annotations)
-					// Compose list of already requested files
-					requestedFiles := append(utils.NewSlice(fileLists[pass]...), targetFiles...)
-					// Select search mode
-					searchMode := shared.GetLocalSearchModeFromContextSavingValue(contextSaving, len(requestedFiles), searchLimit)
-					// Local similarity search stage
-					similarFiles := op_embed.SimilaritySearchStage(
-						searchMode,
-						min(searchLimit, len(fileLists[pass])),
-						perpetualDir,
-						searchQueries,
-						searchTags,
-						fileNames,
-						requestedFiles,
-						stage1Logger)
-					fileLists[pass] = append(fileLists[pass], similarFiles...)
+						logger)
+					// Prepare for multi-pass stage 1
+					selectionPasses = len(preselectedFileNames)
+					stage1Logger := logger.Clone()
+					if selectionPasses > 1 {
+						stage1Logger.DisableLevel(logging.InfoLevel)
+					}
+					fileLists := make([][]string, selectionPasses)
+					for pass := range selectionPasses {
+						// Run stage 1
+						fileLists[pass] = shared.Stage1(
+							OpName,
+							projectRootDir,
+							perpetualDir,
+							projectConfig,
+							implementConfig,
+							projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+							preselectedFileNames[pass],
+							fileNames,
+							projectDesc,
+							indexAnnotations,
+							[]string{}, []string{}, []string{},
+							prompt,
+							task,
+							targetFiles,
+							pass+1,
+							selectionPasses,
+							sameFilesForAllPasses,
+							stage1Logger)
+						// Prepare for local similarity search
+						searchQueries, searchTags := op_embed.GetQueriesForSimilaritySearch(task, targetFiles, annotations)
+						// Compose list of already requested files
+						requestedFiles := append(utils.NewSlice(fileLists[pass]...), targetFiles...)
+						// Select search mode
+						searchMode := shared.GetLocalSearchModeFromContextSavingValue(contextSaving, len(requestedFiles), searchLimit)
+						// Local similarity search stage
+						similarFiles := op_embed.SimilaritySearchStage(
+							searchMode,
+							min(searchLimit, len(fileLists[pass])),
+							perpetualDir,
+							searchQueries,
+							searchTags,
+							fileNames,
+							requestedFiles,
+							stage1Logger)
+						fileLists[pass] = append(fileLists[pass], similarFiles...)
+					}
+					// Merge fileLists together
+					if selectionPasses > 1 {
+						stage1Logger.EnableLevel(logging.InfoLevel)
+					} else {
+						stage1Logger.DisableLevel(logging.InfoLevel)
+					}
+					filesToReview = shared.MergeFileLists(fileLists, stage1Logger)
+				} else {
+					logger.Warnln("All source code files already selected for review, no need to run stage1")
 				}
-				// Merge fileLists together
-				if selectionPasses > 1 {
-					stage1Logger.EnableLevel(logging.InfoLevel)
+			}
+
+			// Filter filesToReview files for presence of "no-upload" mark
+			if !forceUpload {
+				filesToReview = utils.FilterNoUploadProjectFiles(
+					projectRootDir,
+					filesToReview,
+					projectConfig.RegexpArray(config.K_ProjectNoUploadCommentsRx),
+					false,
+					logger)
+			}
+
+			stage2TargetFilesPrompts := []string{}
+			stage2TargetFilesNames := []any{}
+			stage2TargetFilesResponses := []string{}
+
+			var stage2MainPrompt string
+			var stage2MainPromptFinal string
+			var stage2MainPromptBody any
+
+			if planningMode {
+				// planning mode - generate workplan with reasonings and upcoming changes, LLM can modify other files and create new
+				logger.Infoln("Running stage2: using planning, generating work plan")
+				// this will produce messages with related file-list
+				stage2TargetFilesPrompts = []string{}
+				stage2TargetFilesNames = []any{}
+				stage2TargetFilesResponses = []string{}
+				// fill-up main prompts to generate workplan
+				if task == "" {
+					stage2MainPrompt = implementConfig.String(config.K_ImplementStage2ReasoningsPrompt)
+					stage2MainPromptFinal = implementConfig.String(config.K_ImplementStage2ReasoningsPromptFinal)
+					stage2MainPromptBody = targetFiles
 				} else {
-					stage1Logger.DisableLevel(logging.InfoLevel)
+					stage2MainPrompt = implementConfig.String(config.K_ImplementTaskStage2ReasoningsPrompt)
+					stage2MainPromptFinal = implementConfig.String(config.K_ImplementTaskStage2ReasoningsPromptFinal)
+					stage2MainPromptBody = task
 				}
-				filesToReview = shared.MergeFileLists(fileLists, stage1Logger)
 			} else {
-				logger.Warnln("All source code files already selected for review, no need to run stage1")
+				// planning disabled, LLM will only modify targetFiles (files that contain IMPLEMENT comments)
+				logger.Infoln("Running stage2: planning disabled, not generating work plan")
+				// this will produce messages with target file-list + related file-list + instructions for further processing on next stages
+				stage2TargetFilesPrompts = []string{implementConfig.String(config.K_ImplementStage2NoPlanningPrompt)}
+				stage2TargetFilesNames = []any{targetFiles}
+				stage2TargetFilesResponses = []string{implementConfig.String(config.K_ImplementStage2NoPlanningResponse)}
+				// make main prompt empty to skip workplan generation
+				stage2MainPrompt = ""
+				stage2MainPromptFinal = ""
+				stage2MainPromptBody = ""
 			}
-		}
 
-		// Filter filesToReview files for presence of "no-upload" mark
-		if !forceUpload {
-			filesToReview = utils.FilterNoUploadProjectFiles(
+			// Run stage 2 - create file review, create reasonings
+			workplan, messages := shared.Stage2(OpName,
 				projectRootDir,
+				perpetualDir,
+				projectConfig,
+				implementConfig,
+				projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+				[]string{},
 				filesToReview,
-				projectConfig.RegexpArray(config.K_ProjectNoUploadCommentsRx),
+				projectDesc,
+				map[string]string{},
+				false,
+				stage2TargetFilesPrompts,
+				stage2TargetFilesNames,
+				stage2TargetFilesResponses,
+				stage2MainPrompt,
+				stage2MainPromptFinal,
+				stage2MainPromptBody,
 				false,
+				true,
+				logger,
+			)
+
+			// Keep stage 2 message history, so work plan can be revised later
+			stage2Messages := utils.NewSlice(messages...)
+
+			// Run stage 3 - get list of files to modify or delete
+			messages, otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove, readonlyViolations := Stage3(
+				projectRootDir,
+				perpetualDir,
+				projectConfig,
+				implementConfig,
+				projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+				planningMode,
+				allFileNames,
+				projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
+				projectFilesBlacklist,
+				projectFilesReadonly,
+				projectConfig.RegexpArray(config.K_ProjectNoUploadCommentsRx),
+				forceUpload,
+				filesToReview,
+				targetFiles,
+				messages,
+				task,
 				logger)
-		}
 
-		stage2TargetFilesPrompts := []string{}
-		stage2TargetFilesNames := []any{}
-		stage2TargetFilesResponses := []string{}
-
-		var stage2MainPrompt string
-		var stage2MainPromptFinal string
-		var stage2MainPromptBody any
-
-		if planningMode {
-			// planning mode - generate workplan with reasonings and upcoming changes, LLM can modify other files and create new
-			logger.Infoln("Running stage2: using planning, generating work plan")
-			// this will produce messages with related file-list
-			stage2TargetFilesPrompts = []string{}
-			stage2TargetFilesNames = []any{}
-			stage2TargetFilesResponses = []string{}
-			// fill-up main prompts to generate workplan
-			if task == "" {
-				stage2MainPrompt = implementConfig.String(config.K_ImplementStage2ReasoningsPrompt)
-				stage2MainPromptFinal = implementConfig.String(config.K_ImplementStage2ReasoningsPromptFinal)
-				stage2MainPromptBody = targetFiles
-			} else {
-				stage2MainPrompt = implementConfig.String(config.K_ImplementTaskStage2ReasoningsPrompt)
-				stage2MainPromptFinal = implementConfig.String(config.K_ImplementTaskStage2ReasoningsPromptFinal)
-				stage2MainPromptBody = task
+			state.OtherFilesToModify = otherFilesToModify
+			state.TargetFilesToModify = targetFilesToModify
+			state.FilesToDelete = filesToDelete
+			state.FilesToMove = filesToMove
+			state.ReadonlyViolations = readonlyViolations
+			state.Messages = messages
+			state.Task = task
+			state.PlanningMode = planningMode
+			state.TargetFiles = targetFiles
+			state.FilesToReview = filesToReview
+			state.Workplan = workplan
+			state.Stage2Messages = stage2Messages
+			if planningMode {
+				state.recordStageModel("stage2", implementConfig)
+				state.recordStageModel("stage3", implementConfig)
+			}
+
+			//termination point, need to save state:
+			if stepMode == "start" {
+				state.collectTokenUsage()
+				logger.Debugln("Saving state file")
+				if err := saveState(perpetualDir, state); err != nil {
+					if rmErr := removeState(perpetualDir); rmErr != nil {
+						logger.Errorln("Failed to remove invalid state file:", rmErr)
+					}
+					logger.Panicln("Failed to save implement state file:", err)
+				}
+				logger.Infoln("Processing will stop here, to complete scheduled changes run implement again with '-p finish'")
+
+				writePlanReport(outputFile, state, logger)
+				return "", state
 			}
 		} else {
-			// planning disabled, LLM will only modify targetFiles (files that contain IMPLEMENT comments)
-			logger.Infoln("Running stage2: planning disabled, not generating work plan")
-			// this will produce messages with target file-list + related file-list + instructions for further processing on next stages
-			stage2TargetFilesPrompts = []string{implementConfig.String(config.K_ImplementStage2NoPlanningPrompt)}
-			stage2TargetFilesNames = []any{targetFiles}
-			stage2TargetFilesResponses = []string{implementConfig.String(config.K_ImplementStage2NoPlanningResponse)}
-			// make main prompt empty to skip workplan generation
-			stage2MainPrompt = ""
-			stage2MainPromptFinal = ""
-			stage2MainPromptBody = ""
-		}
-
-		// Run stage 2 - create file review, create reasonings
-		workplan, messages := shared.Stage2(OpName,
-			projectRootDir,
-			perpetualDir,
-			projectConfig,
-			implementConfig,
-			projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
-			[]string{},
-			filesToReview,
-			projectDesc,
-			map[string]string{},
-			false,
-			stage2TargetFilesPrompts,
-			stage2TargetFilesNames,
-			stage2TargetFilesResponses,
-			stage2MainPrompt,
-			stage2MainPromptFinal,
-			stage2MainPromptBody,
-			false,
-			true,
-			logger,
-		)
-
-		// Run stage 3 - get list of files to modify or delete
-		messages, otherFilesToModify, targetFilesToModify, filesToDelete := Stage3(
-			projectRootDir,
+			logger.Infoln("Resuming processing from saved state")
+			state, err = loadState(perpetualDir, projectRootDir)
+			if err != nil {
+				if rmErr := removeState(perpetualDir); rmErr != nil {
+					logger.Errorln("Failed to remove invalid state file:", rmErr)
+				}
+				logger.Panicln("Failed to load implement state file:", err)
+			}
+			if stepMode == "resume" {
+				if len(state.Stage4Files) < 1 {
+					logger.Warnln("No stage 4 progress found in saved state, starting stage 4 from the first file")
+				}
+			} else if len(state.Stage4Files) > 0 {
+				logger.Warnln("Discarding stage 4 progress found in saved state, use '-p resume' to continue from the first unfinished file")
+				state.Stage4Files = nil
+				state.Stage4Results = nil
+			}
+		}
+
+		// run either from json state file, or directly after stage 3
+		stashName := runFinalStages(projectRootDir,
 			perpetualDir,
 			projectConfig,
 			implementConfig,
-			projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
-			planningMode,
-			allFileNames,
-			projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
-			projectFilesBlacklist,
-			projectConfig.RegexpArray(config.K_ProjectNoUploadCommentsRx),
-			forceUpload,
-			filesToReview,
-			targetFiles,
-			messages,
-			task,
+			state,
+			noIncrMode,
+			fileNames,
+			version,
 			logger)
+		return stashName, state
+	}
 
-		state.OtherFilesToModify = otherFilesToModify
-		state.TargetFilesToModify = targetFilesToModify
-		state.FilesToDelete = filesToDelete
-		state.Messages = messages
+	if stepMode == "revise" {
+		_, allFileNames := fetchProjectFiles()
+		logger.Infoln("Loading saved state for revision")
+		state, err := loadState(perpetualDir, projectRootDir)
+		if err != nil {
+			logger.Panicln("Failed to load implement state file:", err)
+		}
+		if len(state.Stage2Messages) < 1 {
+			logger.Panicln("Saved state does not contain work plan history, cannot revise it. Run implement again with '-p start'")
+		}
 
-		//termination point, need to save state:
-		if stepMode == "start" {
-			logger.Debugln("Saving state file")
-			if err := saveState(perpetualDir, state); err != nil {
-				if rmErr := removeState(perpetualDir); rmErr != nil {
-					logger.Errorln("Failed to remove invalid state file:", rmErr)
+		// Normalize file paths provided with flags, all files must be inside project root directory
+		normalizeFiles := func(files []string) []string {
+			var result []string
+			for _, file := range files {
+				file, err := utils.MakePathRelative(projectRootDir, file, true)
+				if err != nil {
+					logger.Panicln("File is outside project root directory:", err)
 				}
-				logger.Panicln("Failed to save implement state file:", err)
+				result = append(result, file)
 			}
-			logger.Infoln("Processing will stop here, to complete scheduled changes run implement again with '-p finish'")
-
-			// Build a Markdown report with the generated reasoning and file changes.
-			var report strings.Builder
-			report.WriteString("# Work Plan for the Task\n\n")
-			if strings.TrimSpace(workplan) == "" {
-				report.WriteString("No work plan reasonings were generated.\n")
-			} else {
-				report.WriteString(strings.TrimSpace(workplan))
-				report.WriteByte('\n')
+			return result
+		}
+		filesToAdd := normalizeFiles(parseFileListFlag(planAddFiles))
+		filesToDelete := normalizeFiles(parseFileListFlag(planDeleteFiles))
+		filesToRemove := normalizeFiles(parseFileListFlag(planRemoveFiles))
+
+		// Read feedback only if requested explicitly or if no manual changes provided
+		if inputFile != "" || len(filesToAdd)+len(filesToDelete)+len(filesToRemove) == 0 {
+			if !state.PlanningMode {
+				logger.Panicln("Saved state was created without planning, cannot revise work plan")
 			}
+			feedback := loadInputText(inputFile, "feedback", logger)
+			// Revise work plan, re-run stage 3 with updated message history
+			state.Workplan, state.Stage2Messages = StageRevise(
+				projectRootDir,
+				perpetualDir,
+				projectConfig,
+				implementConfig,
+				projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+				state.Stage2Messages,
+				feedback,
+				logger)
+			state.Messages, state.OtherFilesToModify, state.TargetFilesToModify, state.FilesToDelete, state.FilesToMove, state.ReadonlyViolations = Stage3(
+				projectRootDir,
+				perpetualDir,
+				projectConfig,
+				implementConfig,
+				projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+				state.PlanningMode,
+				allFileNames,
+				projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
+				projectFilesBlacklist,
+				projectFilesReadonly,
+				projectConfig.RegexpArray(config.K_ProjectNoUploadCommentsRx),
+				forceUpload,
+				state.FilesToReview,
+				state.TargetFiles,
+				utils.NewSlice(state.Stage2Messages...),
+				state.Task,
+				logger)
+		}
 
-			report.WriteString("\n# Scheduled File Changes\n\n")
-			report.WriteString("## Files to Modify or Create\n\n")
-
-			for _, file := range otherFilesToModify {
-				report.WriteString("- `")
-				report.WriteString(file)
-				report.WriteString("`\n")
-			}
-			for _, file := range targetFilesToModify {
-				report.WriteString("- `")
-				report.WriteString(file)
-				report.WriteString("`\n")
+		if len(filesToAdd)+len(filesToDelete)+len(filesToRemove) > 0 {
+			logger.Infoln("Applying manual changes to scheduled files")
+			filesToAttach := editScheduledFiles(
+				&state,
+				filesToAdd,
+				filesToDelete,
+				filesToRemove,
+				allFileNames,
+				projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
+				projectFilesBlacklist,
+				projectFilesReadonly,
+				logger)
+			// Attach contents of added existing files to the same message used by stage 3 for extra files,
+			// so LLM will not overwrite them from scratch
+			if len(filesToAttach) > 0 {
+				msgIndex := max(len(state.Stage2Messages)-2, 0)
+				state.Messages[msgIndex] = llm.AddPlainTextFragment(state.Messages[msgIndex], implementConfig.String(config.K_ImplementStage3ExtraFilesPrompt))
+				for _, file := range filesToAttach {
+					state.Messages[msgIndex] = llm.AppendSourceFileToMessage(state.Messages[msgIndex], projectRootDir, file, projectConfig.Tags(config.K_ProjectFilenameTags), logger)
+				}
+				state.Stage2Messages[msgIndex] = state.Messages[msgIndex]
 			}
-			if len(otherFilesToModify) == 0 && len(targetFilesToModify) == 0 {
-				report.WriteString("None.\n")
+			// Update file-list response generated at stage 3
+			if state.PlanningMode {
+				state.Messages[len(state.Messages)-1] = composeFileListResponse(projectConfig, state.OtherFilesToModify, state.TargetFilesToModify, state.FilesToDelete, state.FilesToMove)
 			}
+		}
+
+		// Scheduled changes was revised, discard stage 4 progress if any
+		state.Stage4Files = nil
+		state.Stage4Results = nil
+
+		state.collectTokenUsage()
+		logger.Debugln("Saving state file")
+		if err := saveState(perpetualDir, state); err != nil {
+			logger.Panicln("Failed to save implement state file:", err)
+		}
+		logger.Infoln("Saved state updated, to complete scheduled changes run implement again with '-p finish'")
+		writePlanReport(outputFile, state, logger)
+		return
+	}
 
-			report.WriteString("\n## Files to Delete\n\n")
-			for _, file := range filesToDelete {
-				report.WriteString("- `")
-				report.WriteString(file)
-				report.WriteString("`\n")
+	if queueFile != "" {
+		logger.Infoln("Reading task-queue from file")
+		tasks, err := loadTaskQueue(queueFile)
+		if err != nil {
+			logger.Panicln("Error reading task-queue:", err)
+		}
+		if len(tasks) < 1 {
+			logger.Panicln("Task-queue is empty, cannot continue")
+		}
+
+		// In branch git mode, branch of every task is created from the same commit, so the branches are independent
+		queueGitRef := ""
+		if gitMode == utils.GitModeBranch && stepMode == "" {
+			if queueGitRef, err = utils.GitGetCurrentRef(projectRootDir); err != nil {
+				logger.Panicln("Error getting current git branch:", err)
 			}
-			if len(filesToDelete) == 0 {
-				report.WriteString("None.\n")
+		}
+
+		report := queueReport{QueueFile: queueFile, Total: len(tasks)}
+		for i, queuedTask := range tasks {
+			result := queueTaskResult{Index: i + 1, ID: queuedTask.ID}
+			if queueStopOnFail && report.Failed > 0 {
+				logger.Warnf("Skipping task %d/%d from queue: %s", i+1, len(tasks), queuedTask.ID)
+				result.Status = queueTaskSkipped
+				report.addResult(result)
+				continue
 			}
 
-			if outputFile == "" || outputFile == "-" {
-				if err := utils.WriteTextStdout(report.String()); err != nil {
-					logger.Panicln("Failed to write implement report to stdout:", err)
-				}
-			} else {
-				logger.Infoln("Writing implement report:", outputFile)
-				wrn, err := utils.SaveTextFile(outputFile, report.String())
-				if err != nil {
-					logger.Panicln("Failed to write implement report:", err)
+			logger.Infof("Implementing task %d/%d from queue: %s", i+1, len(tasks), queuedTask.ID)
+			// Only the state of the last failed task is kept for resuming
+			if rmErr := removeState(perpetualDir); rmErr != nil {
+				logger.Panicln("Failed to remove stale state file:", rmErr)
+			}
+			result.StartedAt = time.Now()
+			var taskState state
+			errMsg := runQueuedTask(func() {
+				if i > 0 {
+					checkGitWorkingTree()
 				}
-				if wrn != "" {
-					logger.Warnf("%s: %s", outputFile, wrn)
+				result.Stash, taskState = implementTask(queuedTask.Task)
+			})
+			result.FinishedAt = time.Now()
+			if queueGitRef != "" {
+				if currentRef, err := utils.GitGetCurrentRef(projectRootDir); err == nil && currentRef != queueGitRef {
+					logger.Infoln("Switching back to git branch:", queueGitRef)
+					if err := utils.GitSwitchRef(projectRootDir, queueGitRef); err != nil {
+						logger.Panicln("Error switching back to git branch:", err)
+					}
 				}
 			}
-			return
+			if errMsg != "" {
+				logger.Errorf("Task %d/%d from queue failed: %s", i+1, len(tasks), errMsg)
+				result.Status = queueTaskFailed
+				result.Error = errMsg
+			} else {
+				result.Status = queueTaskDone
+				result.FilesModified = append(utils.NewSlice(taskState.OtherFilesToModify...), taskState.TargetFilesToModify...)
+				result.FilesDeleted = taskState.FilesToDelete
+				result.FilesMoved = taskState.FilesToMove
+			}
+			report.addResult(result)
+
+			// Drop source files cached while processing the task, so the next task will see changes made by this one
+			llm.ClearSourceFileCache()
+			if queueNoReannotate {
+				noAnnotate = true
+			}
 		}
-	} else {
-		logger.Infoln("Resuming processing from saved state")
-		state, err = loadState(perpetualDir, projectRootDir)
-		if err != nil {
-			if rmErr := removeState(perpetualDir); rmErr != nil {
-				logger.Errorln("Failed to remove invalid state file:", rmErr)
+
+		if outputFile == "" || outputFile == "-" {
+			if err := report.writeStdout(); err != nil {
+				logger.Panicln("Failed to write task-queue report to stdout:", err)
+			}
+		} else {
+			logger.Infoln("Writing task-queue report:", outputFile)
+			if err := utils.SaveJsonFile(outputFile, report); err != nil {
+				logger.Panicln("Failed to write task-queue report:", err)
 			}
-			logger.Panicln("Failed to load implement state file:", err)
 		}
+
+		logger.Infof("Task-queue processing completed: %d done, %d failed, %d skipped", report.Done, report.Failed, report.Skipped)
+		if report.Failed > 0 {
+			logger.Panicln("Not all tasks from the task-queue were successfully implemented")
+		}
+		return
 	}
 
-	// run either from json state file, or directly after stage 3
-	runFinalStages(projectRootDir,
-		perpetualDir,
-		projectConfig,
-		implementConfig,
-		state.OtherFilesToModify,
-		state.TargetFilesToModify,
-		state.FilesToDelete,
-		state.Messages,
-		noIncrMode,
-		fileNames,
-		logger)
+	// Read input from file or stdin
+	var task string
+	if mode == "task" {
+		task = loadInputText(inputFile, "task", logger)
+	}
+
+	implementTask(task)
 }
 
-// run stage 4 from here and finalize, may be run after continue
+// run stage 4 from here and finalize, may be run after continue.
+// State with stage 4 progress is saved after each processed file, so interrupted stage 4 can be resumed later
 func runFinalStages(
 	projectRootDir string,
 	perpetualDir string,
 	projectConfig config.Config,
 	implementConfig config.Config,
-	otherFilesToModify []string,
-	targetFilesToModify []string,
-	filesToDelete []string,
-	messages []llm.Message,
+	state state,
 	noIncrMode bool,
 	fileNames []string,
-	logger logging.ILogger) {
+	version string,
+	logger logging.ILogger) string {
+
+	// Failsafe: read-only patterns may be changed after the state was saved
+	otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove, _ := filterReadonlyChanges(
+		state.OtherFilesToModify,
+		state.TargetFilesToModify,
+		state.FilesToDelete,
+		state.FilesToMove,
+		projectConfig.RegexpArray(config.K_ProjectFilesReadonly),
+		logger)
+
+	state.recordStageModel("stage4", implementConfig)
+	saveProgress := func(completedFiles []string, completedFileContents map[string]string) {
+		state.Stage4Files = completedFiles
+		state.Stage4Results = completedFileContents
+		state.collectTokenUsage()
+		logger.Debugln("Saving state file with stage 4 progress")
+		if err := saveState(perpetualDir, state); err != nil {
+			logger.Errorln("Failed to save implement state file, stage 4 will not be resumable:", err)
+		}
+	}
+	saveProgress(state.Stage4Files, state.Stage4Results)
 
 	// Run stage 4 - implement code in selected files
 	results := Stage4(
@@ -581,13 +849,17 @@ func runFinalStages(
 		projectConfig,
 		implementConfig,
 		projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
-		messages,
+		state.Messages,
 		otherFilesToModify,
 		targetFilesToModify,
 		noIncrMode,
+		filesToMove,
+		state.Stage4Files,
+		state.Stage4Results,
+		saveProgress,
 		logger)
 
-	// Extra failsafe: filter-out files from results that not among initial files to modify
+	// Extra failsafe: filter-out files from results that not among initial files to modify, read-only files already excluded from them
 	var filteredResults = make(map[string]string)
 	finalFilesToModify := append(utils.NewSlice(targetFilesToModify...), otherFilesToModify...)
 	for file, content := range results {
@@ -596,10 +868,145 @@ func runFinalStages(
 			logger.Warnln("Skipping file from results that not among files to modify:", file)
 			continue
 		}
+		// Secrets were replaced with placeholders in file contents sent to LLM, put them back
+		content, unknown := llm.RestoreSecrets(content)
+		for _, placeholder := range unknown {
+			logger.Warnf("Cannot restore redacted secret %s in file: %s", placeholder, file)
+		}
 		filteredResults[file] = content
 	}
 
 	// Create and apply stash from generated results
-	newStashFileName := op_stash.CreateStash(filteredResults, fileNames, filesToDelete, logger)
+	state.collectTokenUsage()
+	metadata := op_stash.Metadata{
+		Operation:        OpName,
+		Mode:             state.Mode,
+		Task:             state.Task,
+		TargetFiles:      state.TargetFiles,
+		Workplan:         state.Workplan,
+		Models:           state.Models,
+		TokenUsage:       state.TokenUsage,
+		StartedAt:        state.StartedAt,
+		PerpetualVersion: version,
+	}
+	newStashFileName := op_stash.CreateStash(filteredResults, fileNames, filesToDelete, filesToMove, metadata, projectConfig.String(config.K_ProjectStashCompression), logger)
 	op_stash.Run([]string{"-m", "apply", "-s", newStashFileName}, true, logger)
+	// Commit applied changes to git if enabled
+	if gitMode := projectConfig.String(config.K_ProjectGitMode); gitMode != utils.GitModeNone {
+		op_stash.CommitStash(newStashFileName, gitMode, projectConfig.String(config.K_ProjectGitBranchPrefix), logger)
+	}
+	// Remove old stashes according to retention settings
+	op_stash.Run([]string{"-m", "prune"}, true, logger)
+
+	// Changes are applied, stage 4 progress is not needed anymore
+	if err := removeState(perpetualDir); err != nil {
+		logger.Errorln("Failed to remove implement state file:", err)
+	}
+	return newStashFileName
+}
+
+// loadInputText reads text (task or feedback) from file or stdin, stops on empty input
+func loadInputText(inputFile string, subject string, logger logging.ILogger) string {
+	var text string
+	if inputFile == "" || inputFile == "-" {
+		logger.Infof("Reading %s from stdin", subject)
+		data, wrn, err := utils.LoadTextStdin()
+		if err != nil {
+			logger.Panicln("Error reading from stdin:", err)
+		}
+		if wrn != "" {
+			logger.Warnf("stdin: %s", wrn)
+		}
+		text = string(data)
+	} else {
+		logger.Infof("Reading %s from file", subject)
+		data, wrn, err := utils.LoadTextFile(inputFile)
+		if err != nil {
+			logger.Panicf("Error reading %s from input file: %v", subject, err)
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", inputFile, wrn)
+		}
+		text = data
+	}
+	// Trim excess line breaks at both sides of text, and stop on empty input
+	text = strings.Trim(text, "\n")
+	if len(text) < 1 {
+		logger.Panicf("%s%s is empty, cannot continue", strings.ToUpper(subject[:1]), subject[1:])
+	}
+	return text
+}
+
+// writePlanReport writes Markdown report with the generated work plan and scheduled file changes to file or stdout
+func writePlanReport(outputFile string, state state, logger logging.ILogger) {
+	var report strings.Builder
+	report.WriteString("# Work Plan for the Task\n\n")
+	if strings.TrimSpace(state.Workplan) == "" {
+		report.WriteString("No work plan reasonings were generated.\n")
+	} else {
+		report.WriteString(strings.TrimSpace(state.Workplan))
+		report.WriteByte('\n')
+	}
+
+	report.WriteString("\n# Scheduled File Changes\n\n")
+	report.WriteString("## Files to Modify or Create\n\n")
+
+	for _, file := range state.OtherFilesToModify {
+		report.WriteString("- `")
+		report.WriteString(file)
+		report.WriteString("`\n")
+	}
+	for _, file := range state.TargetFilesToModify {
+		report.WriteString("- `")
+		report.WriteString(file)
+		report.WriteString("`\n")
+	}
+	if len(state.OtherFilesToModify) == 0 && len(state.TargetFilesToModify) == 0 {
+		report.WriteString("None.\n")
+	}
+
+	report.WriteString("\n## Files to Delete\n\n")
+	for _, file := range state.FilesToDelete {
+		report.WriteString("- `")
+		report.WriteString(file)
+		report.WriteString("`\n")
+	}
+	if len(state.FilesToDelete) == 0 {
+		report.WriteString("None.\n")
+	}
+
+	if len(state.FilesToMove) > 0 {
+		report.WriteString("\n## Files to Move or Rename\n\n")
+		for _, source := range slices.Sorted(maps.Keys(state.FilesToMove)) {
+			report.WriteString("- `")
+			report.WriteString(source)
+			report.WriteString("` -> `")
+			report.WriteString(state.FilesToMove[source])
+			report.WriteString("`\n")
+		}
+	}
+
+	if len(state.ReadonlyViolations) > 0 {
+		report.WriteString("\n## Rejected Changes to Read-Only Files\n\n")
+		for _, violation := range state.ReadonlyViolations {
+			report.WriteString("- ")
+			report.WriteString(violation)
+			report.WriteByte('\n')
+		}
+	}
+
+	if outputFile == "" || outputFile == "-" {
+		if err := utils.WriteTextStdout(report.String()); err != nil {
+			logger.Panicln("Failed to write implement report to stdout:", err)
+		}
+	} else {
+		logger.Infoln("Writing implement report:", outputFile)
+		wrn, err := utils.SaveTextFile(outputFile, report.String())
+		if err != nil {
+			logger.Panicln("Failed to write implement report:", err)
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", outputFile, wrn)
+		}
+	}
 }
@@ -0,0 +1,203 @@
+package op_implement
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+const (
+	queueTaskDone    = "done"
+	queueTaskFailed  = "failed"
+	queueTaskSkipped = "skipped"
+)
+
+// queuedTask is a single task read from the task-queue file
+type queuedTask struct {
+	ID   string `json:"id,omitempty"`
+	Task string `json:"task"`
+}
+
+// queueTaskResult is a summary entry for a single task from the task-queue
+type queueTaskResult struct {
+	Index         int               `json:"index"`
+	ID            string            `json:"id"`
+	Status        string            `json:"status"`
+	Error         string            `json:"error,omitempty"`
+	Stash         string            `json:"stash,omitempty"`
+	FilesModified []string          `json:"files_modified,omitempty"`
+	FilesDeleted  []string          `json:"files_deleted,omitempty"`
+	FilesMoved    map[string]string `json:"files_moved,omitempty"`
+	StartedAt     time.Time         `json:"started_at,omitzero"`
+	FinishedAt    time.Time         `json:"finished_at,omitzero"`
+}
+
+// queueReport is a machine-readable report produced after processing the task-queue
+type queueReport struct {
+	QueueFile string            `json:"queue_file"`
+	Total     int               `json:"total"`
+	Done      int               `json:"done"`
+	Failed    int               `json:"failed"`
+	Skipped   int               `json:"skipped"`
+	Tasks     []queueTaskResult `json:"tasks"`
+}
+
+func (r *queueReport) addResult(result queueTaskResult) {
+	switch result.Status {
+	case queueTaskDone:
+		r.Done++
+	case queueTaskFailed:
+		r.Failed++
+	case queueTaskSkipped:
+		r.Skipped++
+	}
+	r.Tasks = append(r.Tasks, result)
+}
+
+func (r *queueReport) writeStdout() error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteTextStdout(string(data) + "\n")
+}
+
+// runQueuedTask runs the task from the task-queue, and recovers from the logger panic raised on task failure,
+// so processing of the task-queue can continue. Returns error message if task failed
+func runQueuedTask(taskFunc func()) (errMsg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			lp, ok := r.(logging.LoggerPanic)
+			if !ok {
+				panic(r)
+			}
+			errMsg = strings.TrimSpace(lp.Message)
+			if errMsg == "" {
+				errMsg = "unknown error"
+			}
+		}
+	}()
+	taskFunc()
+	return ""
+}
+
+// loadTaskQueue reads tasks from the task-queue file: JSONL if file has .jsonl extension, Markdown otherwise
+func loadTaskQueue(queueFile string) ([]queuedTask, error) {
+	text, _, err := utils.LoadTextFile(queueFile)
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(filepath.Ext(queueFile)) == ".jsonl" {
+		return parseJsonlTaskQueue(text)
+	}
+	return parseMarkdownTaskQueue(text)
+}
+
+// parseJsonlTaskQueue parses tasks from JSONL text, each non-empty line is either
+// a JSON object with "task" and optional "id" fields, or a plain JSON string with the task
+func parseJsonlTaskQueue(text string) ([]queuedTask, error) {
+	var tasks []queuedTask
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		var task queuedTask
+		if strings.HasPrefix(line, "\"") {
+			if err := json.Unmarshal([]byte(line), &task.Task); err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+		} else if err := json.Unmarshal([]byte(line), &task); err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		task.Task = strings.Trim(task.Task, "\n")
+		if strings.TrimSpace(task.Task) == "" {
+			return nil, fmt.Errorf("line %d: task is empty", i+1)
+		}
+		if task.ID == "" {
+			task.ID = fmt.Sprintf("task-%d", len(tasks)+1)
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+var markdownHeadingRx = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+var markdownFenceRx = regexp.MustCompile("^\\s*(```|~~~)")
+
+// parseMarkdownTaskQueue splits Markdown text into tasks by its top-level headings (headings inside code blocks are ignored).
+// Heading text is used as task id, heading itself is kept as part of the task. Text without headings is a single task
+func parseMarkdownTaskQueue(text string) ([]queuedTask, error) {
+	lines := strings.Split(text, "\n")
+
+	// Find heading lines outside of fenced code blocks, and detect top heading level
+	type heading struct {
+		line  int
+		level int
+		title string
+	}
+	var headings []heading
+	topLevel := 7
+	fence := ""
+	for i, line := range lines {
+		if m := markdownFenceRx.FindStringSubmatch(line); m != nil {
+			if fence == "" {
+				fence = m[1]
+			} else if fence == m[1] {
+				fence = ""
+			}
+			continue
+		}
+		if fence != "" {
+			continue
+		}
+		if m := markdownHeadingRx.FindStringSubmatch(line); m != nil {
+			headings = append(headings, heading{line: i, level: len(m[1]), title: m[2]})
+			topLevel = min(topLevel, len(m[1]))
+		}
+	}
+
+	var sectionStarts []heading
+	for _, h := range headings {
+		if h.level == topLevel {
+			sectionStarts = append(sectionStarts, h)
+		}
+	}
+
+	if len(sectionStarts) < 1 {
+		task := strings.Trim(text, "\n")
+		if strings.TrimSpace(task) == "" {
+			return nil, nil
+		}
+		return []queuedTask{{ID: "task-1", Task: task}}, nil
+	}
+
+	if preamble := strings.Join(lines[:sectionStarts[0].line], "\n"); strings.TrimSpace(preamble) != "" {
+		return nil, fmt.Errorf("text found before the first task heading at line %d", sectionStarts[0].line+1)
+	}
+
+	var tasks []queuedTask
+	for i, start := range sectionStarts {
+		end := len(lines)
+		if i+1 < len(sectionStarts) {
+			end = sectionStarts[i+1].line
+		}
+		task := strings.Trim(strings.Join(lines[start.line:end], "\n"), "\n")
+		body := strings.TrimSpace(strings.Join(lines[start.line+1:end], "\n"))
+		if body == "" {
+			return nil, fmt.Errorf("task at line %d is empty", start.line+1)
+		}
+		id := start.title
+		if id == "" {
+			id = fmt.Sprintf("task-%d", i+1)
+		}
+		tasks = append(tasks, queuedTask{ID: id, Task: task})
+	}
+	return tasks, nil
+}
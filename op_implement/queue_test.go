@@ -0,0 +1,94 @@
+package op_implement
+
+import (
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/logging"
+)
+
+func TestParseMarkdownTaskQueue(t *testing.T) {
+	text := "# First task\n\nDo the first thing.\n\n## Details\n\nMore details.\n\n```md\n# Not a heading\n```\n\n# Second task\n\nDo the second thing.\n"
+
+	tasks, err := parseMarkdownTaskQueue(text)
+	if err != nil {
+		t.Fatalf("parseMarkdownTaskQueue() error = %v", err)
+	}
+	if len(tasks) != 2 {
+		t.Fatalf("parseMarkdownTaskQueue() returned %d tasks, want 2", len(tasks))
+	}
+
+	if tasks[0].ID != "First task" {
+		t.Errorf("tasks[0].ID = %q, want %q", tasks[0].ID, "First task")
+	}
+	expected := "# First task\n\nDo the first thing.\n\n## Details\n\nMore details.\n\n```md\n# Not a heading\n```"
+	if tasks[0].Task != expected {
+		t.Errorf("tasks[0].Task = %q, want %q", tasks[0].Task, expected)
+	}
+
+	if tasks[1].ID != "Second task" {
+		t.Errorf("tasks[1].ID = %q, want %q", tasks[1].ID, "Second task")
+	}
+	if tasks[1].Task != "# Second task\n\nDo the second thing." {
+		t.Errorf("tasks[1].Task = %q", tasks[1].Task)
+	}
+}
+
+func TestParseMarkdownTaskQueueWithoutHeadings(t *testing.T) {
+	tasks, err := parseMarkdownTaskQueue("\nSingle task without headings\n\n")
+	if err != nil {
+		t.Fatalf("parseMarkdownTaskQueue() error = %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Task != "Single task without headings" {
+		t.Fatalf("parseMarkdownTaskQueue() = %+v", tasks)
+	}
+}
+
+func TestParseMarkdownTaskQueueErrors(t *testing.T) {
+	if _, err := parseMarkdownTaskQueue("Preamble text\n\n# Task\n\nBody\n"); err == nil {
+		t.Errorf("expected error for text before the first heading")
+	}
+	if _, err := parseMarkdownTaskQueue("# Task 1\n\n# Task 2\n\nBody\n"); err == nil {
+		t.Errorf("expected error for empty task section")
+	}
+}
+
+func TestParseJsonlTaskQueue(t *testing.T) {
+	text := "{\"id\": \"fix-bug\", \"task\": \"Fix the bug\"}\n\n\"Plain string task\"\n{\"task\": \"Task without id\\nsecond line\"}\n"
+
+	tasks, err := parseJsonlTaskQueue(text)
+	if err != nil {
+		t.Fatalf("parseJsonlTaskQueue() error = %v", err)
+	}
+	expected := []queuedTask{
+		{ID: "fix-bug", Task: "Fix the bug"},
+		{ID: "task-2", Task: "Plain string task"},
+		{ID: "task-3", Task: "Task without id\nsecond line"},
+	}
+	if len(tasks) != len(expected) {
+		t.Fatalf("parseJsonlTaskQueue() returned %d tasks, want %d", len(tasks), len(expected))
+	}
+	for i := range expected {
+		if tasks[i] != expected[i] {
+			t.Errorf("tasks[%d] = %+v, want %+v", i, tasks[i], expected[i])
+		}
+	}
+
+	if _, err := parseJsonlTaskQueue("{\"id\": \"empty\", \"task\": \"\"}\n"); err == nil {
+		t.Errorf("expected error for empty task")
+	}
+	if _, err := parseJsonlTaskQueue("{not json}\n"); err == nil {
+		t.Errorf("expected error for invalid JSON")
+	}
+}
+
+func TestRunQueuedTaskRecoversLoggerPanic(t *testing.T) {
+	errMsg := runQueuedTask(func() {
+		panic(logging.LoggerPanic{Message: "task failed\n"})
+	})
+	if errMsg != "task failed" {
+		t.Errorf("runQueuedTask() = %q, want %q", errMsg, "task failed")
+	}
+	if errMsg := runQueuedTask(func() {}); errMsg != "" {
+		t.Errorf("runQueuedTask() = %q, want empty", errMsg)
+	}
+}
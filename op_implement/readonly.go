@@ -0,0 +1,73 @@
+package op_implement
+
+import (
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// isReadonlyFile checks whether file matches project_files_readonly patterns:
+// such files may be provided to LLM for reading, but must never be modified, deleted or moved
+func isReadonlyFile(file string, projectFilesReadonly []*regexp.Regexp) bool {
+	_, dropped := utils.FilterFilesWithBlacklist([]string{file}, projectFilesReadonly)
+	return len(dropped) > 0
+}
+
+// formatReadonlyViolation describes rejected change of the read-only file for the plan report,
+// move is described with both source and destination files
+func formatReadonlyViolation(change string, files ...string) string {
+	return fmt.Sprintf("`%s` (%s)", strings.Join(files, "` -> `"), change)
+}
+
+// filterReadonlyChanges removes scheduled changes touching read-only files.
+// Returns filtered lists of files to modify, delete and move, and descriptions of rejected changes
+func filterReadonlyChanges(
+	otherFilesToModify []string,
+	targetFilesToModify []string,
+	filesToDelete []string,
+	filesToMove map[string]string,
+	projectFilesReadonly []*regexp.Regexp,
+	logger logging.ILogger) ([]string, []string, []string, map[string]string, []string) {
+
+	if len(projectFilesReadonly) < 1 {
+		return otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove, nil
+	}
+
+	var violations []string
+	filterFiles := func(files []string, change string) []string {
+		var result []string
+		for _, file := range files {
+			if isReadonlyFile(file, projectFilesReadonly) {
+				logger.Warnf("Skipping %s of read-only file: %s", change, file)
+				violations = append(violations, formatReadonlyViolation(change, file))
+				continue
+			}
+			result = append(result, file)
+		}
+		return result
+	}
+
+	targetFilesToModify = filterFiles(targetFilesToModify, "modify")
+	otherFilesToModify = filterFiles(otherFilesToModify, "modify")
+	filesToDelete = filterFiles(filesToDelete, "delete")
+
+	filteredFilesToMove := map[string]string{}
+	for _, source := range slices.Sorted(maps.Keys(filesToMove)) {
+		dest := filesToMove[source]
+		if isReadonlyFile(source, projectFilesReadonly) || isReadonlyFile(dest, projectFilesReadonly) {
+			logger.Warnf("Skipping move of read-only file: %s -> %s", source, dest)
+			violations = append(violations, formatReadonlyViolation("move", source, dest))
+			// Destination file is generated from the source, it must not be created without moving the source
+			otherFilesToModify, _ = removeScheduledFile(otherFilesToModify, dest)
+			continue
+		}
+		filteredFilesToMove[source] = dest
+	}
+
+	return otherFilesToModify, targetFilesToModify, filesToDelete, filteredFilesToMove, violations
+}
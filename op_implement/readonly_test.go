@@ -0,0 +1,67 @@
+package op_implement
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFilterReadonlyChanges(t *testing.T) {
+	readonly := []*regexp.Regexp{regexp.MustCompile(`(?i)^generated(\\|\/).*`), regexp.MustCompile(`(?i)^api\.go$`)}
+
+	other, target, toDelete, toMove, violations := filterReadonlyChanges(
+		[]string{"main.go", filepath.Join("generated", "types.go"), "moved.go", "api_v2.go"},
+		[]string{"API.go"},
+		[]string{"old.go", filepath.Join("generated", "old.go")},
+		map[string]string{"util.go": "helpers.go", "src.go": "moved.go", "api.go": "api_v2.go"},
+		readonly,
+		newTestLogger(t))
+
+	// Destination of rejected move must not be generated
+	if !slices.Equal(other, []string{"main.go", "moved.go"}) {
+		t.Errorf("otherFilesToModify = %v", other)
+	}
+	if len(target) != 0 {
+		t.Errorf("targetFilesToModify = %v, want empty", target)
+	}
+	if !slices.Equal(toDelete, []string{"old.go"}) {
+		t.Errorf("filesToDelete = %v", toDelete)
+	}
+	if !maps.Equal(toMove, map[string]string{"util.go": "helpers.go", "src.go": "moved.go"}) {
+		t.Errorf("filesToMove = %v", toMove)
+	}
+	expected := []string{
+		"`API.go` (modify)",
+		"`" + filepath.Join("generated", "types.go") + "` (modify)",
+		"`" + filepath.Join("generated", "old.go") + "` (delete)",
+		"`api.go` -> `api_v2.go` (move)",
+	}
+	if !slices.Equal(violations, expected) {
+		t.Errorf("violations = %v, want %v", violations, expected)
+	}
+
+	other, _, _, _, violations = filterReadonlyChanges([]string{"main.go"}, nil, nil, nil, nil, newTestLogger(t))
+	if !slices.Equal(other, []string{"main.go"}) || len(violations) != 0 {
+		t.Errorf("changes must not be filtered without read-only patterns: %v, %v", other, violations)
+	}
+}
+
+func TestWritePlanReportReadonlyViolations(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "plan.md")
+	writePlanReport(outputFile, state{
+		OtherFilesToModify: []string{"main.go"},
+		ReadonlyViolations: []string{"`api.go` (modify)"},
+	}, newTestLogger(t))
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read report: %v", err)
+	}
+	if !strings.Contains(string(data), "## Rejected Changes to Read-Only Files\n\n- `api.go` (modify)\n") {
+		t.Errorf("report does not contain rejected changes:\n%s", data)
+	}
+}
@@ -0,0 +1,167 @@
+package op_implement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// implementRegion is a region of the file marked with begin and end implement-comments,
+// Start and End are indices of the lines with that comments
+type implementRegion struct {
+	Start int
+	End   int
+}
+
+// findImplementRegions searches the text for regions marked with begin and end implement-comments.
+// Returns error if regions are nested or not closed
+func findImplementRegions(text string, beginRx, endRx *regexp.Regexp) ([]implementRegion, error) {
+	var regions []implementRegion
+	start := -1
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		if beginRx.MatchString(line) {
+			if start >= 0 {
+				return nil, fmt.Errorf("line %d: region begin comment found inside region started at line %d", i+1, start+1)
+			}
+			start = i
+		} else if endRx.MatchString(line) {
+			if start < 0 {
+				return nil, fmt.Errorf("line %d: region end comment found outside of region", i+1)
+			}
+			regions = append(regions, implementRegion{Start: start, End: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		return nil, fmt.Errorf("line %d: region is not closed", start+1)
+	}
+	return regions, nil
+}
+
+// hasMatchesOutsideRegions returns true if any line of the text outside of the regions matches any of the regexps,
+// for example when the file also contains regular implement-comments that must be processed with the whole file
+func hasMatchesOutsideRegions(text string, regions []implementRegion, rxs []*regexp.Regexp) bool {
+	next := 0
+	for i, line := range strings.Split(text, "\n") {
+		if next < len(regions) && i > regions[next].End {
+			next++
+		}
+		if next < len(regions) && i >= regions[next].Start {
+			continue
+		}
+		line = strings.TrimSuffix(line, "\r")
+		for _, rx := range rxs {
+			if rx.MatchString(line) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getRegionText returns the text of the region, including the lines with begin and end comments
+func getRegionText(text string, region implementRegion) string {
+	return strings.Join(strings.Split(text, "\n")[region.Start:region.End+1], "\n")
+}
+
+// spliceImplementRegions replaces the regions of the text (including the lines with begin and end comments)
+// with the provided replacements, regions must be sorted and must not overlap
+func spliceImplementRegions(text string, regions []implementRegion, replacements []string) string {
+	lines := strings.Split(text, "\n")
+	var result []string
+	pos := 0
+	for i, region := range regions {
+		result = append(result, lines[pos:region.Start]...)
+		if replacement := strings.TrimRight(replacements[i], "\r\n"); replacement != "" {
+			result = append(result, replacement)
+		}
+		pos = region.End + 1
+	}
+	result = append(result, lines[pos:]...)
+	return strings.Join(result, "\n")
+}
+
+// implementFileRegions asks LLM to implement code for each region of the file separately, and splices results back into the file.
+// Returns false if implementing of any region failed, so the whole file must be processed instead
+func implementFileRegions(
+	connector llm.LLMConnector,
+	allowCaching bool,
+	perpetualDir string,
+	prCfg config.Config,
+	cfg config.Config,
+	stage4Messages []llm.Message,
+	pendingFile string,
+	fileBody string,
+	regions []implementRegion,
+	logger logging.ILogger) (string, bool) {
+
+	// Create prompt for region processing
+	stage4ProcessRegionPrompt, err := utils.ReplaceTagRx(
+		cfg.String(config.K_ImplementStage4ProcessRegionPrompt),
+		cfg.Regexp(config.K_ImplementFilenameEmbedRx),
+		pendingFile)
+	if err != nil {
+		logger.Errorln("Failed to replace filename tag", err)
+		stage4ProcessRegionPrompt = cfg.String(config.K_ImplementStage4ProcessRegionPrompt)
+	}
+
+	// Message history extended with previously implemented regions of the file
+	regionMessages := utils.NewSlice(stage4Messages...)
+	var replacements []string
+	for i, region := range regions {
+		logger.Debugf("Implementing region #%d, lines %d-%d", i+1, region.Start+1, region.End+1)
+		request := llm.AddPlainTextFragment(llm.NewMessage(llm.UserRequest), stage4ProcessRegionPrompt)
+		request = llm.AddFileFragment(request, pendingFile, getRegionText(fileBody, region), prCfg.Tags(config.K_ProjectFilenameTags))
+
+		replacement := ""
+		regionOk := false
+		onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
+		for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
+			llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== Implement (stage 4): %s, region #%d\n\n\n", pendingFile, i+1))
+			aiResponse, status, err := connector.Query(allowCaching, append(utils.NewSlice(regionMessages...), request)...)
+			if perfString := connector.GetPerfString(); perfString != "" {
+				logger.Traceln(perfString)
+			}
+			// Request-size violations cannot be resolved by retrying the same request
+			if status == llm.QueryRequestTooLarge {
+				logger.Panicf("LLM request size limit reached during stage4 while processing %s: %v", pendingFile, err)
+			}
+			if err != nil {
+				logger.Warnln("LLM query failed:", err)
+				continue
+			} else if status == llm.QueryMaxTokens {
+				logger.Warnln("LLM query reached token limit")
+				continue
+			}
+			bodies, err := utils.ParseMultiTaggedTextRx(
+				aiResponse,
+				utils.GetEvenRegexps(prCfg.RegexpArray(config.K_ProjectCodeTagsRx)),
+				utils.GetOddRegexps(prCfg.RegexpArray(config.K_ProjectCodeTagsRx)),
+				false)
+			if err != nil {
+				logger.Warnln("Error while parsing LLM response with region code:", err)
+				continue
+			}
+			if len(bodies) != 1 {
+				logger.Warnln("Invalid number of code blocks detected in LLM response with region code:", len(bodies))
+				continue
+			}
+			replacement = bodies[0]
+			regionMessages = append(regionMessages, request, llm.SetRawResponse(llm.NewMessage(llm.SimulatedAIResponse), aiResponse))
+			regionOk = true
+			break
+		}
+		if !regionOk {
+			return "", false
+		}
+		replacements = append(replacements, replacement)
+	}
+
+	return spliceImplementRegions(fileBody, regions, replacements), true
+}
@@ -0,0 +1,78 @@
+package op_implement
+
+import (
+	"regexp"
+	"testing"
+)
+
+var testRegionBeginRx = regexp.MustCompile("^.*###IMPLEMENT-BEGIN###.*$")
+var testRegionEndRx = regexp.MustCompile("^.*###IMPLEMENT-END###.*$")
+
+func TestFindAndSpliceImplementRegions(t *testing.T) {
+	text := "package main\n\nfunc a() {\n\t// ###IMPLEMENT-BEGIN###\n\t// add logging\n\t// ###IMPLEMENT-END###\n}\n\nfunc b() {\n\t// ###IMPLEMENT-BEGIN###\n\t// ###IMPLEMENT-END###\n}\n"
+
+	regions, err := findImplementRegions(text, testRegionBeginRx, testRegionEndRx)
+	if err != nil {
+		t.Fatalf("findImplementRegions() error = %v", err)
+	}
+	expected := []implementRegion{{Start: 3, End: 5}, {Start: 9, End: 10}}
+	if len(regions) != len(expected) {
+		t.Fatalf("findImplementRegions() = %v, want %v", regions, expected)
+	}
+	for i := range expected {
+		if regions[i] != expected[i] {
+			t.Errorf("regions[%d] = %v, want %v", i, regions[i], expected[i])
+		}
+	}
+
+	if region := getRegionText(text, regions[0]); region != "\t// ###IMPLEMENT-BEGIN###\n\t// add logging\n\t// ###IMPLEMENT-END###" {
+		t.Errorf("getRegionText() = %q", region)
+	}
+
+	result := spliceImplementRegions(text, regions, []string{"\tlog.Println(\"a\")\n", ""})
+	want := "package main\n\nfunc a() {\n\tlog.Println(\"a\")\n}\n\nfunc b() {\n}\n"
+	if result != want {
+		t.Errorf("spliceImplementRegions() = %q, want %q", result, want)
+	}
+}
+
+func TestFindImplementRegionsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+	}{
+		{name: "nested", text: "###IMPLEMENT-BEGIN###\n###IMPLEMENT-BEGIN###\n###IMPLEMENT-END###\n"},
+		{name: "end without begin", text: "code\n###IMPLEMENT-END###\n"},
+		{name: "not closed", text: "###IMPLEMENT-BEGIN###\ncode\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := findImplementRegions(tt.text, testRegionBeginRx, testRegionEndRx); err == nil {
+				t.Errorf("findImplementRegions() expected error")
+			}
+		})
+	}
+}
+
+func TestFindImplementRegionsWithoutMarkers(t *testing.T) {
+	regions, err := findImplementRegions("package main\n// ###IMPLEMENT###\n", testRegionBeginRx, testRegionEndRx)
+	if err != nil || len(regions) != 0 {
+		t.Errorf("findImplementRegions() = %v, %v, want no regions", regions, err)
+	}
+}
+
+func TestHasMatchesOutsideRegions(t *testing.T) {
+	commentsRx := []*regexp.Regexp{regexp.MustCompile(`^\s*//\s*###IMPLEMENT###.*$`)}
+	text := "package main\n\n// ###IMPLEMENT-BEGIN###\n// ###IMPLEMENT###\n// ###IMPLEMENT-END###\n\nfunc a() {}\n"
+	regions, err := findImplementRegions(text, testRegionBeginRx, testRegionEndRx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasMatchesOutsideRegions(text, regions, commentsRx) {
+		t.Errorf("implement comment inside region reported as outside")
+	}
+	text += "\n// ###IMPLEMENT###\n"
+	if !hasMatchesOutsideRegions(text, regions, commentsRx) {
+		t.Errorf("implement comment outside of region not found")
+	}
+}
@@ -0,0 +1,207 @@
+package op_implement
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// StageRevise appends operator feedback to the saved stage 2 message history and requests an updated work plan.
+// Returns updated work plan and message history, that can be used to re-run stage 3
+func StageRevise(projectRootDir string,
+	perpetualDir string,
+	prCfg config.Config,
+	opCfg config.Config,
+	filesToMdLangMappings utils.TextMatcher[string],
+	stage2Messages []llm.Message,
+	feedback string,
+	logger logging.ILogger) (string, []llm.Message) {
+
+	logger.Traceln("StageRevise: Starting")
+	defer logger.Traceln("StageRevise: Finished")
+
+	// Use stage2 llm connector, work plan was generated with it
+	connector, err := llm.NewLLMConnector(
+		OpName+"_stage2",
+		opCfg.String(config.K_SystemPrompt),
+		opCfg.String(config.K_SystemPromptAck),
+		filesToMdLangMappings,
+		llm.GetSimpleRawMessageLogger(perpetualDir))
+	if err != nil {
+		logger.Panicln("Failed to create stage2 LLM connector:", err)
+	}
+
+	messages := utils.NewSlice(stage2Messages...)
+	if len(messages) > 0 {
+		// Mark current last message as cache breakpoint, previous message history will not change
+		messages[len(messages)-1].CacheBreakpoint = true
+	}
+
+	// Create request with feedback
+	request := llm.AddPlainTextFragment(llm.NewMessage(llm.UserRequest), opCfg.String(config.K_ImplementStage2RevisePrompt))
+	request = llm.AddPlainTextFragment(request, feedback)
+	messages = append(messages, request)
+	logger.Debugln("Created work plan revision request message")
+
+	logger.Infoln("Running stage2: revising work plan")
+	debugString := connector.GetDebugString()
+	logger.Notifyln(debugString)
+	llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== Implement (stage 2, revise): %s\n\n\n", debugString))
+
+	workplan := ""
+	onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
+	// allow explicit caching only if allowed with minimum repetitions: later stages can use different models or providers and cannot benefit from caching at this stage
+	allowCaching := connector.GetMinPrefixRepsForCaching() <= 1
+	for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
+		aiResponse, status, err := connector.Query(allowCaching, messages...)
+		if perfString := connector.GetPerfString(); perfString != "" {
+			logger.Traceln(perfString)
+		}
+		// Request-size violations cannot be resolved by retrying the same
+		// request, so terminate immediately.
+		if status == llm.QueryRequestTooLarge {
+			logger.Panicln("LLM request size limit reached while revising work plan:", err)
+		}
+		if err != nil {
+			if onFailRetriesLeft < 1 {
+				logger.Panicln("LLM query failed:", err)
+			} else {
+				logger.Warnln("LLM query failed, retrying:", err)
+			}
+			continue
+		} else if status == llm.QueryMaxTokens {
+			if onFailRetriesLeft < 1 {
+				logger.Panicln("LLM query reached token limit")
+			} else {
+				logger.Warnln("LLM query reached token limit, retrying")
+			}
+			continue
+		}
+		// Filter-out code blocks from response
+		workplan = utils.FilterAndTrimResponse(aiResponse, prCfg.RegexpArray(config.K_ProjectCodeTagsRx), logger)
+		if len(workplan) < 1 {
+			if onFailRetriesLeft < 1 {
+				logger.Panicln("Filtered work plan response from AI is empty or invalid")
+			} else {
+				logger.Warnln("Filtered work plan response from AI is empty or invalid, retrying")
+			}
+			continue
+		}
+		break
+	}
+
+	// Add response to message-history
+	messages = append(messages, llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), workplan))
+	logger.Debugln("Created revised work plan response message")
+	return workplan, messages
+}
+
+// parseFileListFlag splits comma-separated list of files provided with command line flag
+func parseFileListFlag(value string) []string {
+	var files []string
+	for file := range strings.SplitSeq(value, ",") {
+		file = strings.TrimSpace(file)
+		if file != "" {
+			files = append(files, utils.ConvertFilePathToOSFormat(file))
+		}
+	}
+	return files
+}
+
+// removeScheduledFile removes file from the list of scheduled files, case-insensitive
+func removeScheduledFile(files []string, target string) ([]string, bool) {
+	for i, file := range files {
+		if strings.EqualFold(file, target) {
+			return append(files[:i:i], files[i+1:]...), true
+		}
+	}
+	return files, false
+}
+
+// editScheduledFiles manually adds or removes files from the lists of scheduled file changes saved in the state.
+// Files must be relative to the project root. Returns list of existing project files added for modification,
+// which contents was not provided to LLM previously and must be attached to the message history
+func editScheduledFiles(
+	state *state,
+	filesToAdd []string,
+	filesToDelete []string,
+	filesToRemove []string,
+	allFileNames []string,
+	projectFilesWhitelist []*regexp.Regexp,
+	projectFilesBlacklist []*regexp.Regexp,
+	projectFilesReadonly []*regexp.Regexp,
+	logger logging.ILogger) []string {
+
+	checkFilters := func(file string) {
+		if fileWS, wsdr := utils.FilterFilesWithWhitelist([]string{file}, projectFilesWhitelist); len(wsdr) > 0 {
+			logger.Panicln("File is filtered by project whitelist:", file)
+		} else if _, bsdr := utils.FilterFilesWithBlacklist(fileWS, projectFilesBlacklist); len(bsdr) > 0 {
+			logger.Panicln("File is filtered by project or user blacklist:", file)
+		} else if isReadonlyFile(file, projectFilesReadonly) {
+			logger.Panicln("File is read-only according to project config:", file)
+		}
+	}
+
+	removeFromAll := func(file string) bool {
+		var removedOther, removedTarget, removedDelete bool
+		state.OtherFilesToModify, removedOther = removeScheduledFile(state.OtherFilesToModify, file)
+		state.TargetFilesToModify, removedTarget = removeScheduledFile(state.TargetFilesToModify, file)
+		state.FilesToDelete, removedDelete = removeScheduledFile(state.FilesToDelete, file)
+		removedMove := false
+		for source, dest := range state.FilesToMove {
+			if strings.EqualFold(source, file) || strings.EqualFold(dest, file) {
+				delete(state.FilesToMove, source)
+				removedMove = true
+			}
+		}
+		return removedOther || removedTarget || removedDelete || removedMove
+	}
+
+	for _, file := range filesToRemove {
+		if removeFromAll(file) {
+			logger.Infoln(file, "(removed from scheduled changes)")
+		} else {
+			logger.Warnln("File is not among scheduled changes, nothing to remove:", file)
+		}
+	}
+
+	var filesToAttach []string
+	for _, file := range filesToAdd {
+		file, exist := utils.CaseInsensitiveFileSearch(file, allFileNames)
+		checkFilters(file)
+		removeFromAll(file)
+		if targetFile, found := utils.CaseInsensitiveFileSearch(file, state.TargetFiles); found {
+			state.TargetFilesToModify = append(state.TargetFilesToModify, targetFile)
+			logger.Infoln(targetFile, "(among initial target files)")
+			continue
+		}
+		state.OtherFilesToModify = append(state.OtherFilesToModify, file)
+		if !exist {
+			logger.Infoln(file, "(new file)")
+			continue
+		}
+		logger.Infoln(file)
+		if _, found := utils.CaseInsensitiveFileSearch(file, state.FilesToReview); !found {
+			filesToAttach = append(filesToAttach, file)
+			state.FilesToReview = append(state.FilesToReview, file)
+		}
+	}
+
+	for _, file := range filesToDelete {
+		file, exist := utils.CaseInsensitiveFileSearch(file, allFileNames)
+		if !exist {
+			logger.Panicln("Cannot schedule deletion, file does not exist in project:", file)
+		}
+		checkFilters(file)
+		removeFromAll(file)
+		state.FilesToDelete = append(state.FilesToDelete, file)
+		logger.Infoln(file, "(delete)")
+	}
+
+	return filesToAttach
+}
@@ -0,0 +1,94 @@
+package op_implement
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/logging"
+)
+
+func newTestLogger(t *testing.T) logging.ILogger {
+	t.Helper()
+
+	logger, err := logging.NewSimpleLogger(logging.ErrorLevel)
+	if err != nil {
+		t.Fatalf("failed to create test logger: %v", err)
+	}
+
+	return logger
+}
+
+func TestParseFileListFlag(t *testing.T) {
+	files := parseFileListFlag(" a.go, ,b.go,")
+	if !slices.Equal(files, []string{"a.go", "b.go"}) {
+		t.Errorf("parseFileListFlag() = %v", files)
+	}
+	if files := parseFileListFlag(""); len(files) != 0 {
+		t.Errorf("parseFileListFlag(\"\") = %v, want empty", files)
+	}
+}
+
+func TestEditScheduledFiles(t *testing.T) {
+	st := state{
+		OtherFilesToModify:  []string{"other.go", "drop.go"},
+		TargetFilesToModify: []string{},
+		FilesToDelete:       []string{"old.go"},
+		TargetFiles:         []string{"target.go"},
+		FilesToReview:       []string{"other.go", "reviewed.go"},
+	}
+	allFileNames := []string{"other.go", "drop.go", "old.go", "target.go", "reviewed.go", "unseen.go", "remove.go"}
+	whitelist := []*regexp.Regexp{regexp.MustCompile(`\.go$`)}
+
+	filesToAttach := editScheduledFiles(&st,
+		[]string{"Target.go", "reviewed.go", "unseen.go", "new.go", "old.go"},
+		[]string{"remove.go"},
+		[]string{"drop.go", "missing.go"},
+		allFileNames,
+		whitelist,
+		nil,
+		nil,
+		newTestLogger(t))
+
+	if !slices.Equal(st.OtherFilesToModify, []string{"other.go", "reviewed.go", "unseen.go", "new.go", "old.go"}) {
+		t.Errorf("OtherFilesToModify = %v", st.OtherFilesToModify)
+	}
+	if !slices.Equal(st.TargetFilesToModify, []string{"target.go"}) {
+		t.Errorf("TargetFilesToModify = %v", st.TargetFilesToModify)
+	}
+	if !slices.Equal(st.FilesToDelete, []string{"remove.go"}) {
+		t.Errorf("FilesToDelete = %v", st.FilesToDelete)
+	}
+	if !slices.Equal(filesToAttach, []string{"unseen.go", "old.go"}) {
+		t.Errorf("filesToAttach = %v", filesToAttach)
+	}
+	if !slices.Contains(st.FilesToReview, "unseen.go") {
+		t.Errorf("FilesToReview = %v, want unseen.go included", st.FilesToReview)
+	}
+}
+
+func TestEditScheduledFilesRejectsInvalidFiles(t *testing.T) {
+	whitelist := []*regexp.Regexp{regexp.MustCompile(`\.go$`)}
+	readonly := []*regexp.Regexp{regexp.MustCompile(`^gen\.go$`)}
+	tests := []struct {
+		name          string
+		filesToAdd    []string
+		filesToDelete []string
+	}{
+		{name: "not whitelisted", filesToAdd: []string{"notes.txt"}},
+		{name: "delete missing file", filesToDelete: []string{"missing.go"}},
+		{name: "modify read-only file", filesToAdd: []string{"gen.go"}},
+		{name: "delete read-only file", filesToDelete: []string{"gen.go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("expected panic")
+				}
+			}()
+			st := state{}
+			editScheduledFiles(&st, tt.filesToAdd, tt.filesToDelete, nil, []string{"a.go", "gen.go"}, whitelist, nil, readonly, newTestLogger(t))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package op_implement
 
 import (
 	"fmt"
+	"maps"
 	"regexp"
 	"slices"
 	"strings"
@@ -21,13 +22,14 @@ func Stage3(projectRootDir string,
 	allFileNames []string,
 	projectFilesWhitelist []*regexp.Regexp,
 	projectFilesBlacklist []*regexp.Regexp,
+	projectFilesReadonly []*regexp.Regexp,
 	noUploadRx []*regexp.Regexp,
 	forceUpload bool,
 	filesForReview []string,
 	targetFiles []string,
 	messages []llm.Message,
 	task string,
-	logger logging.ILogger) ([]llm.Message, []string, []string, []string) {
+	logger logging.ILogger) ([]llm.Message, []string, []string, []string, map[string]string, []string) {
 
 	logger.Traceln("Stage3: Starting")
 	defer logger.Traceln("Stage3: Finished")
@@ -50,6 +52,9 @@ func Stage3(projectRootDir string,
 	var targetFilesToModify []string
 	var otherFilesToModify []string
 	var filesToDelete []string
+	filesToMove := map[string]string{}
+	// Changes requested for read-only files, reported in the plan output
+	var readonlyViolations []string
 
 	// Send request
 	if planningMode {
@@ -70,6 +75,7 @@ func Stage3(projectRootDir string,
 
 		var filesToProcessRaw []string
 		var filesToDeleteRaw []string
+		var filesToMoveRaw []string
 		onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
 		// Make request and retry on errors
 		for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
@@ -135,6 +141,20 @@ func Stage3(projectRootDir string,
 				}
 				continue
 			}
+			// Process response, parse files that will be moved or renamed
+			filesToMoveRaw, err = utils.ParseTaggedTextRx(
+				aiResponse,
+				prCfg.RegexpArray(config.K_ProjectMoveTagsRx)[0],
+				prCfg.RegexpArray(config.K_ProjectMoveTagsRx)[1],
+				false)
+			if err != nil {
+				if onFailRetriesLeft < 1 {
+					logger.Panicln("Failed to parse list of files for moving", err)
+				} else {
+					logger.Warnln("Failed to parse list of files for moving, retrying", err)
+				}
+				continue
+			}
 			break
 		}
 
@@ -219,6 +239,12 @@ func Stage3(projectRootDir string,
 			if !ok {
 				continue
 			}
+			// Read-only files may be provided for reading, but must not be modified
+			if existing, _ := utils.CaseInsensitiveFileSearch(file, allFileNames); isReadonlyFile(existing, projectFilesReadonly) {
+				logger.Warnln("Skipping requested file, it is read-only:", existing)
+				readonlyViolations = append(readonlyViolations, formatReadonlyViolation("modify", existing))
+				continue
+			}
 			// Sort files selected by LLM
 			file, found := utils.CaseInsensitiveFileSearch(file, targetFiles)
 			if found {
@@ -296,6 +322,12 @@ func Stage3(projectRootDir string,
 				continue
 			}
 
+			if isReadonlyFile(file, projectFilesReadonly) {
+				logger.Warnln("Skipping requested file deletion, file is read-only:", file)
+				readonlyViolations = append(readonlyViolations, formatReadonlyViolation("delete", file))
+				continue
+			}
+
 			var removed bool
 
 			otherFilesToModify, removed = removeFileCaseInsensitive(otherFilesToModify, file)
@@ -320,19 +352,90 @@ func Stage3(projectRootDir string,
 		}
 		logger.Debugln("Files to delete parsed")
 
-		// Generate simulated AI message, with list of files
-		response := llm.NewMessage(llm.SimulatedAIResponse)
-		for _, item := range otherFilesToModify {
-			response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectFilenameTags))
+		isFileAllowed := func(file string) bool {
+			fileWS, wsdr := utils.FilterFilesWithWhitelist([]string{file}, projectFilesWhitelist)
+			if len(wsdr) > 0 {
+				return false
+			}
+			_, bsdr := utils.FilterFilesWithBlacklist(fileWS, projectFilesBlacklist)
+			return len(bsdr) < 1
 		}
-		for _, item := range targetFilesToModify {
-			response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectFilenameTags))
+
+		logger.Debugln("Raw file-list to move by LLM:", filesToMoveRaw)
+		if len(filesToMoveRaw) > 0 {
+			logger.Infoln("Files for moving selected by LLM:")
 		}
-		for _, item := range filesToDelete {
-			response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectDeleteTags))
+		for _, raw := range filesToMoveRaw {
+			sourceRaw, destRaw, ok := strings.Cut(raw, "->")
+			if !ok {
+				logger.Warnln("Skipping invalid file move request, no destination provided:", raw)
+				continue
+			}
+			source, ok := normalizeLLMRequestedFile(strings.TrimSpace(sourceRaw))
+			if !ok {
+				continue
+			}
+			dest, ok := normalizeLLMRequestedFile(strings.TrimSpace(destRaw))
+			if !ok {
+				continue
+			}
+
+			source, found := utils.CaseInsensitiveFileSearch(source, allFileNames)
+			if !found {
+				logger.Warnln("Skipping requested file move, file does not exist in project:", source)
+				continue
+			}
+			if _, found := utils.CaseInsensitiveFileSearch(dest, allFileNames); found {
+				logger.Warnln("Skipping requested file move, destination file already exists in project:", dest)
+				continue
+			}
+			if _, found := utils.CaseInsensitiveFileSearch(source, filesToDelete); found {
+				logger.Warnln("Skipping requested file move, file is selected for deletion:", source)
+				continue
+			}
+			if !isFileAllowed(source) || !isFileAllowed(dest) {
+				logger.Warnf("Skipping requested file move, filtered by project whitelist or blacklist: %s -> %s", source, dest)
+				continue
+			}
+			if isReadonlyFile(source, projectFilesReadonly) || isReadonlyFile(dest, projectFilesReadonly) {
+				logger.Warnf("Skipping requested file move, file is read-only: %s -> %s", source, dest)
+				readonlyViolations = append(readonlyViolations, formatReadonlyViolation("move", source, dest))
+				continue
+			}
+			duplicate := false
+			for movedSource, movedDest := range filesToMove {
+				if strings.EqualFold(movedSource, source) || strings.EqualFold(movedDest, dest) {
+					duplicate = true
+				}
+			}
+			if duplicate {
+				logger.Warnf("Skipping already requested file move: %s -> %s", source, dest)
+				continue
+			}
+
+			// Changes requested for the source file will be applied to the moved file
+			var removedOther, removedTarget bool
+			otherFilesToModify, removedOther = removeFileCaseInsensitive(otherFilesToModify, source)
+			targetFilesToModify, removedTarget = removeFileCaseInsensitive(targetFilesToModify, source)
+			if _, found := utils.CaseInsensitiveFileSearch(dest, otherFilesToModify); !found && (removedOther || removedTarget) {
+				otherFilesToModify = append(otherFilesToModify, dest)
+			}
+			// Moved file will be generated from its source, so source contents must be provided to LLM
+			if _, found := utils.CaseInsensitiveFileSearch(dest, otherFilesToModify); found {
+				_, alreadyInReview := utils.CaseInsensitiveFileSearch(source, filesForReview)
+				_, alreadyInTargets := utils.CaseInsensitiveFileSearch(source, targetFiles)
+				if !alreadyInReview && !alreadyInTargets {
+					appendUnexpectedExistingFile(source, true)
+				}
+			}
+
+			filesToMove[source] = dest
+			logger.Infof("%s -> %s (move)", source, dest)
 		}
-		// Add response to the message history
-		messages = append(messages, response)
+		logger.Debugln("Files to move parsed")
+
+		// Generate simulated AI message with list of files, add it to the message history
+		messages = append(messages, composeFileListResponse(prCfg, otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove))
 		logger.Debugln("File-list response message created")
 	} else {
 		logger.Infoln("Running stage3: planning disabled")
@@ -355,9 +458,38 @@ func Stage3(projectRootDir string,
 		logger.Warnln("File was filtered-out with project or user blacklist:", file)
 	}
 
-	if len(otherFilesToModify)+len(targetFilesToModify)+len(filesToDelete) == 0 {
-		logger.Warnln("Stage3 returned no files for creation, modification, or deletion")
+	// final read-only check, also covers target files when planning is disabled
+	var violations []string
+	otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove, violations = filterReadonlyChanges(
+		otherFilesToModify,
+		targetFilesToModify,
+		filesToDelete,
+		filesToMove,
+		projectFilesReadonly,
+		logger)
+	readonlyViolations = append(readonlyViolations, violations...)
+
+	if len(otherFilesToModify)+len(targetFilesToModify)+len(filesToDelete)+len(filesToMove) == 0 {
+		logger.Warnln("Stage3 returned no files for creation, modification, deletion, or moving")
 	}
 
-	return messages, otherFilesToModify, targetFilesToModify, filesToDelete
+	return messages, otherFilesToModify, targetFilesToModify, filesToDelete, filesToMove, readonlyViolations
+}
+
+// composeFileListResponse generates simulated AI message with list of files to modify, delete and move
+func composeFileListResponse(prCfg config.Config, otherFilesToModify, targetFilesToModify, filesToDelete []string, filesToMove map[string]string) llm.Message {
+	response := llm.NewMessage(llm.SimulatedAIResponse)
+	for _, item := range otherFilesToModify {
+		response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectFilenameTags))
+	}
+	for _, item := range targetFilesToModify {
+		response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectFilenameTags))
+	}
+	for _, item := range filesToDelete {
+		response = llm.AddTaggedFragment(response, item, prCfg.Tags(config.K_ProjectDeleteTags))
+	}
+	for _, source := range slices.Sorted(maps.Keys(filesToMove)) {
+		response = llm.AddTaggedFragment(response, source+" -> "+filesToMove[source], prCfg.Tags(config.K_ProjectMoveTags))
+	}
+	return response
 }
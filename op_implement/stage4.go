@@ -2,6 +2,8 @@ package op_implement
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"strings"
 
 	"github.com/DarkCaster/Perpetual/config"
@@ -11,6 +13,9 @@ import (
 )
 
 // Perform the actual code implementation process based on the Stage 2 and 3 answers, which includes the contents of other files related to the files for which we need to implement the code and extra reasonings (if enabled).
+// Files from completedFiles list are not processed again, their contents from completedFileContents used as already implemented changes.
+// Files from filesToMove are generated at their destination path, using contents of the source file as original.
+// onProgress callback (if provided) is called after each processed file with current lists of completed files and their contents.
 func Stage4(projectRootDir string,
 	perpetualDir string,
 	prCfg config.Config,
@@ -20,6 +25,10 @@ func Stage4(projectRootDir string,
 	otherFiles []string,
 	targetFiles []string,
 	noIncrMode bool,
+	filesToMove map[string]string,
+	completedFiles []string,
+	completedFileContents map[string]string,
+	onProgress func(completedFiles []string, completedFileContents map[string]string),
 	logger logging.ILogger) map[string]string {
 
 	logger.Traceln("Stage4: Starting")       // Add trace logging
@@ -39,6 +48,21 @@ func Stage4(projectRootDir string,
 	processedFileContents := make(map[string]string)
 	var processedFiles []string
 
+	// Restore progress from previous interrupted run
+	completedFiles = utils.NewSlice(completedFiles...)
+	if len(completedFiles) > 0 {
+		maps.Copy(processedFileContents, completedFileContents)
+		for _, file := range completedFiles {
+			if _, ok := processedFileContents[file]; ok {
+				processedFiles = append(processedFiles, file)
+			}
+		}
+		isCompleted := func(file string) bool { return slices.Contains(completedFiles, file) }
+		otherFiles = slices.DeleteFunc(utils.NewSlice(otherFiles...), isCompleted)
+		targetFiles = slices.DeleteFunc(utils.NewSlice(targetFiles...), isCompleted)
+		logger.Infof("Resuming stage4, files already processed: %d, files left: %d", len(completedFiles), len(otherFiles)+len(targetFiles))
+	}
+
 	logger.Infoln("Running stage4: implementing code")
 	debugString := connector.GetDebugString()
 	logger.Notifyln(debugString)
@@ -86,10 +110,12 @@ func Stage4(projectRootDir string,
 		}
 
 		pendingFile := ""
+		isTargetFile := false
 		if len(otherFiles) > 0 {
 			pendingFile, otherFiles = otherFiles[0], otherFiles[1:]
 		} else if len(targetFiles) > 0 {
 			pendingFile, targetFiles = targetFiles[0], targetFiles[1:]
+			isTargetFile = true
 		}
 
 		if pendingFile == "" {
@@ -98,6 +124,59 @@ func Stage4(projectRootDir string,
 
 		logger.Infoln(pendingFile)
 
+		// Moved file is based on contents of its source file
+		sourceFile := pendingFile
+		for source, dest := range filesToMove {
+			if dest == pendingFile {
+				sourceFile = source
+			}
+		}
+
+		// Save body to processedFileContents and add record to processedFiles
+		completeFile := func(fileBodies []string) {
+			if len(fileBodies) > 0 {
+				logger.Debugln("Found output for:", pendingFile)
+				processedFileContents[pendingFile] = fileBodies[0]
+				processedFiles = append(processedFiles, pendingFile)
+			}
+			completedFiles = append(completedFiles, pendingFile)
+			if onProgress != nil {
+				onProgress(completedFiles, processedFileContents)
+			}
+		}
+
+		// Implement only regions of target file marked with region implement-comments, if present
+		if isTargetFile {
+			if fileBody, _, err := llm.GetSourceFileFromCache(pendingFile); err == nil {
+				// LLM works with redacted file contents, secrets are restored after stage 4
+				fileBody, _ = llm.RedactSecrets(fileBody)
+				regionRx := cfg.RegexpArray(config.K_ImplementRegionTagsRx)
+				regions, err := findImplementRegions(fileBody, regionRx[0], regionRx[1])
+				if err != nil {
+					logger.Warnf("Invalid implement regions in file %s, processing whole file: %v", pendingFile, err)
+				} else if len(regions) > 0 && hasMatchesOutsideRegions(fileBody, regions, cfg.RegexpArray(config.K_ImplementCommentsRx)) {
+					logger.Warnln("Implement comments found outside of marked regions, processing whole file:", pendingFile)
+				} else if len(regions) > 0 {
+					logger.Infoln("Implementing marked regions:", len(regions))
+					if regionsBody, ok := implementFileRegions(
+						connector,
+						allowCaching,
+						perpetualDir,
+						prCfg,
+						cfg,
+						stage4Messages,
+						pendingFile,
+						fileBody,
+						regions,
+						logger); ok {
+						completeFile([]string{regionsBody})
+						continue
+					}
+					logger.Warnln("Failed to implement marked regions, processing whole file:", pendingFile)
+				}
+			}
+		}
+
 		// Create prompt from stage4ProcessFilePromptTemplate
 		stage4ProcessFilePrompt, err := utils.ReplaceTagRx(
 			cfg.String(config.K_ImplementStage4ProcessPrompt),
@@ -127,7 +206,7 @@ func Stage4(projectRootDir string,
 
 		if incrModeTries > 0 {
 			//detect if we can use incremental mode depending on file size and filename match
-			_, fileSize, err := llm.GetSourceFileFromCache(pendingFile)
+			_, fileSize, err := llm.GetSourceFileFromCache(sourceFile)
 			if err != nil {
 				incrModeTries = 0
 				logger.Debugln("Not using incremental mode, new file:", pendingFile)
@@ -250,11 +329,13 @@ func Stage4(projectRootDir string,
 						utils.GetEvenRegexps(prCfg.RegexpArray(config.K_ProjectCodeTagsRx)),
 						utils.GetOddRegexps(prCfg.RegexpArray(config.K_ProjectCodeTagsRx)))
 					// get file from cache
-					fileBody, _, err := llm.GetSourceFileFromCache(pendingFile)
+					fileBody, _, err := llm.GetSourceFileFromCache(sourceFile)
 					if err != nil {
 						//should not occur, so this is an internal error
 						logger.Panicf("Internal error: failed to get file from cache: %v", err)
 					}
+					// search blocks refer to the redacted file contents provided to LLM
+					fileBody, _ = llm.RedactSecrets(fileBody)
 					changedOk := true
 					// iterate over each search-and-replace blocks
 					for i, block := range blocks {
@@ -348,12 +429,7 @@ func Stage4(projectRootDir string,
 			break
 		}
 
-		// Save body to processedFileContents and add record to processedFiles
-		if len(fileBodies) > 0 {
-			logger.Debugln("Found output for:", pendingFile)
-			processedFileContents[pendingFile] = fileBodies[0]
-			processedFiles = append(processedFiles, pendingFile)
-		}
+		completeFile(fileBodies)
 	}
 
 	return processedFileContents
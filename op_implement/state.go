@@ -3,7 +3,9 @@ package op_implement
 import (
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/DarkCaster/Perpetual/config"
 	"github.com/DarkCaster/Perpetual/llm"
 	"github.com/DarkCaster/Perpetual/utils"
 )
@@ -15,12 +17,48 @@ const StateFileName = ".implement_state.json"
 
 // state holds all the data required to resume the 'implement' operation at
 // stage 4 after the preparation stages (1-3) have been completed and confirmed
-// by the operator/agent.
+// by the operator/agent. It also holds the stage 2 results needed to revise
+// the work plan and re-run stage 3 before finishing, and the files already
+// generated at stage 4, so an interrupted stage 4 can be resumed.
 type state struct {
-	OtherFilesToModify  []string      `json:"other_files_to_modify,omitempty"`
-	TargetFilesToModify []string      `json:"target_files_to_modify,omitempty"`
-	FilesToDelete       []string      `json:"files_to_delete,omitempty"`
-	Messages            []llm.Message `json:"messages,omitempty"`
+	OtherFilesToModify  []string          `json:"other_files_to_modify,omitempty"`
+	TargetFilesToModify []string          `json:"target_files_to_modify,omitempty"`
+	FilesToDelete       []string          `json:"files_to_delete,omitempty"`
+	FilesToMove         map[string]string `json:"files_to_move,omitempty"`
+	ReadonlyViolations  []string          `json:"readonly_violations,omitempty"`
+	Messages            []llm.Message     `json:"messages,omitempty"`
+	Task                string            `json:"task,omitempty"`
+	PlanningMode        bool              `json:"planning_mode,omitempty"`
+	TargetFiles         []string          `json:"target_files,omitempty"`
+	FilesToReview       []string          `json:"files_to_review,omitempty"`
+	Workplan            string            `json:"workplan,omitempty"`
+	Stage2Messages      []llm.Message     `json:"stage2_messages,omitempty"`
+	// Stage 4 progress, used to resume interrupted stage 4
+	Stage4Files   []string          `json:"stage4_files,omitempty"`
+	Stage4Results map[string]string `json:"stage4_results,omitempty"`
+	// Provenance recorded into the stash metadata
+	Mode       string            `json:"mode,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	Models     map[string]string `json:"models,omitempty"`
+	TokenUsage llm.TokenUsage    `json:"token_usage"`
+}
+
+// recordStageModel saves description of LLM provider and model configured for the stage
+func (s *state) recordStageModel(stage string, cfg config.Config) {
+	connector, err := llm.NewLLMConnector(OpName+"_"+stage, cfg.String(config.K_SystemPrompt), cfg.String(config.K_SystemPromptAck), nil, nil)
+	if err != nil {
+		return
+	}
+	if s.Models == nil {
+		s.Models = make(map[string]string)
+	}
+	s.Models[stage] = connector.GetDebugString()
+}
+
+// collectTokenUsage adds tokens used by LLM queries since last collection to the state
+func (s *state) collectTokenUsage() {
+	s.TokenUsage = s.TokenUsage.Add(llm.GetTokenUsage())
+	llm.ResetTokenUsage()
 }
 
 // getStateFilePath returns the full path to the state file inside perpetualDir.
@@ -52,6 +90,13 @@ func loadState(perpetualDir, projectRootDir string) (state, error) {
 	for _, file := range state.FilesToDelete {
 		llm.PrecacheSourceFile(projectRootDir, file)
 	}
+	for file := range state.FilesToMove {
+		llm.PrecacheSourceFile(projectRootDir, file)
+	}
+	// secrets from reviewed files might be copied by LLM into generated files, remember them to restore placeholders
+	for _, file := range state.FilesToReview {
+		llm.RegisterSourceFileSecrets(projectRootDir, file)
+	}
 	return state, nil
 }
 
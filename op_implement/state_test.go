@@ -0,0 +1,40 @@
+package op_implement
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestSaveLoadStateWithStage4Progress(t *testing.T) {
+	perpetualDir := t.TempDir()
+	projectRootDir := t.TempDir()
+
+	saved := state{
+		OtherFilesToModify:  []string{"a.go", "b.go"},
+		TargetFilesToModify: []string{"c.go"},
+		Stage4Files:         []string{"a.go", "b.go"},
+		Stage4Results:       map[string]string{"a.go": "package a\n"},
+	}
+	if err := saveState(perpetualDir, saved); err != nil {
+		t.Fatalf("saveState() error = %v", err)
+	}
+
+	loaded, err := loadState(perpetualDir, projectRootDir)
+	if err != nil {
+		t.Fatalf("loadState() error = %v", err)
+	}
+	if !slices.Equal(loaded.Stage4Files, saved.Stage4Files) {
+		t.Errorf("Stage4Files = %v, want %v", loaded.Stage4Files, saved.Stage4Files)
+	}
+	if !maps.Equal(loaded.Stage4Results, saved.Stage4Results) {
+		t.Errorf("Stage4Results = %v, want %v", loaded.Stage4Results, saved.Stage4Results)
+	}
+
+	if err := removeState(perpetualDir); err != nil {
+		t.Fatalf("removeState() error = %v", err)
+	}
+	if err := removeState(perpetualDir); err != nil {
+		t.Errorf("removeState() on missing file error = %v", err)
+	}
+}
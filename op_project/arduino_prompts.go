@@ -20,6 +20,16 @@ func (p *arduinoPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*\\.s$", defaultAIAnnotatePrompt_S, defaultAIAnnotatePrompt_S_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(c|cpp|ino|h|hpp|hh|tpp|ipp)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before top-level declarations, keeping their comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.c$", defaultChunkSplitRx_C},
+		{"(?i)^.*\\.(cpp|ino|h|hpp|hh|tpp|ipp)$", defaultChunkSplitRx_CPP},
+	}
 	return result
 }
 
@@ -66,6 +76,11 @@ func (p *arduinoPrompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(c|cpp|ino|h|hpp|hh|tpp|ipp)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.c$", defaultSymbolsRx_C},
+		{"(?i)^.*\\.(cpp|ino|h|hpp|hh|tpp|ipp)$", defaultSymbolsRx_CPP},
+	}
 	return result
 }
 
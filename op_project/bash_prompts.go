@@ -17,6 +17,15 @@ func (p *bashPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*\\.(sh|bash|in)$", defaultAIAnnotatePrompt_Bash, defaultAIAnnotatePrompt_Bash_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(sh|bash|in)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before functions, keeping their comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.(sh|bash|in)$", defaultChunkSplitRx_Bash},
+	}
 	return result
 }
 
@@ -54,6 +63,10 @@ func (p *bashPrompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(sh|bash|in)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.(sh|bash|in)$", defaultSymbolsRx_Bash},
+	}
 	return result
 }
 
@@ -20,6 +20,15 @@ func (p *cPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*(CMakeLists.txt|\\.cmake)", defaultAIAnnotatePrompt_Cmake, defaultAIAnnotatePrompt_Cmake_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(c|h)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before top-level declarations, keeping their comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.(c|h)$", defaultChunkSplitRx_C},
+	}
 	return result
 }
 
@@ -66,6 +75,10 @@ func (p *cPrompts) GetProjectConfig() map[string]any {
 		{"(?i)^.*\\.(c|h)$", 8192},
 		{"(?i)^.*(CMakeLists.txt|\\.cmake)", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.(c|h)$", defaultSymbolsRx_C},
+	}
 	return result
 }
 
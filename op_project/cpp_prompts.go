@@ -21,6 +21,16 @@ func (p *cppPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*(CMakeLists.txt|\\.cmake)", defaultAIAnnotatePrompt_Cmake, defaultAIAnnotatePrompt_Cmake_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(c|cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before top-level declarations, keeping their comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.c$", defaultChunkSplitRx_C},
+		{"(?i)^.*\\.(cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp)$", defaultChunkSplitRx_CPP},
+	}
 	return result
 }
 
@@ -70,6 +80,11 @@ func (p *cppPrompts) GetProjectConfig() map[string]any {
 		{"(?i)^.*\\.(c|cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp)$", 8192},
 		{"(?i)^.*(CMakeLists.txt|\\.cmake)", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.c$", defaultSymbolsRx_C},
+		{"(?i)^.*\\.(cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp)$", defaultSymbolsRx_CPP},
+	}
 	return result
 }
 
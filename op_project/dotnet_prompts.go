@@ -25,6 +25,16 @@ func (p *dotNetPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*\\.html$", defaultAIAnnotatePrompt_HTML, defaultAIAnnotatePrompt_HTML_SHORT},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(cs|vb)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before type and member declarations, keeping their comments and attributes
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.cs$", defaultChunkSplitRx_CSharp},
+		{"(?i)^.*\\.vb$", defaultChunkSplitRx_VBNet},
+	}
 	return result
 }
 
@@ -77,6 +87,11 @@ func (p *dotNetPrompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(cs|vb|xaml|cshtml|sql|css|js|html)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.cs$", defaultSymbolsRx_CSharp},
+		{"(?i)^.*\\.vb$", defaultSymbolsRx_VBNet},
+	}
 	return result
 }
 
@@ -23,6 +23,7 @@ const dotEnvExample = `# Configuration files should have ".env" extensions and i
 # "openai": which parameters started with OPENAI_* prefix
 # "ollama": which parameters started with OLLAMA_* prefix
 # "generic": Generic OpenAI compatible provider, which parameters started with GENERIC_* prefix
+# Also, the built-in "local" embedder can be selected for the embed operation only, its parameters started with LOCAL_* prefix
 
 # You can also setup multiple profiles for supported LLM providers by adding number to profile name
 # Env vars will use following naming scheme: <PROVIDER><PROFILE NUMBER>_<OPTION>
@@ -32,6 +33,9 @@ const dotEnvExample = `# Configuration files should have ".env" extensions and i
 # You can use encoding names supported by "golang.org/x/text/encoding/ianaindex" package
 # FALLBACK_TEXT_ENCODING="windows-1252"
 
+# How long to wait (in seconds) for project resources locked by another running instance of Perpetual, 0 - do not wait
+# PERPETUAL_LOCK_TIMEOUT="300"
+
 # Per-operation provider selection
 
 # LLM_PROVIDER_OP_ANNOTATE="anthropic"
@@ -21,6 +21,9 @@ const ollamaEnvExample = `# Options for Ollama instance, local or public.
 # You can use encoding names supported by "golang.org/x/text/encoding/ianaindex" package
 # FALLBACK_TEXT_ENCODING="windows-1252"
 
+# How long to wait (in seconds) for project resources locked by another running instance of Perpetual, 0 - do not wait
+# PERPETUAL_LOCK_TIMEOUT="300"
+
 # Uncomment if this is the only .env config file you are using
 # LLM_PROVIDER="ollama"
 
@@ -163,6 +166,11 @@ OLLAMA_ON_FAIL_RETRIES_OP_ANNOTATE="5" # this number include errors caused by co
 # OLLAMA_ON_FAIL_RETRIES_OP_EXPLAIN_STAGE2="3"
 OLLAMA_ON_FAIL_RETRIES="5"
 
+# Number of concurrent requests, only used by annotate operation for now, annotate -j flag overrides it
+# Rate limit pauses are shared between concurrent requests
+# OLLAMA_CONCURRENCY_OP_ANNOTATE="4" # requires OLLAMA_NUM_PARALLEL to be set on the server
+# OLLAMA_CONCURRENCY="1"
+
 # Options to set temperature. Depends on model, 0 produces mostly deterministic results, may be unset to use model-defaults
 # OLLAMA_TEMPERATURE_OP_ANNOTATE="0.5"
 # OLLAMA_TEMPERATURE_OP_IMPLEMENT_STAGE1="0.2" # less creative for file-list output
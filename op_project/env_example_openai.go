@@ -24,6 +24,9 @@ const openAiEnvExample = `# Options for OpenAI provider. Below are sane defaults
 # You can use encoding names supported by "golang.org/x/text/encoding/ianaindex" package
 # FALLBACK_TEXT_ENCODING="windows-1252"
 
+# How long to wait (in seconds) for project resources locked by another running instance of Perpetual, 0 - do not wait
+# PERPETUAL_LOCK_TIMEOUT="300"
+
 # Uncomment if this is the only .env config file you are using
 # LLM_PROVIDER="openai"
 
@@ -167,6 +170,11 @@ OPENAI_ON_FAIL_RETRIES_OP_EXPLAIN_STAGE1="2"
 OPENAI_ON_FAIL_RETRIES_OP_EXPLAIN_STAGE2="10" # may hit token limit on low API usage tiers, so add more retries
 OPENAI_ON_FAIL_RETRIES="5"
 
+# Number of concurrent requests, only used by annotate operation for now, annotate -j flag overrides it
+# Rate limit pauses are shared between concurrent requests
+# OPENAI_CONCURRENCY_OP_ANNOTATE="4" # check rate limits of your API usage tier before increasing
+# OPENAI_CONCURRENCY="1"
+
 # Options to set temperature. Depends on model, 0 produces mostly deterministic results, may be unset to use model-defaults
 # OPENAI_TEMPERATURE_OP_ANNOTATE="0.5"
 # OPENAI_TEMPERATURE_OP_IMPLEMENT_STAGE1="0.2" # less creative for file-list output
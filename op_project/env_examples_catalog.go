@@ -31,6 +31,11 @@ var envExampleCatalog = []EnvExampleFile{
 		Content:  genericEnvExample,
 		Provider: "generic",
 	},
+	{
+		Filename: localEnvExampleFileName,
+		Content:  localEnvExample,
+		Provider: "local",
+	},
 }
 
 func GetEnvExampleCatalogWithVersion(version string) []EnvExampleFile {
@@ -36,6 +36,17 @@ func (p *flutterPrompts) GetAnnotateConfig() map[string]any {
 		//TODO: source files for mac, ios and web builds support
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(dart|c|cc|cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp|java|kt)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before top-level declarations, keeping their comments and annotations
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.dart$", defaultChunkSplitRx_Dart},
+		{"(?i)^.*\\.c$", defaultChunkSplitRx_C},
+		{"(?i)^.*\\.(cc|cpp|cxx|c\\+\\+|cppm|h|h\\+\\+|hpp|hh|tpp|ipp)$", defaultChunkSplitRx_CPP},
+	}
 	return result
 }
 
@@ -115,6 +126,12 @@ func (p *flutterPrompts) GetProjectConfig() map[string]any {
 		{"(?i)^.*\\.(dart|arb|cc|cpp|cxx|c\\+\\+|cppm|h\\+\\+|hpp|hh|tpp|ipp|rc|java|kt|xml)$", 8192},
 		{"(?i)^.*(CMakeLists.txt|\\.cmake)", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.dart$", defaultSymbolsRx_Dart},
+		{"(?i)^.*\\.c$", defaultSymbolsRx_C},
+		{"(?i)^.*\\.(cc|cpp|h|hpp)$", defaultSymbolsRx_CPP},
+	}
 	return result
 }
 
@@ -22,6 +22,20 @@ func (p *goPrompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*\\.html$", defaultAIAnnotatePrompt_HTML, defaultAIAnnotatePrompt_HTML_SHORT},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// split large files before top-level declarations, keeping their doc-comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.go$", "(?m)^(?://[^\\n]*\\n)*(?:func|type|var|const)\\b"},
+	}
+	// exported symbols that annotation must mention, test files are not checked
+	result[config.K_AnnotateSymbolsRx] = [][2]string{
+		{"(?i)^.*_test\\.go$", ""},
+		{"(?i)^.*\\.go$", "(?m)^(?:func(?: \\([^)]*\\))? |type )([A-Z]\\w*)"},
+	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.go$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
 	return result
 }
 
@@ -75,6 +89,10 @@ func (p *goPrompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(go|html|js|css)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.go$", defaultSymbolsRx_Go},
+	}
 	return result
 }
 
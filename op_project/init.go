@@ -108,7 +108,7 @@ func Init(version, lang string, envExamples bool, descFile string, userFilterFil
 	// Create a .gitignore file in the .perpetual directory
 	logger.Infoln("Writing .gitignore file")
 
-	gitignoreText := fmt.Sprintf("/%s\n/%s\n/%s\n/%s\n/%s*\n/%s\n/%s\n", DotEnvMaskName, utils.AnnotationsFileName, utils.EmbeddingsFileName, utils.LockFileName, llm.LLMRawLogFile, utils.StashesDirName, op_implement.StateFileName)
+	gitignoreText := fmt.Sprintf("/%s\n/%s\n/%s\n/%s\n/%s\n/%s\n/%s\n/%s\n/%s*\n/%s\n/%s\n", DotEnvMaskName, utils.AnnotationsFileName, utils.DirSummariesFileName, utils.SymbolsFileName, utils.EmbeddingsFileName, utils.EmbeddingsIndexFileName, utils.KeywordsIndexFileName, utils.LockFileName, llm.LLMRawLogFile, utils.StashesDirName, op_implement.StateFileName)
 	_, err = utils.SaveTextFile(filepath.Join(perpetualDir, ".gitignore"), gitignoreText)
 	if err != nil {
 		logger.Panicln("Error creating .gitignore file:", err)
@@ -173,16 +173,82 @@ var defaultFileNameTagsRegexps = []string{"(?m)\\s*<filename>\\n?", "(?m)<\\/fil
 var defaultFileNameTags = []string{"<filename>", "</filename>"}
 var defaultDeleteTagsRegexps = []string{"(?m)\\s*<delete>\\n?", "(?m)<\\/delete>\\s*$?"}
 var defaultDeleteTags = []string{"<delete>", "</delete>"}
+var defaultMoveTagsRegexps = []string{"(?m)\\s*<move>\\n?", "(?m)<\\/move>\\s*$?"}
+var defaultMoveTags = []string{"<move>", "</move>"}
 var defaultOutputTagsRegexps = []string{"(?m)\\s*```[a-zA-Z]+\\n?", "(?m)```\\s*($|\\n)"}
 var defaultOutputTagsRegexps_WithNumbers = []string{"(?m)\\s*```[a-zA-Z0-9]+\\n?", "(?m)```\\s*($|\\n)"}
+var defaultImplementRegionTagsRegexps = []string{"^.*###IMPLEMENT-BEGIN###.*$", "^.*###IMPLEMENT-END###.*$"}
+
+// Private keys, API tokens of popular services and env-style assignments of credentials, only the value is redacted
+var defaultSecretsRegexps = []string{
+	"-----BEGIN [A-Z ]*PRIVATE KEY-----[\\s\\S]*?-----END [A-Z ]*PRIVATE KEY-----",
+	"\\b(AKIA[0-9A-Z]{16})\\b",
+	"\\b(gh[pousr]_[A-Za-z0-9]{36,})\\b",
+	"\\b(github_pat_[A-Za-z0-9_]{40,})\\b",
+	"\\b(sk-[A-Za-z0-9_-]{20,})\\b",
+	"\\b(xox[abposr]-[A-Za-z0-9-]{10,})\\b",
+	"\\b(AIza[0-9A-Za-z_-]{35})\\b",
+	"(?m)^[ \\t]*(?:export[ \\t]+)?[A-Z0-9_]*(?:SECRET|PASSWORD|PASSWD|TOKEN|API_?KEY|PRIVATE_?KEY|ACCESS_?KEY)(?:_[A-Z0-9_]*)?[ \\t]*[=:][ \\t]*[\"']?([^\\s\"'#$<>(){}]{8,})",
+}
+var defaultAnnotateForbiddenRegexps = []string{
+	"(?i)\\bI (?:cannot|can't|can not|am unable to|am not able to)\\b",
+	"(?i)\\bas an AI\\b",
+	"(?i)\\bplease (?:provide|share|send|upload)\\b",
+	"(?i)^\\s*(?:sorry|unfortunately)\\b",
+}
+
+// regexps for local symbol index, named capture groups set the kind of symbols they match
+const defaultSymbolsRx_Go = "(?m)^(?:type\\s+(?P<type>\\w+)|func\\s+\\([^)]*\\)\\s*(?P<method>\\w+)|func\\s+(?P<func>\\w+)|const\\s+(?P<const>\\w+)|var\\s+(?P<var>\\w+)|import\\s+(?:\\w+\\s+)?\"(?P<import>[^\"]+)\")"
+const defaultSymbolsRx_Python = "(?m)^(?:class[ \\t]+(?P<class>\\w+)|(?:async[ \\t]+)?def[ \\t]+(?P<func>\\w+)|[ \\t]+(?:async[ \\t]+)?def[ \\t]+(?P<method>\\w+)|(?P<const>[A-Z][A-Z0-9_]*)[ \\t]*(?::[^=\\n]*)?=[^=]|import[ \\t]+(?P<import>[\\w.]+)|from[ \\t]+(?P<import>[\\w.]+)[ \\t]+import\\b)"
+const defaultSymbolsRx_C = "(?m)^(?:#[ \\t]*include[ \\t]*[<\"](?P<import>[^>\"\\n]+)[>\"]|#[ \\t]*define[ \\t]+(?P<macro>\\w+)|(?:typedef[ \\t]+)?(?:struct|union|enum)[ \\t]+(?P<type>\\w+)[ \\t]*\\{?[ \\t]*$|typedef[ \\t][^;\\n]*?\\b(?P<type>\\w+)[ \\t]*;|[A-Za-z_][\\w \\t\\*]*?[ \\t\\*](?P<func>[A-Za-z_]\\w*)[ \\t]*\\([^;\\n]*$)"
+const defaultSymbolsRx_CPP = "(?m)^(?:#[ \\t]*include[ \\t]*[<\"](?P<import>[^>\"\\n]+)[>\"]|#[ \\t]*define[ \\t]+(?P<macro>\\w+)|namespace[ \\t]+(?P<namespace>[\\w:]+)|(?:template[ \\t]*<[^>\\n]*>[ \\t]*)?(?:typedef[ \\t]+)?(?:class|struct|union|enum(?:[ \\t]+class)?)[ \\t]+(?P<type>\\w+)[^;\\n]*$|using[ \\t]+(?P<type>\\w+)[ \\t]*=|typedef[ \\t][^;\\n]*?\\b(?P<type>\\w+)[ \\t]*;|[A-Za-z_][\\w \\t\\*&:<>,]*?[ \\t\\*&](?P<func>[A-Za-z_~][\\w:~]*)[ \\t]*\\([^;\\n]*$)"
+const defaultSymbolsRx_Bash = "(?m)^(?:function[ \\t]+(?P<func>[\\w:-]+)|(?P<func>[\\w:-]+)[ \\t]*\\(\\)|(?:export[ \\t]+|readonly[ \\t]+|declare[ \\t]+-\\w+[ \\t]+)?(?P<var>[A-Z_][A-Z0-9_]*)=|(?:source|\\.)[ \\t]+(?P<import>\\S+))"
+const defaultSymbolsRx_CSharp = "(?m)^[ \\t]*(?:using[ \\t]+(?P<import>[\\w.]+)[ \\t]*;|namespace[ \\t]+(?P<namespace>[\\w.]+)|(?:(?:public|private|protected|internal|static|abstract|sealed|partial|readonly|unsafe|new)[ \\t]+)*(?:class|interface|struct|enum|record(?:[ \\t]+(?:class|struct))?)[ \\t]+(?P<type>\\w+)|(?:public|private|protected|internal)[ \\t]+(?:(?:static|virtual|override|abstract|async|sealed|new|extern|unsafe|partial)[ \\t]+)*[\\w<>\\[\\],.?]+[ \\t]+(?P<method>\\w+)[ \\t]*(?:<[^>\\n]*>)?[ \\t]*\\(|(?:(?:public|private|protected|internal)[ \\t]+)?const[ \\t]+[\\w<>.?]+[ \\t]+(?P<const>\\w+))"
+const defaultSymbolsRx_VBNet = "(?im)^[ \\t]*(?:Imports[ \\t]+(?P<import>[\\w.]+)|Namespace[ \\t]+(?P<namespace>[\\w.]+)|(?:(?:Public|Private|Protected|Friend|Partial|MustInherit|NotInheritable|Shared)[ \\t]+)*(?:Class|Module|Structure|Interface|Enum)[ \\t]+(?P<type>\\w+)|(?:(?:Public|Private|Protected|Friend|Shared|Overrides|Overridable|MustOverride|Async|Overloads)[ \\t]+)*(?:Sub|Function)[ \\t]+(?P<method>\\w+)|(?:(?:Public|Private|Protected|Friend)[ \\t]+)?Const[ \\t]+(?P<const>\\w+))"
+const defaultSymbolsRx_Dart = "(?m)^(?:import[ \\t]+['\"](?P<import>[^'\"\\n]+)['\"]|(?:(?:abstract|sealed|base|final)[ \\t]+)*(?:class|mixin|enum|extension|typedef)[ \\t]+(?P<type>\\w+)|const[ \\t]+(?:[\\w<>?]+[ \\t]+)?(?P<const>\\w+)[ \\t]*=|(?:[\\w<>?,]+[ \\t]+)?(?P<func>[a-z_]\\w*)[ \\t]*\\([^;\\n]*\\)[ \\t]*(?:async[ \\t]*)?(?:\\{|=>))"
+const defaultSymbolsRx_VB6 = "(?im)^(?:Attribute[ \\t]+VB_Name[ \\t]*=[ \\t]*\"(?P<module>\\w+)\"|(?:(?:Public|Private|Friend|Global)[ \\t]+)?(?:Static[ \\t]+)?(?:Sub|Function)[ \\t]+(?P<func>\\w+)|(?:(?:Public|Private|Friend)[ \\t]+)?Property[ \\t]+(?:Get|Let|Set)[ \\t]+(?P<property>\\w+)|(?:(?:Public|Private|Global)[ \\t]+)?Const[ \\t]+(?P<const>\\w+)|(?:(?:Public|Private)[ \\t]+)?(?:Type|Enum)[ \\t]+(?P<type>\\w+))"
+
+// Size (in characters) of fragments for annotation of large files. Source code contains more tokens per character than text,
+// so it is split into smaller fragments
+const defaultAnnotateChunkSize = 100000
+const defaultAnnotateCodeChunkSize = 60000
+
+// Regexps to split large files for annotation before declarations, together with preceding comments and attributes
+const defaultChunkSplitRx_C = "(?m)^(?:[ \\t]*(?://|/\\*|\\*)[^\\n]*\\n)*(?:typedef\\b|(?:struct|union|enum)[ \\t]+\\w+[ \\t]*\\{?[ \\t]*$|[A-Za-z_][\\w \\t\\*]*?[ \\t\\*][A-Za-z_]\\w*[ \\t]*\\([^;\\n]*$)"
+const defaultChunkSplitRx_CPP = "(?m)^(?:[ \\t]*(?://|/\\*|\\*)[^\\n]*\\n)*(?:template[ \\t]*<|namespace\\b|typedef\\b|using[ \\t]+\\w+[ \\t]*=|(?:class|struct|union|enum)\\b[^;\\n]*$|[A-Za-z_][\\w \\t\\*&:<>,]*?[ \\t\\*&][A-Za-z_~][\\w:~]*[ \\t]*\\([^;\\n]*$)"
+const defaultChunkSplitRx_CSharp = "(?m)^(?:[ \\t]*(?://|/\\*|\\*|\\[)[^\\n]*\\n)*[ \\t]*(?:namespace[ \\t]|(?:(?:public|private|protected|internal|static|abstract|sealed|partial|readonly|unsafe|new)[ \\t]+)*(?:class|interface|struct|enum|record)[ \\t]|(?:public|private|protected|internal)[ \\t]+[^=;\\n]*\\()"
+const defaultChunkSplitRx_VBNet = "(?im)^(?:[ \\t]*(?:'|<)[^\\n]*\\n)*[ \\t]*(?:Namespace[ \\t]|(?:(?:Public|Private|Protected|Friend|Partial|MustInherit|NotInheritable|Shared|Overrides|Overridable|MustOverride|Async|Overloads)[ \\t]+)*(?:Class|Module|Structure|Interface|Enum|Sub|Function|Property)[ \\t])"
+const defaultChunkSplitRx_Dart = "(?m)^(?:[ \\t]*(?://|/\\*|\\*|@)[^\\n]*\\n)*(?:(?:(?:abstract|sealed|base|final)[ \\t]+)*(?:class|mixin|enum|extension|typedef)[ \\t]|(?:[\\w<>?,]+[ \\t]+)?[a-z_]\\w*[ \\t]*\\([^;\\n]*$)"
+const defaultChunkSplitRx_Bash = "(?m)^(?:#[^\\n]*\\n)*(?:function[ \\t]+[\\w:-]+|[\\w:-]+[ \\t]*\\(\\))"
+const defaultChunkSplitRx_VB6 = "(?im)^(?:'[^\\n]*\\n)*(?:(?:Public|Private|Friend|Global)[ \\t]+)?(?:Static[ \\t]+)?(?:Sub|Function|Property[ \\t]+(?:Get|Let|Set))[ \\t]+\\w+"
+
 var defaultIncrModeTagsRegexps = []string{"(?m)(^|\\n)\\s*SEARCH>>>\\s*($|\\n)", "(?m)(^|\\n)\\s*<<<REPLACE>>>\\s*($|\\n)", "(?m)(^|\\n)\\s*<<<DONE\\s*($|\\n)"}
 
 func getDefaultAnnotateConfigTemplate() map[string]any {
 	result := config.GetAnnotateConfigTemplate()
 	result[config.K_SystemPromptAck] = defaultAISystemPromptAcknowledge
-	result[config.K_AnnotateTaskPrompt] = "Create detailed summary of the tasks marked with \"###IMPLEMENT###\" comments in the source code file provided in my next message. Also provide keywords that describe the tasks, areas, and dependent entities that can be traced in the source code file. In addition to the code, the file name is also provided between the <filename></filename> tags. When creating summary follow this template strictly:\n\nTasks:\n- <task description>\n- <task description>\n\nKeywords: <comma separated list of keywords>"
+	result[config.K_AnnotateTaskPrompt] = "Create detailed summary of the tasks marked with \"###IMPLEMENT###\" comments or placed in code regions between \"###IMPLEMENT-BEGIN###\" and \"###IMPLEMENT-END###\" comments in the source code file provided in my next message. Also provide keywords that describe the tasks, areas, and dependent entities that can be traced in the source code file. In addition to the code, the file name is also provided between the <filename></filename> tags. When creating summary follow this template strictly:\n\nTasks:\n- <task description>\n- <task description>\n\nKeywords: <comma separated list of keywords>"
 	result[config.K_AnnotateTaskResponse] = "Waiting for file contents"
 	result[config.K_AnnotateFileResponse] = "Waiting for file contents"
+	result[config.K_AnnotateDirPrompt] = "Create a summary for the project directory, using the summaries of its files and subdirectories provided in my next message. The summary must describe the purpose of the directory and the main entities, features and responsibilities implemented inside it, so it can be used to decide whether the directory is relevant to a task without looking at the files inside. Mention only the most important files and subdirectories, do not list them all. Keep the summary short: one paragraph of a few sentences, without headers or lists."
+	result[config.K_AnnotateDirResponse] = "Waiting for directory contents"
+	// chunked annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{{"^.*$", defaultAnnotateChunkSize}}
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{}
+	result[config.K_AnnotateChunkPrompt] = "The source file provided in my next message is too large to be summarized at once, so it is split into consecutive fragments, and you will be given one of them. Create a summary for this fragment of the file. Describe the purpose of the code in the fragment and list the entities declared in it (types, classes, functions, methods, constants, variables) with their names exactly as in the code and a short description of each. Do not guess about the code that is not part of the fragment. In addition to the fragment contents, the file name is also provided between the <filename></filename> tags."
+	result[config.K_AnnotateChunkResponse] = "Waiting for file fragment"
+	result[config.K_AnnotateMergePrompt] = "The source file is too large to be provided at once, so it was split into consecutive fragments and a summary was created for each fragment. In my next message I will provide the file name between the <filename></filename> tags, followed by the summaries of its fragments in the order they appear in the file. Using these summaries instead of the file contents, create a summary for the whole file according to the following instructions."
+	result[config.K_AnnotateMergeResponse] = "Waiting for fragment summaries"
+	// annotation quality checks
+	result[config.K_AnnotateMinLength] = 10
+	result[config.K_AnnotateMaxLength] = 10000
+	result[config.K_AnnotateRequiredRx] = [][2]string{}
+	result[config.K_AnnotateForbiddenRx] = defaultAnnotateForbiddenRegexps
+	result[config.K_AnnotateLanguageRx] = "\\p{Latin}"
+	result[config.K_AnnotateLanguageMinPercent] = 70.0
+	result[config.K_AnnotateSymbolsRx] = [][2]string{}
+	result[config.K_AnnotateSymbolsMinPercent] = 30.0
+	result[config.K_AnnotateNotesRx] = []string{"(?i)\\bNOTE\\s+for\\s+summarization\\b"}
 	return result
 }
 
@@ -190,23 +256,24 @@ func getDefaultImplementConfigTemplate() map[string]any {
 	result := config.GetImplementConfigTemplate()
 	result[config.K_SystemPromptAck] = defaultAISystemPromptAcknowledge
 	// stage 1
-	result[config.K_ImplementStage1AnalysisPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\". Review source code contents and all the project information provided earlier and create a list of filenames from the project structure that you will need to see in addition to this source code to implement the tasks. Place each filename between <filename></filename> tags."
+	result[config.K_ImplementStage1AnalysisPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\" or placed in code regions between the comments \"###IMPLEMENT-BEGIN###\" and \"###IMPLEMENT-END###\". Review source code contents and all the project information provided earlier and create a list of filenames from the project structure that you will need to see in addition to this source code to implement the tasks. Place each filename between <filename></filename> tags."
 	result[config.K_ImplementTaskStage1AnalysisPrompt] = "Below are the tasks that need to be implemented. Review the tasks and all the project information provided earlier and create a list of filenames from the project structure that you will need to see to implement the tasks. Place each filename between <filename></filename> tags. The tasks are:"
 
 	// stage 2
 	result[config.K_CodePrompt] = "Here are the contents of the project's source code files that are likely relevant to the tasks you'll be working on."
 	result[config.K_CodeResponse] = defaultAIAcknowledge
-	result[config.K_ImplementStage2NoPlanningPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\". Study all the code I've provided for you and be ready to implement the tasks, one file at a time."
+	result[config.K_ImplementStage2NoPlanningPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\" or placed in code regions between the comments \"###IMPLEMENT-BEGIN###\" and \"###IMPLEMENT-END###\". Study all the code I've provided for you and be ready to implement the tasks, one file at a time."
 	result[config.K_ImplementStage2NoPlanningResponse] = "I have carefully studied all the code provided to me, and I am ready to implement the tasks."
 	//TODO: Provide work-plan template to follow, as we do for annotate operation.
 	//This should improve quality of work plan generation for smaller models.
-	result[config.K_ImplementStage2ReasoningsPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\". Study all the source code and other project information provided to you and create a work plan indicating what changes to the code base need to be made to complete the tasks. Work plan should only contain steps about code base modification. Do not write any code or examples, deployment or code-review steps in your work plan. Make sure there are no multiline fenced code blocks in your output."
-	result[config.K_ImplementStage2ReasoningsPromptFinal] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\". Study all the source code provided to you and create a work plan indicating what changes to the code need to be made to complete the tasks."
+	result[config.K_ImplementStage2ReasoningsPrompt] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\" or placed in code regions between the comments \"###IMPLEMENT-BEGIN###\" and \"###IMPLEMENT-END###\". Study all the source code and other project information provided to you and create a work plan indicating what changes to the code base need to be made to complete the tasks. Work plan should only contain steps about code base modification. Do not write any code or examples, deployment or code-review steps in your work plan. Make sure there are no multiline fenced code blocks in your output."
+	result[config.K_ImplementStage2ReasoningsPromptFinal] = "Here are the contents of the source code files that interest me. The files contain sections of code with tasks that need to be implemented, marked with the comments \"###IMPLEMENT###\" or placed in code regions between the comments \"###IMPLEMENT-BEGIN###\" and \"###IMPLEMENT-END###\". Study all the source code provided to you and create a work plan indicating what changes to the code need to be made to complete the tasks."
 	result[config.K_ImplementTaskStage2ReasoningsPrompt] = "Below are the tasks that need to be implemented. Study all the source code and other project information provided to you and create a work plan indicating what changes to the code base need to be made to complete the tasks. Work plan should only contain steps about code base modification. Do not write any code or examples, deployment or code-review steps in your work plan. Make sure there are no multiline fenced code blocks in your output. The tasks are:"
 	result[config.K_ImplementTaskStage2ReasoningsPromptFinal] = "Below are the tasks that need to be implemented. Study all the source code provided to you and create a work plan indicating what changes to the code need to be made to complete the tasks. The tasks are:"
+	result[config.K_ImplementStage2RevisePrompt] = "Below is my feedback on your work plan. Revise the work plan according to the feedback, and output the complete updated work plan. Work plan should only contain steps about code base modification. Do not write any code or examples in your work plan. Make sure there are no multiline fenced code blocks in your output. The feedback is:"
 
 	// stage 3
-	result[config.K_ImplementStage3PlanningPrompt] = "Now create a list of filenames that will be changed, created, or deleted by you as a result of implementing the tasks according to your work plan. Place each filename that will be changed or created between <filename></filename> tags. If an existing file should be deleted, place that filename between <delete></delete> tags."
+	result[config.K_ImplementStage3PlanningPrompt] = "Now create a list of filenames that will be changed, created, or deleted by you as a result of implementing the tasks according to your work plan. Place each filename that will be changed or created between <filename></filename> tags. If an existing file should be deleted, place that filename between <delete></delete> tags. If an existing file should be renamed or moved, place its current filename and its new filename separated with \" -> \" between <move></move> tags, and if the moved file also needs changes, place its new filename between <filename></filename> tags as well."
 	result[config.K_ImplementStage3ExtraFilesPrompt] = "Below are the contents of additional source code files that may be relevant to the tasks."
 
 	// stage 4
@@ -215,7 +282,9 @@ func getDefaultImplementConfigTemplate() map[string]any {
 	result[config.K_ImplementStage4ProcessPrompt] = "Implement the required code for the following file: \"###FILENAME###\". Output the entire file with the code you implemented. The response must only contain that file with implemented code as code-block and nothing else."
 	result[config.K_ImplementStage4ContinuePrompt] = "You previous response hit token limit. Continue generating code right from the point where it stopped. Do not repeat already generated fragment in your response."
 	result[config.K_ImplementStage4ProcessIncrPrompt] = "Implement the required code for the following file: \"###FILENAME###\". Output your changes as one or more search-and-replace blocks in following format:\n\nSEARCH>>>\n<several consecutive lines of code from file needed to show the exact location where your changes will be made>\n<<<REPLACE>>>\n<lines of code with your changes implemented that will replace the lines of code above>\n<<<DONE\n\n\n\nImportant notes:\n\n- If you believe a file requires changes that cannot be efficiently packaged into search-and-replace blocks as described above, you can output the entire file at once with code markup (```), with all required changes included.\n- Be careful with indentation: do not remove leading spaces or tabs inside search-and-replace blocks, do not accidentally replace tabs with spaces and vice versa.\n- Do not use code markup (```) inside search-and-replace blocks.\n- Reply either with search-and-replace blocks or with the entire file with the changes made.\n"
+	result[config.K_ImplementStage4ProcessRegionPrompt] = "Implement the required code for the code region from the file \"###FILENAME###\" provided below. The region starts with the line containing the \"###IMPLEMENT-BEGIN###\" comment and ends with the line containing the \"###IMPLEMENT-END###\" comment. Output only the code that will replace the whole region, including the lines with these comments, as code-block and nothing else. Do not output the rest of the file. The region is:"
 	result[config.K_ImplementFilenameEmbedRx] = "###FILENAME###"
+	result[config.K_ImplementRegionTagsRx] = defaultImplementRegionTagsRegexps
 
 	return result
 }
@@ -249,6 +318,9 @@ func getDefaultExplainConfigTemplate() map[string]any {
 	result[config.K_ExplainOutQuestionHeader] = "# Question"
 	// stage 1
 	result[config.K_ExplainStage1QuestionPrompt] = "Here is a question about the project's codebase that you need to answer. Study the question and, using the available information about the project, create a list of filenames from the project structure whose contents you need to see to answer the question. Place each filename between <filename></filename> tags. The question is:"
+	// definitions of symbols mentioned in the question
+	result[config.K_ExplainSymbolsPrompt] = "Here are the locations of definitions of symbols mentioned in the question, found in the project source code (in the format: symbol name, kind, file path and line number). Take them into account when working on the question."
+	result[config.K_ExplainSymbolsResponse] = defaultAIAcknowledge
 	// stage 2
 	result[config.K_CodePrompt] = "Here are the contents of the project's source code files that are likely relevant to the question you'll be working on."
 	result[config.K_CodeResponse] = defaultAIAcknowledge
@@ -267,6 +339,7 @@ func getDefaultReportConfigTemplate() map[string]any {
 func getDefaultProjectConfigTemplate() map[string]any {
 	result := config.GetProjectConfigTemplate()
 	result[config.K_ProjectFilesBlacklist] = []string{}
+	result[config.K_ProjectFilesReadonly] = []string{}
 	result[config.K_ProjectTestFilesBlacklist] = []string{}
 	result[config.K_ProjectMdCodeMappings] = [][2]string{}
 	result[config.K_ProjectMediumContextSavingFileCount] = 400
@@ -276,6 +349,15 @@ func getDefaultProjectConfigTemplate() map[string]any {
 	result[config.K_ProjectHighContextSavingSelectPercent] = 30.0
 	result[config.K_ProjectHighContextSavingRandomPercent] = 20.0
 	result[config.K_ProjectIndexResponse] = "I have carefully studied the information provided and will take it into account when working on the project tasks. Ready for your primary instructions."
+	// directory summaries, used to select relevant directories first when project is too large, zero file count disables it
+	result[config.K_ProjectDirIndexPrompt] = "For your careful consideration, here is the directory structure of the project. Brief descriptions of project directories are provided, including the directory paths and descriptions of their contents. Source code files located outside these directories are also listed with their descriptions. Please study this before proceeding."
+	result[config.K_ProjectDirSelectPrompt] = "The project is too large to describe every file at once. So, instead of filenames, now create a list of directories from the project directory structure whose files you may need to see for this. You may also list individual files from the directory structure. Place each directory name or filename between <filename></filename> tags. Files from the selected directories will be described to you in the next step."
+	result[config.K_ProjectDirSummariesFileCount] = 800
+	result[config.K_ProjectDirIndexMaxEntries] = 150
+	// local symbol index, symbols declared in files are listed in the project index next to annotations, zero count disables it
+	result[config.K_ProjectSymbolsRx] = [][2]string{}
+	result[config.K_ProjectSymbolsMaxCount] = 30
+	result[config.K_ProjectSymbolsHeader] = "Declared symbols (extracted from the source code):"
 	// optional project description
 	result[config.K_ProjectDescriptionPrompt] = "Primary tasks will follow shortly. For your awareness, project description is provided:"
 	result[config.K_ProjectDescriptionResponse] = "I have carefully studied the information provided and will take it into account when working on the project tasks."
@@ -284,9 +366,22 @@ func getDefaultProjectConfigTemplate() map[string]any {
 	result[config.K_ProjectFilenameTagsRx] = defaultFileNameTagsRegexps
 	result[config.K_ProjectDeleteTags] = defaultDeleteTags
 	result[config.K_ProjectDeleteTagsRx] = defaultDeleteTagsRegexps
+	result[config.K_ProjectMoveTags] = defaultMoveTags
+	result[config.K_ProjectMoveTagsRx] = defaultMoveTagsRegexps
 	result[config.K_ProjectCodeTagsRx] = defaultOutputTagsRegexps
 	result[config.K_ProjectNoUploadCommentsRx] = defaultOutputTagsRegexps
 	// settings for incremental file-change mode
 	result[config.K_ProjectFilesIncrModeRx] = defaultIncrModeTagsRegexps
+	// secrets redaction, zero entropy threshold disables detection of high-entropy tokens
+	result[config.K_ProjectSecretsRx] = defaultSecretsRegexps
+	result[config.K_ProjectSecretsEntropyThreshold] = 4.0
+	result[config.K_ProjectSecretsEntropyMinLength] = 32
+	// stash retention and compression settings, zero values disable retention limits
+	result[config.K_ProjectStashKeepCount] = 100
+	result[config.K_ProjectStashMaxAgeDays] = 0.0
+	result[config.K_ProjectStashMaxTotalSizeMB] = 0.0
+	result[config.K_ProjectStashCompression] = "none"
+	result[config.K_ProjectGitMode] = "none"
+	result[config.K_ProjectGitBranchPrefix] = "perpetual/"
 	return result
 }
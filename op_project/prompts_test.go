@@ -0,0 +1,58 @@
+package op_project
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/config"
+)
+
+func TestAnnotateChunkSplitRx(t *testing.T) {
+	tests := []struct {
+		lang       string
+		file       string
+		text       string
+		boundaries int
+	}{
+		{"go", "main.go", "package main\n\n// Run runs\nfunc Run() {}\n\ntype T struct{}\n", 2},
+		{"python3", "main.py", "import os\n\n@decorator\ndef run():\n    pass\n\nclass A:\n    def m(self):\n        pass\n", 2},
+		{"c", "main.c", "#include <stdio.h>\n\n// adds numbers\nint add(int a, int b)\n{\n\treturn a + b;\n}\n\nstruct point {\n\tint x;\n};\n\nstatic void run(void) {\n\tadd(1, 2);\n}\n", 3},
+		{"cpp", "widget.cpp", "namespace app {\n\n/// Widget class\nclass Widget {\npublic:\n\tvoid draw();\n};\n\nvoid Widget::draw() {\n}\n\n}\n", 3},
+		{"arduino", "sketch.ino", "// setup\nvoid setup() {\n\tpinMode(13, OUTPUT);\n}\n\nvoid loop() {\n}\n", 2},
+		{"flutter", "lib/main.dart", "import 'package:flutter/material.dart';\n\nvoid main() {\n  runApp(const App());\n}\n\n/// Root widget\nclass App extends StatelessWidget {\n  @override\n  Widget build(BuildContext context) {\n    return Container();\n  }\n}\n", 2},
+		{"dotnet", "Service.cs", "using System;\n\nnamespace App\n{\n    /// <summary>Service</summary>\n    public class Service\n    {\n        [Obsolete]\n        public void Run()\n        {\n            var x = Compute(1);\n        }\n    }\n}\n", 3},
+		{"dotnet", "Service.vb", "Imports System\n\nNamespace App\n    ''' <summary>Service</summary>\n    Public Class Service\n        Public Sub Run()\n        End Sub\n    End Class\nEnd Namespace\n", 3},
+		{"bash", "run.sh", "#!/bin/bash\n\n# prints usage\nusage() {\n  echo usage\n}\n\nfunction main {\n  usage\n}\n\nmain \"$@\"\n", 2},
+		{"vb6", "Module1.bas", "Attribute VB_Name = \"Module1\"\nOption Explicit\n\n' entry point\nPublic Sub Main()\nEnd Sub\n\nPrivate Function Sum(a As Long) As Long\nEnd Function\n\nPublic Property Get Name() As String\nEnd Property\n", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.lang+"/"+tt.file, func(t *testing.T) {
+			p, err := newPrompts(tt.lang)
+			if err != nil {
+				t.Fatal(err)
+			}
+			annotateConfig := p.GetAnnotateConfig()
+			var splitRx *regexp.Regexp
+			for _, entry := range annotateConfig[config.K_AnnotateChunkSplitRx].([][2]string) {
+				if regexp.MustCompile(entry[0]).MatchString(tt.file) {
+					splitRx = regexp.MustCompile(entry[1])
+					break
+				}
+			}
+			if splitRx == nil {
+				t.Fatalf("no split regexp for file %s", tt.file)
+			}
+			if boundaries := len(splitRx.FindAllStringIndex(tt.text, -1)); boundaries != tt.boundaries {
+				t.Errorf("found %d boundaries, want %d: %q", boundaries, tt.boundaries, splitRx.FindAllString(tt.text, -1))
+			}
+			for _, entry := range annotateConfig[config.K_AnnotateChunkSizes].([][2]any) {
+				if regexp.MustCompile(entry[0].(string)).MatchString(tt.file) {
+					if entry[1] != defaultAnnotateCodeChunkSize {
+						t.Errorf("chunk size for source file = %v, want %d", entry[1], defaultAnnotateCodeChunkSize)
+					}
+					break
+				}
+			}
+		})
+	}
+}
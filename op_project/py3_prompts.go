@@ -23,6 +23,19 @@ func (p *py3Prompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*requirements\\.txt$", defaultAIAnnotatePrompt_PyReqTxt, defaultAIAnnotatePrompt_PyReqTxt_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// split large files before top-level functions and classes, keeping their comments and decorators
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.py$", "(?m)^(?:#[^\\n]*\\n|@[^\\n]*\\n)*(?:async\\s+def|def|class)\\b"},
+	}
+	// public symbols that annotation must mention
+	result[config.K_AnnotateSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.py$", "(?m)^(?:def|class) ([A-Za-z]\\w*)"},
+	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.py$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
 	return result
 }
 
@@ -78,6 +91,10 @@ func (p *py3Prompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(py|lua|pl|bat|cmd|sh|bash|sh\\.in|bash\\.in)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.py$", defaultSymbolsRx_Python},
+	}
 	return result
 }
 
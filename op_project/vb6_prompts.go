@@ -19,6 +19,15 @@ func (p *vb6Prompts) GetAnnotateConfig() map[string]any {
 		{"(?i)^.*\\.bas$", defaultAIAnnotatePrompt_VB6_Module, defaultAIAnnotatePrompt_VB6_Module_Short},
 		{"^.*$", defaultAIAnnotatePrompt_Generic, defaultAIAnnotatePrompt_Generic_Short},
 	}
+	// fragment sizes for annotation of large files
+	result[config.K_AnnotateChunkSizes] = [][2]any{
+		{"(?i)^.*\\.(frm|cls|bas)$", defaultAnnotateCodeChunkSize},
+		{"^.*$", defaultAnnotateChunkSize},
+	}
+	// split large files before procedures and properties, keeping their comments
+	result[config.K_AnnotateChunkSplitRx] = [][2]string{
+		{"(?i)^.*\\.(frm|cls|bas)$", defaultChunkSplitRx_VB6},
+	}
 	return result
 }
 
@@ -58,6 +67,10 @@ func (p *vb6Prompts) GetProjectConfig() map[string]any {
 	result[config.K_ProjectFilesIncrModeMinLen] = [][2]any{
 		{"(?i)^.*\\.(frm|cls|bas)$", 8192},
 	}
+	// extractors for local symbol index
+	result[config.K_ProjectSymbolsRx] = [][2]string{
+		{"(?i)^.*\\.(frm|cls|bas)$", defaultSymbolsRx_VB6},
+	}
 	return result
 }
 
@@ -92,6 +92,8 @@ func Run(args []string, logger logging.ILogger) {
 
 	reportConfig := config.LoadOpReportConfig(perpetualDir, logger)
 	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	// Hide secrets in file contents sent to LLM
+	llm.InitSecretRedactor(config.NewSecretRedactor(projectConfig))
 
 	projectFilesBlacklist := projectConfig.RegexpArray(config.K_ProjectFilesBlacklist)
 
@@ -137,7 +139,9 @@ func Run(args []string, logger logging.ILogger) {
 		}
 		op_annotate.Run(op_annotate_params, true, logger)
 		// Load annotations
+		unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
 		annotations, err := utils.GetAnnotations(filepath.Join(perpetualDir, utils.AnnotationsFileName), fileNames)
+		unlockAnnotations()
 		if err != nil {
 			logger.Panicln("Error loading annotations:", err)
 		}
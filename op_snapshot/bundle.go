@@ -0,0 +1,258 @@
+package op_snapshot
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+const SnapshotVersion = 1
+
+const snapshotManifestName = "manifest.json"
+const snapshotAnnotationsName = "annotations.json"
+const snapshotEmbeddingsName = "embeddings.msgpack"
+const snapshotDefaultFile = "perpetual-snapshot.tar.gz"
+
+// snapshotManifest describes the snapshot contents and the LLM configuration that produced them
+type snapshotManifest struct {
+	SnapshotVersion     int    `json:"snapshot_version"`
+	Created             string `json:"created"`
+	PerpetualVersion    string `json:"perpetual_version"`
+	AnnotationsProducer string `json:"annotations_producer,omitempty"`
+	AnnotationsCount    int    `json:"annotations_count"`
+	EmbeddingsProducer  string `json:"embeddings_producer,omitempty"`
+	EmbeddingsCount     int    `json:"embeddings_count"`
+	VectorDimensions    int    `json:"vector_dimensions,omitempty"`
+}
+
+type snapshotAnnotation struct {
+	Checksum   string `json:"checksum"`
+	Annotation string `json:"annotation"`
+}
+
+type snapshotEmbedding struct {
+	Checksum string      `json:"checksum"`
+	Vectors  [][]float32 `json:"vectors"`
+	// 1-based inclusive line ranges of file chunks, one per vector, optional
+	Lines [][2]int `json:"lines,omitempty"`
+}
+
+// Snapshot contains annotations and embeddings keyed by checksum of file contents,
+// so it does not depend on file paths and can be imported into any copy of the project
+type Snapshot struct {
+	manifest    snapshotManifest
+	annotations map[string]string
+	embeddings  map[string][][]float32
+	chunkLines  map[string][][2]int
+}
+
+func newSnapshot(perpetualVersion, annotationsProducer, embeddingsProducer string) *Snapshot {
+	return &Snapshot{
+		manifest: snapshotManifest{
+			SnapshotVersion:     SnapshotVersion,
+			Created:             time.Now().UTC().Format(time.RFC3339),
+			PerpetualVersion:    perpetualVersion,
+			AnnotationsProducer: annotationsProducer,
+			EmbeddingsProducer:  embeddingsProducer,
+		},
+		annotations: map[string]string{},
+		embeddings:  map[string][][]float32{},
+		chunkLines:  map[string][][2]int{},
+	}
+}
+
+// addFiles adds annotations and embeddings of the project files to the snapshot.
+// Only entries that are up to date with current file checksums are added
+func (s *Snapshot) addFiles(
+	fileChecksums map[string]string,
+	annotations map[string]string,
+	annotationChecksums map[string]string,
+	embeddings map[string][][]float32,
+	embeddingChecksums map[string]string,
+	chunkLines map[string][][2]int) {
+
+	for file, checksum := range fileChecksums {
+		if annotation, exist := annotations[file]; exist && annotationChecksums[file] == checksum {
+			s.annotations[checksum] = annotation
+		}
+		if vectors, exist := embeddings[file]; exist && embeddingChecksums[file] == checksum && len(vectors) > 0 {
+			s.embeddings[checksum] = vectors
+			if lines, exist := chunkLines[file]; exist && len(lines) == len(vectors) {
+				s.chunkLines[checksum] = lines
+			}
+			if s.manifest.VectorDimensions == 0 && len(vectors[0]) > 0 {
+				s.manifest.VectorDimensions = len(vectors[0])
+			}
+		}
+	}
+	s.manifest.AnnotationsCount = len(s.annotations)
+	s.manifest.EmbeddingsCount = len(s.embeddings)
+}
+
+// mergeInto copies snapshot entries matching current file checksums into local storage maps.
+// Local entries that are already up to date are replaced only when overwrite is set. Returns names of updated files
+func mergeInto[T any](
+	entries map[string]T,
+	fileChecksums map[string]string,
+	local map[string]T,
+	localChecksums map[string]string,
+	overwrite bool) []string {
+
+	var updated []string
+	for file, checksum := range fileChecksums {
+		entry, exist := entries[checksum]
+		if !exist {
+			continue
+		}
+		if _, localExist := local[file]; localExist && localChecksums[file] == checksum && !overwrite {
+			continue
+		}
+		local[file] = entry
+		localChecksums[file] = checksum
+		updated = append(updated, file)
+	}
+	slices.Sort(updated)
+	return updated
+}
+
+// exportSnapshot writes snapshot into gzip-compressed tar archive with manifest, annotations and embeddings
+func exportSnapshot(snapshotFile string, snapshot *Snapshot) error {
+	manifestData, err := json.MarshalIndent(snapshot.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	var annotations []snapshotAnnotation
+	for checksum, annotation := range snapshot.annotations {
+		annotations = append(annotations, snapshotAnnotation{Checksum: checksum, Annotation: annotation})
+	}
+	slices.SortFunc(annotations, func(a, b snapshotAnnotation) int { return strings.Compare(a.Checksum, b.Checksum) })
+	annotationsData, err := json.MarshalIndent(annotations, "", "  ")
+	if err != nil {
+		return err
+	}
+	var embeddings []snapshotEmbedding
+	for checksum, vectors := range snapshot.embeddings {
+		embeddings = append(embeddings, snapshotEmbedding{Checksum: checksum, Vectors: vectors, Lines: snapshot.chunkLines[checksum]})
+	}
+	slices.SortFunc(embeddings, func(a, b snapshotEmbedding) int { return strings.Compare(a.Checksum, b.Checksum) })
+	embeddingsData, err := msgpack.Marshal(embeddings)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(snapshotFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+	writeEntry := func(entryName string, data []byte) error {
+		header := &tar.Header{Name: entryName, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tarWriter.Write(data)
+		return err
+	}
+
+	if err := writeEntry(snapshotManifestName, append(manifestData, '\n')); err != nil {
+		return err
+	}
+	if err := writeEntry(snapshotAnnotationsName, append(annotationsData, '\n')); err != nil {
+		return err
+	}
+	if err := writeEntry(snapshotEmbeddingsName, embeddingsData); err != nil {
+		return err
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// importSnapshot reads snapshot created with exportSnapshot and validates its contents
+func importSnapshot(snapshotFile string) (*Snapshot, error) {
+	file, err := os.Open(snapshotFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("snapshot is not gzip-compressed: %v", err)
+	}
+	defer gzipReader.Close()
+
+	contents := make(map[string][]byte)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return nil, err
+		}
+		contents[header.Name] = data
+	}
+	for _, name := range []string{snapshotManifestName, snapshotAnnotationsName, snapshotEmbeddingsName} {
+		if _, exist := contents[name]; !exist {
+			return nil, fmt.Errorf("snapshot does not contain %s", name)
+		}
+	}
+
+	snapshot := &Snapshot{annotations: map[string]string{}, embeddings: map[string][][]float32{}, chunkLines: map[string][][2]int{}}
+	if err := json.Unmarshal(contents[snapshotManifestName], &snapshot.manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot manifest: %v", err)
+	}
+	if snapshot.manifest.SnapshotVersion != SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d, expected: %d", snapshot.manifest.SnapshotVersion, SnapshotVersion)
+	}
+	var annotations []snapshotAnnotation
+	if err := json.Unmarshal(contents[snapshotAnnotationsName], &annotations); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot annotations: %v", err)
+	}
+	for _, entry := range annotations {
+		snapshot.annotations[entry.Checksum] = entry.Annotation
+	}
+	var embeddings []snapshotEmbedding
+	if err := msgpack.Unmarshal(contents[snapshotEmbeddingsName], &embeddings); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot embeddings: %v", err)
+	}
+	for _, entry := range embeddings {
+		for _, vector := range entry.Vectors {
+			if len(vector) != snapshot.manifest.VectorDimensions {
+				return nil, fmt.Errorf("snapshot embeddings have inconsistent vector dimensions: expected %d, got %d", snapshot.manifest.VectorDimensions, len(vector))
+			}
+		}
+		snapshot.embeddings[entry.Checksum] = entry.Vectors
+		if len(entry.Lines) > 0 {
+			if len(entry.Lines) != len(entry.Vectors) {
+				return nil, fmt.Errorf("snapshot embeddings have %d line ranges for %d vectors", len(entry.Lines), len(entry.Vectors))
+			}
+			snapshot.chunkLines[entry.Checksum] = entry.Lines
+		}
+	}
+	return snapshot, nil
+}
@@ -0,0 +1,107 @@
+package op_snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestSnapshot() *Snapshot {
+	snapshot := newSnapshot("v-test", "[provider:annotate]", "[provider:embed]")
+	snapshot.addFiles(
+		map[string]string{"a.go": "sum-a", "b.go": "sum-b", "c.go": "sum-c"},
+		map[string]string{"a.go": "annotation a", "b.go": "stale annotation b"},
+		map[string]string{"a.go": "sum-a", "b.go": "old-sum-b", "c.go": "error"},
+		map[string][][]float32{"a.go": {{1, 2}}, "c.go": {{3, 4}, {5, 6}}},
+		map[string]string{"a.go": "sum-a", "c.go": "sum-c"},
+		map[string][][2]int{"a.go": {{1, 10}}, "c.go": {{1, 5}}})
+	return snapshot
+}
+
+func TestSnapshotAddFiles(t *testing.T) {
+	snapshot := newTestSnapshot()
+	if !reflect.DeepEqual(snapshot.annotations, map[string]string{"sum-a": "annotation a"}) {
+		t.Errorf("unexpected annotations: %v", snapshot.annotations)
+	}
+	if len(snapshot.embeddings) != 2 || snapshot.manifest.VectorDimensions != 2 {
+		t.Errorf("unexpected embeddings: %v, dimensions: %d", snapshot.embeddings, snapshot.manifest.VectorDimensions)
+	}
+	if !reflect.DeepEqual(snapshot.chunkLines, map[string][][2]int{"sum-a": {{1, 10}}}) {
+		t.Errorf("unexpected chunk lines: %v", snapshot.chunkLines)
+	}
+	if snapshot.manifest.AnnotationsCount != 1 || snapshot.manifest.EmbeddingsCount != 2 {
+		t.Errorf("unexpected manifest counts: %+v", snapshot.manifest)
+	}
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	snapshotFile := filepath.Join(t.TempDir(), snapshotDefaultFile)
+	snapshot := newTestSnapshot()
+	if err := exportSnapshot(snapshotFile, snapshot); err != nil {
+		t.Fatalf("exportSnapshot() error = %v", err)
+	}
+	imported, err := importSnapshot(snapshotFile)
+	if err != nil {
+		t.Fatalf("importSnapshot() error = %v", err)
+	}
+	if !reflect.DeepEqual(imported, snapshot) {
+		t.Errorf("imported snapshot differs:\ngot:  %+v\nwant: %+v", imported, snapshot)
+	}
+}
+
+func TestImportSnapshotErrors(t *testing.T) {
+	dir := t.TempDir()
+	notGzip := filepath.Join(dir, "plain.tar.gz")
+	if err := os.WriteFile(notGzip, []byte("not a snapshot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importSnapshot(notGzip); err == nil || !strings.Contains(err.Error(), "gzip") {
+		t.Errorf("expected gzip error, got: %v", err)
+	}
+
+	wrongVersion := filepath.Join(dir, "version.tar.gz")
+	snapshot := newTestSnapshot()
+	snapshot.manifest.SnapshotVersion = SnapshotVersion + 1
+	if err := exportSnapshot(wrongVersion, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importSnapshot(wrongVersion); err == nil || !strings.Contains(err.Error(), "version") {
+		t.Errorf("expected version error, got: %v", err)
+	}
+
+	wrongLines := filepath.Join(dir, "lines.tar.gz")
+	snapshot = newTestSnapshot()
+	snapshot.chunkLines["sum-c"] = [][2]int{{1, 5}}
+	if err := exportSnapshot(wrongLines, snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importSnapshot(wrongLines); err == nil || !strings.Contains(err.Error(), "line ranges") {
+		t.Errorf("expected line ranges error, got: %v", err)
+	}
+}
+
+func TestMergeInto(t *testing.T) {
+	entries := map[string]string{"sum-a": "new a", "sum-b": "new b", "sum-x": "new x"}
+	fileChecksums := map[string]string{"a.go": "sum-a", "b.go": "sum-b", "c.go": "sum-c", "copy.go": "sum-a"}
+
+	local := map[string]string{"a.go": "local a", "b.go": "local b"}
+	localChecksums := map[string]string{"a.go": "sum-a", "b.go": "old-sum-b", "c.go": "error", "copy.go": "error"}
+	updated := mergeInto(entries, fileChecksums, local, localChecksums, false)
+	if !reflect.DeepEqual(updated, []string{"b.go", "copy.go"}) {
+		t.Errorf("unexpected updated files: %v", updated)
+	}
+	wantLocal := map[string]string{"a.go": "local a", "b.go": "new b", "copy.go": "new a"}
+	if !reflect.DeepEqual(local, wantLocal) {
+		t.Errorf("unexpected local entries: %v", local)
+	}
+	if localChecksums["b.go"] != "sum-b" || localChecksums["copy.go"] != "sum-a" || localChecksums["c.go"] != "error" {
+		t.Errorf("unexpected local checksums: %v", localChecksums)
+	}
+
+	updated = mergeInto(entries, fileChecksums, local, localChecksums, true)
+	if !reflect.DeepEqual(updated, []string{"a.go", "b.go", "copy.go"}) || local["a.go"] != "new a" {
+		t.Errorf("unexpected overwrite result: %v, %v", updated, local)
+	}
+}
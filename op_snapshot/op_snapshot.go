@@ -0,0 +1,309 @@
+package op_snapshot
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/op_annotate"
+	"github.com/DarkCaster/Perpetual/op_embed"
+	"github.com/DarkCaster/Perpetual/usage"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+const OpName = "snapshot"
+const OpDesc = "Export or import annotations and embeddings to share them between project copies"
+
+func snapshotFlags() *flag.FlagSet {
+	return flag.NewFlagSet(OpName, flag.ExitOnError)
+}
+
+func Run(version string, args []string, logger logging.ILogger) {
+	var help, verbose, trace, overwrite, forceEmbeddings bool
+	var mode, snapshotFile, userFilterFile string
+
+	flags := snapshotFlags()
+	flags.BoolVar(&help, "h", false, "This help message")
+	flags.StringVar(&mode, "m", "", "Select operation mode (valid values: export|import).\n"+
+		"export: save up-to-date annotations and embeddings of project files to the snapshot file.\n"+
+		"import: load annotations and embeddings from the snapshot file for project files with matching contents.")
+	flags.StringVar(&snapshotFile, "b", "", "Snapshot file to write with '-m export' (default: "+snapshotDefaultFile+" in current directory), or to read with '-m import'")
+	flags.BoolVar(&overwrite, "a", false, "Overwrite local annotations and embeddings that are already up to date when importing")
+	flags.BoolVar(&forceEmbeddings, "e", false, "Import embeddings even if they were produced with embedding configuration different from the local one")
+	flags.StringVar(&userFilterFile, "x", "", "Path to user-supplied regex filter-file for filtering out certain files from processing")
+	flags.BoolVar(&verbose, "v", false, "Enable debug logging")
+	flags.BoolVar(&trace, "vv", false, "Enable debug and trace logging")
+	flags.Parse(args)
+
+	mode = strings.ToUpper(mode)
+	if mode == "" {
+		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: export|import)", flags)
+	}
+
+	if mode != "EXPORT" && mode != "IMPORT" {
+		logger.Errorln("Invalid mode:", mode)
+		usage.PrintOperationUsage("You must provide a valid operation mode with the '-m' flag (valid values: export|import)", flags)
+	}
+
+	if mode == "IMPORT" && snapshotFile == "" {
+		usage.PrintOperationUsage("You must provide snapshot file to import with the '-b' flag", flags)
+	}
+
+	if overwrite && mode != "IMPORT" {
+		usage.PrintOperationUsage("The '-a' flag can only be used in import mode", flags)
+	}
+
+	if forceEmbeddings && mode != "IMPORT" {
+		usage.PrintOperationUsage("The '-e' flag can only be used in import mode", flags)
+	}
+
+	if snapshotFile == "" {
+		snapshotFile = snapshotDefaultFile
+	}
+
+	if verbose {
+		logger.EnableLevel(logging.DebugLevel)
+	}
+	if trace {
+		logger.EnableLevel(logging.DebugLevel)
+		logger.EnableLevel(logging.TraceLevel)
+	}
+
+	logger.Debugln("Starting 'snapshot' operation")
+	logger.Traceln("Args:", args)
+
+	if help {
+		usage.PrintOperationUsage("", flags)
+	}
+
+	projectRootDir, perpetualDir, err := utils.FindProjectRoot(logger, false)
+	if err != nil {
+		logger.Panicln("Error finding project root directory:", err)
+	}
+
+	globalConfigDir, err := utils.FindConfigDir()
+	if err != nil {
+		logger.Panicln("Error finding perpetual config directory:", err)
+	}
+
+	logger.Infoln("Project root directory:", projectRootDir)
+	logger.Debugln("Perpetual directory:", perpetualDir)
+
+	utils.LoadEnvFiles(logger, perpetualDir, globalConfigDir)
+
+	projectConfig := config.LoadProjectConfig(perpetualDir, logger)
+	annotateConfig := config.LoadOpAnnotateConfig(perpetualDir, logger)
+
+	var userBlacklist []*regexp.Regexp
+	if userFilterFile != "" {
+		userBlacklist, err = utils.AppendUserFilterFromFile(userFilterFile, userBlacklist)
+		if err != nil {
+			logger.Panicln("Error processing user blacklist-filter:", err)
+		}
+	}
+
+	// Preparation of project files
+	logger.Infoln("Fetching project files")
+	fileNames, _, err := utils.GetProjectFileList(
+		projectRootDir,
+		perpetualDir,
+		projectConfig.RegexpArray(config.K_ProjectFilesWhitelist),
+		projectConfig.RegexpArray(config.K_ProjectFilesBlacklist))
+
+	if err != nil {
+		logger.Panicln("Error getting project file-list:", err)
+	}
+
+	// Check fileNames array for case collisions
+	if !utils.CheckFilenameCaseCollisions(fileNames) {
+		logger.Panicln("Filename case collisions detected in project files")
+	}
+	// File names and dir-names must not contain path separators characters
+	if !utils.CheckForPathSeparatorsInFilenames(fileNames) {
+		logger.Panicln("Invalid characters detected in project filenames or directories: / and \\ characters are not allowed!")
+	}
+
+	// Only files passed the user blacklist are exported or imported
+	selectedFiles, droppedFiles := utils.FilterFilesWithBlacklist(fileNames, userBlacklist)
+	if len(droppedFiles) > 0 {
+		logger.Infoln("Number of files filtered by user-provided blacklist:", len(droppedFiles))
+	}
+
+	logger.Infoln("Calculating checksums for project files")
+	fileChecksums, err := utils.CalculateFilesChecksums(projectRootDir, selectedFiles)
+	if err != nil {
+		logger.Panicln("Error getting project-files checksums:", err)
+	}
+
+	// LLM configuration that produces annotations and embeddings for this project, recorded to the snapshot for reference
+	annotationsProducer := ""
+	if connector, err := llm.NewLLMConnector(op_annotate.OpName,
+		annotateConfig.String(config.K_SystemPrompt),
+		annotateConfig.String(config.K_SystemPromptAck),
+		projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+		func(v ...any) {}); err == nil {
+		annotationsProducer = connector.GetDebugString()
+	} else {
+		logger.Debugln("Failed to create LLM connector for annotate operation:", err)
+	}
+	embeddingsProducer := ""
+	if connector, err := llm.NewLLMConnector(op_embed.OpName, "", "",
+		projectConfig.TextMatcherString(config.K_ProjectMdCodeMappings),
+		func(v ...any) {}); err == nil {
+		embeddingsProducer = connector.GetDebugString()
+	} else {
+		logger.Debugln("Failed to create LLM connector for embed operation:", err)
+	}
+
+	annotationsFilePath := filepath.Join(perpetualDir, utils.AnnotationsFileName)
+	embeddingsFilePath := filepath.Join(perpetualDir, utils.EmbeddingsFileName)
+
+	if mode == "EXPORT" {
+		unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
+		defer unlockAnnotations()
+		unlockEmbeddings := utils.LockProjectResource(perpetualDir, utils.LockResourceEmbeddings, false, logger)
+		defer unlockEmbeddings()
+
+		annotations, err := utils.GetAnnotations(annotationsFilePath, selectedFiles)
+		if err != nil {
+			logger.Panicln("Failed to read annotations:", err)
+		}
+		annotationChecksums := utils.GetChecksumsFromAnnotations(annotationsFilePath, selectedFiles)
+		embeddings, embeddingChecksums, vectorDimensions, err := utils.GetEmbeddings(embeddingsFilePath, selectedFiles)
+		if err != nil {
+			logger.Panicln("Failed to load embeddings:", err)
+		}
+		if vectorDimensions < 0 {
+			logger.Panicln("Vectors dimensions inconsistency detected for existing embeddings, rebuild all embeddings by running embed operation with '-m full' flag")
+		}
+		chunkLines, err := utils.GetEmbeddingsChunkLines(embeddingsFilePath, selectedFiles)
+		if err != nil {
+			logger.Panicln("Failed to load embeddings:", err)
+		}
+
+		snapshot := newSnapshot(version, annotationsProducer, embeddingsProducer)
+		snapshot.addFiles(fileChecksums, annotations, annotationChecksums, embeddings, embeddingChecksums, chunkLines)
+		if len(snapshot.annotations) < len(selectedFiles) {
+			logger.Warnln("Files without up-to-date annotations, not exported:", len(selectedFiles)-len(snapshot.annotations))
+		}
+
+		logger.Infoln("Exporting snapshot to:", snapshotFile)
+		if err := exportSnapshot(snapshotFile, snapshot); err != nil {
+			logger.Panicln("Failed to export snapshot:", err)
+		}
+		logger.Infof("Exported annotations: %d, embeddings: %d", snapshot.manifest.AnnotationsCount, snapshot.manifest.EmbeddingsCount)
+		return
+	}
+
+	logger.Infoln("Importing snapshot from:", snapshotFile)
+	snapshot, err := importSnapshot(snapshotFile)
+	if err != nil {
+		logger.Panicln("Failed to import snapshot:", err)
+	}
+	logger.Infof("Snapshot created: %s, Perpetual version: %s", snapshot.manifest.Created, snapshot.manifest.PerpetualVersion)
+	if snapshot.manifest.AnnotationsProducer != "" {
+		logger.Infoln("Annotations produced with:", snapshot.manifest.AnnotationsProducer)
+	}
+	if snapshot.manifest.EmbeddingsProducer != "" {
+		logger.Infoln("Embeddings produced with:", snapshot.manifest.EmbeddingsProducer)
+	}
+
+	// Annotations and embeddings are loaded and saved for all project files, so entries of files filtered by user blacklist are kept,
+	// only files with calculated checksums are updated from the snapshot
+	unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, true, logger)
+	defer unlockAnnotations()
+	updated, err := importAnnotations(snapshot, annotationsFilePath, fileNames, fileChecksums, overwrite)
+	if err != nil {
+		logger.Panicln("Failed to import annotations:", err)
+	}
+	for _, file := range updated {
+		logger.Debugln("Imported annotation:", file)
+	}
+	if len(updated) > 0 {
+		logger.Infoln("Annotations imported:", len(updated))
+	} else {
+		logger.Infoln("No annotations imported")
+	}
+
+	// Embeddings
+	if len(snapshot.embeddings) < 1 {
+		return
+	}
+	if embeddingsProducer != "" && snapshot.manifest.EmbeddingsProducer != "" && embeddingsProducer != snapshot.manifest.EmbeddingsProducer {
+		if !forceEmbeddings {
+			logger.Warnln("Local embeddings configuration differs from the snapshot, not importing embeddings (use '-e' flag to import them anyway):", embeddingsProducer)
+			return
+		}
+		logger.Warnln("Local embeddings configuration differs from the snapshot, importing embeddings anyway:", embeddingsProducer)
+	}
+	unlockEmbeddings := utils.LockProjectResource(perpetualDir, utils.LockResourceEmbeddings, true, logger)
+	defer unlockEmbeddings()
+	updated, err = importEmbeddings(snapshot, embeddingsFilePath, fileNames, fileChecksums, overwrite)
+	if errors.Is(err, errVectorDimensionsMismatch) {
+		logger.Warnln("Not importing embeddings:", err)
+		return
+	}
+	if err != nil {
+		logger.Panicln("Failed to import embeddings:", err)
+	}
+	for _, file := range updated {
+		logger.Debugln("Imported embeddings:", file)
+	}
+	if len(updated) > 0 {
+		logger.Infoln("Embeddings imported:", len(updated))
+	} else {
+		logger.Infoln("No embeddings imported")
+	}
+}
+
+var errVectorDimensionsMismatch = errors.New("vector dimensions of local embeddings do not match the snapshot")
+
+// importAnnotations merges snapshot annotations for files from fileChecksums into annotations storage.
+// Storage is loaded and saved for all projectFiles, so annotations of other project files are preserved
+func importAnnotations(snapshot *Snapshot, annotationsFilePath string, projectFiles []string, fileChecksums map[string]string, overwrite bool) ([]string, error) {
+	annotations, err := utils.GetAnnotations(annotationsFilePath, projectFiles)
+	if err != nil {
+		return nil, err
+	}
+	annotationChecksums := utils.GetChecksumsFromAnnotations(annotationsFilePath, projectFiles)
+	updated := mergeInto(snapshot.annotations, fileChecksums, annotations, annotationChecksums, overwrite)
+	if len(updated) < 1 {
+		return nil, nil
+	}
+	return updated, utils.SaveAnnotations(annotationsFilePath, annotationChecksums, annotations)
+}
+
+// importEmbeddings merges snapshot embeddings for files from fileChecksums into embeddings storage.
+// Storage is loaded and saved for all projectFiles, so embeddings of other project files are preserved
+func importEmbeddings(snapshot *Snapshot, embeddingsFilePath string, projectFiles []string, fileChecksums map[string]string, overwrite bool) ([]string, error) {
+	embeddings, embeddingChecksums, vectorDimensions, err := utils.GetEmbeddings(embeddingsFilePath, projectFiles)
+	if err != nil {
+		return nil, err
+	}
+	if vectorDimensions != 0 && vectorDimensions != snapshot.manifest.VectorDimensions {
+		return nil, fmt.Errorf("%w: %d, snapshot: %d", errVectorDimensionsMismatch, vectorDimensions, snapshot.manifest.VectorDimensions)
+	}
+	chunkLines, err := utils.GetEmbeddingsChunkLines(embeddingsFilePath, projectFiles)
+	if err != nil {
+		return nil, err
+	}
+	updated := mergeInto(snapshot.embeddings, fileChecksums, embeddings, embeddingChecksums, overwrite)
+	if len(updated) < 1 {
+		return nil, nil
+	}
+	for _, file := range updated {
+		// Snapshots made by older versions do not contain line ranges of chunks, they are restored when file is embedded again
+		if lines, exist := snapshot.chunkLines[fileChecksums[file]]; exist {
+			chunkLines[file] = lines
+		} else {
+			delete(chunkLines, file)
+		}
+	}
+	return updated, utils.SaveEmbeddings(embeddingsFilePath, embeddingChecksums, embeddings, chunkLines)
+}
@@ -0,0 +1,87 @@
+package op_snapshot
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func TestImportKeepsFilteredFiles(t *testing.T) {
+	dir := t.TempDir()
+	annotationsFilePath := filepath.Join(dir, utils.AnnotationsFileName)
+	embeddingsFilePath := filepath.Join(dir, utils.EmbeddingsFileName)
+	projectFiles := []string{"a.go", "b.go", "excluded.go"}
+
+	if err := utils.SaveAnnotations(annotationsFilePath,
+		map[string]string{"a.go": "old-sum-a", "excluded.go": "sum-x"},
+		map[string]string{"a.go": "old annotation a", "excluded.go": "annotation x"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := utils.SaveEmbeddings(embeddingsFilePath,
+		map[string]string{"excluded.go": "sum-x"},
+		map[string][][]float32{"excluded.go": {{7, 8}}},
+		map[string][][2]int{"excluded.go": {{1, 3}}}); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := newSnapshot("v-test", "", "")
+	snapshot.addFiles(
+		map[string]string{"a.go": "sum-a", "b.go": "sum-b", "excluded.go": "sum-y"},
+		map[string]string{"a.go": "annotation a", "b.go": "annotation b", "excluded.go": "annotation y"},
+		map[string]string{"a.go": "sum-a", "b.go": "sum-b", "excluded.go": "sum-y"},
+		map[string][][]float32{"a.go": {{1, 2}}, "excluded.go": {{5, 6}}},
+		map[string]string{"a.go": "sum-a", "excluded.go": "sum-y"},
+		map[string][][2]int{"a.go": {{1, 4}}, "excluded.go": {{1, 2}}})
+
+	// excluded.go is filtered out, so its checksum is not calculated
+	fileChecksums := map[string]string{"a.go": "sum-a", "b.go": "sum-b"}
+	updated, err := importAnnotations(snapshot, annotationsFilePath, projectFiles, fileChecksums, false)
+	if err != nil {
+		t.Fatalf("importAnnotations() error = %v", err)
+	}
+	if !reflect.DeepEqual(updated, []string{"a.go", "b.go"}) {
+		t.Errorf("unexpected imported annotations: %v", updated)
+	}
+	annotations, _ := utils.GetAnnotations(annotationsFilePath, projectFiles)
+	wantAnnotations := map[string]string{"a.go": "annotation a", "b.go": "annotation b", "excluded.go": "annotation x"}
+	if !reflect.DeepEqual(annotations, wantAnnotations) {
+		t.Errorf("unexpected annotations after import: %v", annotations)
+	}
+	if checksums := utils.GetChecksumsFromAnnotations(annotationsFilePath, projectFiles); checksums["excluded.go"] != "sum-x" {
+		t.Errorf("checksum of filtered file changed: %v", checksums)
+	}
+
+	updated, err = importEmbeddings(snapshot, embeddingsFilePath, projectFiles, fileChecksums, false)
+	if err != nil {
+		t.Fatalf("importEmbeddings() error = %v", err)
+	}
+	if !reflect.DeepEqual(updated, []string{"a.go"}) {
+		t.Errorf("unexpected imported embeddings: %v", updated)
+	}
+	embeddings, checksums, _, _ := utils.GetEmbeddings(embeddingsFilePath, projectFiles)
+	wantEmbeddings := map[string][][]float32{"a.go": {{1, 2}}, "excluded.go": {{7, 8}}}
+	if !reflect.DeepEqual(embeddings, wantEmbeddings) || checksums["excluded.go"] != "sum-x" {
+		t.Errorf("unexpected embeddings after import: %v, checksums: %v", embeddings, checksums)
+	}
+	chunkLines, _ := utils.GetEmbeddingsChunkLines(embeddingsFilePath, projectFiles)
+	wantChunkLines := map[string][][2]int{"a.go": {{1, 4}}, "excluded.go": {{1, 3}}}
+	if !reflect.DeepEqual(chunkLines, wantChunkLines) {
+		t.Errorf("unexpected line ranges after import: %v", chunkLines)
+	}
+}
+
+func TestImportEmbeddingsDimensionsMismatch(t *testing.T) {
+	embeddingsFilePath := filepath.Join(t.TempDir(), utils.EmbeddingsFileName)
+	if err := utils.SaveEmbeddings(embeddingsFilePath,
+		map[string]string{"a.go": "sum-a"}, map[string][][]float32{"a.go": {{1, 2, 3}}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	snapshot := newTestSnapshot()
+	_, err := importEmbeddings(snapshot, embeddingsFilePath, []string{"a.go", "c.go"}, map[string]string{"a.go": "sum-a", "c.go": "sum-c"}, true)
+	if !errors.Is(err, errVectorDimensionsMismatch) {
+		t.Errorf("expected vector dimensions error, got: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package op_stash
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+const BundleVersion = 1
+
+const bundleManifestName = "manifest.json"
+const bundlePatchName = "changes.patch"
+const bundleOriginalDir = "original"
+const bundleModifiedDir = "modified"
+const bundleFileExt = ".tar.gz"
+
+// bundleManifest describes the stash exported to the bundle. File contents are not stored in the manifest,
+// they are stored as separate files in the bundle, so the bundle can be inspected with common tools
+type bundleManifest struct {
+	BundleVersion int    `json:"bundle_version"`
+	Name          string `json:"name"`
+	Stash         Stash  `json:"stash"`
+}
+
+func getBundleContentPath(dir, filename string) string {
+	return path.Join(dir, filepath.ToSlash(filename))
+}
+
+// exportBundle writes stash into gzip-compressed tar archive with manifest, file contents and unified diff for review
+func exportBundle(bundleFile string, name string, stash Stash) error {
+	manifest := bundleManifest{BundleVersion: BundleVersion, Name: name, Stash: stash}
+	manifest.Stash.Files = nil
+	contents := make(map[string]string)
+	var contentNames []string
+	addContent := func(dir, filename string, state FileState) FileState {
+		if !state.Exists {
+			return state
+		}
+		contentName := getBundleContentPath(dir, filename)
+		contents[contentName] = state.Contents
+		contentNames = append(contentNames, contentName)
+		return FileState{Exists: true, Checksum: state.getChecksum()}
+	}
+	for _, entry := range stash.Files {
+		// Store paths in portable format, bundle may be imported on another OS
+		entry.Filename = filepath.ToSlash(entry.Filename)
+		entry.MovedFrom = filepath.ToSlash(entry.MovedFrom)
+		entry.Original = addContent(bundleOriginalDir, entry.Filename, entry.Original)
+		entry.Modified = addContent(bundleModifiedDir, entry.Filename, entry.Modified)
+		manifest.Stash.Files = append(manifest.Stash.Files, entry)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(bundleFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	modTime := time.Now()
+	writeEntry := func(entryName string, data []byte) error {
+		header := &tar.Header{Name: entryName, Mode: 0644, Size: int64(len(data)), ModTime: modTime, Typeflag: tar.TypeReg}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tarWriter.Write(data)
+		return err
+	}
+
+	if err := writeEntry(bundleManifestName, append(manifestData, '\n')); err != nil {
+		return err
+	}
+	if err := writeEntry(bundlePatchName, []byte(formatStashDiff(stash, nil))); err != nil {
+		return err
+	}
+	for _, contentName := range contentNames {
+		if err := writeEntry(contentName, []byte(contents[contentName])); err != nil {
+			return err
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		return err
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// importBundle reads stash from the bundle created with exportBundle, validates file paths and contents checksums.
+// Returns original stash name and restored stash
+func importBundle(bundleFile string) (string, Stash, error) {
+	file, err := os.Open(bundleFile)
+	if err != nil {
+		return "", Stash{}, err
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return "", Stash{}, fmt.Errorf("bundle is not gzip-compressed: %v", err)
+	}
+	defer gzipReader.Close()
+
+	var manifestData []byte
+	contents := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", Stash{}, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			return "", Stash{}, err
+		}
+		if header.Name == bundleManifestName {
+			manifestData = data
+		} else {
+			contents[header.Name] = string(data)
+		}
+	}
+	if manifestData == nil {
+		return "", Stash{}, fmt.Errorf("bundle does not contain %s", bundleManifestName)
+	}
+
+	var manifest bundleManifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return "", Stash{}, fmt.Errorf("failed to parse bundle manifest: %v", err)
+	}
+	if manifest.BundleVersion != BundleVersion {
+		return "", Stash{}, fmt.Errorf("unsupported bundle version: %d, expected: %d", manifest.BundleVersion, BundleVersion)
+	}
+	if err := validateStash(manifest.Stash); err != nil {
+		return "", Stash{}, err
+	}
+
+	restoreContent := func(dir, filename string, state FileState) (FileState, error) {
+		if !state.Exists {
+			return state, nil
+		}
+		contentName := getBundleContentPath(dir, filename)
+		text, ok := contents[contentName]
+		if !ok {
+			return state, fmt.Errorf("bundle does not contain %s", contentName)
+		}
+		checksum := calculateContentsChecksum(text)
+		if state.Checksum != "" && state.Checksum != checksum {
+			return state, fmt.Errorf("checksum mismatch for %s", contentName)
+		}
+		return FileState{Exists: true, Contents: text, Checksum: checksum}, nil
+	}
+	stash := manifest.Stash
+	for i, entry := range stash.Files {
+		stash.Files[i].Filename = filepath.FromSlash(entry.Filename)
+		stash.Files[i].MovedFrom = filepath.FromSlash(entry.MovedFrom)
+		// Bundle may come from another machine, do not allow it to touch files outside project root
+		if !filepath.IsLocal(stash.Files[i].Filename) || (entry.MovedFrom != "" && !filepath.IsLocal(stash.Files[i].MovedFrom)) {
+			return "", Stash{}, fmt.Errorf("file path is not inside project root: %s", entry.Filename)
+		}
+		if stash.Files[i].Original, err = restoreContent(bundleOriginalDir, entry.Filename, entry.Original); err != nil {
+			return "", Stash{}, err
+		}
+		if stash.Files[i].Modified, err = restoreContent(bundleModifiedDir, entry.Filename, entry.Modified); err != nil {
+			return "", Stash{}, err
+		}
+	}
+	return manifest.Name, stash, nil
+}
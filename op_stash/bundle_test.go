@@ -0,0 +1,186 @@
+package op_stash
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func newBundleTestStash() Stash {
+	return Stash{
+		Version:  StashVersion,
+		Metadata: &Metadata{Operation: "implement", Task: "Update files"},
+		Files: []FileEntry{
+			{
+				Filename:   filepath.Join("src", "file.txt"),
+				FileParams: utils.FileParams{ModernEncoding: utils.UTF16BE},
+				Original:   newFileState("original\n"),
+				Modified:   newFileState("modified\n"),
+			},
+			{
+				Filename: "new.txt",
+				Original: FileState{Exists: false},
+				Modified: newFileState("created\n"),
+			},
+		},
+	}
+}
+
+func readBundleEntries(t *testing.T, bundleFile string) map[string]string {
+	t.Helper()
+
+	file, err := os.Open(bundleFile)
+	if err != nil {
+		t.Fatalf("failed to open bundle: %v", err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("failed to open gzip stream: %v", err)
+	}
+	entries := make(map[string]string)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read bundle: %v", err)
+		}
+		data, err := io.ReadAll(tarReader)
+		if err != nil {
+			t.Fatalf("failed to read bundle entry: %v", err)
+		}
+		entries[header.Name] = string(data)
+	}
+	return entries
+}
+
+func writeBundleEntries(t *testing.T, bundleFile string, entries map[string]string) {
+	t.Helper()
+
+	file, err := os.Create(bundleFile)
+	if err != nil {
+		t.Fatalf("failed to create bundle: %v", err)
+	}
+	defer file.Close()
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+	for name, data := range entries {
+		if err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("failed to write bundle entry header: %v", err)
+		}
+		if _, err := tarWriter.Write([]byte(data)); err != nil {
+			t.Fatalf("failed to write bundle entry: %v", err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatalf("failed to close tar stream: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatalf("failed to close gzip stream: %v", err)
+	}
+}
+
+func TestBundleExportImportRoundTrip(t *testing.T) {
+	bundleFile := filepath.Join(t.TempDir(), "bundle.tar.gz")
+	stash := newBundleTestStash()
+
+	if err := exportBundle(bundleFile, "2025-01-01_10-00-00", stash); err != nil {
+		t.Fatalf("exportBundle() failed: %v", err)
+	}
+
+	entries := readBundleEntries(t, bundleFile)
+	if entries["modified/src/file.txt"] != "modified\n" || entries["original/src/file.txt"] != "original\n" {
+		t.Fatalf("bundle does not contain file contents: %v", entries)
+	}
+	if _, ok := entries["original/new.txt"]; ok {
+		t.Fatalf("bundle must not contain contents for absent file")
+	}
+	if !strings.Contains(entries[bundlePatchName], "+modified") {
+		t.Fatalf("bundle patch does not contain changes:\n%s", entries[bundlePatchName])
+	}
+	if strings.Contains(entries[bundleManifestName], "\"contents\": \"modified") {
+		t.Fatalf("manifest must not contain file contents:\n%s", entries[bundleManifestName])
+	}
+
+	name, imported, err := importBundle(bundleFile)
+	if err != nil {
+		t.Fatalf("importBundle() failed: %v", err)
+	}
+	if name != "2025-01-01_10-00-00" {
+		t.Errorf("importBundle() name = %q", name)
+	}
+	if !reflect.DeepEqual(imported, stash) {
+		t.Errorf("importBundle() stash = %+v, want %+v", imported, stash)
+	}
+}
+
+func TestBundleImportRejectsInvalidBundles(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(entries map[string]string)
+	}{
+		{
+			name: "checksum mismatch",
+			modify: func(entries map[string]string) {
+				entries["modified/src/file.txt"] = "tampered\n"
+			},
+		},
+		{
+			name: "missing contents",
+			modify: func(entries map[string]string) {
+				delete(entries, "modified/new.txt")
+			},
+		},
+		{
+			name: "path outside project",
+			modify: func(entries map[string]string) {
+				entries[bundleManifestName] = strings.ReplaceAll(entries[bundleManifestName], "\"new.txt\"", "\"../new.txt\"")
+				entries["modified/../new.txt"] = entries["modified/new.txt"]
+			},
+		},
+		{
+			name: "missing manifest",
+			modify: func(entries map[string]string) {
+				delete(entries, bundleManifestName)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			bundleFile := filepath.Join(tempDir, "bundle.tar.gz")
+			if err := exportBundle(bundleFile, "test", newBundleTestStash()); err != nil {
+				t.Fatalf("exportBundle() failed: %v", err)
+			}
+			entries := readBundleEntries(t, bundleFile)
+			tt.modify(entries)
+			writeBundleEntries(t, bundleFile, entries)
+
+			if _, _, err := importBundle(bundleFile); err == nil {
+				t.Fatalf("importBundle() must fail")
+			}
+		})
+	}
+}
+
+func TestStashExportWritesBundle(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+	writeTestStash(t, stashDir, "2025-01-01_10-00-00", newBundleTestStash())
+
+	runStash(t, "-m", "export")
+	utils.RunGlobalCleanup()
+
+	if _, _, err := importBundle(filepath.Join(projectRootDir, "2025-01-01_10-00-00"+bundleFileExt)); err != nil {
+		t.Fatalf("failed to read exported bundle: %v", err)
+	}
+}
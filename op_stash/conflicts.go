@@ -0,0 +1,47 @@
+package op_stash
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+const (
+	conflictModeRefuse  = "refuse"
+	conflictModeMarkers = "markers"
+	conflictModeMerge   = "merge"
+)
+
+// readCurrentState reads the state of the file as it is on disk now
+func readCurrentState(projectRootDir string, filename string) (FileState, error) {
+	targetPath := filepath.Join(projectRootDir, filename)
+	if _, err := os.Stat(targetPath); err != nil {
+		if os.IsNotExist(err) {
+			return FileState{Exists: false}, nil
+		}
+		return FileState{}, err
+	}
+	contents, _, err := utils.LoadTextFile(targetPath)
+	if err != nil {
+		return FileState{}, err
+	}
+	return newFileState(contents), nil
+}
+
+// resolveConflict combines local changes of the file (current) with the state from the stash (target),
+// base is the state that the stash expects to find on disk. Returns resulting state and number of conflicting regions marked.
+// Returns false if file was created or deleted on either side and its changes cannot be combined
+func resolveConflict(mode string, base, current, target FileState, currentLabel, targetLabel string) (FileState, int, bool) {
+	if !current.Exists || !target.Exists {
+		return FileState{}, 0, false
+	}
+	var contents string
+	var conflicts int
+	if mode == conflictModeMerge {
+		contents, conflicts = mergeText(base.Contents, current.Contents, target.Contents, currentLabel, targetLabel)
+	} else {
+		contents, conflicts = markConflicts(current.Contents, target.Contents, currentLabel, targetLabel)
+	}
+	return newFileState(contents), conflicts, true
+}
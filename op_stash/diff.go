@@ -0,0 +1,187 @@
+package op_stash
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const diffContextLines = 3
+
+const (
+	fileStatusApplied    = "applied"
+	fileStatusRolledBack = "rolled back"
+	fileStatusDiverged   = "diverged"
+)
+
+type diffLine struct {
+	kind byte
+	text string
+}
+
+// splitDiffLines splits file contents into lines, last line without trailing newline is marked with newline suffix,
+// so it does not match the same line that has trailing newline
+func splitDiffLines(state FileState) []string {
+	if !state.Exists || state.Contents == "" {
+		return nil
+	}
+	contents := strings.ReplaceAll(state.Contents, "\r\n", "\n")
+	if strings.HasSuffix(contents, "\n") {
+		return strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	}
+	lines := strings.Split(contents, "\n")
+	lines[len(lines)-1] += "\n"
+	return lines
+}
+
+func formatHunkRange(start, count int) string {
+	if count == 0 {
+		// Empty range refers to the line before the change
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// unifiedDiff produces unified diff between two states of the file, returns empty string if the states are equal
+func unifiedDiff(fromName, toName string, from, to FileState) string {
+	if from.matches(to) {
+		return ""
+	}
+
+	fromLines := splitDiffLines(from)
+	toLines := splitDiffLines(to)
+
+	// Build edit script from matching lines
+	var script []diffLine
+	matches := diffMatches(fromLines, toLines)
+	j := 0
+	for i, line := range fromLines {
+		if matches[i] < 0 {
+			script = append(script, diffLine{'-', line})
+			continue
+		}
+		for ; j < matches[i]; j++ {
+			script = append(script, diffLine{'+', toLines[j]})
+		}
+		script = append(script, diffLine{' ', line})
+		j++
+	}
+	for ; j < len(toLines); j++ {
+		script = append(script, diffLine{'+', toLines[j]})
+	}
+
+	var sb strings.Builder
+	fromHeader, toHeader := "/dev/null", "/dev/null"
+	if from.Exists {
+		fromHeader = "a/" + filepath.ToSlash(fromName)
+	}
+	if to.Exists {
+		toHeader = "b/" + filepath.ToSlash(toName)
+	}
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromHeader, toHeader)
+
+	// Group changes with surrounding context lines into hunks
+	for pos := 0; pos < len(script); {
+		if script[pos].kind == ' ' {
+			pos++
+			continue
+		}
+		start := max(pos-diffContextLines, 0)
+		end := pos
+		for end < len(script) {
+			if script[end].kind != ' ' {
+				end++
+				continue
+			}
+			// Stop hunk if unchanged lines are enough to separate it from the next change
+			next := end
+			for next < len(script) && script[next].kind == ' ' {
+				next++
+			}
+			if next == len(script) || next-end > 2*diffContextLines {
+				end = min(end+diffContextLines, len(script))
+				break
+			}
+			end = next
+		}
+
+		// Count line positions for the hunk header
+		fromStart, toStart := 0, 0
+		for _, line := range script[:start] {
+			if line.kind != '+' {
+				fromStart++
+			}
+			if line.kind != '-' {
+				toStart++
+			}
+		}
+		fromCount, toCount := 0, 0
+		for _, line := range script[start:end] {
+			if line.kind != '+' {
+				fromCount++
+			}
+			if line.kind != '-' {
+				toCount++
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", formatHunkRange(fromStart, fromCount), formatHunkRange(toStart, toCount))
+
+		for _, line := range script[start:end] {
+			text, noNewline := strings.CutSuffix(line.text, "\n")
+			fmt.Fprintf(&sb, "%c%s\n", line.kind, text)
+			if noNewline {
+				sb.WriteString("\\ No newline at end of file\n")
+			}
+		}
+		pos = end
+	}
+
+	return sb.String()
+}
+
+// formatStashDiff returns unified diff for all files from the stash, or only for selected files if not empty
+func formatStashDiff(stash Stash, selectedFiles []string) string {
+	entriesByFile := make(map[string]FileEntry)
+	movedSources := make(map[string]bool)
+	for _, entry := range stash.Files {
+		entriesByFile[entry.Filename] = entry
+		if entry.MovedFrom != "" {
+			movedSources[entry.MovedFrom] = true
+		}
+	}
+	var sb strings.Builder
+	for _, entry := range stash.Files {
+		if len(selectedFiles) > 0 && !slices.Contains(selectedFiles, entry.Filename) {
+			continue
+		}
+		// Moved file is shown with a single diff between its source and destination paths
+		if movedSources[entry.Filename] {
+			continue
+		}
+		fromName, from := entry.Filename, entry.Original
+		if source, ok := entriesByFile[entry.MovedFrom]; ok && entry.MovedFrom != "" {
+			fromName, from = source.Filename, source.Original
+		}
+		fmt.Fprintf(&sb, "diff a/%s b/%s\n", filepath.ToSlash(fromName), filepath.ToSlash(entry.Filename))
+		if fromName != entry.Filename {
+			fmt.Fprintf(&sb, "rename from %s\nrename to %s\n", filepath.ToSlash(fromName), filepath.ToSlash(entry.Filename))
+		}
+		sb.WriteString(unifiedDiff(fromName, entry.Filename, from, entry.Modified))
+	}
+	return sb.String()
+}
+
+// getFileStatus compares current state of the file with the states recorded in the stash
+func getFileStatus(entry FileEntry, current FileState) string {
+	if current.matches(entry.Modified) {
+		return fileStatusApplied
+	}
+	if current.matches(entry.Original) {
+		return fileStatusRolledBack
+	}
+	return fileStatusDiverged
+}
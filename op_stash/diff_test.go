@@ -0,0 +1,76 @@
+package op_stash
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     FileState
+		to       FileState
+		expected string
+	}{
+		{
+			name:     "equal states",
+			from:     newFileState("a\n"),
+			to:       newFileState("a\n"),
+			expected: "",
+		},
+		{
+			name: "modified file",
+			from: newFileState("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n"),
+			to:   newFileState("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n"),
+			expected: "--- a/dir/file.txt\n+++ b/dir/file.txt\n" +
+				"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n" +
+				"@@ -10,3 +10,4 @@\n 10\n 11\n 12\n+13\n",
+		},
+		{
+			name:     "created file",
+			from:     FileState{Exists: false},
+			to:       newFileState("a\nb\n"),
+			expected: "--- /dev/null\n+++ b/dir/file.txt\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "deleted file",
+			from:     newFileState("a\n"),
+			to:       FileState{Exists: false},
+			expected: "--- a/dir/file.txt\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:     "missing newline at end",
+			from:     newFileState("a\nb"),
+			to:       newFileState("a\nb\n"),
+			expected: "--- a/dir/file.txt\n+++ b/dir/file.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := unifiedDiff("dir/file.txt", "dir/file.txt", tt.from, tt.to); result != tt.expected {
+				t.Errorf("unifiedDiff() =\n%s\nwant:\n%s", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGetFileStatus(t *testing.T) {
+	entry := FileEntry{
+		Filename: "file.txt",
+		Original: newFileState("original\n"),
+		Modified: newFileState("modified\n"),
+	}
+	tests := []struct {
+		current  FileState
+		expected string
+	}{
+		{current: newFileState("modified\n"), expected: fileStatusApplied},
+		{current: newFileState("original\n"), expected: fileStatusRolledBack},
+		{current: newFileState("edited\n"), expected: fileStatusDiverged},
+		{current: FileState{Exists: false}, expected: fileStatusDiverged},
+	}
+	for _, tt := range tests {
+		if status := getFileStatus(entry, tt.current); status != tt.expected {
+			t.Errorf("getFileStatus(%q) = %q, want %q", tt.current.Contents, status, tt.expected)
+		}
+	}
+}
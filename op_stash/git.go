@@ -0,0 +1,116 @@
+package op_stash
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// formatCommitMessage generates git commit message for the stash from its task and work plan
+func formatCommitMessage(name string, stash Stash) string {
+	subject := ""
+	if stash.Metadata != nil {
+		subject = stash.Metadata.getSubject()
+	}
+	if subject == "" {
+		subject = "Apply changes from stash " + name
+	}
+	var sb strings.Builder
+	sb.WriteString(subject + "\n")
+	if stash.Metadata != nil {
+		if task := strings.TrimSpace(stash.Metadata.Task); task != "" && task != subject {
+			fmt.Fprintf(&sb, "\nTask:\n\n%s\n", task)
+		}
+		if workplan := strings.TrimSpace(stash.Metadata.Workplan); workplan != "" {
+			fmt.Fprintf(&sb, "\nWork plan:\n\n%s\n", workplan)
+		}
+	}
+	fmt.Fprintf(&sb, "\nPerpetual stash: %s\n", name)
+	return sb.String()
+}
+
+// getStashPaths returns all paths created, modified or deleted by the stash
+func getStashPaths(stash Stash) []string {
+	var paths []string
+	for _, entry := range stash.Files {
+		// Entry for file that is absent in both states has nothing to commit, git will not accept unknown path
+		if entry.Original.Exists || entry.Modified.Exists {
+			paths = append(paths, filepath.ToSlash(entry.Filename))
+		}
+	}
+	return paths
+}
+
+// CommitStash commits files changed by the applied stash to git, in a new branch when git mode is "branch".
+// Only files from the stash are committed. Commit hash and branch are recorded in the stash metadata,
+// so the stash can be rolled back with git revert later. Called internally.
+func CommitStash(stashName string, gitMode string, branchPrefix string, logger logging.ILogger) string {
+	logger.Traceln("CommitStash: Starting")
+	defer logger.Traceln("CommitStash: Finished")
+
+	projectRootDir, perpetualDir, err := utils.FindProjectRoot(logger, true)
+	if err != nil {
+		logger.Panicln("Error finding project root directory:", err)
+	}
+
+	stashDir := filepath.Join(perpetualDir, utils.StashesDirName)
+	unlockStashes := utils.LockProjectResource(perpetualDir, utils.LockResourceStash, true, logger)
+	defer unlockStashes()
+
+	stashFile := findStashFile(stashDir, stashName)
+	if stashFile == "" {
+		logger.Panicln("Stash not found:", stashName)
+	}
+	stash, err := loadStash(stashFile)
+	if err != nil {
+		logger.Panicln("Error loading stash:", err)
+	}
+
+	branch := ""
+	if gitMode == utils.GitModeBranch {
+		branch = branchPrefix + stashName
+		logger.Infoln("Creating git branch:", branch)
+		if err := utils.GitCreateBranch(projectRootDir, branch); err != nil {
+			logger.Panicln("Error creating git branch:", err)
+		}
+	}
+
+	// Files ignored by git cannot be committed, leave them as they are
+	paths := getStashPaths(stash)
+	ignored, err := utils.GitGetIgnoredFiles(projectRootDir, paths)
+	if err != nil {
+		logger.Panicln("Error checking files ignored by git:", err)
+	}
+	for _, file := range ignored {
+		logger.Warnln("Not committing file ignored by git:", file)
+	}
+	paths = slices.DeleteFunc(paths, func(path string) bool { return slices.Contains(ignored, path) })
+
+	commit, err := utils.GitCommitFiles(projectRootDir, paths, formatCommitMessage(stashName, stash))
+	if err != nil {
+		logger.Panicln("Error committing stash files to git:", err)
+	}
+	if commit == "" {
+		logger.Warnln("No changes to commit to git from stash:", stashName)
+		return ""
+	}
+	logger.Infoln("Created git commit:", commit)
+
+	if stash.Metadata == nil {
+		stash.Metadata = &Metadata{}
+	}
+	stash.Metadata.GitCommit = commit
+	stash.Metadata.GitBranch = branch
+	compression := ""
+	if strings.HasSuffix(stashFile, compressedStashFileExt) {
+		compression = stashCompressionGzip
+	}
+	if _, err := saveStash(stashDir, stashName, stash, compression); err != nil {
+		logger.Panicln("Error saving stash:", err)
+	}
+	return commit
+}
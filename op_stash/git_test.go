@@ -0,0 +1,147 @@
+package op_stash
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func runTestGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", args[0], err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func setupTempGitProject(t *testing.T) (string, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	projectRootDir, stashDir := setupTempProject(t)
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("original\n"), 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+	runTestGit(t, projectRootDir, "init", "-q")
+	runTestGit(t, projectRootDir, "add", "file.txt")
+	runTestGit(t, projectRootDir, "commit", "-q", "-m", "Initial commit")
+	return projectRootDir, stashDir
+}
+
+func TestFormatCommitMessage(t *testing.T) {
+	stash := Stash{Metadata: &Metadata{Task: "Add feature\n\nMore details", Workplan: "1. Change file.txt"}}
+	message := formatCommitMessage("2025-01-01_10-00-00", stash)
+	expected := "Add feature\n\nTask:\n\nAdd feature\n\nMore details\n\nWork plan:\n\n1. Change file.txt\n\nPerpetual stash: 2025-01-01_10-00-00\n"
+	if message != expected {
+		t.Errorf("formatCommitMessage() = %q, want %q", message, expected)
+	}
+
+	message = formatCommitMessage("2025-01-01_10-00-00", Stash{})
+	if !strings.HasPrefix(message, "Apply changes from stash 2025-01-01_10-00-00\n") {
+		t.Errorf("formatCommitMessage() without metadata = %q", message)
+	}
+}
+
+func TestCommitStashAndRevert(t *testing.T) {
+	projectRootDir, stashDir := setupTempGitProject(t)
+
+	stashName := CreateStash(
+		map[string]string{"file.txt": "modified\n", "new.txt": "new\n"},
+		[]string{"file.txt"},
+		nil,
+		nil,
+		Metadata{Task: "Update file"},
+		"gzip",
+		newTestLogger(t),
+	)
+	runStash(t, "-m", "apply", "-s", stashName)
+	utils.RunGlobalCleanup()
+
+	if err := os.WriteFile(filepath.Join(projectRootDir, "unrelated.txt"), []byte("unrelated\n"), 0644); err != nil {
+		t.Fatalf("failed to create unrelated file: %v", err)
+	}
+
+	commit := CommitStash(stashName, utils.GitModeBranch, "perpetual/", newTestLogger(t))
+	if commit == "" {
+		t.Fatalf("CommitStash() did not create commit")
+	}
+	if branch := runTestGit(t, projectRootDir, "rev-parse", "--abbrev-ref", "HEAD"); branch != "perpetual/"+stashName {
+		t.Errorf("unexpected branch: %s", branch)
+	}
+	if files := runTestGit(t, projectRootDir, "show", "--name-only", "--format=", commit); files != "file.txt\nnew.txt" {
+		t.Errorf("unexpected files in commit:\n%s", files)
+	}
+	if subject := runTestGit(t, projectRootDir, "log", "-1", "--format=%s"); subject != "Update file" {
+		t.Errorf("unexpected commit subject: %s", subject)
+	}
+
+	stash, err := loadStash(filepath.Join(stashDir, stashName+compressedStashFileExt))
+	if err != nil {
+		t.Fatalf("failed to load stash: %v", err)
+	}
+	if stash.Metadata.GitCommit != commit || stash.Metadata.GitBranch != "perpetual/"+stashName {
+		t.Fatalf("git commit is not recorded in stash metadata: %+v", stash.Metadata)
+	}
+
+	runStash(t, "-m", "rollback", "-g", "-s", stashName)
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "original\n")
+	assertFileNotExists(t, projectRootDir, "new.txt")
+	assertFileContents(t, projectRootDir, "unrelated.txt", "unrelated\n")
+	if subject := runTestGit(t, projectRootDir, "log", "-1", "--format=%s"); !strings.HasPrefix(subject, "Revert") {
+		t.Errorf("rollback did not create revert commit: %s", subject)
+	}
+}
+
+func TestStashRevertRequiresGitCommit(t *testing.T) {
+	_, stashDir := setupTempProject(t)
+	writeTestStash(t, stashDir, "2025-01-01_10-00-00", newBundleTestStash())
+
+	assertPanics(t, func() {
+		runStash(t, "-m", "rollback", "-g")
+	})
+	utils.RunGlobalCleanup()
+}
+
+func TestCommitStashSkipsIgnoredFiles(t *testing.T) {
+	projectRootDir, _ := setupTempGitProject(t)
+	if err := os.WriteFile(filepath.Join(projectRootDir, ".gitignore"), []byte("*.log\n"), 0644); err != nil {
+		t.Fatalf("failed to create .gitignore: %v", err)
+	}
+	runTestGit(t, projectRootDir, "add", ".gitignore")
+	runTestGit(t, projectRootDir, "commit", "-q", "-m", "Ignore logs")
+
+	stashName := CreateStash(
+		map[string]string{"file.txt": "modified\n", "debug.log": "log\n"},
+		[]string{"file.txt"},
+		nil,
+		nil,
+		Metadata{Task: "Update file"},
+		"gzip",
+		newTestLogger(t),
+	)
+	runStash(t, "-m", "apply", "-s", stashName)
+	utils.RunGlobalCleanup()
+
+	commit := CommitStash(stashName, utils.GitModeCommit, "perpetual/", newTestLogger(t))
+	if commit == "" {
+		t.Fatalf("CommitStash() did not create commit")
+	}
+	if files := runTestGit(t, projectRootDir, "show", "--name-only", "--format=", commit); files != "file.txt" {
+		t.Errorf("unexpected files in commit:\n%s", files)
+	}
+	assertFileContents(t, projectRootDir, "debug.log", "log\n")
+}
@@ -0,0 +1,191 @@
+package op_stash
+
+import (
+	"slices"
+	"strings"
+)
+
+const conflictBeginMarker = "<<<<<<<"
+const conflictSeparatorMarker = "======="
+const conflictEndMarker = ">>>>>>>"
+
+// diffMatches finds the longest common subsequence of lines a and b using linear space variant of Myers diff algorithm.
+// Returns slice with index of the matching line in b for each line of a, or -1 if the line has no match
+func diffMatches(a, b []string) []int {
+	n, m := len(a), len(b)
+	matches := make([]int, n)
+	for i := range matches {
+		matches[i] = -1
+	}
+
+	// Buffers for furthest reaching paths are shared by all subproblems, so memory usage stays O(n+m)
+	offset := n + m + 1
+	vf := make([]int, 2*offset+1)
+	vb := make([]int, 2*offset+1)
+
+	// middleSnake finds the middle snake of the shortest edit script for a[aLo:aHi] and b[bLo:bHi]
+	// by running forward and backward searches until they overlap, returns its start and end points
+	middleSnake := func(aLo, aHi, bLo, bHi int) (int, int, int, int) {
+		rn, rm := aHi-aLo, bHi-bLo
+		delta := rn - rm
+		odd := delta%2 != 0
+		vf[offset+1] = 0
+		vb[offset+1] = 0
+		for d := 0; d <= (rn+rm+1)/2; d++ {
+			// Forward search, x and y are counted from the start of subproblem
+			for k := -d; k <= d; k += 2 {
+				var x int
+				if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+					x = vf[offset+k+1]
+				} else {
+					x = vf[offset+k-1] + 1
+				}
+				y := x - k
+				startX, startY := x, y
+				for x < rn && y < rm && a[aLo+x] == b[bLo+y] {
+					x++
+					y++
+				}
+				vf[offset+k] = x
+				// Backward path on the same diagonal from the previous step
+				if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+vb[offset+c] >= rn {
+					return aLo + startX, bLo + startY, aLo + x, bLo + y
+				}
+			}
+			// Backward search, x and y are counted from the end of subproblem
+			for c := -d; c <= d; c += 2 {
+				var x int
+				if c == -d || (c != d && vb[offset+c-1] < vb[offset+c+1]) {
+					x = vb[offset+c+1]
+				} else {
+					x = vb[offset+c-1] + 1
+				}
+				y := x - c
+				startX, startY := x, y
+				for x < rn && y < rm && a[aHi-x-1] == b[bHi-y-1] {
+					x++
+					y++
+				}
+				vb[offset+c] = x
+				// Forward path on the same diagonal from the current step
+				if k := delta - c; !odd && k >= -d && k <= d && vf[offset+k]+x >= rn {
+					return aHi - x, bHi - y, aHi - startX, bHi - startY
+				}
+			}
+		}
+		// Not reached, searches always overlap
+		return aLo, bLo, aLo, bLo
+	}
+
+	var solve func(aLo, aHi, bLo, bHi int)
+	solve = func(aLo, aHi, bLo, bHi int) {
+		// Common prefix and suffix are always matching
+		for aLo < aHi && bLo < bHi && a[aLo] == b[bLo] {
+			matches[aLo] = bLo
+			aLo++
+			bLo++
+		}
+		for aLo < aHi && bLo < bHi && a[aHi-1] == b[bHi-1] {
+			aHi--
+			bHi--
+			matches[aHi] = bHi
+		}
+		if aLo == aHi || bLo == bHi {
+			return
+		}
+		x, y, u, v := middleSnake(aLo, aHi, bLo, bHi)
+		for i := 0; x+i < u; i++ {
+			matches[x+i] = y + i
+		}
+		solve(aLo, x, bLo, y)
+		solve(u, aHi, v, bHi)
+	}
+	solve(0, n, 0, m)
+
+	return matches
+}
+
+func appendConflict(result []string, current []string, incoming []string, currentLabel, incomingLabel string) []string {
+	result = append(result, conflictBeginMarker+" "+currentLabel)
+	result = append(result, current...)
+	result = append(result, conflictSeparatorMarker)
+	result = append(result, incoming...)
+	return append(result, conflictEndMarker+" "+incomingLabel)
+}
+
+// mergeText performs line-based three-way merge of current and incoming texts derived from the common base text.
+// Non-overlapping changes are merged automatically, overlapping changes are written with conflict markers.
+// Returns merged text and number of conflicting regions
+func mergeText(base, current, incoming, currentLabel, incomingLabel string) (string, int) {
+	baseLines := strings.Split(base, "\n")
+	currentLines := strings.Split(current, "\n")
+	incomingLines := strings.Split(incoming, "\n")
+	currentMatches := diffMatches(baseLines, currentLines)
+	incomingMatches := diffMatches(baseLines, incomingLines)
+
+	var result []string
+	conflicts := 0
+	i, j, k := 0, 0, 0
+	for i < len(baseLines) || j < len(currentLines) || k < len(incomingLines) {
+		// Stable line, unchanged in both versions
+		if i < len(baseLines) && currentMatches[i] == j && incomingMatches[i] == k {
+			result = append(result, baseLines[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+		// Find next base line that is present in both versions, lines before it form unstable chunk
+		nextI, nextJ, nextK := len(baseLines), len(currentLines), len(incomingLines)
+		for l := i; l < len(baseLines); l++ {
+			if currentMatches[l] >= 0 && incomingMatches[l] >= 0 {
+				nextI, nextJ, nextK = l, currentMatches[l], incomingMatches[l]
+				break
+			}
+		}
+		baseChunk := baseLines[i:nextI]
+		currentChunk := currentLines[j:nextJ]
+		incomingChunk := incomingLines[k:nextK]
+		switch {
+		case slices.Equal(currentChunk, baseChunk):
+			result = append(result, incomingChunk...)
+		case slices.Equal(incomingChunk, baseChunk), slices.Equal(currentChunk, incomingChunk):
+			result = append(result, currentChunk...)
+		default:
+			result = appendConflict(result, currentChunk, incomingChunk, currentLabel, incomingLabel)
+			conflicts++
+		}
+		i, j, k = nextI, nextJ, nextK
+	}
+
+	return strings.Join(result, "\n"), conflicts
+}
+
+// markConflicts compares current and incoming texts without common base and writes every differing region with conflict markers.
+// Returns resulting text and number of conflicting regions
+func markConflicts(current, incoming, currentLabel, incomingLabel string) (string, int) {
+	currentLines := strings.Split(current, "\n")
+	incomingLines := strings.Split(incoming, "\n")
+	matches := diffMatches(currentLines, incomingLines)
+
+	var result []string
+	conflicts := 0
+	j, k := 0, 0
+	for j < len(currentLines) || k < len(incomingLines) {
+		if j < len(currentLines) && matches[j] == k {
+			result = append(result, currentLines[j])
+			j, k = j+1, k+1
+			continue
+		}
+		nextJ, nextK := len(currentLines), len(incomingLines)
+		for l := j; l < len(currentLines); l++ {
+			if matches[l] >= 0 {
+				nextJ, nextK = l, matches[l]
+				break
+			}
+		}
+		result = appendConflict(result, currentLines[j:nextJ], incomingLines[k:nextK], currentLabel, incomingLabel)
+		conflicts++
+		j, k = nextJ, nextK
+	}
+
+	return strings.Join(result, "\n"), conflicts
+}
@@ -0,0 +1,119 @@
+package op_stash
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestDiffMatches(t *testing.T) {
+	a := strings.Split("a\nb\nc\nd", "\n")
+	b := strings.Split("a\nx\nc\nd\ne", "\n")
+	matches := diffMatches(a, b)
+	expected := []int{0, -1, 2, 3}
+	for i := range expected {
+		if matches[i] != expected[i] {
+			t.Fatalf("diffMatches() = %v, want %v", matches, expected)
+		}
+	}
+}
+
+func TestDiffMatchesIsLongestCommonSubsequence(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(40))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for iter := 0; iter < 500; iter++ {
+		a, b := randomLines(), randomLines()
+		matches := diffMatches(a, b)
+		count, last := 0, -1
+		for i, j := range matches {
+			if j < 0 {
+				continue
+			}
+			if j <= last || a[i] != b[j] {
+				t.Fatalf("invalid matches %v for %v and %v", matches, a, b)
+			}
+			last = j
+			count++
+		}
+		// Reference LCS length with dynamic programming
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if count != lcs[0][0] {
+			t.Fatalf("diffMatches() found %d matches, want %d for %v and %v", count, lcs[0][0], a, b)
+		}
+	}
+}
+
+func TestMergeText(t *testing.T) {
+	tests := []struct {
+		name      string
+		base      string
+		current   string
+		incoming  string
+		expected  string
+		conflicts int
+	}{
+		{
+			name:     "non-overlapping changes",
+			base:     "a\nb\nc\nd\ne\n",
+			current:  "a\nB\nc\nd\ne\n",
+			incoming: "a\nb\nc\nD\ne\nf\n",
+			expected: "a\nB\nc\nD\ne\nf\n",
+		},
+		{
+			name:     "same change on both sides",
+			base:     "a\nb\nc\n",
+			current:  "a\nx\nc\n",
+			incoming: "a\nx\nc\n",
+			expected: "a\nx\nc\n",
+		},
+		{
+			name:      "overlapping changes",
+			base:      "a\nb\nc\n",
+			current:   "a\nx\nc\n",
+			incoming:  "a\ny\nc\n",
+			expected:  "a\n<<<<<<< current\nx\n=======\ny\n>>>>>>> stash\nc\n",
+			conflicts: 1,
+		},
+		{
+			name:     "insertions at both ends",
+			base:     "b\n",
+			current:  "a\nb\n",
+			incoming: "b\nc\n",
+			expected: "a\nb\nc\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, conflicts := mergeText(tt.base, tt.current, tt.incoming, "current", "stash")
+			if result != tt.expected || conflicts != tt.conflicts {
+				t.Errorf("mergeText() = %q, %d; want %q, %d", result, conflicts, tt.expected, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestMarkConflicts(t *testing.T) {
+	result, conflicts := markConflicts("a\nb\nc\n", "a\nc\nd\n", "current", "stash")
+	expected := "a\n<<<<<<< current\nb\n=======\n>>>>>>> stash\nc\n<<<<<<< current\n=======\nd\n>>>>>>> stash\n"
+	if result != expected || conflicts != 2 {
+		t.Errorf("markConflicts() = %q, %d; want %q, 2", result, conflicts, expected)
+	}
+}
@@ -0,0 +1,127 @@
+package op_stash
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const summarySubjectMaxLength = 80
+
+// describeEntry returns short description of the change recorded in the stash entry
+func describeEntry(entry FileEntry) string {
+	switch {
+	case entry.MovedFrom != "":
+		return fmt.Sprintf("Moved: %s -> %s", entry.MovedFrom, entry.Filename)
+	case entry.Original.Exists && entry.Modified.Exists:
+		return "Modified: " + entry.Filename
+	case !entry.Original.Exists && entry.Modified.Exists:
+		return "Created: " + entry.Filename
+	case entry.Original.Exists && !entry.Modified.Exists:
+		return "Deleted: " + entry.Filename
+	default:
+		return "Unchanged absent: " + entry.Filename
+	}
+}
+
+// getSubject returns first line of the task, or list of target files if task is empty
+func (m Metadata) getSubject() string {
+	subject := strings.TrimSpace(m.Task)
+	if subject == "" && len(m.TargetFiles) > 0 {
+		subject = "implement comments in " + strings.Join(m.TargetFiles, ", ")
+	}
+	subject, _, _ = strings.Cut(subject, "\n")
+	subject = strings.TrimSpace(subject)
+	if runes := []rune(subject); len(runes) > summarySubjectMaxLength {
+		subject = string(runes[:summarySubjectMaxLength-3]) + "..."
+	}
+	return subject
+}
+
+// formatStashSummary returns one-line summary of the stash used when listing stashes
+func formatStashSummary(stash Stash) string {
+	summary := fmt.Sprintf("%d file(s)", len(stash.Files))
+	if stash.Metadata == nil {
+		return summary
+	}
+	if stash.Metadata.Mode != "" {
+		summary = fmt.Sprintf("[%s] %s", stash.Metadata.Mode, summary)
+	}
+	if subject := stash.Metadata.getSubject(); subject != "" {
+		summary += ": " + subject
+	}
+	return summary
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// formatStashDetails returns Markdown report with full information about the stash and how it was created
+func formatStashDetails(name string, stash Stash) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Stash %s\n\n", name)
+	fmt.Fprintf(&sb, "- Stash version: %d\n", stash.Version)
+
+	metadata := stash.Metadata
+	if metadata == nil {
+		sb.WriteString("\nNo metadata recorded, stash was created by an older version.\n")
+	} else {
+		if metadata.Operation != "" {
+			fmt.Fprintf(&sb, "- Operation: %s\n", metadata.Operation)
+		}
+		if metadata.Mode != "" {
+			fmt.Fprintf(&sb, "- Mode: %s\n", metadata.Mode)
+		}
+		fmt.Fprintf(&sb, "- Started: %s\n", formatTime(metadata.StartedAt))
+		fmt.Fprintf(&sb, "- Created: %s\n", formatTime(metadata.CreatedAt))
+		fmt.Fprintf(&sb, "- Token usage: %d input, %d output\n", metadata.TokenUsage.InputTokens, metadata.TokenUsage.OutputTokens)
+		if metadata.PerpetualVersion != "" {
+			fmt.Fprintf(&sb, "- Perpetual version: %s\n", metadata.PerpetualVersion)
+		}
+		if metadata.GitCommit != "" {
+			fmt.Fprintf(&sb, "- Git commit: %s\n", metadata.GitCommit)
+		}
+		if metadata.GitBranch != "" {
+			fmt.Fprintf(&sb, "- Git branch: %s\n", metadata.GitBranch)
+		}
+
+		if len(metadata.Models) > 0 {
+			sb.WriteString("\n## Models\n\n")
+			for _, stage := range slices.Sorted(maps.Keys(metadata.Models)) {
+				fmt.Fprintf(&sb, "- %s: %s\n", stage, metadata.Models[stage])
+			}
+		}
+
+		if len(metadata.TargetFiles) > 0 {
+			sb.WriteString("\n## Target Files\n\n")
+			for _, file := range metadata.TargetFiles {
+				fmt.Fprintf(&sb, "- %s\n", file)
+			}
+		}
+
+		if metadata.Task != "" {
+			fmt.Fprintf(&sb, "\n## Task\n\n%s\n", strings.TrimSpace(metadata.Task))
+		}
+
+		if metadata.Workplan != "" {
+			fmt.Fprintf(&sb, "\n## Work Plan\n\n%s\n", strings.TrimSpace(metadata.Workplan))
+		}
+	}
+
+	sb.WriteString("\n## Files\n\n")
+	for _, entry := range stash.Files {
+		// Source path of moved file is described by the entry of its destination path
+		if slices.ContainsFunc(stash.Files, func(other FileEntry) bool { return other.MovedFrom == entry.Filename }) {
+			continue
+		}
+		fmt.Fprintf(&sb, "- %s\n", describeEntry(entry))
+	}
+
+	return sb.String()
+}
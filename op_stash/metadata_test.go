@@ -0,0 +1,68 @@
+package op_stash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatStashSummary(t *testing.T) {
+	files := []FileEntry{{Filename: "a.go"}, {Filename: "b.go"}}
+	tests := []struct {
+		name     string
+		stash    Stash
+		expected string
+	}{
+		{
+			name:     "no metadata",
+			stash:    Stash{Files: files},
+			expected: "2 file(s)",
+		},
+		{
+			name:     "implement comments",
+			stash:    Stash{Files: files, Metadata: &Metadata{Mode: "comment", TargetFiles: []string{"a.go", "b.go"}}},
+			expected: "[comment] 2 file(s): implement comments in a.go, b.go",
+		},
+		{
+			name:     "long task",
+			stash:    Stash{Files: files, Metadata: &Metadata{Mode: "task", Task: "  " + strings.Repeat("x", 100) + "\nsecond line"}},
+			expected: "[task] 2 file(s): " + strings.Repeat("x", 77) + "...",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if summary := formatStashSummary(tt.stash); summary != tt.expected {
+				t.Errorf("formatStashSummary() = %q, want %q", summary, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatStashDetails(t *testing.T) {
+	stash := Stash{
+		Version: StashVersion,
+		Metadata: &Metadata{
+			Operation: "implement",
+			Mode:      "task",
+			Task:      "Rename file",
+			Workplan:  "Move old.go to new.go",
+			Models:    map[string]string{"stage4": "[provider:test]", "stage1": "[provider:other]"},
+		},
+		Files: []FileEntry{
+			{Filename: "old.go", Original: FileState{Exists: true}},
+			{Filename: "new.go", Modified: FileState{Exists: true}, MovedFrom: "old.go"},
+		},
+	}
+	details := formatStashDetails("name", stash)
+	for _, expected := range []string{
+		"# Stash name\n",
+		"- Mode: task\n",
+		"- stage1: [provider:other]\n- stage4: [provider:test]\n",
+		"## Task\n\nRename file\n",
+		"## Work Plan\n\nMove old.go to new.go\n",
+		"## Files\n\n- Moved: old.go -> new.go\n",
+	} {
+		if !strings.Contains(details, expected) {
+			t.Errorf("formatStashDetails() does not contain %q:\n%s", expected, details)
+		}
+	}
+}
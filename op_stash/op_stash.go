@@ -3,22 +3,46 @@ package op_stash
 import (
 	"flag"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/DarkCaster/Perpetual/config"
 	"github.com/DarkCaster/Perpetual/llm"
 	"github.com/DarkCaster/Perpetual/logging"
 	"github.com/DarkCaster/Perpetual/usage"
 	"github.com/DarkCaster/Perpetual/utils"
 )
 
-const StashVersion = 2
+const StashVersion = 3
+
+// Oldest stash version that can still be applied or rolled back, it has no metadata and no checksums
+const MinStashVersion = 2
 
 type Stash struct {
-	Version int         `json:"version"`
-	Files   []FileEntry `json:"files"`
+	Version  int         `json:"version"`
+	Metadata *Metadata   `json:"metadata,omitempty"`
+	Files    []FileEntry `json:"files"`
+}
+
+// Metadata describes how the stash was created, so generated changes can be traced back to the task that produced them
+type Metadata struct {
+	Operation        string            `json:"operation,omitempty"`
+	Mode             string            `json:"mode,omitempty"`
+	Task             string            `json:"task,omitempty"`
+	TargetFiles      []string          `json:"target_files,omitempty"`
+	Workplan         string            `json:"workplan,omitempty"`
+	Models           map[string]string `json:"models,omitempty"`
+	TokenUsage       llm.TokenUsage    `json:"token_usage"`
+	StartedAt        time.Time         `json:"started_at"`
+	CreatedAt        time.Time         `json:"created_at"`
+	PerpetualVersion string            `json:"perpetual_version,omitempty"`
+	// Set if changes from the stash were committed to git
+	GitCommit string `json:"git_commit,omitempty"`
+	GitBranch string `json:"git_branch,omitempty"`
 }
 
 type FileEntry struct {
@@ -26,11 +50,42 @@ type FileEntry struct {
 	FileParams utils.FileParams `json:"file_params"`
 	Original   FileState        `json:"original"`
 	Modified   FileState        `json:"modified"`
+	// Set if file was moved (renamed) from another path, entry for that path records its deletion
+	MovedFrom string `json:"moved_from,omitempty"`
 }
 
 type FileState struct {
 	Exists   bool   `json:"exists"`
 	Contents string `json:"contents,omitempty"`
+	// SHA256 checksum of the contents, used to detect local changes made after the stash was created
+	Checksum string `json:"checksum,omitempty"`
+}
+
+func newFileState(contents string) FileState {
+	return FileState{
+		Exists:   true,
+		Contents: contents,
+		Checksum: calculateContentsChecksum(contents),
+	}
+}
+
+func calculateContentsChecksum(contents string) string {
+	return utils.CalculateSHA256ForString(strings.ReplaceAll(contents, "\r\n", "\n"))
+}
+
+// getChecksum returns checksum stored in the file state, or calculates it for older stashes without checksums
+func (s FileState) getChecksum() string {
+	if !s.Exists {
+		return ""
+	}
+	if s.Checksum != "" {
+		return s.Checksum
+	}
+	return calculateContentsChecksum(s.Contents)
+}
+
+func (s FileState) matches(other FileState) bool {
+	return s.Exists == other.Exists && s.getChecksum() == other.getChecksum()
 }
 
 const OpName = "stash"
@@ -42,24 +97,12 @@ func stashFlags() *flag.FlagSet {
 }
 
 func validateStash(stash Stash) error {
-	if stash.Version != StashVersion {
-		return fmt.Errorf("unsupported stash version: %d, expected: %d", stash.Version, StashVersion)
+	if stash.Version < MinStashVersion || stash.Version > StashVersion {
+		return fmt.Errorf("unsupported stash version: %d, expected: %d-%d", stash.Version, MinStashVersion, StashVersion)
 	}
 	return nil
 }
 
-func loadStash(stashFile string) (Stash, error) {
-	var stash Stash
-	err := utils.LoadJsonFile(stashFile, &stash)
-	if err != nil {
-		return stash, err
-	}
-	if err := validateStash(stash); err != nil {
-		return stash, err
-	}
-	return stash, nil
-}
-
 func resolveTargetFile(projectRootDir, sourceFile, targetFile string) (string, error) {
 	target := sourceFile
 	if targetFile != "" {
@@ -96,16 +139,20 @@ func applyFileState(projectRootDir string, filename string, state FileState, log
 }
 
 func Run(args []string, innerCall bool, logger logging.ILogger) {
-	var help, verbose, trace bool
-	var mode, name, fileName, targetFile string
+	var help, verbose, trace, force, gitRevert bool
+	var mode, name, fileName, targetFile, conflictMode, bundleFile string
 
 	// Parse flags for the "stash" operation
 	flags := stashFlags()
 	flags.BoolVar(&help, "h", false, "Show usage")
-	flags.StringVar(&mode, "m", "", "Select operation mode: list, list-files, apply, rollback")
+	flags.StringVar(&mode, "m", "", "Select operation mode: list, list-files, show, diff, status, apply, rollback, undo, redo, prune, export, import")
 	flags.StringVar(&name, "s", "latest", "Set stash name to apply or revert")
 	flags.StringVar(&fileName, "o", "", "Select single file to apply or revert from stash")
 	flags.StringVar(&targetFile, "t", "", "Target path where file from stash (selected with '-o') will be saved, relative to project root. Optional")
+	flags.StringVar(&conflictMode, "c", conflictModeRefuse, "Select how to handle files changed after stash was created: refuse, markers, merge")
+	flags.StringVar(&bundleFile, "b", "", "Bundle file to write with '-m export' (default: <stash name>"+bundleFileExt+" in current directory), or to read with '-m import'")
+	flags.BoolVar(&gitRevert, "g", false, "Roll back by reverting git commit recorded in the stash (stash must be created with git mode enabled)")
+	flags.BoolVar(&force, "force", false, "Overwrite files changed after stash was created, skipping conflict detection")
 	flags.BoolVar(&verbose, "v", false, "Enable debug logging")
 	flags.BoolVar(&trace, "vv", false, "Enable debug and trace logging")
 	flags.Parse(args)
@@ -121,27 +168,62 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 	logger.Debugln("Starting 'stash' operation")
 	logger.Traceln("Args:", args)
 
-	var list, listFiles, apply, rollback bool
+	var list, listFiles, show, diff, status, apply, rollback, undo, redo, prune, export, importBundleFile bool
 	switch mode {
 	case "list":
 		list = true
 	case "list-files":
 		listFiles = true
+	case "show":
+		show = true
+	case "diff":
+		diff = true
+	case "prune":
+		prune = true
+	case "export":
+		export = true
+	case "import":
+		importBundleFile = true
+	case "status":
+		status = true
 	case "apply":
 		apply = true
 	case "rollback":
 		rollback = true
+	case "undo":
+		undo = true
+	case "redo":
+		redo = true
 	case "":
-		usage.PrintOperationUsage("You must provide a valid report mode with the '-m' flag (valid values: list|list-files|apply|rollback)", flags)
+		usage.PrintOperationUsage("You must provide a valid report mode with the '-m' flag (valid values: list|list-files|show|diff|status|apply|rollback|undo|redo|prune|export|import)", flags)
 	default:
 		logger.Errorln("Invalid operation mode:", mode)
-		usage.PrintOperationUsage("You must provide a valid report mode with the '-m' flag (valid values: list|list-files|apply|rollback)", flags)
+		usage.PrintOperationUsage("You must provide a valid report mode with the '-m' flag (valid values: list|list-files|show|diff|status|apply|rollback|undo|redo|prune|export|import)", flags)
+	}
+
+	switch conflictMode {
+	case conflictModeRefuse, conflictModeMarkers, conflictModeMerge:
+	default:
+		logger.Errorln("Invalid conflict handling mode:", conflictMode)
+		usage.PrintOperationUsage("You must provide a valid conflict handling mode with the '-c' flag (valid values: refuse|markers|merge)", flags)
 	}
 
 	if help {
 		usage.PrintOperationUsage("", flags)
 	}
 
+	if (undo || redo) && (name != "latest" || fileName != "" || targetFile != "") {
+		usage.PrintOperationUsage("The '-s', '-o' and '-t' flags cannot be used with '-m undo' or '-m redo'", flags)
+	}
+
+	if gitRevert && (!rollback || fileName != "") {
+		usage.PrintOperationUsage("The '-g' flag can be only used with '-m rollback' and cannot be used with '-o'", flags)
+	}
+
+	if importBundleFile && bundleFile == "" {
+		usage.PrintOperationUsage("You must provide bundle file to import with the '-b' flag", flags)
+	}
+
 	outerCallLogger := logger.Clone()
 	if innerCall {
 		outerCallLogger.DisableLevel(logging.ErrorLevel)
@@ -166,18 +248,30 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		}
 	}
 
-	stashes, err := os.ReadDir(stashDir)
-	if err != nil {
-		outerCallLogger.Panicln("Error reading stash directory:", err)
-	}
+	// Modes that only read stashes may run concurrently, other modes change stashes or project files
+	readOnly := list || listFiles || show || diff || status || export
+	unlockStashes := utils.LockProjectResource(perpetualDir, utils.LockResourceStash, !readOnly, logger)
+	defer unlockStashes()
 
-	fileStashes := make([]os.DirEntry, 0, len(stashes))
-	for _, entry := range stashes {
-		if entry.Type().IsRegular() {
-			fileStashes = append(fileStashes, entry)
+	if importBundleFile {
+		logger.Infoln("Importing stash from bundle:", bundleFile)
+		bundleName, stash, err := importBundle(bundleFile)
+		if err != nil {
+			outerCallLogger.Panicln("Error importing bundle:", err)
+		}
+		projectConfig := config.LoadProjectConfig(perpetualDir, outerCallLogger)
+		stashName := getUniqueStashName(stashDir, trimStashFileExt(filepath.Base(bundleName)))
+		if _, err := saveStash(stashDir, stashName, stash, projectConfig.String(config.K_ProjectStashCompression)); err != nil {
+			outerCallLogger.Panicln("Error saving stash:", err)
 		}
+		logger.Infof("Imported stash %s, use '-m apply -s %s' to apply it", stashName, stashName)
+		return
+	}
+
+	stashes, err := listStashFiles(stashDir)
+	if err != nil {
+		outerCallLogger.Panicln("Error reading stash directory:", err)
 	}
-	stashes = fileStashes
 
 	// Check if no stash files are present
 	if len(stashes) == 0 {
@@ -185,24 +279,58 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		return
 	}
 
+	if prune {
+		projectConfig := config.LoadProjectConfig(perpetualDir, outerCallLogger)
+		removed := pruneStashes(stashDir, getRetentionPolicy(projectConfig), logger)
+		outerCallLogger.Infof("Removed %d of %d stashes", removed, len(stashes))
+		return
+	}
+
+	stack, err := loadUndoStack(stashDir)
+	if err != nil {
+		outerCallLogger.Panicln("Error loading undo stack:", err)
+	}
+
 	if list {
-		// Print stashes directly to console
-		for _, stash := range stashes {
-			fmt.Println(strings.TrimSuffix(stash.Name(), ".json"))
+		// Print stashes with short summary directly to console
+		for _, entry := range stashes {
+			stash, err := loadStash(filepath.Join(stashDir, entry.FileName))
+			if err != nil {
+				logger.Warnf("Failed to load stash %s: %v", entry.Name, err)
+				fmt.Println(entry.Name)
+				continue
+			}
+			// Mark stashes tracked by the undo stack, so it is clear what undo and redo will do
+			marker := ""
+			if slices.Contains(stack.Applied, entry.Name) {
+				marker = " (applied)"
+			} else if slices.Contains(stack.Undone, entry.Name) {
+				marker = " (undone)"
+			}
+			fmt.Printf("%s\t%s%s\n", entry.Name, formatStashSummary(stash), marker)
 		}
 		return
 	}
 
-	if name == "latest" {
-		name = stashes[len(stashes)-1].Name()
+	if undo {
+		if len(stack.Applied) < 1 {
+			logger.Infoln("Nothing to undo.")
+			return
+		}
+		name = stack.Applied[len(stack.Applied)-1]
+	} else if redo {
+		if len(stack.Undone) < 1 {
+			logger.Infoln("Nothing to redo.")
+			return
+		}
+		name = stack.Undone[len(stack.Undone)-1]
+	} else if name == "latest" {
+		name = stashes[len(stashes)-1].Name
 	}
+	name = trimStashFileExt(name)
 	logger.Infoln("Processing stash:", name)
-	// Add .json extension if not present
-	if filepath.Ext(name) != ".json" {
-		name += ".json"
-	}
-	stashFile := filepath.Join(stashDir, name)
-	if _, err := os.Stat(stashFile); os.IsNotExist(err) {
+	stashFile := findStashFile(stashDir, name)
+	if stashFile == "" {
 		outerCallLogger.Panicln("Stash not found:", name)
 	}
 	stash, err := loadStash(stashFile)
@@ -210,6 +338,26 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 		outerCallLogger.Panicln("Error loading stash:", err)
 	}
 
+	if show {
+		fmt.Print(formatStashDetails(name, stash))
+		return
+	}
+
+	if gitRevert {
+		if stash.Metadata == nil || stash.Metadata.GitCommit == "" {
+			outerCallLogger.Panicln("No git commit recorded in stash:", name)
+		}
+		logger.Infoln("Reverting git commit:", stash.Metadata.GitCommit)
+		if err := utils.GitRevertCommit(projectRootDir, stash.Metadata.GitCommit); err != nil {
+			outerCallLogger.Panicln("Error reverting git commit:", err)
+		}
+		stack.removeApplied(name)
+		if err := saveUndoStack(stashDir, stack); err != nil {
+			logger.Errorln("Failed to save undo stack:", err)
+		}
+		return
+	}
+
 	if listFiles {
 		logger.Infoln("Listing files in stash:", name)
 		for _, entry := range stash.Files {
@@ -223,13 +371,79 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 			} else {
 				fmt.Println("Modified (deleted):", entry.Filename)
 			}
+			if entry.MovedFrom != "" {
+				fmt.Printf("Moved: %s -> %s\n", entry.MovedFrom, entry.Filename)
+			}
+		}
+		return
+	}
+
+	// Select files to apply or revert, file moved with single-file selection is processed together with its source path
+	selectedFiles := []string{fileName}
+	if fileName != "" && targetFile == "" {
+		for _, entry := range stash.Files {
+			if entry.MovedFrom == "" {
+				continue
+			}
+			if entry.Filename == fileName {
+				selectedFiles = append(selectedFiles, entry.MovedFrom)
+			} else if entry.MovedFrom == fileName {
+				selectedFiles = append(selectedFiles, entry.Filename)
+			}
+		}
+	}
+
+	if export {
+		if bundleFile == "" {
+			bundleFile = name + bundleFileExt
+		}
+		logger.Infoln("Exporting stash to bundle:", bundleFile)
+		if err := exportBundle(bundleFile, name, stash); err != nil {
+			outerCallLogger.Panicln("Error exporting bundle:", err)
+		}
+		return
+	}
+
+	if diff {
+		if fileName != "" {
+			fmt.Print(formatStashDiff(stash, selectedFiles))
+		} else {
+			fmt.Print(formatStashDiff(stash, nil))
+		}
+		return
+	}
+
+	if status {
+		for _, entry := range stash.Files {
+			if fileName != "" && !slices.Contains(selectedFiles, entry.Filename) {
+				continue
+			}
+			current, err := readCurrentState(projectRootDir, entry.Filename)
+			if err != nil {
+				outerCallLogger.Panicf("Failed to read file %s: %v", entry.Filename, err)
+			}
+			fmt.Printf("%s: %s\n", getFileStatus(entry, current), entry.Filename)
 		}
 		return
 	}
 
 	applyStates := func(useModifiedState bool) {
+		type fileAction struct {
+			entry  FileEntry
+			target string
+			state  FileState
+		}
+
+		targetLabel := fmt.Sprintf("stash %s (rollback)", name)
+		if useModifiedState {
+			targetLabel = fmt.Sprintf("stash %s (apply)", name)
+		}
+
+		// Check all selected files for local changes before writing anything
+		var actions []fileAction
+		var conflicts []string
 		for _, entry := range stash.Files {
-			if fileName != "" && entry.Filename != fileName {
+			if fileName != "" && !slices.Contains(selectedFiles, entry.Filename) {
 				continue
 			}
 
@@ -238,30 +452,110 @@ func Run(args []string, innerCall bool, logger logging.ILogger) {
 				outerCallLogger.Panicln("Requested file is not inside project root", target)
 			}
 
-			state := entry.Original
+			state, baseState := entry.Original, entry.Modified
 			if useModifiedState {
-				state = entry.Modified
+				state, baseState = entry.Modified, entry.Original
+			}
+
+			// File saved to a custom target path is not related to stashed states, so it is not checked for conflicts
+			if !force && targetFile == "" {
+				current, err := readCurrentState(projectRootDir, target)
+				if err != nil {
+					outerCallLogger.Panicf("Failed to read file %s: %v", target, err)
+				}
+				if current.matches(state) {
+					logger.Debugln("File is already in the requested state:", target)
+					continue
+				}
+				if !current.matches(baseState) {
+					if conflictMode == conflictModeRefuse {
+						conflicts = append(conflicts, target)
+						continue
+					}
+					resolved, count, ok := resolveConflict(conflictMode, baseState, current, state, "current", targetLabel)
+					if !ok {
+						logger.Warnln("File was created or deleted after stash was created, its changes cannot be combined, skipping:", target)
+						continue
+					}
+					if count > 0 {
+						logger.Warnf("%s: %d conflicting region(s) marked, resolve them manually", target, count)
+					} else {
+						logger.Infoln("Merged with local changes:", target)
+					}
+					state = resolved
+				}
 			}
 
+			actions = append(actions, fileAction{entry: entry, target: target, state: state})
+		}
+
+		if len(conflicts) > 0 {
+			for _, conflict := range conflicts {
+				logger.Errorln("File was changed after stash was created:", conflict)
+			}
+			outerCallLogger.Panicln("Refusing to overwrite local changes, use '-c merge' or '-c markers' to combine them, or '-force' to overwrite")
+		}
+
+		for _, action := range actions {
 			// SaveTextFile looks up encoding parameters by the exact path used
 			// for writing, so associate the stashed parameters with the
 			// resolved target path before applying the file state.
-			utils.SetFileParams(filepath.Join(projectRootDir, target), entry.FileParams)
-			applyFileState(projectRootDir, target, state, outerCallLogger)
+			utils.SetFileParams(filepath.Join(projectRootDir, action.target), action.entry.FileParams)
+			applyFileState(projectRootDir, action.target, action.state, outerCallLogger)
+		}
+	}
+
+	// Rolling back a stash before newer stashes that changed the same files would overwrite their changes
+	if (rollback || undo) && !force && targetFile == "" {
+		var files []string
+		for _, entry := range stash.Files {
+			if fileName == "" || slices.Contains(selectedFiles, entry.Filename) {
+				files = append(files, entry.Filename)
+			}
+		}
+		newer, shared, err := findNewerOverlappingStash(stashDir, stack, name, files)
+		if err != nil {
+			outerCallLogger.Panicln("Error checking newer applied stashes:", err)
+		}
+		if newer != "" {
+			for _, file := range shared {
+				logger.Errorf("File was also changed by newer applied stash %s: %s", newer, file)
+			}
+			outerCallLogger.Panicf("Stash %s must be rolled back after newer stash %s, use '-m undo' to roll back stashes in order, or '-force' to proceed anyway", name, newer)
 		}
 	}
 
-	if apply {
+	if apply || redo {
 		logger.Infoln("Applying changes")
 		applyStates(true)
-	} else if rollback {
+	} else if rollback || undo {
 		logger.Infoln("Rolling back changes")
 		applyStates(false)
 	}
+
+	// Only operations with whole stash change its position in the undo stack
+	if fileName != "" || targetFile != "" {
+		return
+	}
+	switch {
+	case apply || redo:
+		stack.pushApplied(name, redo)
+	case undo:
+		stack.pushUndone(name)
+	case rollback:
+		stack.removeApplied(name)
+	}
+	if err := saveUndoStack(stashDir, stack); err != nil {
+		logger.Errorln("Failed to save undo stack:", err)
+	}
 }
 
-// This function creates new stash from code generation results. Called internally
-func CreateStash(results map[string]string, projectFiles []string, filesToDelete []string, logger logging.ILogger) string {
+// This function creates new stash from code generation results. Called internally.
+// filesToMove maps source paths of moved (renamed) files to destination paths, contents for destination path
+// is taken from results if present (file was moved and modified), or from the source file otherwise.
+// metadata describes the operation that produced the results, its creation time is set here.
+// compression selects stash file format: gzip, or none for plain JSON
+func CreateStash(results map[string]string, projectFiles []string, filesToDelete []string, filesToMove map[string]string, metadata Metadata, compression string, logger logging.ILogger) string {
 	logger.Traceln("CreateStash: Starting")
 	defer logger.Traceln("CreateStash: Finished")
 
@@ -279,6 +573,9 @@ func CreateStash(results map[string]string, projectFiles []string, filesToDelete
 		}
 	}
 
+	unlockStashes := utils.LockProjectResource(perpetualDir, utils.LockResourceStash, true, logger)
+	defer unlockStashes()
+
 	readOriginalState := func(filePath string) FileState {
 		_, err := os.Stat(filepath.Join(projectRootDir, filePath))
 		if err != nil {
@@ -297,10 +594,7 @@ func CreateStash(results map[string]string, projectFiles []string, filesToDelete
 			}
 		}
 
-		return FileState{
-			Exists:   true,
-			Contents: backup,
-		}
+		return newFileState(backup)
 	}
 
 	normalizeFilePath := func(filePathInitial string) string {
@@ -317,8 +611,10 @@ func CreateStash(results map[string]string, projectFiles []string, filesToDelete
 	}
 
 	logger.Infoln("Creating new stash from generated results")
+	metadata.CreatedAt = time.Now()
 	stash := Stash{
-		Version: StashVersion,
+		Version:  StashVersion,
+		Metadata: &metadata,
 	}
 
 	entriesByFile := make(map[string]int)
@@ -341,10 +637,7 @@ func CreateStash(results map[string]string, projectFiles []string, filesToDelete
 			Filename:   filePathFinal,
 			FileParams: fileParams,
 			Original:   original,
-			Modified: FileState{
-				Exists:   true,
-				Contents: fileContent,
-			},
+			Modified:   newFileState(fileContent),
 		})
 	}
 
@@ -367,26 +660,56 @@ func CreateStash(results map[string]string, projectFiles []string, filesToDelete
 		})
 	}
 
+	sourceFiles := slices.Sorted(maps.Keys(filesToMove))
+	for _, sourcePathInitial := range sourceFiles {
+		sourcePathFinal := normalizeFilePath(sourcePathInitial)
+		destPathFinal := normalizeFilePath(filesToMove[sourcePathInitial])
+		original := readOriginalState(sourcePathFinal)
+		if !original.Exists {
+			logger.Warnf("Source file for move does not exist, skipping: %s -> %s", sourcePathFinal, destPathFinal)
+			continue
+		}
+		fileParams := utils.GetFileParams(filepath.Join(projectRootDir, sourcePathFinal))
+
+		if _, ok := entriesByFile[sourcePathFinal]; ok {
+			logger.Warnln("File is both modified and moved in stash, move will take precedence:", sourcePathFinal)
+		}
+		addOrReplaceEntry(FileEntry{
+			Filename:   sourcePathFinal,
+			FileParams: fileParams,
+			Original:   original,
+			Modified: FileState{
+				Exists: false,
+			},
+		})
+
+		// Destination entry, use moved and modified contents from results if present
+		if index, ok := entriesByFile[destPathFinal]; ok && stash.Files[index].Modified.Exists {
+			stash.Files[index].MovedFrom = sourcePathFinal
+			stash.Files[index].FileParams = fileParams
+			continue
+		}
+		addOrReplaceEntry(FileEntry{
+			Filename:   destPathFinal,
+			FileParams: fileParams,
+			Original:   readOriginalState(destPathFinal),
+			Modified:   original,
+			MovedFrom:  sourcePathFinal,
+		})
+	}
+
 	if len(stash.Files) > 0 {
 		logger.Debugln("Files in stash:")
 		for _, entry := range stash.Files {
-			if entry.Original.Exists && entry.Modified.Exists {
-				logger.Debugln("Modified:", entry.Filename)
-			} else if !entry.Original.Exists && entry.Modified.Exists {
-				logger.Debugln("Created:", entry.Filename)
-			} else if entry.Original.Exists && !entry.Modified.Exists {
-				logger.Debugln("Deleted:", entry.Filename)
-			} else {
-				logger.Debugln("Unchanged absent:", entry.Filename)
-			}
+			logger.Debugln(describeEntry(entry))
 		}
 	}
 
-	stashFileName := time.Now().Format("2006-01-02_15-04-05")
-	err = utils.SaveJsonFile(filepath.Join(stashDir, stashFileName+".json"), stash)
-	if err != nil {
+	// Several stashes may be created within the same second (e.g. when processing a task-queue), unique name keeps them all
+	stashName := getUniqueStashName(stashDir, time.Now().Format(stashNameTimeLayout))
+	if _, err := saveStash(stashDir, stashName, stash, compression); err != nil {
 		logger.Panicln("Error saving stash:", err)
 	}
 
-	return stashFileName
+	return stashName
 }
@@ -262,6 +262,10 @@ func TestStashSingleFileTargetCanBeCreatedAndDeletedOnRollback(t *testing.T) {
 func TestStashApplyAndRollbackPreserveUTF16Encoding(t *testing.T) {
 	projectRootDir, stashDir := setupTempProject(t)
 
+	if err := os.WriteFile(filepath.Join(projectRootDir, "encoded.txt"), []byte{0xFE, 0xFF, 0x00, 0x6F, 0x00, 0x6C, 0x00, 0x64}, 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+
 	writeTestStash(t, stashDir, "utf16", Stash{
 		Version: StashVersion,
 		Files: []FileEntry{
@@ -452,6 +456,9 @@ func TestCreateStashStoresFileEncodingParams(t *testing.T) {
 		},
 		[]string{"modified.txt", "deleted.txt"},
 		[]string{"deleted.txt"},
+		nil,
+		Metadata{},
+		"none",
 		newTestLogger(t),
 	)
 
@@ -511,6 +518,9 @@ func TestCreateStashIncludesFilesToDelete(t *testing.T) {
 		},
 		[]string{"existing.txt", "delete.txt"},
 		[]string{"delete.txt"},
+		nil,
+		Metadata{},
+		"none",
 		newTestLogger(t),
 	)
 
@@ -526,3 +536,227 @@ func TestCreateStashIncludesFilesToDelete(t *testing.T) {
 	assertFileNotExists(t, projectRootDir, "created.txt")
 	assertFileContents(t, projectRootDir, "delete.txt", "delete original\n")
 }
+
+func TestCreateStashMovesFiles(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+
+	if err := os.MkdirAll(filepath.Join(projectRootDir, "src"), 0755); err != nil {
+		t.Fatalf("failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectRootDir, "src", "old.txt"), []byte("old original\n"), 0644); err != nil {
+		t.Fatalf("failed to create moved file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectRootDir, "rename.txt"), []byte("rename original\n"), 0644); err != nil {
+		t.Fatalf("failed to create renamed file: %v", err)
+	}
+
+	stashName := CreateStash(
+		map[string]string{
+			"renamed.txt": "rename modified\n",
+		},
+		[]string{filepath.Join("src", "old.txt"), "rename.txt"},
+		nil,
+		map[string]string{
+			filepath.Join("src", "old.txt"): filepath.Join("dst", "new.txt"),
+			"rename.txt":                    "renamed.txt",
+		},
+		Metadata{},
+		"none",
+		newTestLogger(t),
+	)
+
+	stash, err := loadStash(filepath.Join(stashDir, stashName+".json"))
+	if err != nil {
+		t.Fatalf("failed to load created stash: %v", err)
+	}
+	movedFrom := map[string]string{}
+	for _, entry := range stash.Files {
+		if entry.MovedFrom != "" {
+			movedFrom[entry.Filename] = entry.MovedFrom
+		}
+	}
+	if len(movedFrom) != 2 || movedFrom[filepath.Join("dst", "new.txt")] != filepath.Join("src", "old.txt") || movedFrom["renamed.txt"] != "rename.txt" {
+		t.Fatalf("unexpected moved entries in stash: %v", movedFrom)
+	}
+
+	runStash(t, "-m", "apply", "-s", stashName)
+	utils.RunGlobalCleanup()
+	assertFileNotExists(t, projectRootDir, filepath.Join("src", "old.txt"))
+	assertFileContents(t, projectRootDir, filepath.Join("dst", "new.txt"), "old original\n")
+	assertFileNotExists(t, projectRootDir, "rename.txt")
+	assertFileContents(t, projectRootDir, "renamed.txt", "rename modified\n")
+
+	// Single-file rollback of moved file also restores its source path
+	runStash(t, "-m", "rollback", "-s", stashName, "-o", "renamed.txt")
+	utils.RunGlobalCleanup()
+	assertFileNotExists(t, projectRootDir, "renamed.txt")
+	assertFileContents(t, projectRootDir, "rename.txt", "rename original\n")
+	assertFileContents(t, projectRootDir, filepath.Join("dst", "new.txt"), "old original\n")
+
+	runStash(t, "-m", "rollback", "-s", stashName)
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, filepath.Join("src", "old.txt"), "old original\n")
+	assertFileNotExists(t, projectRootDir, filepath.Join("dst", "new.txt"))
+}
+
+func writeConflictTestStash(t *testing.T, projectRootDir, stashDir string) {
+	t.Helper()
+
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("one\ntwo\nthree\nfour\n"), 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+
+	writeTestStash(t, stashDir, "conflict", Stash{
+		Version: StashVersion,
+		Files: []FileEntry{
+			{
+				Filename: "file.txt",
+				Original: newFileState("one\ntwo\nthree\nfour\n"),
+				Modified: newFileState("one\nTWO\nthree\nfour\n"),
+			},
+		},
+	})
+}
+
+func TestStashRefusesToOverwriteLocalChanges(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+	writeConflictTestStash(t, projectRootDir, stashDir)
+
+	runStash(t, "-m", "apply", "-s", "conflict")
+	utils.RunGlobalCleanup()
+
+	// Hand-edit file after stash was applied
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("one\nTWO\nthree\nFOUR\n"), 0644); err != nil {
+		t.Fatalf("failed to edit project file: %v", err)
+	}
+
+	assertPanics(t, func() {
+		runStash(t, "-m", "rollback", "-s", "conflict")
+	})
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "one\nTWO\nthree\nFOUR\n")
+
+	runStash(t, "-m", "rollback", "-s", "conflict", "-force")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "one\ntwo\nthree\nfour\n")
+}
+
+func TestStashMergesLocalChanges(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+	writeConflictTestStash(t, projectRootDir, stashDir)
+
+	runStash(t, "-m", "apply", "-s", "conflict")
+	utils.RunGlobalCleanup()
+
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("one\nTWO\nthree\nFOUR\n"), 0644); err != nil {
+		t.Fatalf("failed to edit project file: %v", err)
+	}
+
+	runStash(t, "-m", "rollback", "-s", "conflict", "-c", "merge")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "one\ntwo\nthree\nFOUR\n")
+}
+
+func TestStashWritesConflictMarkers(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+	writeConflictTestStash(t, projectRootDir, stashDir)
+
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("one\nlocal\nthree\nfour\n"), 0644); err != nil {
+		t.Fatalf("failed to edit project file: %v", err)
+	}
+
+	runStash(t, "-m", "apply", "-s", "conflict", "-c", "markers")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt",
+		"one\n<<<<<<< current\nlocal\n=======\nTWO\n>>>>>>> stash conflict (apply)\nthree\nfour\n")
+}
+
+func TestCreateStashStoresMetadata(t *testing.T) {
+	_, stashDir := setupTempProject(t)
+
+	stashName := CreateStash(
+		map[string]string{"created.txt": "created contents\n"},
+		nil,
+		nil,
+		nil,
+		Metadata{
+			Operation:        "implement",
+			Mode:             "task",
+			Task:             "Create file\nwith details",
+			Models:           map[string]string{"stage4": "[provider:test]"},
+			PerpetualVersion: "v-test",
+		},
+		"none",
+		newTestLogger(t),
+	)
+
+	stash, err := loadStash(filepath.Join(stashDir, stashName+".json"))
+	if err != nil {
+		t.Fatalf("failed to load created stash: %v", err)
+	}
+	if stash.Version != StashVersion || stash.Metadata == nil {
+		t.Fatalf("expected stash version %d with metadata, got version %d, metadata %v", StashVersion, stash.Version, stash.Metadata)
+	}
+	if stash.Metadata.Task != "Create file\nwith details" || stash.Metadata.PerpetualVersion != "v-test" || stash.Metadata.Models["stage4"] != "[provider:test]" {
+		t.Fatalf("unexpected stash metadata: %+v", *stash.Metadata)
+	}
+	if stash.Metadata.CreatedAt.IsZero() {
+		t.Fatalf("expected stash creation time to be set")
+	}
+	if summary := formatStashSummary(stash); summary != "[task] 1 file(s): Create file" {
+		t.Fatalf("unexpected stash summary: %q", summary)
+	}
+}
+
+func TestStashAppliesPreviousVersion(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+
+	writeTestStash(t, stashDir, "previous-version", Stash{
+		Version: MinStashVersion,
+		Files: []FileEntry{
+			{
+				Filename: "file.txt",
+				Original: FileState{Exists: false},
+				Modified: FileState{Exists: true, Contents: "contents\n"},
+			},
+		},
+	})
+
+	runStash(t, "-m", "apply", "-s", "previous-version")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "contents\n")
+}
+
+func TestCreateStashWithGzipCompression(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("original\n"), 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+
+	stashName := CreateStash(
+		map[string]string{"file.txt": "modified\n"},
+		[]string{"file.txt"},
+		nil,
+		nil,
+		Metadata{},
+		"gzip",
+		newTestLogger(t),
+	)
+
+	data, err := os.ReadFile(filepath.Join(stashDir, stashName+compressedStashFileExt))
+	if err != nil {
+		t.Fatalf("failed to read compressed stash: %v", err)
+	}
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		t.Fatalf("stash file is not gzip-compressed")
+	}
+
+	runStash(t, "-m", "apply", "-s", stashName)
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "modified\n")
+
+	runStash(t, "-m", "rollback")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "original\n")
+}
@@ -0,0 +1,84 @@
+package op_stash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/logging"
+)
+
+// retentionPolicy limits the number, age and total size of stashes, zero values disable the limit
+type retentionPolicy struct {
+	KeepCount    int
+	MaxAge       time.Duration
+	MaxTotalSize int64
+}
+
+func getRetentionPolicy(projectConfig config.Config) retentionPolicy {
+	return retentionPolicy{
+		KeepCount:    projectConfig.Integer(config.K_ProjectStashKeepCount),
+		MaxAge:       time.Duration(projectConfig.Float(config.K_ProjectStashMaxAgeDays) * float64(24*time.Hour)),
+		MaxTotalSize: int64(projectConfig.Float(config.K_ProjectStashMaxTotalSizeMB) * 1024 * 1024),
+	}
+}
+
+// selectStashesToPrune returns stashes that violate retention policy, oldest stashes are removed first.
+// Stashes must be sorted from oldest to newest, the newest stash is always kept. Stashes listed in applied
+// are still applied to the project files and needed to undo the changes, so they are kept and returned separately
+func selectStashesToPrune(stashes []stashFile, policy retentionPolicy, now time.Time, applied []string) ([]stashFile, []stashFile) {
+	if len(stashes) < 2 {
+		return nil, nil
+	}
+
+	var totalSize int64
+	for _, stash := range stashes {
+		totalSize += stash.Size
+	}
+
+	var result, keptApplied []stashFile
+	for _, stash := range stashes[:len(stashes)-1] {
+		remaining := len(stashes) - len(result)
+		overCount := policy.KeepCount > 0 && remaining > policy.KeepCount
+		tooOld := policy.MaxAge > 0 && now.Sub(stash.Created) > policy.MaxAge
+		overSize := policy.MaxTotalSize > 0 && totalSize > policy.MaxTotalSize
+		if !overCount && !tooOld && !overSize {
+			continue
+		}
+		if slices.Contains(applied, stash.Name) {
+			keptApplied = append(keptApplied, stash)
+			continue
+		}
+		result = append(result, stash)
+		totalSize -= stash.Size
+	}
+	return result, keptApplied
+}
+
+// pruneStashes removes stashes that violate retention policy, returns number of removed stashes
+func pruneStashes(stashDir string, policy retentionPolicy, logger logging.ILogger) int {
+	stashes, err := listStashFiles(stashDir)
+	if err != nil {
+		logger.Panicln("Error reading stash directory:", err)
+	}
+	stack, err := loadUndoStack(stashDir)
+	if err != nil {
+		logger.Panicln("Error loading undo stack:", err)
+	}
+	toPrune, keptApplied := selectStashesToPrune(stashes, policy, time.Now(), stack.Applied)
+	for _, stash := range keptApplied {
+		logger.Warnf("Not removing stash %s, it is still applied, roll it back with '-m rollback' or '-m undo' first", stash.Name)
+	}
+	removed := 0
+	for _, stash := range toPrune {
+		logger.Infoln("Removing stash:", stash.Name)
+		if err := os.Remove(filepath.Join(stashDir, stash.FileName)); err != nil {
+			logger.Errorf("Failed to remove stash %s: %v", stash.Name, err)
+			continue
+		}
+		removed++
+	}
+	return removed
+}
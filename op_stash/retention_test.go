@@ -0,0 +1,96 @@
+package op_stash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSelectStashesToPrune(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	stashes := []stashFile{
+		{Name: "s1", Size: 100, Created: now.Add(-30 * 24 * time.Hour)},
+		{Name: "s2", Size: 100, Created: now.Add(-10 * 24 * time.Hour)},
+		{Name: "s3", Size: 100, Created: now.Add(-2 * 24 * time.Hour)},
+		{Name: "s4", Size: 100, Created: now.Add(-time.Hour)},
+	}
+	tests := []struct {
+		name     string
+		policy   retentionPolicy
+		applied  []string
+		expected []string
+		kept     []string
+	}{
+		{name: "no limits", policy: retentionPolicy{}, expected: nil},
+		{name: "keep count", policy: retentionPolicy{KeepCount: 2}, expected: []string{"s1", "s2"}},
+		{name: "max age", policy: retentionPolicy{MaxAge: 7 * 24 * time.Hour}, expected: []string{"s1", "s2"}},
+		{name: "max total size", policy: retentionPolicy{MaxTotalSize: 250}, expected: []string{"s1", "s2"}},
+		{name: "newest stash is kept", policy: retentionPolicy{MaxAge: time.Minute, MaxTotalSize: 1}, expected: []string{"s1", "s2", "s3"}},
+		{name: "applied stash is kept", policy: retentionPolicy{KeepCount: 2}, applied: []string{"s1", "s4"}, expected: []string{"s2", "s3"}, kept: []string{"s1"}},
+		{name: "applied stash counts to size", policy: retentionPolicy{MaxTotalSize: 250}, applied: []string{"s2"}, expected: []string{"s1", "s3"}, kept: []string{"s2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names, keptNames []string
+			toPrune, kept := selectStashesToPrune(stashes, tt.policy, now, tt.applied)
+			for _, stash := range toPrune {
+				names = append(names, stash.Name)
+			}
+			for _, stash := range kept {
+				keptNames = append(keptNames, stash.Name)
+			}
+			if !slices.Equal(names, tt.expected) || !slices.Equal(keptNames, tt.kept) {
+				t.Errorf("selectStashesToPrune() = %v, %v, want %v, %v", names, keptNames, tt.expected, tt.kept)
+			}
+		})
+	}
+}
+
+func TestPruneStashes(t *testing.T) {
+	stashDir := t.TempDir()
+	for _, fileName := range []string{"2025-01-01_10-00-00.json", "2025-01-02_10-00-00.json.gz", "2025-01-03_10-00-00.json", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(stashDir, fileName), []byte("{}"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+
+	if removed := pruneStashes(stashDir, retentionPolicy{KeepCount: 1}, newTestLogger(t)); removed != 2 {
+		t.Fatalf("pruneStashes() removed %d stashes, want 2", removed)
+	}
+
+	stashes, err := listStashFiles(stashDir)
+	if err != nil {
+		t.Fatalf("failed to list stashes: %v", err)
+	}
+	if len(stashes) != 1 || stashes[0].Name != "2025-01-03_10-00-00" {
+		t.Fatalf("unexpected remaining stashes: %v", stashes)
+	}
+	if _, err := os.Stat(filepath.Join(stashDir, "notes.txt")); err != nil {
+		t.Fatalf("non-stash file must be kept: %v", err)
+	}
+}
+
+func TestPruneStashesKeepsAppliedStash(t *testing.T) {
+	stashDir := t.TempDir()
+	for _, fileName := range []string{"2025-01-01_10-00-00.json", "2025-01-02_10-00-00.json", "2025-01-03_10-00-00.json"} {
+		if err := os.WriteFile(filepath.Join(stashDir, fileName), []byte("{}"), 0644); err != nil {
+			t.Fatalf("failed to create test file: %v", err)
+		}
+	}
+	if err := saveUndoStack(stashDir, undoStack{Applied: []string{"2025-01-01_10-00-00"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed := pruneStashes(stashDir, retentionPolicy{KeepCount: 1}, newTestLogger(t)); removed != 1 {
+		t.Fatalf("pruneStashes() removed %d stashes, want 1", removed)
+	}
+	stack, err := loadUndoStack(stashDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(stack.Applied, []string{"2025-01-01_10-00-00"}) {
+		t.Errorf("applied stash is removed, undo stack: %v", stack.Applied)
+	}
+}
@@ -0,0 +1,87 @@
+package op_stash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// File inside the stash directory, names starting with dot are not treated as stashes
+const undoStackFileName = ".undo_stack.json"
+
+// undoStack tracks order in which stashes were applied, so they can be undone and redone in the correct sequence
+type undoStack struct {
+	// Currently applied stashes, from oldest to newest
+	Applied []string `json:"applied"`
+	// Stashes rolled back with undo, most recently undone is the last
+	Undone []string `json:"undone"`
+}
+
+func loadUndoStack(stashDir string) (undoStack, error) {
+	var stack undoStack
+	if err := utils.LoadJsonFile(filepath.Join(stashDir, undoStackFileName), &stack); err != nil {
+		if os.IsNotExist(err) {
+			return undoStack{}, nil
+		}
+		return undoStack{}, err
+	}
+	// Stashes may be removed by prune operation or manually
+	exists := func(name string) bool { return findStashFile(stashDir, name) != "" }
+	stack.Applied = slices.DeleteFunc(stack.Applied, func(name string) bool { return !exists(name) })
+	stack.Undone = slices.DeleteFunc(stack.Undone, func(name string) bool { return !exists(name) })
+	return stack, nil
+}
+
+func saveUndoStack(stashDir string, stack undoStack) error {
+	return utils.SaveJsonFile(filepath.Join(stashDir, undoStackFileName), stack)
+}
+
+// pushApplied records stash as the newest applied one. New changes make previously undone stashes obsolete,
+// so redo history is cleared unless stash is re-applied by redo itself
+func (s *undoStack) pushApplied(name string, redo bool) {
+	s.removeApplied(name)
+	s.Applied = append(s.Applied, name)
+	if redo {
+		s.Undone = slices.DeleteFunc(s.Undone, func(undone string) bool { return undone == name })
+	} else {
+		s.Undone = nil
+	}
+}
+
+// removeApplied records stash as rolled back
+func (s *undoStack) removeApplied(name string) {
+	s.Applied = slices.DeleteFunc(s.Applied, func(applied string) bool { return applied == name })
+}
+
+// pushUndone records stash as rolled back with undo, so it can be re-applied with redo
+func (s *undoStack) pushUndone(name string) {
+	s.removeApplied(name)
+	s.Undone = append(s.Undone, name)
+}
+
+// findNewerOverlappingStash returns the name of the stash applied after the selected one and touching any of the files,
+// and list of shared files. Rolling back the selected stash first would overwrite changes made by such stash
+func findNewerOverlappingStash(stashDir string, stack undoStack, name string, files []string) (string, []string, error) {
+	pos := slices.Index(stack.Applied, name)
+	if pos < 0 {
+		return "", nil, nil
+	}
+	for i := len(stack.Applied) - 1; i > pos; i-- {
+		newer, err := loadStash(findStashFile(stashDir, stack.Applied[i]))
+		if err != nil {
+			return "", nil, err
+		}
+		var shared []string
+		for _, entry := range newer.Files {
+			if slices.Contains(files, entry.Filename) {
+				shared = append(shared, entry.Filename)
+			}
+		}
+		if len(shared) > 0 {
+			return stack.Applied[i], shared, nil
+		}
+	}
+	return "", nil, nil
+}
@@ -0,0 +1,116 @@
+package op_stash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+func newStackTestStash(filename, original, modified string) Stash {
+	return Stash{
+		Version: StashVersion,
+		Files: []FileEntry{
+			{Filename: filename, Original: newFileState(original), Modified: newFileState(modified)},
+		},
+	}
+}
+
+func loadTestUndoStack(t *testing.T, stashDir string) undoStack {
+	t.Helper()
+
+	stack, err := loadUndoStack(stashDir)
+	if err != nil {
+		t.Fatalf("failed to load undo stack: %v", err)
+	}
+	return stack
+}
+
+func TestUndoStackOperations(t *testing.T) {
+	var stack undoStack
+	stack.pushApplied("s1", false)
+	stack.pushApplied("s2", false)
+	stack.pushUndone("s2")
+	if !slices.Equal(stack.Applied, []string{"s1"}) || !slices.Equal(stack.Undone, []string{"s2"}) {
+		t.Fatalf("unexpected stack after undo: %+v", stack)
+	}
+
+	stack.pushApplied("s2", true)
+	if !slices.Equal(stack.Applied, []string{"s1", "s2"}) || len(stack.Undone) != 0 {
+		t.Fatalf("unexpected stack after redo: %+v", stack)
+	}
+
+	stack.pushUndone("s2")
+	stack.pushApplied("s3", false)
+	if !slices.Equal(stack.Applied, []string{"s1", "s3"}) || len(stack.Undone) != 0 {
+		t.Fatalf("new stash must clear redo history: %+v", stack)
+	}
+}
+
+func TestLoadUndoStackDropsMissingStashes(t *testing.T) {
+	_, stashDir := setupTempProject(t)
+	writeTestStash(t, stashDir, "2025-01-01_10-00-00", newStackTestStash("file.txt", "a\n", "b\n"))
+	if err := saveUndoStack(stashDir, undoStack{Applied: []string{"2025-01-01_09-00-00", "2025-01-01_10-00-00"}, Undone: []string{"removed"}}); err != nil {
+		t.Fatalf("failed to save undo stack: %v", err)
+	}
+
+	stack := loadTestUndoStack(t, stashDir)
+	if !slices.Equal(stack.Applied, []string{"2025-01-01_10-00-00"}) || len(stack.Undone) != 0 {
+		t.Fatalf("unexpected stack: %+v", stack)
+	}
+
+	stashes, err := listStashFiles(stashDir)
+	if err != nil || len(stashes) != 1 {
+		t.Fatalf("undo stack file must not be listed as stash: %v, %v", stashes, err)
+	}
+}
+
+func TestStashUndoRedoInOrder(t *testing.T) {
+	projectRootDir, stashDir := setupTempProject(t)
+	if err := os.WriteFile(filepath.Join(projectRootDir, "file.txt"), []byte("v1\n"), 0644); err != nil {
+		t.Fatalf("failed to create project file: %v", err)
+	}
+	// Newer stash has the older name, so "latest" does not match the order of application
+	writeTestStash(t, stashDir, "2025-01-02_10-00-00", newStackTestStash("file.txt", "v1\n", "v2\n"))
+	writeTestStash(t, stashDir, "2025-01-01_10-00-00", newStackTestStash("file.txt", "v2\n", "v3\n"))
+
+	runStash(t, "-m", "apply", "-s", "2025-01-02_10-00-00")
+	utils.RunGlobalCleanup()
+	runStash(t, "-m", "apply", "-s", "2025-01-01_10-00-00")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v3\n")
+
+	// Rolling back older stash would clobber changes of the newer one
+	assertPanics(t, func() {
+		runStash(t, "-m", "rollback", "-s", "2025-01-02_10-00-00")
+	})
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v3\n")
+
+	runStash(t, "-m", "undo")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v2\n")
+	runStash(t, "-m", "undo")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v1\n")
+
+	runStash(t, "-m", "redo")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v2\n")
+
+	stack := loadTestUndoStack(t, stashDir)
+	if !slices.Equal(stack.Applied, []string{"2025-01-02_10-00-00"}) || !slices.Equal(stack.Undone, []string{"2025-01-01_10-00-00"}) {
+		t.Fatalf("unexpected stack: %+v", stack)
+	}
+
+	runStash(t, "-m", "redo")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v3\n")
+
+	// Nothing left to redo
+	runStash(t, "-m", "redo")
+	utils.RunGlobalCleanup()
+	assertFileContents(t, projectRootDir, "file.txt", "v3\n")
+}
@@ -0,0 +1,141 @@
+package op_stash
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+const stashFileExt = ".json"
+const compressedStashFileExt = ".json.gz"
+
+const stashCompressionGzip = "gzip"
+
+// stash names are based on creation time, used when file time is not available
+const stashNameTimeLayout = "2006-01-02_15-04-05"
+
+type stashFile struct {
+	Name     string
+	FileName string
+	Size     int64
+	Created  time.Time
+}
+
+func isStashFileName(fileName string) bool {
+	// Hidden files inside the stash directory hold internal state (see undoStackFileName)
+	if strings.HasPrefix(fileName, ".") {
+		return false
+	}
+	return strings.HasSuffix(fileName, stashFileExt) || strings.HasSuffix(fileName, compressedStashFileExt)
+}
+
+func trimStashFileExt(fileName string) string {
+	if name, found := strings.CutSuffix(fileName, compressedStashFileExt); found {
+		return name
+	}
+	return strings.TrimSuffix(fileName, stashFileExt)
+}
+
+// findStashFile returns path to the stash file with provided name (with or without extension), or empty string if not found
+func findStashFile(stashDir, name string) string {
+	candidates := []string{name}
+	if !isStashFileName(name) {
+		candidates = []string{name + stashFileExt, name + compressedStashFileExt}
+	}
+	for _, candidate := range candidates {
+		if info, err := os.Stat(filepath.Join(stashDir, candidate)); err == nil && info.Mode().IsRegular() {
+			return filepath.Join(stashDir, candidate)
+		}
+	}
+	return ""
+}
+
+// getUniqueStashName adds numeric suffix to the stash name if stash with the same name already exists
+func getUniqueStashName(stashDir, baseName string) string {
+	name := baseName
+	for i := 1; findStashFile(stashDir, name) != ""; i++ {
+		name = fmt.Sprintf("%s_%d", baseName, i)
+	}
+	return name
+}
+
+// listStashFiles returns all stash files from the stash directory, sorted from oldest to newest
+func listStashFiles(stashDir string) ([]stashFile, error) {
+	entries, err := os.ReadDir(stashDir)
+	if err != nil {
+		return nil, err
+	}
+	var stashes []stashFile
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !isStashFileName(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		name := trimStashFileExt(entry.Name())
+		created := info.ModTime()
+		if len(name) >= len(stashNameTimeLayout) {
+			if parsed, err := time.ParseInLocation(stashNameTimeLayout, name[:len(stashNameTimeLayout)], time.Local); err == nil {
+				created = parsed
+			}
+		}
+		stashes = append(stashes, stashFile{Name: name, FileName: entry.Name(), Size: info.Size(), Created: created})
+	}
+	slices.SortStableFunc(stashes, func(a, b stashFile) int { return strings.Compare(a.Name, b.Name) })
+	return stashes, nil
+}
+
+// loadStash reads plain or gzip-compressed stash file
+func loadStash(stashFile string) (Stash, error) {
+	var stash Stash
+	data, err := os.ReadFile(stashFile)
+	if err != nil {
+		return stash, err
+	}
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return stash, err
+		}
+		defer reader.Close()
+		if err := json.NewDecoder(reader).Decode(&stash); err != nil {
+			return stash, err
+		}
+	} else if err := utils.LoadJsonFile(stashFile, &stash); err != nil {
+		return stash, err
+	}
+	if err := validateStash(stash); err != nil {
+		return stash, err
+	}
+	return stash, nil
+}
+
+// saveStash writes stash to the stash directory, returns name of created file
+func saveStash(stashDir, name string, stash Stash, compression string) (string, error) {
+	if compression != stashCompressionGzip {
+		fileName := name + stashFileExt
+		return fileName, utils.SaveJsonFile(filepath.Join(stashDir, fileName), stash)
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	encoder := json.NewEncoder(writer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(stash); err != nil {
+		return "", err
+	}
+	if err := writer.Close(); err != nil {
+		return "", err
+	}
+	fileName := name + compressedStashFileExt
+	return fileName, os.WriteFile(filepath.Join(stashDir, fileName), buffer.Bytes(), 0644)
+}
@@ -56,19 +56,19 @@ func Stage1(
 		logger.Panicln("Failed to create stage1 LLM connector:", err)
 	}
 
-	var messages []llm.Message
-	// Create project description request message
-	if projectDesc != "" {
-		// Create prompt
-		request := llm.AddPlainTextFragment(llm.NewMessage(llm.UserRequest), prCfg.String(config.K_ProjectDescriptionPrompt))
-		request = llm.AddPlainTextFragment(request, projectDesc)
-		messages = append(messages, request)
-		logger.Debugln("Created project description request")
-		// Create response
-		response := llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), prCfg.String(config.K_ProjectDescriptionResponse))
-		messages = append(messages, response)
-		logger.Debugln("Created simulated project description response")
-	}
+	headMessages, preQueriesMessages, analysisRequest := composeStage1Messages(
+		projectRootDir,
+		prCfg,
+		projectDesc,
+		preQueriesPrompts,
+		preQueriesBodies,
+		preQueriesResponses,
+		mainPrompt,
+		mainPromptBody,
+		targetFiles,
+		logger)
+
+	messages := utils.NewSlice(headMessages...)
 	// Create project-index request message
 	indexRequest := llm.ComposeMessageWithAnnotations(
 		prCfg.String(config.K_ProjectIndexPrompt),
@@ -83,8 +83,63 @@ func Stage1(
 	indexResponse := llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), prCfg.String(config.K_ProjectIndexResponse))
 	messages = append(messages, indexResponse)
 	logger.Debugln("Created project-index simulated response message")
+	messages = append(messages, preQueriesMessages...)
+
+	if totalPasses < connector.GetMinPrefixRepsForCaching() {
+		safeForCaching = false
+	}
+	// We can benefit from caching if stage 1 can be called multiple times with same input parameters.
+	// Set safeForCaching marker when calling stage 1 to inform about this condition where we can benefit from caching.
+	analysisRequest.CacheBreakpoint = safeForCaching
+
+	messages = append(messages, analysisRequest)
+	logger.Debugln("Created main request message")
+
+	logger.Notifyln("Running stage1: find project files for review, pass", pass)
+	debugString := connector.GetDebugString()
+	logger.Notifyln(debugString)
+	llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== %s (stage 1): %s\n\n\n", cases.Title(language.English, cases.Compact).String(opName), debugString))
+
+	// Perform LLM query
+	filesForReviewRaw := queryFileList(connector, prCfg, messages, safeForCaching, logger)
+	// Filter all requested files through project file-list, return only files found in project file-list
+	filesForReview := filterRequestedProjectFiles(projectRootDir, filesForReviewRaw, targetFiles, allProjectFiles, logger)
+	if len(allProjectFiles) > 0 && len(filesForReview)+len(targetFiles) == 0 {
+		logger.Errorln("Stage1 returned no project files relevant to the task, this may be a LLM error, ensure your task is correct and retry if needed")
+	}
+	return filesForReview
+}
+
+// composeStage1Messages creates project description and pre-queries messages with simulated responses,
+// and the main request message with contents of target files
+func composeStage1Messages(
+	projectRootDir string,
+	prCfg config.Config,
+	projectDesc string,
+	preQueriesPrompts []string,
+	preQueriesBodies []string,
+	preQueriesResponses []string,
+	mainPrompt string,
+	mainPromptBody string,
+	targetFiles []string,
+	logger logging.ILogger) ([]llm.Message, []llm.Message, llm.Message) {
+
+	var headMessages []llm.Message
+	// Create project description request message
+	if projectDesc != "" {
+		// Create prompt
+		request := llm.AddPlainTextFragment(llm.NewMessage(llm.UserRequest), prCfg.String(config.K_ProjectDescriptionPrompt))
+		request = llm.AddPlainTextFragment(request, projectDesc)
+		headMessages = append(headMessages, request)
+		logger.Debugln("Created project description request")
+		// Create response
+		response := llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), prCfg.String(config.K_ProjectDescriptionResponse))
+		headMessages = append(headMessages, response)
+		logger.Debugln("Created simulated project description response")
+	}
 
 	// Create extra history of queries with LLM responses that will be inserted before main query
+	var preQueriesMessages []llm.Message
 	for i := range preQueriesPrompts {
 		if preQueriesBodies[i] == "" {
 			continue
@@ -92,11 +147,11 @@ func Stage1(
 		// Create prompt
 		request := llm.AddPlainTextFragment(llm.NewMessage(llm.UserRequest), preQueriesPrompts[i])
 		request = llm.AddPlainTextFragment(request, preQueriesBodies[i])
-		messages = append(messages, request)
+		preQueriesMessages = append(preQueriesMessages, request)
 		logger.Debugf("Created pre-request message #%d", i)
 		// Create response
 		response := llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), preQueriesResponses[i])
-		messages = append(messages, response)
+		preQueriesMessages = append(preQueriesMessages, response)
 		logger.Debugf("Created simulated response for pre-request message #%d", i)
 	}
 
@@ -109,22 +164,17 @@ func Stage1(
 	for _, item := range targetFiles {
 		analysisRequest = llm.AppendSourceFileToMessage(analysisRequest, projectRootDir, item, prCfg.Tags(config.K_ProjectFilenameTags), logger)
 	}
-	if totalPasses < connector.GetMinPrefixRepsForCaching() {
-		safeForCaching = false
-	}
-	// We can benefit from caching if stage 1 can be called multiple times with same input parameters.
-	// Set safeForCaching marker when calling stage 1 to inform about this condition where we can benefit from caching.
-	analysisRequest.CacheBreakpoint = safeForCaching
-
-	messages = append(messages, analysisRequest)
-	logger.Debugln("Created main request message")
+	return headMessages, preQueriesMessages, analysisRequest
+}
 
-	logger.Notifyln("Running stage1: find project files for review, pass", pass)
-	debugString := connector.GetDebugString()
-	logger.Notifyln(debugString)
-	llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== %s (stage 1): %s\n\n\n", cases.Title(language.English, cases.Compact).String(opName), debugString))
+// queryFileList performs stage 1 query and parses list of files (or directories) from LLM response
+func queryFileList(
+	connector llm.LLMConnector,
+	prCfg config.Config,
+	messages []llm.Message,
+	safeForCaching bool,
+	logger logging.ILogger) []string {
 
-	// Perform LLM query
 	var filesForReviewRaw []string
 	onFailRetriesLeft := max(connector.GetOnFailureRetryLimit(), 1)
 	for ; onFailRetriesLeft >= 0; onFailRetriesLeft-- {
@@ -178,12 +228,7 @@ func Stage1(
 		logger.Debugln("Parsed list of files for review from LLM response")
 		break
 	}
-	// Filter all requested files through project file-list, return only files found in project file-list
-	filesForReview := filterRequestedProjectFiles(projectRootDir, filesForReviewRaw, targetFiles, allProjectFiles, logger)
-	if len(allProjectFiles) > 0 && len(filesForReview)+len(targetFiles) == 0 {
-		logger.Errorln("Stage1 returned no project files relevant to the task, this may be a LLM error, ensure your task is correct and retry if needed")
-	}
-	return filesForReview
+	return filesForReviewRaw
 }
 
 func filterRequestedProjectFiles(projectRootDir string, llmRequestedFiles []string, userRequestedFiles []string, projectFiles []string, logger logging.ILogger) []string {
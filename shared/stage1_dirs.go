@@ -0,0 +1,231 @@
+package shared
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/llm"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+)
+
+// Stage1SelectDirs runs directory selection for stage 1 once for all passes, so it is not repeated with the same input
+// for every pass: directories are selected from the union of files preselected for all passes,
+// and every pass is narrowed to files from selected directories. Pass left with no files gets all selected files
+func Stage1SelectDirs(
+	opName string,
+	projectRootDir string,
+	perpetualDir string,
+	prCfg config.Config,
+	opCfg config.Config,
+	filesToMdLangMappings utils.TextMatcher[string],
+	preselectedProjectFiles [][]string,
+	projectDesc string,
+	annotations map[string]string,
+	preQueriesPrompts []string,
+	preQueriesBodies []string,
+	preQueriesResponses []string,
+	mainPrompt string,
+	mainPromptBody string,
+	targetFiles []string,
+	logger logging.ILogger) [][]string {
+
+	dirSummariesFileCount := prCfg.Integer(config.K_ProjectDirSummariesFileCount)
+	var allPreselectedFiles []string
+	seen := map[string]bool{}
+	for _, files := range preselectedProjectFiles {
+		for _, file := range files {
+			if !seen[file] {
+				seen[file] = true
+				allPreselectedFiles = append(allPreselectedFiles, file)
+			}
+		}
+	}
+	if dirSummariesFileCount < 1 || len(allPreselectedFiles) < dirSummariesFileCount {
+		return preselectedProjectFiles
+	}
+	sort.Strings(allPreselectedFiles)
+
+	connector, err := llm.NewLLMConnector(
+		opName+"_stage1",
+		opCfg.String(config.K_SystemPrompt),
+		opCfg.String(config.K_SystemPromptAck),
+		filesToMdLangMappings,
+		llm.GetSimpleRawMessageLogger(perpetualDir))
+	if err != nil {
+		logger.Panicln("Failed to create stage1 LLM connector:", err)
+	}
+	headMessages, preQueriesMessages, analysisRequest := composeStage1Messages(
+		projectRootDir,
+		prCfg,
+		projectDesc,
+		preQueriesPrompts,
+		preQueriesBodies,
+		preQueriesResponses,
+		mainPrompt,
+		mainPromptBody,
+		targetFiles,
+		logger)
+
+	selectedFiles := stage1SelectDirs(
+		opName,
+		projectRootDir,
+		perpetualDir,
+		prCfg,
+		connector,
+		allPreselectedFiles,
+		annotations,
+		headMessages,
+		preQueriesMessages,
+		analysisRequest,
+		logger)
+	if len(selectedFiles) == len(allPreselectedFiles) {
+		return preselectedProjectFiles
+	}
+	return narrowPreselectedFiles(preselectedProjectFiles, selectedFiles)
+}
+
+// narrowPreselectedFiles keeps only selected files in the file list of every pass
+func narrowPreselectedFiles(preselectedProjectFiles [][]string, selectedFiles []string) [][]string {
+	selected := map[string]bool{}
+	for _, file := range selectedFiles {
+		selected[file] = true
+	}
+	result := make([][]string, len(preselectedProjectFiles))
+	for pass, files := range preselectedProjectFiles {
+		for _, file := range files {
+			if selected[file] {
+				result[pass] = append(result[pass], file)
+			}
+		}
+		if len(result[pass]) < 1 {
+			result[pass] = utils.NewSlice(selectedFiles...)
+		}
+	}
+	return result
+}
+
+// stage1SelectDirs narrows the list of files for stage 1 for large projects: LLM is provided with summaries of project directories
+// (generated by `annotate` operation) instead of annotations for every file, and selects relevant directories first.
+// Returns files from selected directories, or all preselected files if project is small or directory summaries are not available
+func stage1SelectDirs(
+	opName string,
+	projectRootDir string,
+	perpetualDir string,
+	prCfg config.Config,
+	connector llm.LLMConnector,
+	preselectedProjectFiles []string,
+	annotations map[string]string,
+	headMessages []llm.Message,
+	preQueriesMessages []llm.Message,
+	analysisRequest llm.Message,
+	logger logging.ILogger) []string {
+
+	dirSummariesFileCount := prCfg.Integer(config.K_ProjectDirSummariesFileCount)
+	if dirSummariesFileCount < 1 || len(preselectedProjectFiles) < dirSummariesFileCount {
+		return preselectedProjectFiles
+	}
+
+	unlockAnnotations := utils.LockProjectResource(perpetualDir, utils.LockResourceAnnotations, false, logger)
+	dirSummaries, _ := utils.LoadDirSummaries(filepath.Join(perpetualDir, utils.DirSummariesFileName))
+	unlockAnnotations()
+	if len(dirSummaries) < 1 {
+		logger.Warnln("Directory summaries not found, run annotate operation to generate them, using annotations for all files")
+		return preselectedProjectFiles
+	}
+
+	dirTree := utils.NewDirTree(preselectedProjectFiles)
+	dirs, files := dirTree.GetIndexEntries(prCfg.Integer(config.K_ProjectDirIndexMaxEntries))
+	if len(dirs) < 1 {
+		return preselectedProjectFiles
+	}
+
+	// Directories are marked with trailing path separator, so LLM can distinguish them from files
+	var entries []string
+	descriptions := map[string]string{}
+	for _, dir := range dirs {
+		entry := dir + string(filepath.Separator)
+		entries = append(entries, entry)
+		descriptions[entry] = dirSummaries[dir]
+	}
+	for _, file := range files {
+		entries = append(entries, file)
+		descriptions[file] = annotations[file]
+	}
+
+	messages := utils.NewSlice(headMessages...)
+	indexRequest := llm.ComposeMessageWithAnnotations(
+		prCfg.String(config.K_ProjectDirIndexPrompt),
+		entries,
+		prCfg.Tags(config.K_ProjectFilenameTags),
+		descriptions,
+		logger)
+	indexResponse := llm.AddPlainTextFragment(llm.NewMessage(llm.SimulatedAIResponse), prCfg.String(config.K_ProjectIndexResponse))
+	selectRequest := llm.AddPlainTextFragment(analysisRequest, prCfg.String(config.K_ProjectDirSelectPrompt))
+	selectRequest.CacheBreakpoint = false
+	messages = append(messages, indexRequest, indexResponse)
+	messages = append(messages, preQueriesMessages...)
+	messages = append(messages, selectRequest)
+	logger.Debugln("Created directory selection request messages, directories:", len(dirs), "files:", len(files))
+
+	logger.Notifyln("Running stage1: find project directories for review")
+	llm.GetSimpleRawMessageLogger(perpetualDir)(fmt.Sprintf("=== %s (stage 1, directories): %s\n\n\n", cases.Title(language.English, cases.Compact).String(opName), connector.GetDebugString()))
+
+	selectedFiles := filterRequestedDirEntries(projectRootDir, queryFileList(connector, prCfg, messages, false, logger), dirTree, dirs, preselectedProjectFiles, logger)
+	if len(selectedFiles) < 1 {
+		logger.Warnln("No project directories selected by LLM, using annotations for all files")
+		return preselectedProjectFiles
+	}
+	logger.Infof("Selected %d of %d files for stage 1", len(selectedFiles), len(preselectedProjectFiles))
+	return selectedFiles
+}
+
+// filterRequestedDirEntries converts directories and files requested by LLM to the list of project files,
+// directory is expanded to all files inside it. Files are returned in the order of project files list
+func filterRequestedDirEntries(
+	projectRootDir string,
+	llmRequestedEntries []string,
+	dirTree *utils.DirTree,
+	dirs []string,
+	projectFiles []string,
+	logger logging.ILogger) []string {
+
+	selected := map[string]bool{}
+	logger.Infoln("Directories and files requested by LLM:")
+	for _, entry := range llmRequestedEntries {
+		entry = strings.TrimSpace(utils.ConvertFilePathToOSFormat(entry))
+		entry = strings.TrimRight(entry, string(filepath.Separator))
+		if entry == "" {
+			continue
+		}
+		entry, err := utils.MakePathRelative(projectRootDir, entry, true)
+		if err != nil {
+			logger.Errorln("Failed to validate directory or filename requested by LLM:", entry)
+			continue
+		}
+		if dir, found := utils.CaseInsensitiveFileSearch(entry, dirs); found {
+			logger.Infoln(dir + string(filepath.Separator))
+			for _, file := range dirTree.GetFilesRecursive(dir) {
+				selected[file] = true
+			}
+		} else if file, found := utils.CaseInsensitiveFileSearch(entry, projectFiles); found {
+			logger.Infoln(file)
+			selected[file] = true
+		} else {
+			logger.Warnln("Directory or file requested by LLM not found in project structure:", entry)
+		}
+	}
+
+	var result []string
+	for _, file := range projectFiles {
+		if selected[file] {
+			result = append(result, file)
+		}
+	}
+	return result
+}
@@ -0,0 +1,110 @@
+package shared
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/DarkCaster/Perpetual/config"
+	"github.com/DarkCaster/Perpetual/logging"
+	"github.com/DarkCaster/Perpetual/utils"
+)
+
+// UpdateSymbols loads local symbol index, extracts symbols from project files changed since the previous run
+// and saves the index back. Symbol extraction does not use LLM, so the index is up to date even when annotations are not
+func UpdateSymbols(
+	projectRootDir string,
+	perpetualDir string,
+	prCfg config.Config,
+	fileNames []string,
+	logger logging.ILogger) map[string][]utils.Symbol {
+
+	logger.Traceln("UpdateSymbols: Starting")
+	defer logger.Traceln("UpdateSymbols: Finished")
+
+	fileChecksums, err := utils.CalculateFilesChecksums(projectRootDir, fileNames)
+	if err != nil {
+		logger.Panicln("Error getting project-files checksums:", err)
+	}
+
+	unlockSymbols := utils.LockProjectResource(perpetualDir, utils.LockResourceSymbols, true, logger)
+	defer unlockSymbols()
+
+	symbolsFilePath := filepath.Join(perpetualDir, utils.SymbolsFileName)
+	oldSymbols, oldChecksums := utils.LoadSymbols(symbolsFilePath)
+
+	symbolsRx := prCfg.TextMatcherString(config.K_ProjectSymbolsRx)
+	symbols := map[string][]utils.Symbol{}
+	checksums := map[string]string{}
+	changed := len(oldChecksums) != len(fileNames)
+	for _, file := range fileNames {
+		rxString := ""
+		if matched, values, _ := symbolsRx.TryMatch(file); matched {
+			rxString = values[0]
+		}
+		checksums[file] = utils.GetSymbolsChecksum(fileChecksums[file], rxString)
+		if fileSymbols, exist := oldSymbols[file]; exist && oldChecksums[file] == checksums[file] {
+			symbols[file] = fileSymbols
+			continue
+		}
+		changed = true
+		fileContents, wrn, err := utils.LoadTextFile(filepath.Join(projectRootDir, file))
+		if err != nil {
+			logger.Errorf("Failed to read file %s: %s", file, err)
+			delete(checksums, file)
+			continue
+		}
+		if wrn != "" {
+			logger.Warnf("%s: %s", file, wrn)
+		}
+		var extractorRx *regexp.Regexp
+		if rxString != "" {
+			extractorRx = regexp.MustCompile(rxString)
+		}
+		symbols[file] = utils.ExtractSymbols(file, fileContents, extractorRx)
+		logger.Debugf("Extracted %d symbols from file: %s", len(symbols[file]), file)
+	}
+
+	if changed {
+		logger.Debugln("Saving symbol index")
+		if err := utils.SaveSymbols(symbolsFilePath, checksums, symbols); err != nil {
+			logger.Panicln("Failed to save symbol index:", err)
+		}
+	}
+	return symbols
+}
+
+// AddSymbolsToAnnotations creates file descriptions for the project index from annotations and listings of symbols
+// declared in files, so stage 1 can select files by their symbols even when annotations are stale or missing
+func AddSymbolsToAnnotations(annotations map[string]string, symbols map[string][]utils.Symbol, prCfg config.Config) map[string]string {
+	maxCount := prCfg.Integer(config.K_ProjectSymbolsMaxCount)
+	if maxCount < 1 {
+		return annotations
+	}
+	result := make(map[string]string, len(annotations))
+	for file, annotation := range annotations {
+		result[file] = annotation
+	}
+	for file, fileSymbols := range symbols {
+		listing := utils.FormatSymbols(fileSymbols, maxCount)
+		if listing == "" {
+			continue
+		}
+		description := prCfg.String(config.K_ProjectSymbolsHeader) + "\n" + listing
+		if annotation := strings.TrimSpace(result[file]); annotation != "" {
+			description = annotation + "\n\n" + description
+		}
+		result[file] = description
+	}
+	return result
+}
+
+// FormatSymbolDefinitions creates a list of symbol definitions with their locations for use in LLM requests
+func FormatSymbolDefinitions(definitions []utils.SymbolDefinition) string {
+	var lines []string
+	for _, definition := range definitions {
+		lines = append(lines, fmt.Sprintf("- `%s` (%s): %s:%d", definition.Symbol.Name, definition.Symbol.Kind, definition.File, definition.Symbol.Line))
+	}
+	return strings.Join(lines, "\n")
+}
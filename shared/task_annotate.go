@@ -54,6 +54,10 @@ func TaskAnnotate(targetFiles []string, logger logging.ILogger) []string {
 		if wrn != "" {
 			logger.Warnf("%s: %s", filePath, wrn)
 		}
+		fileContents, redacted := llm.RedactSecrets(fileContents)
+		if redacted > 0 {
+			logger.Warnf("Redacted %d secret(s) in file: %s", redacted, filePath)
+		}
 
 		annotateRequest := llm.AddPlainTextFragment(
 			llm.NewMessage(llm.UserRequest),
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const DirSummariesFileName = ".dir_summaries.json"
+
+type dirSummaryEntry struct {
+	Dirname  string `json:"dirname"`
+	Checksum string `json:"checksum"`
+	Summary  string `json:"summary"`
+}
+
+// DirTree describes directory structure of the project files, project root directory is represented by empty string
+type DirTree struct {
+	// Files located directly inside directory
+	Files map[string][]string
+	// Direct subdirectories of directory
+	Dirs map[string][]string
+	// Count of files inside directory and all its subdirectories
+	FileCount map[string]int
+}
+
+func getParentDir(path string) string {
+	parent := filepath.Dir(path)
+	if parent == "." || parent == string(filepath.Separator) {
+		return ""
+	}
+	return parent
+}
+
+// NewDirTree builds directory structure from the list of project files
+func NewDirTree(files []string) *DirTree {
+	tree := &DirTree{
+		Files:     map[string][]string{},
+		Dirs:      map[string][]string{},
+		FileCount: map[string]int{},
+	}
+	for _, file := range files {
+		dir := getParentDir(file)
+		tree.Files[dir] = append(tree.Files[dir], file)
+		// Register directory and all its parents
+		for {
+			if _, exist := tree.FileCount[dir]; !exist && dir != "" {
+				parent := getParentDir(dir)
+				tree.Dirs[parent] = append(tree.Dirs[parent], dir)
+			}
+			tree.FileCount[dir]++
+			if dir == "" {
+				break
+			}
+			dir = getParentDir(dir)
+		}
+	}
+	for dir := range tree.FileCount {
+		sort.Strings(tree.Files[dir])
+		sort.Strings(tree.Dirs[dir])
+	}
+	return tree
+}
+
+// GetDirsByDepth returns project directories (except root) grouped by depth, deepest directories go first,
+// so summaries of subdirectories can be generated before summaries of their parents
+func (t *DirTree) GetDirsByDepth() [][]string {
+	depths := map[int][]string{}
+	maxDepth := 0
+	for dir := range t.FileCount {
+		if dir == "" {
+			continue
+		}
+		depth := strings.Count(dir, string(filepath.Separator))
+		depths[depth] = append(depths[depth], dir)
+		maxDepth = max(maxDepth, depth)
+	}
+	var result [][]string
+	for depth := maxDepth; depth >= 0; depth-- {
+		if dirs, exist := depths[depth]; exist {
+			sort.Strings(dirs)
+			result = append(result, dirs)
+		}
+	}
+	return result
+}
+
+// GetFilesRecursive returns all files inside directory and its subdirectories
+func (t *DirTree) GetFilesRecursive(dir string) []string {
+	result := NewSlice(t.Files[dir]...)
+	for _, subdir := range t.Dirs[dir] {
+		result = append(result, t.GetFilesRecursive(subdir)...)
+	}
+	return result
+}
+
+// GetDirChecksum calculates checksum of the directory contents used to generate its summary:
+// annotations of files located directly inside directory and summaries of its subdirectories.
+// Summary is regenerated only when the checksum changes
+func (t *DirTree) GetDirChecksum(dir string, annotations, dirSummaries map[string]string) string {
+	hash := sha256.New()
+	for _, file := range t.Files[dir] {
+		hash.Write([]byte("file\x00" + file + "\x00" + annotations[file] + "\x00"))
+	}
+	for _, subdir := range t.Dirs[dir] {
+		hash.Write([]byte("dir\x00" + subdir + "\x00" + dirSummaries[subdir] + "\x00"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// GetIndexEntries selects directories and files describing the project structure with no more than maxEntries items.
+// Starting from the project root, directory with the most files is replaced with its files and subdirectories,
+// while the entries limit allows it. Directories that were not expanded represent all files inside them
+func (t *DirTree) GetIndexEntries(maxEntries int) ([]string, []string) {
+	dirs := NewSlice(t.Dirs[""]...)
+	files := NewSlice(t.Files[""]...)
+	var fixedDirs []string
+	for len(dirs) > 0 {
+		// Try to expand directory with the largest file count
+		slices.SortFunc(dirs, func(a, b string) int {
+			if t.FileCount[a] != t.FileCount[b] {
+				return t.FileCount[b] - t.FileCount[a]
+			}
+			return strings.Compare(a, b)
+		})
+		dir := dirs[0]
+		dirs = dirs[1:]
+		count := len(dirs) + len(fixedDirs) + len(files) + len(t.Dirs[dir]) + len(t.Files[dir])
+		if count > maxEntries {
+			fixedDirs = append(fixedDirs, dir)
+			continue
+		}
+		dirs = append(dirs, t.Dirs[dir]...)
+		files = append(files, t.Files[dir]...)
+	}
+	sort.Strings(fixedDirs)
+	sort.Strings(files)
+	return fixedDirs, files
+}
+
+// LoadDirSummaries returns summaries and checksums of project directories, empty maps if summaries file is missing
+func LoadDirSummaries(filePath string) (map[string]string, map[string]string) {
+	var entries []dirSummaryEntry
+	if err := LoadJsonFile(filePath, &entries); err != nil {
+		entries = nil
+	}
+	summaries := map[string]string{}
+	checksums := map[string]string{}
+	for _, entry := range entries {
+		summaries[entry.Dirname] = entry.Summary
+		checksums[entry.Dirname] = entry.Checksum
+	}
+	return summaries, checksums
+}
+
+// SaveDirSummaries saves summaries of directories listed in checksums map
+func SaveDirSummaries(filePath string, checksums map[string]string, summaries map[string]string) error {
+	var entries []dirSummaryEntry
+	for dirname, checksum := range checksums {
+		if summary, ok := summaries[dirname]; ok {
+			entries = append(entries, dirSummaryEntry{Dirname: dirname, Checksum: checksum, Summary: summary})
+		}
+	}
+	slices.SortFunc(entries, func(a, b dirSummaryEntry) int { return strings.Compare(a.Dirname, b.Dirname) })
+	return SaveJsonFile(filePath, entries)
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func newTestDirTree() *DirTree {
+	return NewDirTree([]string{
+		"main.go",
+		filepath.Join("llm", "llm.go"),
+		filepath.Join("llm", "openai.go"),
+		filepath.Join("llm", "ollama.go"),
+		filepath.Join("op", "annotate", "annotate.go"),
+		filepath.Join("op", "embed", "embed.go"),
+		filepath.Join("op", "embed", "search.go"),
+	})
+}
+
+func TestDirTree(t *testing.T) {
+	tree := newTestDirTree()
+	if !slices.Equal(tree.Dirs[""], []string{"llm", "op"}) || !slices.Equal(tree.Files[""], []string{"main.go"}) {
+		t.Errorf("root dirs %v, files %v", tree.Dirs[""], tree.Files[""])
+	}
+	if tree.FileCount[""] != 7 || tree.FileCount["op"] != 3 {
+		t.Errorf("file counts: %v", tree.FileCount)
+	}
+	expectedDepths := [][]string{{filepath.Join("op", "annotate"), filepath.Join("op", "embed")}, {"llm", "op"}}
+	if depths := tree.GetDirsByDepth(); len(depths) != 2 || !slices.Equal(depths[0], expectedDepths[0]) || !slices.Equal(depths[1], expectedDepths[1]) {
+		t.Errorf("GetDirsByDepth() = %v", depths)
+	}
+	if files := tree.GetFilesRecursive("op"); len(files) != 3 {
+		t.Errorf("GetFilesRecursive() = %v", files)
+	}
+}
+
+func TestDirTreeGetIndexEntries(t *testing.T) {
+	tree := newTestDirTree()
+
+	// Largest directory is expanded first, while entries limit allows it
+	dirs, files := tree.GetIndexEntries(5)
+	if !slices.Equal(dirs, []string{"op"}) || !slices.Equal(files, []string{filepath.Join("llm", "llm.go"), filepath.Join("llm", "ollama.go"), filepath.Join("llm", "openai.go"), "main.go"}) {
+		t.Errorf("GetIndexEntries(5) = %v, %v", dirs, files)
+	}
+
+	dirs, files = tree.GetIndexEntries(2)
+	if !slices.Equal(dirs, []string{"llm", "op"}) || !slices.Equal(files, []string{"main.go"}) {
+		t.Errorf("GetIndexEntries(2) = %v, %v", dirs, files)
+	}
+
+	// All files are listed when limit is large enough
+	dirs, files = tree.GetIndexEntries(100)
+	if len(dirs) != 0 || len(files) != 7 {
+		t.Errorf("GetIndexEntries(100) = %v, %v", dirs, files)
+	}
+}
+
+func TestDirSummariesChecksumsAndStorage(t *testing.T) {
+	tree := newTestDirTree()
+	annotations := map[string]string{filepath.Join("op", "embed", "embed.go"): "embed"}
+	summaries := map[string]string{filepath.Join("op", "embed"): "embeddings"}
+
+	checksum := tree.GetDirChecksum("op", annotations, summaries)
+	// Parent directory checksum does not depend on annotations of files inside subdirectories directly, only on their summaries
+	annotations[filepath.Join("op", "embed", "embed.go")] = "changed"
+	if tree.GetDirChecksum("op", annotations, summaries) != checksum {
+		t.Errorf("checksum changed without changes of subdirectory summary")
+	}
+	summaries[filepath.Join("op", "embed")] = "changed"
+	if tree.GetDirChecksum("op", annotations, summaries) == checksum {
+		t.Errorf("checksum not changed after changing subdirectory summary")
+	}
+
+	filePath := filepath.Join(t.TempDir(), DirSummariesFileName)
+	if loaded, _ := LoadDirSummaries(filePath); len(loaded) != 0 {
+		t.Errorf("summaries loaded from missing file: %v", loaded)
+	}
+	if err := SaveDirSummaries(filePath, map[string]string{"op": "sum-op", "llm": "sum-llm"}, map[string]string{"op": "operations"}); err != nil {
+		t.Fatalf("SaveDirSummaries() failed: %v", err)
+	}
+	loaded, checksums := LoadDirSummaries(filePath)
+	if len(loaded) != 1 || loaded["op"] != "operations" || checksums["op"] != "sum-op" {
+		t.Errorf("LoadDirSummaries() = %v, %v", loaded, checksums)
+	}
+}
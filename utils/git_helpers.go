@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const GitModeNone = "none"
+const GitModeCommit = "commit"
+const GitModeBranch = "branch"
+
+// runGit runs git command inside the directory and returns its trimmed output
+func runGit(dir string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, message)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// GitGetDirtyFiles returns status lines for uncommitted changes and untracked files in the project directory.
+// Paths matching excludes (relative to the project directory, e.g. ".perpetual") are not checked
+func GitGetDirtyFiles(projectRootDir string, excludes ...string) ([]string, error) {
+	args := []string{"status", "--porcelain", "--untracked-files=all", "--", "."}
+	for _, exclude := range excludes {
+		args = append(args, ":(exclude)"+exclude)
+	}
+	output, err := runGit(projectRootDir, "", args...)
+	if err != nil {
+		return nil, err
+	}
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// GitCreateBranch creates new branch from the current commit and switches to it, uncommitted changes are kept
+func GitCreateBranch(projectRootDir string, branch string) error {
+	_, err := runGit(projectRootDir, "", "checkout", "-b", branch)
+	return err
+}
+
+// GitGetCurrentRef returns name of the current branch, or hash of the current commit when HEAD is detached
+func GitGetCurrentRef(projectRootDir string) (string, error) {
+	if branch, err := runGit(projectRootDir, "", "symbolic-ref", "-q", "--short", "HEAD"); err == nil && branch != "" {
+		return branch, nil
+	}
+	return runGit(projectRootDir, "", "rev-parse", "HEAD")
+}
+
+// GitSwitchRef switches to the existing branch or commit, uncommitted changes are kept if they do not conflict
+func GitSwitchRef(projectRootDir string, ref string) error {
+	_, err := runGit(projectRootDir, "", "checkout", "-q", ref)
+	return err
+}
+
+// GitGetIgnoredFiles returns selected files (relative to the project directory) that are ignored by git
+// and not tracked, such files cannot be added to commit
+func GitGetIgnoredFiles(projectRootDir string, files []string) ([]string, error) {
+	if len(files) < 1 {
+		return nil, nil
+	}
+	cmd := exec.Command("git", append([]string{"-C", projectRootDir, "check-ignore", "--"}, files...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Exit code 1 means that none of the files are ignored
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("git check-ignore failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	output := strings.TrimSpace(stdout.String())
+	if output == "" {
+		return nil, nil
+	}
+	return strings.Split(output, "\n"), nil
+}
+
+// GitCommitFiles commits only the selected files (relative to the project directory, including deleted ones)
+// with the provided message, other staged or unstaged changes are left untouched. Returns hash of the new commit,
+// or empty string if selected files have no changes to commit
+func GitCommitFiles(projectRootDir string, files []string, message string) (string, error) {
+	if len(files) < 1 {
+		return "", nil
+	}
+	pathspec := append([]string{"--"}, files...)
+	if _, err := runGit(projectRootDir, "", append([]string{"add", "-A"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	if staged, err := runGit(projectRootDir, "", append([]string{"diff", "--cached", "--name-only"}, pathspec...)...); err != nil || staged == "" {
+		return "", err
+	}
+	if _, err := runGit(projectRootDir, message, append([]string{"commit", "-q", "-F", "-"}, pathspec...)...); err != nil {
+		return "", err
+	}
+	return runGit(projectRootDir, "", "rev-parse", "HEAD")
+}
+
+// GitRevertCommit creates new commit that reverts changes made by the selected commit
+func GitRevertCommit(projectRootDir string, commit string) error {
+	_, err := runGit(projectRootDir, "", "revert", "--no-edit", commit)
+	return err
+}
@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func setupTestGitRepo(t *testing.T) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not available")
+	}
+	t.Setenv("GIT_AUTHOR_NAME", "Test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "Test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	repoDir := t.TempDir()
+	if _, err := runGit(repoDir, "", "init", "-q"); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	writeTestRepoFile(t, repoDir, "keep.txt", "keep\n")
+	writeTestRepoFile(t, repoDir, "delete.txt", "delete\n")
+	if _, err := GitCommitFiles(repoDir, []string{"keep.txt", "delete.txt"}, "Initial commit"); err != nil {
+		t.Fatalf("Failed to create initial commit: %v", err)
+	}
+	return repoDir
+}
+
+func writeTestRepoFile(t *testing.T, repoDir, name, contents string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filepath.Join(repoDir, name)), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, name), []byte(contents), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+}
+
+func TestGitGetDirtyFiles(t *testing.T) {
+	repoDir := setupTestGitRepo(t)
+
+	dirty, err := GitGetDirtyFiles(repoDir, ".perpetual")
+	if err != nil || len(dirty) != 0 {
+		t.Fatalf("Expected clean tree, got %v, %v", dirty, err)
+	}
+
+	writeTestRepoFile(t, repoDir, filepath.Join(".perpetual", "state.json"), "{}\n")
+	dirty, err = GitGetDirtyFiles(repoDir, ".perpetual")
+	if err != nil || len(dirty) != 0 {
+		t.Fatalf("Expected excluded files to be ignored, got %v, %v", dirty, err)
+	}
+
+	writeTestRepoFile(t, repoDir, "keep.txt", "changed\n")
+	dirty, err = GitGetDirtyFiles(repoDir, ".perpetual")
+	if err != nil || len(dirty) != 1 {
+		t.Fatalf("Expected one dirty file, got %v, %v", dirty, err)
+	}
+}
+
+func TestGitCommitAndRevertFiles(t *testing.T) {
+	repoDir := setupTestGitRepo(t)
+
+	writeTestRepoFile(t, repoDir, "keep.txt", "modified\n")
+	writeTestRepoFile(t, repoDir, filepath.Join("dir", "new.txt"), "new\n")
+	writeTestRepoFile(t, repoDir, "unrelated.txt", "unrelated\n")
+	if err := os.Remove(filepath.Join(repoDir, "delete.txt")); err != nil {
+		t.Fatalf("Failed to remove file: %v", err)
+	}
+
+	if err := GitCreateBranch(repoDir, "perpetual/test"); err != nil {
+		t.Fatalf("GitCreateBranch failed: %v", err)
+	}
+	commit, err := GitCommitFiles(repoDir, []string{"keep.txt", "dir/new.txt", "delete.txt"}, "Apply changes\n\nDetails")
+	if err != nil {
+		t.Fatalf("GitCommitFiles failed: %v", err)
+	}
+
+	branch, _ := runGit(repoDir, "", "rev-parse", "--abbrev-ref", "HEAD")
+	if branch != "perpetual/test" {
+		t.Errorf("Expected to be on the new branch, got %s", branch)
+	}
+	changed, _ := runGit(repoDir, "", "show", "--name-only", "--format=", commit)
+	if changed != "delete.txt\ndir/new.txt\nkeep.txt" {
+		t.Errorf("Unexpected files in commit:\n%s", changed)
+	}
+	dirty, _ := GitGetDirtyFiles(repoDir)
+	if len(dirty) != 1 || dirty[0] != "?? unrelated.txt" {
+		t.Errorf("Unrelated file must not be committed, got %v", dirty)
+	}
+
+	if err := GitRevertCommit(repoDir, commit); err != nil {
+		t.Fatalf("GitRevertCommit failed: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(repoDir, "keep.txt")); err != nil || string(data) != "keep\n" {
+		t.Errorf("Expected reverted file contents, got %q, %v", string(data), err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "delete.txt")); err != nil {
+		t.Errorf("Expected deleted file to be restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(repoDir, "dir", "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("Expected created file to be removed, got %v", err)
+	}
+}
+
+func TestGitCommitFilesWithoutChanges(t *testing.T) {
+	repoDir := setupTestGitRepo(t)
+
+	commit, err := GitCommitFiles(repoDir, []string{"keep.txt"}, "No changes")
+	if err != nil || commit != "" {
+		t.Fatalf("Expected no commit for unchanged files, got %q, %v", commit, err)
+	}
+}
+
+func TestGitSwitchRef(t *testing.T) {
+	repoDir := setupTestGitRepo(t)
+
+	original, err := GitGetCurrentRef(repoDir)
+	if err != nil || original == "" {
+		t.Fatalf("GitGetCurrentRef failed: %q, %v", original, err)
+	}
+	writeTestRepoFile(t, repoDir, "keep.txt", "modified\n")
+	if err := GitCreateBranch(repoDir, "perpetual/test"); err != nil {
+		t.Fatalf("GitCreateBranch failed: %v", err)
+	}
+	if _, err := GitCommitFiles(repoDir, []string{"keep.txt"}, "Modify"); err != nil {
+		t.Fatalf("GitCommitFiles failed: %v", err)
+	}
+	if ref, _ := GitGetCurrentRef(repoDir); ref != "perpetual/test" {
+		t.Errorf("Expected to be on the new branch, got %s", ref)
+	}
+	if err := GitSwitchRef(repoDir, original); err != nil {
+		t.Fatalf("GitSwitchRef failed: %v", err)
+	}
+	if ref, _ := GitGetCurrentRef(repoDir); ref != original {
+		t.Errorf("Expected to be back on %s, got %s", original, ref)
+	}
+	if data, err := os.ReadFile(filepath.Join(repoDir, "keep.txt")); err != nil || string(data) != "keep\n" {
+		t.Errorf("Expected original file contents, got %q, %v", string(data), err)
+	}
+}
+
+func TestGitGetIgnoredFiles(t *testing.T) {
+	repoDir := setupTestGitRepo(t)
+
+	writeTestRepoFile(t, repoDir, ".gitignore", "*.log\n")
+	writeTestRepoFile(t, repoDir, "debug.log", "log\n")
+	ignored, err := GitGetIgnoredFiles(repoDir, []string{"keep.txt", "debug.log", "missing.log", "new.txt"})
+	if err != nil {
+		t.Fatalf("GitGetIgnoredFiles failed: %v", err)
+	}
+	if len(ignored) != 2 || ignored[0] != "debug.log" || ignored[1] != "missing.log" {
+		t.Errorf("Unexpected ignored files: %v", ignored)
+	}
+	if ignored, err := GitGetIgnoredFiles(repoDir, []string{"keep.txt"}); err != nil || len(ignored) != 0 {
+		t.Errorf("Expected no ignored files, got %v, %v", ignored, err)
+	}
+}
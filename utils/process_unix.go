@@ -0,0 +1,17 @@
+//go:build !windows
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isProcessAlive checks whether process with the pid is running, process owned by another user is considered running
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
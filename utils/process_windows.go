@@ -0,0 +1,28 @@
+//go:build windows
+
+package utils
+
+import (
+	"errors"
+	"syscall"
+)
+
+const processQueryLimitedInformation = 0x1000
+const processStillActive = 259
+
+// isProcessAlive checks whether process with the pid is running, process that cannot be queried is considered running
+func isProcessAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	handle, err := syscall.OpenProcess(processQueryLimitedInformation, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(handle)
+	var exitCode uint32
+	if err := syscall.GetExitCodeProcess(handle, &exitCode); err != nil {
+		return true
+	}
+	return exitCode == processStillActive
+}
@@ -36,6 +36,8 @@ type embeddingEntry struct {
 	Filename string      `json:"filename"`
 	Checksum string      `json:"checksum"`
 	Vectors  [][]float32 `json:"vectors"`
+	// 1-based inclusive line ranges of file chunks, one per vector, optional
+	Lines [][2]int `json:"lines,omitempty"`
 }
 
 type embeddingEntries []embeddingEntry
@@ -129,7 +131,7 @@ func GetChangedAnnotations(annotationsFilePath string, fileChecksums map[string]
 	return changedFiles, nil
 }
 
-func SaveEmbeddings(filePath string, checksums map[string]string, embeddings map[string][][]float32) error {
+func SaveEmbeddings(filePath string, checksums map[string]string, embeddings map[string][][]float32, chunkLines map[string][][2]int) error {
 	var entries embeddingEntries
 	for filename, checksum := range checksums {
 		vectors, ok := embeddings[filename]
@@ -141,6 +143,10 @@ func SaveEmbeddings(filePath string, checksums map[string]string, embeddings map
 			Checksum: checksum,
 			Vectors:  vectors,
 		}
+		//only save line ranges matching the vectors
+		if lines, ok := chunkLines[filename]; ok && len(lines) == len(vectors) {
+			entry.Lines = lines
+		}
 		entries = append(entries, entry)
 	}
 	sort.Sort(entries)
@@ -163,22 +169,19 @@ func GetEmbeddings(filePath string, filenames []string) (map[string][][]float32,
 	vectorDimensions := 0
 	fileVectors := make(map[string][][]float32)
 	fileChecksums := make(map[string]string)
+	entryIndexes := make(map[string]int, len(embeddings))
+	for i, entry := range embeddings {
+		entryIndexes[entry.Filename] = i
+	}
 	for _, filename := range filenames {
 		//set initial state of requested file checksum to "error"
 		fileChecksums[filename] = "error"
 		//only set vectors for requested files, to lower ram usage
-		var vectors [][]float32
-		found := false
-		for _, entry := range embeddings {
-			if entry.Filename == filename {
-				vectors = entry.Vectors
-				found = true
-				break
-			}
-		}
+		idx, found := entryIndexes[filename]
 		if !found {
 			continue
 		}
+		vectors := embeddings[idx].Vectors
 		//set vectors
 		fileVectors[filename] = vectors
 		//detect vector dimensions
@@ -203,6 +206,30 @@ func GetEmbeddings(filePath string, filenames []string) (map[string][][]float32,
 	return fileVectors, fileChecksums, vectorDimensions, nil
 }
 
+// GetEmbeddingsChunkLines returns line ranges of embedded chunks for requested files,
+// files embedded without line ranges are not included
+func GetEmbeddingsChunkLines(filePath string, filenames []string) (map[string][][2]int, error) {
+	var embeddings embeddingEntries
+	err := LoadMsgPackFile(filePath, &embeddings)
+	if err != nil {
+		embeddings = nil
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	requested := make(map[string]bool, len(filenames))
+	for _, filename := range filenames {
+		requested[filename] = true
+	}
+	chunkLines := make(map[string][][2]int)
+	for _, entry := range embeddings {
+		if requested[entry.Filename] && len(entry.Lines) > 0 && len(entry.Lines) == len(entry.Vectors) {
+			chunkLines[entry.Filename] = entry.Lines
+		}
+	}
+	return chunkLines, nil
+}
+
 func GetChangedFiles(oldFileChecksums map[string]string, curFileChecksums map[string]string) []string {
 	var changedFiles []string
 	for filename, checksum := range curFileChecksums {
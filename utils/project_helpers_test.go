@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"path/filepath"
+	"reflect"
 	"regexp"
 	"testing"
 )
@@ -120,3 +122,25 @@ func TestFilterFilesWithBlacklist(t *testing.T) {
 		})
 	}
 }
+
+func TestEmbeddingsChunkLines(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), EmbeddingsFileName)
+	checksums := map[string]string{"a.go": "1", "b.go": "2", "c.go": "3"}
+	embeddings := map[string][][]float32{"a.go": {{1, 0}, {0, 1}}, "b.go": {{1, 1}}, "c.go": {{0, 1}}}
+	// Line ranges for c.go do not match its vectors and must not be saved
+	chunkLines := map[string][][2]int{"a.go": {{1, 10}, {8, 20}}, "c.go": {{1, 5}, {4, 9}}}
+	if err := SaveEmbeddings(filePath, checksums, embeddings, chunkLines); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := GetEmbeddingsChunkLines(filePath, []string{"a.go", "b.go", "c.go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded, map[string][][2]int{"a.go": {{1, 10}, {8, 20}}}) {
+		t.Errorf("Unexpected chunk lines: %v", loaded)
+	}
+	vectors, loadedChecksums, dimensions, err := GetEmbeddings(filePath, []string{"a.go", "b.go"})
+	if err != nil || dimensions != 2 || len(vectors["a.go"]) != 2 || loadedChecksums["c.go"] != "3" {
+		t.Errorf("Unexpected embeddings: %v, %v, %d, %v", vectors, loadedChecksums, dimensions, err)
+	}
+}
@@ -0,0 +1,318 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DarkCaster/Perpetual/logging"
+)
+
+// Resources inside .perpetual directory protected with advisory locks.
+// Operations that only read the resource take shared lock, operations that write it take exclusive lock
+const LockResourceAnnotations = "annotations"
+const LockResourceEmbeddings = "embeddings"
+const LockResourceSymbols = "symbols"
+const LockResourceImplementState = "implement_state"
+const LockResourceStash = "stash"
+const LockResourceMessageLog = "message_log"
+
+const lockTimeoutEnvVar = "PERPETUAL_LOCK_TIMEOUT"
+const defaultLockTimeout = 300 * time.Second
+const lockPollInterval = 250 * time.Millisecond
+const lockMutexPollInterval = 10 * time.Millisecond
+
+// Lock records are changed while holding short-lived mutex file, it may be left only by crashed process
+const lockMutexStaleTimeout = 10 * time.Second
+
+var ErrLockBusy = errors.New("resource is locked by another process")
+
+// lockRecord is stored in the lock directory for every process holding the lock
+type lockRecord struct {
+	Resource   string    `json:"resource"`
+	Exclusive  bool      `json:"exclusive"`
+	PID        int       `json:"pid"`
+	Host       string    `json:"host"`
+	Operation  string    `json:"operation"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+func (r lockRecord) String() string {
+	mode := "shared"
+	if r.Exclusive {
+		mode = "exclusive"
+	}
+	return fmt.Sprintf("%s lock held by '%s' operation (pid %d on %s) since %s", mode, r.Operation, r.PID, r.Host, r.AcquiredAt.Local().Format("15:04:05"))
+}
+
+type heldLock struct {
+	recordPath     string
+	record         lockRecord
+	sharedCount    int
+	exclusiveCount int
+}
+
+// Locks held by the current process, lock can be acquired multiple times by internally invoked operations
+var heldLocksLock sync.Mutex
+var heldLocks = map[string]*heldLock{}
+
+var hostNameSanitizeRx = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+func getLockHostName() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		return "unknown"
+	}
+	return host
+}
+
+func getLockOperation() string {
+	if len(os.Args) > 1 {
+		return os.Args[1]
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// GetLockTimeout returns how long to wait for the lock held by another process, set with PERPETUAL_LOCK_TIMEOUT env variable (seconds)
+func GetLockTimeout() time.Duration {
+	if timeout, err := GetEnvFloat(lockTimeoutEnvVar); err == nil && timeout >= 0 {
+		return time.Duration(timeout * float64(time.Second))
+	}
+	return defaultLockTimeout
+}
+
+// prepareLockDir creates directory for lock records, directory name is the same as lockfile used by older versions
+func prepareLockDir(perpetualDir string) (string, error) {
+	lockDir := filepath.Join(perpetualDir, LockFileName)
+	if info, err := os.Stat(lockDir); err == nil && !info.IsDir() {
+		return lockDir, fmt.Errorf("lockfile created by older version of Perpetual found, remove it if no other instance is running: %s", lockDir)
+	}
+	return lockDir, os.MkdirAll(lockDir, 0755)
+}
+
+func lockResourceMutex(lockDir, resource string) (func(), error) {
+	mutexPath := filepath.Join(lockDir, resource+".mutex")
+	for {
+		f, err := os.OpenFile(mutexPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(mutexPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, err := os.Stat(mutexPath); err == nil && time.Since(info.ModTime()) > lockMutexStaleTimeout {
+			os.Remove(mutexPath)
+			continue
+		}
+		time.Sleep(lockMutexPollInterval)
+	}
+}
+
+// readLockRecords returns records of processes holding the lock, records left by terminated processes are removed
+func readLockRecords(lockDir, resource string) ([]lockRecord, error) {
+	entries, err := os.ReadDir(lockDir)
+	if err != nil {
+		return nil, err
+	}
+	host := getLockHostName()
+	var records []lockRecord
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), resource+"@") || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		recordPath := filepath.Join(lockDir, entry.Name())
+		var record lockRecord
+		if err := LoadJsonFile(recordPath, &record); err != nil {
+			// Records are written while holding the mutex, so broken record cannot be incomplete write in progress
+			os.Remove(recordPath)
+			continue
+		}
+		// Process liveness can be checked only on the same host
+		if record.Host == host && !isProcessAlive(record.PID) {
+			os.Remove(recordPath)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func writeLockRecord(recordPath string, record lockRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(recordPath, data, 0644)
+}
+
+// releaseHeldLock releases one acquisition of the lock held by this process. Record is removed when the lock is not held anymore,
+// and downgraded to shared when the last exclusive acquisition made while holding shared lock is released
+func releaseHeldLock(lockDir, resource, key string, exclusive bool) {
+	heldLocksLock.Lock()
+	defer heldLocksLock.Unlock()
+	held, ok := heldLocks[key]
+	if !ok {
+		return
+	}
+	if exclusive && held.exclusiveCount > 0 {
+		held.exclusiveCount--
+	} else if !exclusive && held.sharedCount > 0 {
+		held.sharedCount--
+	}
+	if held.sharedCount+held.exclusiveCount < 1 {
+		os.Remove(held.recordPath)
+		delete(heldLocks, key)
+		return
+	}
+	if held.exclusiveCount < 1 && held.record.Exclusive {
+		held.record.Exclusive = false
+		if unlockMutex, err := lockResourceMutex(lockDir, resource); err == nil {
+			writeLockRecord(held.recordPath, held.record)
+			unlockMutex()
+		}
+	}
+}
+
+// acquireProjectLock tries to acquire the lock until timeout expires, onWait is called once with lock holders
+// if the lock cannot be acquired immediately. Returns ErrLockBusy with description of holders on timeout.
+// Upgrade of shared lock held by this process to exclusive lock does not wait: two processes waiting
+// for each other to release shared locks would only fail on timeout
+func acquireProjectLock(perpetualDir, resource string, exclusive bool, timeout time.Duration, onWait func([]lockRecord)) (func(), error) {
+	lockDir, err := prepareLockDir(perpetualDir)
+	if err != nil {
+		return nil, err
+	}
+
+	key := filepath.Join(lockDir, resource)
+	release := func() {
+		releaseHeldLock(lockDir, resource, key, exclusive)
+	}
+
+	host := getLockHostName()
+	pid := os.Getpid()
+	recordPath := filepath.Join(lockDir, fmt.Sprintf("%s@%s@%d.json", resource, hostNameSanitizeRx.ReplaceAllString(host, "_"), pid))
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for {
+		// Locks held by this process are only checked and changed while holding the mutex,
+		// it is released before waiting, so other goroutines can acquire and release locks in the meantime
+		heldLocksLock.Lock()
+		held, upgrade := heldLocks[key]
+		// Lock already held by this process with the same or stronger mode
+		if upgrade && (held.exclusiveCount > 0 || !exclusive) {
+			if exclusive {
+				held.exclusiveCount++
+			} else {
+				held.sharedCount++
+			}
+			heldLocksLock.Unlock()
+			return release, nil
+		}
+
+		unlockMutex, err := lockResourceMutex(lockDir, resource)
+		if err != nil {
+			heldLocksLock.Unlock()
+			return nil, err
+		}
+		records, err := readLockRecords(lockDir, resource)
+		if err != nil {
+			unlockMutex()
+			heldLocksLock.Unlock()
+			return nil, err
+		}
+		var holders []lockRecord
+		for _, record := range records {
+			if record.PID == pid && record.Host == host {
+				continue
+			}
+			if exclusive || record.Exclusive {
+				holders = append(holders, record)
+			}
+		}
+		if len(holders) < 1 {
+			record := lockRecord{
+				Resource:   resource,
+				Exclusive:  exclusive,
+				PID:        pid,
+				Host:       host,
+				Operation:  getLockOperation(),
+				AcquiredAt: time.Now(),
+			}
+			if upgrade {
+				record.AcquiredAt = held.record.AcquiredAt
+			}
+			err := writeLockRecord(recordPath, record)
+			unlockMutex()
+			if err != nil {
+				heldLocksLock.Unlock()
+				return nil, err
+			}
+			if upgrade {
+				held.record = record
+				held.exclusiveCount++
+			} else if exclusive {
+				heldLocks[key] = &heldLock{recordPath: recordPath, record: record, exclusiveCount: 1}
+			} else {
+				heldLocks[key] = &heldLock{recordPath: recordPath, record: record, sharedCount: 1}
+			}
+			heldLocksLock.Unlock()
+			return release, nil
+		}
+		unlockMutex()
+		heldLocksLock.Unlock()
+
+		if upgrade || !time.Now().Before(deadline) {
+			var descriptions []string
+			for _, holder := range holders {
+				descriptions = append(descriptions, holder.String())
+			}
+			if upgrade {
+				return nil, fmt.Errorf("%w: %s: cannot upgrade shared lock to exclusive: %s", ErrLockBusy, resource, strings.Join(descriptions, "; "))
+			}
+			return nil, fmt.Errorf("%w: %s: %s", ErrLockBusy, resource, strings.Join(descriptions, "; "))
+		}
+		if !waiting && onWait != nil {
+			onWait(holders)
+		}
+		waiting = true
+		time.Sleep(min(lockPollInterval, time.Until(deadline)))
+	}
+}
+
+// LockProjectResource acquires advisory lock for the resource inside .perpetual directory, waiting for other processes
+// to release it (see GetLockTimeout). Returns function that releases the lock,
+// locks that are not released explicitly are released with global cleanup when operation completes
+func LockProjectResource(perpetualDir, resource string, exclusive bool, logger logging.ILogger) func() {
+	release, err := acquireProjectLock(perpetualDir, resource, exclusive, GetLockTimeout(), func(holders []lockRecord) {
+		for _, holder := range holders {
+			logger.Infof("Waiting for %s: %s", resource, holder)
+		}
+	})
+	if err != nil {
+		logger.Panicln("Failed to lock project resource, another instance might be running:", err)
+	}
+	logger.Traceln("Locked project resource:", resource)
+	return release
+}
+
+// TryLockProjectResource acquires advisory lock without waiting, returns ErrLockBusy if it is held by another process
+func TryLockProjectResource(perpetualDir, resource string, exclusive bool) (func(), error) {
+	return acquireProjectLock(perpetualDir, resource, exclusive, 0, nil)
+}
+
+// releaseAllProjectLocks removes lock records of the current process
+func releaseAllProjectLocks() {
+	heldLocksLock.Lock()
+	defer heldLocksLock.Unlock()
+	for key, held := range heldLocks {
+		os.Remove(held.recordPath)
+		delete(heldLocks, key)
+	}
+}
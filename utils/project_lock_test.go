@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeForeignLockRecord simulates lock held by another process
+func writeForeignLockRecord(t *testing.T, perpetualDir, resource string, exclusive bool, pid int) string {
+	t.Helper()
+
+	lockDir, err := prepareLockDir(perpetualDir)
+	if err != nil {
+		t.Fatalf("Failed to prepare lock directory: %v", err)
+	}
+	recordPath := filepath.Join(lockDir, fmt.Sprintf("%s@test@%d.json", resource, pid))
+	record := lockRecord{Resource: resource, Exclusive: exclusive, PID: pid, Host: getLockHostName(), Operation: "test", AcquiredAt: time.Now()}
+	if err := writeLockRecord(recordPath, record); err != nil {
+		t.Fatalf("Failed to write lock record: %v", err)
+	}
+	return recordPath
+}
+
+// getDeadPID returns pid of the process that already terminated
+func getDeadPID(t *testing.T) int {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run helper process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestProjectLockSharedAndExclusive(t *testing.T) {
+	perpetualDir := t.TempDir()
+	writeForeignLockRecord(t, perpetualDir, LockResourceAnnotations, false, os.Getppid())
+
+	unlock, err := TryLockProjectResource(perpetualDir, LockResourceAnnotations, false)
+	if err != nil {
+		t.Fatalf("Shared lock must be compatible with other shared lock: %v", err)
+	}
+	unlock()
+
+	if _, err := TryLockProjectResource(perpetualDir, LockResourceAnnotations, true); !errors.Is(err, ErrLockBusy) {
+		t.Fatalf("Exclusive lock must not be acquired while shared lock is held, got: %v", err)
+	}
+
+	unlock, err = TryLockProjectResource(perpetualDir, LockResourceEmbeddings, true)
+	if err != nil {
+		t.Fatalf("Locks of different resources must not conflict: %v", err)
+	}
+	unlock()
+}
+
+func TestProjectLockRemovesStaleRecords(t *testing.T) {
+	perpetualDir := t.TempDir()
+	recordPath := writeForeignLockRecord(t, perpetualDir, LockResourceStash, true, getDeadPID(t))
+
+	unlock, err := TryLockProjectResource(perpetualDir, LockResourceStash, true)
+	if err != nil {
+		t.Fatalf("Lock held by terminated process must be ignored: %v", err)
+	}
+	defer unlock()
+	if _, err := os.Stat(recordPath); !os.IsNotExist(err) {
+		t.Errorf("Stale lock record must be removed, got: %v", err)
+	}
+}
+
+func TestProjectLockIsReentrant(t *testing.T) {
+	perpetualDir := t.TempDir()
+
+	unlockShared, err := TryLockProjectResource(perpetualDir, LockResourceStash, false)
+	if err != nil {
+		t.Fatalf("Failed to acquire shared lock: %v", err)
+	}
+	unlockExclusive, err := TryLockProjectResource(perpetualDir, LockResourceStash, true)
+	if err != nil {
+		t.Fatalf("Shared lock held by the same process must be upgraded: %v", err)
+	}
+
+	unlockExclusive()
+	records, _ := readLockRecords(filepath.Join(perpetualDir, LockFileName), LockResourceStash)
+	if len(records) != 1 {
+		t.Fatalf("Lock must be held until released by all owners, got %v", records)
+	}
+	if records[0].Exclusive {
+		t.Fatalf("Upgraded lock must be downgraded to shared after exclusive owner releases it")
+	}
+	unlockShared()
+	records, _ = readLockRecords(filepath.Join(perpetualDir, LockFileName), LockResourceStash)
+	if len(records) != 0 {
+		t.Fatalf("Lock record must be removed after release, got %v", records)
+	}
+}
+
+func TestProjectLockWaitAndTimeout(t *testing.T) {
+	perpetualDir := t.TempDir()
+	recordPath := writeForeignLockRecord(t, perpetualDir, LockResourceImplementState, true, os.Getppid())
+
+	waited := false
+	start := time.Now()
+	_, err := acquireProjectLock(perpetualDir, LockResourceImplementState, false, 300*time.Millisecond, func(holders []lockRecord) {
+		waited = len(holders) == 1
+	})
+	if !errors.Is(err, ErrLockBusy) {
+		t.Fatalf("Expected lock timeout, got: %v", err)
+	}
+	if !waited || time.Since(start) < 300*time.Millisecond {
+		t.Fatalf("Lock must be awaited until timeout")
+	}
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		os.Remove(recordPath)
+	}()
+	unlock, err := acquireProjectLock(perpetualDir, LockResourceImplementState, true, 10*time.Second, nil)
+	if err != nil {
+		t.Fatalf("Lock must be acquired after it is released by other process: %v", err)
+	}
+	unlock()
+}
+
+func TestProjectLockUpgradeDoesNotWait(t *testing.T) {
+	perpetualDir := t.TempDir()
+	writeForeignLockRecord(t, perpetualDir, LockResourceAnnotations, false, os.Getppid())
+
+	unlockShared, err := TryLockProjectResource(perpetualDir, LockResourceAnnotations, false)
+	if err != nil {
+		t.Fatalf("Failed to acquire shared lock: %v", err)
+	}
+	defer unlockShared()
+	start := time.Now()
+	_, err = acquireProjectLock(perpetualDir, LockResourceAnnotations, true, 10*time.Second, nil)
+	if !errors.Is(err, ErrLockBusy) || time.Since(start) > 5*time.Second {
+		t.Fatalf("Upgrade blocked by other process must fail without waiting, got: %v", err)
+	}
+}
+
+func TestProjectLockDoesNotBlockOtherGoroutinesWhileWaiting(t *testing.T) {
+	perpetualDir := t.TempDir()
+	recordPath := writeForeignLockRecord(t, perpetualDir, LockResourceImplementState, true, os.Getppid())
+	defer os.Remove(recordPath)
+
+	waiting := make(chan struct{})
+	go func() {
+		acquireProjectLock(perpetualDir, LockResourceImplementState, true, time.Second, func([]lockRecord) { close(waiting) })
+	}()
+	<-waiting
+	start := time.Now()
+	unlock, err := TryLockProjectResource(perpetualDir, LockResourceStash, true)
+	if err != nil || time.Since(start) > 500*time.Millisecond {
+		t.Fatalf("Other resource must be locked while another goroutine waits, got: %v", err)
+	}
+	unlock()
+}
+
+func TestProjectLockRejectsLegacyLockfile(t *testing.T) {
+	perpetualDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(perpetualDir, LockFileName), nil, 0644); err != nil {
+		t.Fatalf("Failed to create legacy lockfile: %v", err)
+	}
+
+	if _, err := TryLockProjectResource(perpetualDir, LockResourceStash, false); err == nil {
+		t.Fatalf("Legacy lockfile must not be silently ignored")
+	}
+}
@@ -0,0 +1,242 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"regexp"
+	"slices"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Placeholder is derived from the secret itself, so the same secret always gets the same placeholder,
+// even in separate runs (for example when implement operation is run with "-p start" and "-p finish")
+const secretPlaceholderPrefix = "PERPETUAL_REDACTED_"
+
+var secretPlaceholderRx = regexp.MustCompile(secretPlaceholderPrefix + "[0-9a-f]{16}")
+
+// Candidates for high-entropy tokens: base64, base64url and hex-encoded strings
+var secretCandidateRx = regexp.MustCompile(`[A-Za-z0-9+/_=-]+`)
+
+// SecretRedactor replaces credentials found in text with placeholders before the text is sent to LLM,
+// and restores original values from the placeholders found in text generated by LLM.
+// Nil redactor does not change the text
+type SecretRedactor struct {
+	lock             sync.Mutex
+	secretsRx        []*regexp.Regexp
+	entropyThreshold float64
+	entropyMinLength int
+	secrets          map[string]string
+}
+
+// NewSecretRedactor creates redactor detecting secrets with regexps (if regexp has capture group, only first group is redacted)
+// and with entropy check for long tokens, entropyThreshold (bits per character) of 0 disables the entropy check
+func NewSecretRedactor(secretsRx []*regexp.Regexp, entropyThreshold float64, entropyMinLength int) *SecretRedactor {
+	return &SecretRedactor{
+		secretsRx:        secretsRx,
+		entropyThreshold: entropyThreshold,
+		entropyMinLength: entropyMinLength,
+		secrets:          make(map[string]string),
+	}
+}
+
+func getSecretPlaceholder(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return secretPlaceholderPrefix + hex.EncodeToString(hash[:8])
+}
+
+// getShannonEntropy returns entropy of the text in bits per character
+func getShannonEntropy(text string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range text {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// Minimal share of adjacent characters of different classes (upper, lower, digit) in random generated token,
+// camel-case identifiers change character class only at word boundaries
+const secretMinClassSwitchRatio = 0.45
+
+func getCharClass(c rune) int {
+	switch {
+	case unicode.IsUpper(c):
+		return 1
+	case unicode.IsLower(c):
+		return 2
+	case unicode.IsDigit(c):
+		return 3
+	default:
+		return 0
+	}
+}
+
+// isHighEntropyToken checks token looks like random generated key: it must be long enough,
+// contain upper and lower case letters and digits mixed together, so long identifiers and hex checksums are not matched
+func (r *SecretRedactor) isHighEntropyToken(token string) bool {
+	if r.entropyThreshold <= 0 || len(token) < r.entropyMinLength {
+		return false
+	}
+	var classes [4]bool
+	switches := 0
+	prevClass := -1
+	for _, c := range token {
+		class := getCharClass(c)
+		classes[class] = true
+		if prevClass >= 0 && class != prevClass {
+			switches++
+		}
+		prevClass = class
+	}
+	if !classes[1] || !classes[2] || !classes[3] || float64(switches) < float64(len(token)-1)*secretMinClassSwitchRatio {
+		return false
+	}
+	return getShannonEntropy(token) >= r.entropyThreshold
+}
+
+// findSecrets returns sorted non-overlapping positions of secrets found in the text
+func (r *SecretRedactor) findSecrets(text string) [][2]int {
+	var ranges [][2]int
+	for _, rx := range r.secretsRx {
+		for _, match := range rx.FindAllStringSubmatchIndex(text, -1) {
+			if len(match) >= 4 && match[2] >= 0 {
+				ranges = append(ranges, [2]int{match[2], match[3]})
+			} else {
+				ranges = append(ranges, [2]int{match[0], match[1]})
+			}
+		}
+	}
+	for _, match := range secretCandidateRx.FindAllStringIndex(text, -1) {
+		if r.isHighEntropyToken(text[match[0]:match[1]]) {
+			ranges = append(ranges, [2]int{match[0], match[1]})
+		}
+	}
+
+	// Merge overlapping secrets, drop empty matches and text that is already redacted
+	slices.SortFunc(ranges, func(a, b [2]int) int { return a[0] - b[0] })
+	var result [][2]int
+	for _, rng := range ranges {
+		if rng[0] >= rng[1] || secretPlaceholderRx.MatchString(text[rng[0]:rng[1]]) {
+			continue
+		}
+		if last := len(result) - 1; last >= 0 && rng[0] < result[last][1] {
+			result[last][1] = max(result[last][1], rng[1])
+			continue
+		}
+		result = append(result, rng)
+	}
+	return result
+}
+
+// RedactedSecret is the position of replaced secret: [start, end) rune offsets of the secret in the original text,
+// and of its placeholder in the redacted text
+type RedactedSecret struct {
+	Original [2]int
+	Redacted [2]int
+}
+
+// Redact replaces secrets with placeholders, returns redacted text and number of replaced secrets
+func (r *SecretRedactor) Redact(text string) (string, int) {
+	result, secrets := r.RedactWithMapping(text)
+	return result, len(secrets)
+}
+
+// RedactWithMapping replaces secrets with placeholders, returns redacted text and positions of replaced secrets,
+// so offsets in redacted text can be mapped back to the original text with MapRedactedRanges
+func (r *SecretRedactor) RedactWithMapping(text string) (string, []RedactedSecret) {
+	if r == nil {
+		return text, nil
+	}
+	ranges := r.findSecrets(text)
+	if len(ranges) < 1 {
+		return text, nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]byte, 0, len(text))
+	var secrets []RedactedSecret
+	pos := 0
+	originalRunes := 0
+	redactedRunes := 0
+	for _, rng := range ranges {
+		secret := text[rng[0]:rng[1]]
+		placeholder := getSecretPlaceholder(secret)
+		r.secrets[placeholder] = secret
+		result = append(result, text[pos:rng[0]]...)
+		result = append(result, placeholder...)
+		// Placeholder contains only ASCII characters, so its length in runes equals its length in bytes
+		prefixRunes := utf8.RuneCountInString(text[pos:rng[0]])
+		secretRunes := utf8.RuneCountInString(secret)
+		secrets = append(secrets, RedactedSecret{
+			Original: [2]int{originalRunes + prefixRunes, originalRunes + prefixRunes + secretRunes},
+			Redacted: [2]int{redactedRunes + prefixRunes, redactedRunes + prefixRunes + len(placeholder)},
+		})
+		originalRunes += prefixRunes + secretRunes
+		redactedRunes += prefixRunes + len(placeholder)
+		pos = rng[1]
+	}
+	result = append(result, text[pos:]...)
+	return string(result), secrets
+}
+
+// MapRedactedRanges converts [start, end) rune offsets in the text redacted by RedactWithMapping to offsets in the original text,
+// ranges starting or ending inside a placeholder are extended to cover the whole secret
+func MapRedactedRanges(ranges [][2]int, secrets []RedactedSecret) [][2]int {
+	mapOffset := func(offset int, isEnd bool) int {
+		delta := 0
+		for _, secret := range secrets {
+			if offset <= secret.Redacted[0] {
+				break
+			}
+			if offset < secret.Redacted[1] {
+				if isEnd {
+					return secret.Original[1]
+				}
+				return secret.Original[0]
+			}
+			delta = secret.Original[1] - secret.Redacted[1]
+		}
+		return offset + delta
+	}
+	result := make([][2]int, len(ranges))
+	for i, r := range ranges {
+		result[i] = [2]int{mapOffset(r[0], false), mapOffset(r[1], true)}
+	}
+	return result
+}
+
+// Register remembers secrets found in the text without redacting it,
+// so placeholders produced from this text in previous runs can be restored
+func (r *SecretRedactor) Register(text string) {
+	r.Redact(text)
+}
+
+// Restore replaces known placeholders with original secrets, returns restored text and unknown placeholders left as is
+func (r *SecretRedactor) Restore(text string) (string, []string) {
+	if r == nil {
+		return text, nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	var unknown []string
+	result := secretPlaceholderRx.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if secret, ok := r.secrets[placeholder]; ok {
+			return secret
+		}
+		if !slices.Contains(unknown, placeholder) {
+			unknown = append(unknown, placeholder)
+		}
+		return placeholder
+	})
+	return result, unknown
+}
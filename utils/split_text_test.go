@@ -1,6 +1,9 @@
 package utils
 
 import (
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -101,3 +104,103 @@ func TestSplitTextToChunks(t *testing.T) {
 		})
 	}
 }
+
+func TestSplitTextAtBoundaries(t *testing.T) {
+	boundaryRx := regexp.MustCompile(`(?m)^(?://[^\n]*\n)*func\b`)
+	testCases := []struct {
+		name           string
+		sourceText     string
+		boundaryRx     *regexp.Regexp
+		chunkSize      int
+		chunkOverlap   int
+		expectedChunks []string
+	}{
+		{
+			name:           "Empty text",
+			sourceText:     "",
+			boundaryRx:     boundaryRx,
+			chunkSize:      10,
+			expectedChunks: []string{},
+		},
+		{
+			name:           "Text smaller than chunk size",
+			sourceText:     "func a() {}\n",
+			boundaryRx:     boundaryRx,
+			chunkSize:      20,
+			expectedChunks: []string{"func a() {}\n"},
+		},
+		{
+			name:           "Segments packed into chunks",
+			sourceText:     "package x\n\nfunc a() {}\n// comment\nfunc b() {}\nfunc c() {}\n",
+			boundaryRx:     boundaryRx,
+			chunkSize:      36,
+			expectedChunks: []string{"package x\n\nfunc a() {}\n", "// comment\nfunc b() {}\nfunc c() {}\n"},
+		},
+		{
+			name:           "Large segment split with overlap",
+			sourceText:     "func a() {}\nfunc b() { return 1234567890 }\n",
+			boundaryRx:     boundaryRx,
+			chunkSize:      20,
+			chunkOverlap:   2,
+			expectedChunks: []string{"func a() {}\n", "func b() { return 12", "return 1234567890 }\n"},
+		},
+		{
+			name:           "No boundary regexp",
+			sourceText:     "Hello world!",
+			boundaryRx:     nil,
+			chunkSize:      6,
+			chunkOverlap:   0,
+			expectedChunks: []string{"Hello ", "world!"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result := SplitTextAtBoundaries(tc.sourceText, tc.boundaryRx, tc.chunkSize, tc.chunkOverlap)
+
+			if len(result) != len(tc.expectedChunks) {
+				t.Errorf("Expected %d chunks, got %d: %q", len(tc.expectedChunks), len(result), result)
+				return
+			}
+
+			for i, chunk := range result {
+				if chunk != tc.expectedChunks[i] {
+					t.Errorf("Chunk %d mismatch:\nExpected: %q\nGot:      %q", i, tc.expectedChunks[i], chunk)
+				}
+			}
+			if tc.chunkOverlap == 0 && strings.Join(result, "") != tc.sourceText {
+				t.Errorf("Chunks do not add up to source text")
+			}
+		})
+	}
+}
+
+func TestGetTextChunksRanges(t *testing.T) {
+	testCases := []struct {
+		textLength   int
+		chunkSize    int
+		chunkOverlap int
+		expected     [][2]int
+	}{
+		{0, 10, 0, [][2]int{}},
+		{5, 10, 3, [][2]int{{0, 5}}},
+		{20, 5, 5, [][2]int{{0, 20}}},
+		{20, 10, 0, [][2]int{{0, 10}, {10, 20}}},
+		{20, 10, 3, [][2]int{{0, 10}, {7, 17}, {10, 20}}},
+		{12, 10, 2, [][2]int{{0, 10}, {2, 12}}},
+	}
+	for _, tc := range testCases {
+		if result := GetTextChunksRanges(tc.textLength, tc.chunkSize, tc.chunkOverlap); !reflect.DeepEqual(result, tc.expected) {
+			t.Errorf("GetTextChunksRanges(%d, %d, %d) = %v, want %v", tc.textLength, tc.chunkSize, tc.chunkOverlap, result, tc.expected)
+		}
+	}
+}
+
+func TestGetLineRanges(t *testing.T) {
+	text := "line1\nline2\nline3\n"
+	result := GetLineRanges(text, [][2]int{{0, 5}, {0, 6}, {3, 9}, {12, 18}, {0, 0}})
+	expected := [][2]int{{1, 1}, {1, 1}, {1, 2}, {3, 3}, {1, 1}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %v, got %v", expected, result)
+	}
+}
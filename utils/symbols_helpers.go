@@ -0,0 +1,256 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const SymbolsFileName = ".symbols.json"
+
+// Symbol is a top-level declaration found in the project file without using LLM.
+// Kind is one of: type, func, method, const, var, import for Go files,
+// or the name of the capture group that matched the symbol for regexp-based extractors
+type Symbol struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	Line int    `json:"line"`
+}
+
+// SymbolDefinition is a location of the symbol definition in the project
+type SymbolDefinition struct {
+	File   string
+	Symbol Symbol
+}
+
+type symbolsEntry struct {
+	Filename string   `json:"filename"`
+	Checksum string   `json:"checksum"`
+	Symbols  []Symbol `json:"symbols"`
+}
+
+var identifierRx = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z_][A-Za-z0-9_]*)*`)
+
+// GetSymbolsChecksum calculates checksum of the symbol index entry from the file checksum and the extractor used,
+// so symbols are extracted again when either the file or the extractor regexp changes
+func GetSymbolsChecksum(fileChecksum, extractorRx string) string {
+	hash := sha256.Sum256([]byte(fileChecksum + "\x00" + extractorRx))
+	return hex.EncodeToString(hash[:])
+}
+
+// ExtractSymbols returns top-level declarations of the file.
+// Go source files are parsed with go/parser, extractorRx is used for other files,
+// or when Go file cannot be parsed. Returns empty list when no extractor is available for the file
+func ExtractSymbols(filePath, fileContents string, extractorRx *regexp.Regexp) []Symbol {
+	if strings.EqualFold(filepath.Ext(filePath), ".go") {
+		if symbols, err := ExtractGoSymbols(fileContents); err == nil {
+			return symbols
+		}
+	}
+	if extractorRx == nil {
+		return []Symbol{}
+	}
+	return ExtractSymbolsWithRegexp(fileContents, extractorRx)
+}
+
+func getReceiverTypeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return getReceiverTypeName(t.X)
+	case *ast.ParenExpr:
+		return getReceiverTypeName(t.X)
+	case *ast.IndexExpr:
+		return getReceiverTypeName(t.X)
+	case *ast.IndexListExpr:
+		return getReceiverTypeName(t.X)
+	}
+	return ""
+}
+
+// ExtractGoSymbols parses Go source file and returns its imports and top-level declarations,
+// methods are named as <receiver type>.<method name>
+func ExtractGoSymbols(fileContents string) ([]Symbol, error) {
+	fileSet := token.NewFileSet()
+	file, err := parser.ParseFile(fileSet, "", fileContents, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, err
+	}
+	symbols := []Symbol{}
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil {
+			symbols = append(symbols, Symbol{Name: path, Kind: "import", Line: fileSet.Position(spec.Pos()).Line})
+		}
+	}
+	for _, decl := range file.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				name := d.Name.Name
+				if receiver := getReceiverTypeName(d.Recv.List[0].Type); receiver != "" {
+					name = receiver + "." + name
+				}
+				symbols = append(symbols, Symbol{Name: name, Kind: "method", Line: fileSet.Position(d.Pos()).Line})
+			} else {
+				symbols = append(symbols, Symbol{Name: d.Name.Name, Kind: "func", Line: fileSet.Position(d.Pos()).Line})
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.TypeSpec:
+					symbols = append(symbols, Symbol{Name: s.Name.Name, Kind: "type", Line: fileSet.Position(s.Pos()).Line})
+				case *ast.ValueSpec:
+					kind := "var"
+					if d.Tok == token.CONST {
+						kind = "const"
+					}
+					for _, name := range s.Names {
+						if name.Name != "_" {
+							symbols = append(symbols, Symbol{Name: name.Name, Kind: kind, Line: fileSet.Position(name.Pos()).Line})
+						}
+					}
+				}
+			}
+		}
+	}
+	return symbols, nil
+}
+
+// ExtractSymbolsWithRegexp returns symbols matched by named capture groups of the regexp,
+// the name of the first non-empty group of each match is used as the symbol kind
+func ExtractSymbolsWithRegexp(fileContents string, extractorRx *regexp.Regexp) []Symbol {
+	symbols := []Symbol{}
+	groupNames := extractorRx.SubexpNames()
+	pos, line := 0, 1
+	for _, match := range extractorRx.FindAllStringSubmatchIndex(fileContents, -1) {
+		for i := 1; i < len(groupNames); i++ {
+			start, end := match[2*i], match[2*i+1]
+			if groupNames[i] == "" || start < 0 || start == end {
+				continue
+			}
+			line += strings.Count(fileContents[pos:start], "\n")
+			pos = start
+			symbols = append(symbols, Symbol{Name: fileContents[start:end], Kind: groupNames[i], Line: line})
+			break
+		}
+	}
+	return symbols
+}
+
+// FormatSymbols creates brief listing of symbol names grouped by kind, with no more than maxCount names.
+// Imports are listed last, so declarations are not dropped in favor of them. Returns empty string if there are no symbols to list
+func FormatSymbols(symbols []Symbol, maxCount int) string {
+	var kinds []string
+	names := map[string][]string{}
+	total := 0
+	for _, symbol := range symbols {
+		if slices.Contains(names[symbol.Kind], symbol.Name) {
+			continue
+		}
+		if _, exist := names[symbol.Kind]; !exist {
+			kinds = append(kinds, symbol.Kind)
+		}
+		names[symbol.Kind] = append(names[symbol.Kind], symbol.Name)
+		total++
+	}
+	if idx := slices.Index(kinds, "import"); idx >= 0 {
+		kinds = append(slices.Delete(kinds, idx, idx+1), "import")
+	}
+	var result strings.Builder
+	count := 0
+	for _, kind := range kinds {
+		if count >= maxCount {
+			break
+		}
+		list := names[kind][:min(len(names[kind]), maxCount-count)]
+		count += len(list)
+		fmt.Fprintf(&result, "- %s: %s\n", kind, strings.Join(list, ", "))
+	}
+	if total > count {
+		fmt.Fprintf(&result, "- (%d more)\n", total-count)
+	}
+	return strings.TrimSuffix(result.String(), "\n")
+}
+
+// FindSymbolDefinitions finds definitions of symbols mentioned in the text (imports are not considered definitions).
+// Methods also match by their name without receiver type, names qualified with package or receiver in the text
+// also match by their unqualified part. Names defined in more than maxPerName places
+// are considered too generic and skipped. Results are sorted by file name and line
+func FindSymbolDefinitions(symbols map[string][]Symbol, text string, maxPerName int) []SymbolDefinition {
+	identifiers := map[string]bool{}
+	for _, identifier := range identifierRx.FindAllString(text, -1) {
+		// Qualified names also match by every dot-separated suffix, e.g. "utils.LoadSymbols" matches "LoadSymbols"
+		for {
+			if len(identifier) > 2 {
+				identifiers[identifier] = true
+			}
+			dot := strings.Index(identifier, ".")
+			if dot < 0 {
+				break
+			}
+			identifier = identifier[dot+1:]
+		}
+	}
+	found := map[string][]SymbolDefinition{}
+	for file, fileSymbols := range symbols {
+		for _, symbol := range fileSymbols {
+			if symbol.Kind == "import" {
+				continue
+			}
+			if identifiers[symbol.Name] {
+				found[symbol.Name] = append(found[symbol.Name], SymbolDefinition{File: file, Symbol: symbol})
+			} else if dot := strings.LastIndex(symbol.Name, "."); dot >= 0 && identifiers[symbol.Name[dot+1:]] {
+				found[symbol.Name[dot+1:]] = append(found[symbol.Name[dot+1:]], SymbolDefinition{File: file, Symbol: symbol})
+			}
+		}
+	}
+	var result []SymbolDefinition
+	for _, definitions := range found {
+		if len(definitions) <= maxPerName {
+			result = append(result, definitions...)
+		}
+	}
+	slices.SortFunc(result, func(a, b SymbolDefinition) int {
+		if a.File != b.File {
+			return strings.Compare(a.File, b.File)
+		}
+		return a.Symbol.Line - b.Symbol.Line
+	})
+	return result
+}
+
+// LoadSymbols returns symbols and checksums of project files from the symbol index, empty maps if index file is missing
+func LoadSymbols(filePath string) (map[string][]Symbol, map[string]string) {
+	var entries []symbolsEntry
+	if err := LoadJsonFile(filePath, &entries); err != nil {
+		entries = nil
+	}
+	symbols := map[string][]Symbol{}
+	checksums := map[string]string{}
+	for _, entry := range entries {
+		symbols[entry.Filename] = entry.Symbols
+		checksums[entry.Filename] = entry.Checksum
+	}
+	return symbols, checksums
+}
+
+// SaveSymbols saves symbols of files listed in checksums map to the symbol index
+func SaveSymbols(filePath string, checksums map[string]string, symbols map[string][]Symbol) error {
+	var entries []symbolsEntry
+	for filename, checksum := range checksums {
+		if fileSymbols, ok := symbols[filename]; ok {
+			entries = append(entries, symbolsEntry{Filename: filename, Checksum: checksum, Symbols: fileSymbols})
+		}
+	}
+	slices.SortFunc(entries, func(a, b symbolsEntry) int { return strings.Compare(a.Filename, b.Filename) })
+	return SaveJsonFile(filePath, entries)
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+const testGoSource = `package main
+
+import (
+	"fmt"
+	cfg "github.com/example/config"
+)
+
+const MaxItems, _ = 10, 0
+
+var defaultName = "main"
+
+type Config struct{}
+
+type List[T any] []T
+
+func (c *Config) Load() error { return nil }
+
+func (l List[T]) Len() int { return len(l) }
+
+func NewConfig() *Config { fmt.Println(cfg.Name); return nil }
+`
+
+func TestExtractGoSymbols(t *testing.T) {
+	symbols, err := ExtractGoSymbols(testGoSource)
+	if err != nil {
+		t.Fatalf("ExtractGoSymbols() error = %v", err)
+	}
+	expected := []Symbol{
+		{Name: "fmt", Kind: "import", Line: 4},
+		{Name: "github.com/example/config", Kind: "import", Line: 5},
+		{Name: "MaxItems", Kind: "const", Line: 8},
+		{Name: "defaultName", Kind: "var", Line: 10},
+		{Name: "Config", Kind: "type", Line: 12},
+		{Name: "List", Kind: "type", Line: 14},
+		{Name: "Config.Load", Kind: "method", Line: 16},
+		{Name: "List.Len", Kind: "method", Line: 18},
+		{Name: "NewConfig", Kind: "func", Line: 20},
+	}
+	if !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("ExtractGoSymbols() = %v, want %v", symbols, expected)
+	}
+	if _, err := ExtractGoSymbols("package main\nfunc broken( {"); err == nil {
+		t.Errorf("ExtractGoSymbols() expected error for invalid source")
+	}
+}
+
+func TestExtractSymbols(t *testing.T) {
+	pyRx := regexp.MustCompile(`(?m)^(?:class[ \t]+(?P<class>\w+)|(?:async[ \t]+)?def[ \t]+(?P<func>\w+)|[ \t]+(?:async[ \t]+)?def[ \t]+(?P<method>\w+)|import[ \t]+(?P<import>[\w.]+)|from[ \t]+(?P<import>[\w.]+)[ \t]+import\b)`)
+	pySource := "import os\nfrom app.models import User\n\nclass Service:\n    def run(self):\n        pass\n\nasync def main():\n    pass\n"
+	expected := []Symbol{
+		{Name: "os", Kind: "import", Line: 1},
+		{Name: "app.models", Kind: "import", Line: 2},
+		{Name: "Service", Kind: "class", Line: 4},
+		{Name: "run", Kind: "method", Line: 5},
+		{Name: "main", Kind: "func", Line: 8},
+	}
+	if symbols := ExtractSymbols("app/service.py", pySource, pyRx); !reflect.DeepEqual(symbols, expected) {
+		t.Errorf("ExtractSymbols() = %v, want %v", symbols, expected)
+	}
+	if symbols := ExtractSymbols("readme.txt", "text", nil); len(symbols) != 0 {
+		t.Errorf("ExtractSymbols() without extractor = %v", symbols)
+	}
+	// Go files that cannot be parsed use regexp extractor
+	goRx := regexp.MustCompile(`(?m)^func\s+(?P<func>\w+)`)
+	if symbols := ExtractSymbols("main.go", "func Broken( {\n", goRx); !reflect.DeepEqual(symbols, []Symbol{{Name: "Broken", Kind: "func", Line: 1}}) {
+		t.Errorf("ExtractSymbols() fallback = %v", symbols)
+	}
+}
+
+func TestFormatSymbols(t *testing.T) {
+	symbols := []Symbol{
+		{Name: "fmt", Kind: "import"},
+		{Name: "Config", Kind: "type"},
+		{Name: "Config.Load", Kind: "method"},
+		{Name: "Config.Save", Kind: "method"},
+		{Name: "Config", Kind: "type"},
+		{Name: "NewConfig", Kind: "func"},
+	}
+	if result := FormatSymbols(symbols, 10); result != "- type: Config\n- method: Config.Load, Config.Save\n- func: NewConfig\n- import: fmt" {
+		t.Errorf("FormatSymbols() = %q", result)
+	}
+	if result := FormatSymbols(symbols, 3); result != "- type: Config\n- method: Config.Load, Config.Save\n- (2 more)" {
+		t.Errorf("FormatSymbols() with limit = %q", result)
+	}
+	if result := FormatSymbols(nil, 10); result != "" {
+		t.Errorf("FormatSymbols() without symbols = %q", result)
+	}
+}
+
+func TestFindSymbolDefinitions(t *testing.T) {
+	symbols := map[string][]Symbol{
+		"config.go": {{Name: "fmt", Kind: "import", Line: 3}, {Name: "Config", Kind: "type", Line: 5}, {Name: "Config.Load", Kind: "method", Line: 9}},
+		"a.go":      {{Name: "Run", Kind: "func", Line: 1}},
+		"b.go":      {{Name: "Run", Kind: "func", Line: 1}},
+		"c.go":      {{Name: "Run", Kind: "func", Line: 1}},
+	}
+	definitions := FindSymbolDefinitions(symbols, "Where is Load method of Config defined? How fmt is used? Run it", 2)
+	expected := []SymbolDefinition{
+		{File: "config.go", Symbol: Symbol{Name: "Config", Kind: "type", Line: 5}},
+		{File: "config.go", Symbol: Symbol{Name: "Config.Load", Kind: "method", Line: 9}},
+	}
+	if !reflect.DeepEqual(definitions, expected) {
+		t.Errorf("FindSymbolDefinitions() = %v, want %v", definitions, expected)
+	}
+}
+
+func TestFindSymbolDefinitionsQualified(t *testing.T) {
+	symbols := map[string][]Symbol{
+		"utils/symbols.go": {{Name: "LoadSymbols", Kind: "func", Line: 7}, {Name: "SymbolsFileName", Kind: "const", Line: 3}},
+		"config/config.go": {{Name: "Config", Kind: "type", Line: 5}, {Name: "Config.Load", Kind: "method", Line: 9}},
+	}
+	definitions := FindSymbolDefinitions(symbols, "Why utils.LoadSymbols ignores utils.SymbolsFileName? See cfg.Config.Load", 2)
+	expected := []SymbolDefinition{
+		{File: "config/config.go", Symbol: Symbol{Name: "Config.Load", Kind: "method", Line: 9}},
+		{File: "utils/symbols.go", Symbol: Symbol{Name: "SymbolsFileName", Kind: "const", Line: 3}},
+		{File: "utils/symbols.go", Symbol: Symbol{Name: "LoadSymbols", Kind: "func", Line: 7}},
+	}
+	if !reflect.DeepEqual(definitions, expected) {
+		t.Errorf("FindSymbolDefinitions() = %v, want %v", definitions, expected)
+	}
+}
+
+func TestSaveLoadSymbols(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), SymbolsFileName)
+	if symbols, _ := LoadSymbols(filePath); len(symbols) != 0 {
+		t.Errorf("symbols loaded from missing file: %v", symbols)
+	}
+	symbols := map[string][]Symbol{"main.go": {{Name: "main", Kind: "func", Line: 3}}, "stale.go": {}}
+	if err := SaveSymbols(filePath, map[string]string{"main.go": "sum-main", "readme.txt": "sum-readme"}, symbols); err != nil {
+		t.Fatalf("SaveSymbols() failed: %v", err)
+	}
+	loaded, checksums := LoadSymbols(filePath)
+	if !reflect.DeepEqual(loaded, map[string][]Symbol{"main.go": symbols["main.go"]}) || !reflect.DeepEqual(checksums, map[string]string{"main.go": "sum-main"}) {
+		t.Errorf("LoadSymbols() = %v, %v", loaded, checksums)
+	}
+	if GetSymbolsChecksum("sum-main", "") == GetSymbolsChecksum("sum-main", "rx") {
+		t.Errorf("symbols checksum does not depend on extractor")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"regexp"
 	"strings"
+	"unicode"
 )
 
 type TagPair struct {
@@ -238,33 +239,168 @@ func GetOddRegexps(arr []*regexp.Regexp) []*regexp.Regexp {
 }
 
 func SplitTextToChunks(sourceText string, chunkSize, chunkOverlap int) []string {
-	if len(sourceText) < 1 {
-		return []string{}
+	sourceRunes := []rune(sourceText)
+	result := []string{}
+	for _, r := range GetTextChunksRanges(len(sourceRunes), chunkSize, chunkOverlap) {
+		result = append(result, string(sourceRunes[r[0]:r[1]]))
 	}
+	return result
+}
 
-	if chunkOverlap >= chunkSize {
-		return []string{sourceText}
+// GetTextChunksRanges returns [start, end) rune offsets of the chunks of text with textLength runes,
+// chunks have chunkSize runes and overlap by chunkOverlap runes, the last chunk is aligned to the end of text
+func GetTextChunksRanges(textLength, chunkSize, chunkOverlap int) [][2]int {
+	if textLength < 1 {
+		return [][2]int{}
 	}
+	if chunkOverlap >= chunkSize || textLength <= chunkSize {
+		return [][2]int{{0, textLength}}
+	}
+	result := [][2]int{}
+	start := 0
+	//leave the last chunk untouched
+	for textLength-start > chunkSize {
+		result = append(result, [2]int{start, start + chunkSize})
+		//mind the overlap from start
+		skip := chunkSize - chunkOverlap
+		if textLength-start-skip < chunkSize {
+			skip = textLength - start - chunkSize
+		}
+		start += skip
+	}
+	//remaining text is a full chunk
+	result = append(result, [2]int{start, textLength})
+	return result
+}
 
+// GetLineRanges converts [start, end) rune offsets of text fragments to 1-based inclusive line numbers
+func GetLineRanges(sourceText string, ranges [][2]int) [][2]int {
+	// lineAt[i] is the line number of the rune at offset i
 	sourceRunes := []rune(sourceText)
-	// single chunk text
-	if len(sourceRunes) <= chunkSize {
+	lineAt := make([]int, len(sourceRunes)+1)
+	line := 1
+	for i, r := range sourceRunes {
+		lineAt[i] = line
+		if r == '\n' {
+			line++
+		}
+	}
+	lineAt[len(sourceRunes)] = line
+	result := make([][2]int, len(ranges))
+	for i, r := range ranges {
+		start := min(max(r[0], 0), len(sourceRunes))
+		end := min(max(r[1]-1, start), len(sourceRunes))
+		result[i] = [2]int{lineAt[start], lineAt[end]}
+	}
+	return result
+}
+
+// SplitTextAtBoundaries splits text into chunks of no more than chunkSize runes at positions where boundaryRx matches,
+// for example at the beginning of functions or classes. Consecutive segments between boundaries are packed into one chunk
+// while it fits the size limit. Segments larger than chunkSize, or whole text if boundaryRx is nil,
+// are split with SplitTextToChunks using chunkOverlap
+func SplitTextAtBoundaries(sourceText string, boundaryRx *regexp.Regexp, chunkSize, chunkOverlap int) []string {
+	if boundaryRx == nil {
+		return SplitTextToChunks(sourceText, chunkSize, chunkOverlap)
+	}
+	if len(sourceText) < 1 {
+		return []string{}
+	}
+	if len([]rune(sourceText)) <= chunkSize {
 		return []string{sourceText}
 	}
 
+	var segments []string
+	start := 0
+	for _, loc := range boundaryRx.FindAllStringIndex(sourceText, -1) {
+		if loc[0] > start {
+			segments = append(segments, sourceText[start:loc[0]])
+			start = loc[0]
+		}
+	}
+	segments = append(segments, sourceText[start:])
+
 	result := []string{}
-	//copy source runes chunk by chunk, mind the overlap from start
-	//leave the last chunk untouched
-	for len(sourceRunes) > chunkSize {
-		//copy chunk from start
-		result = append(result, string(sourceRunes[:chunkSize]))
-		skip := chunkSize - chunkOverlap
-		if len(sourceRunes)-skip < chunkSize {
-			skip = len(sourceRunes) - chunkSize
+	var chunk strings.Builder
+	chunkLen := 0
+	flush := func() {
+		if chunkLen > 0 {
+			result = append(result, chunk.String())
+			chunk.Reset()
+			chunkLen = 0
+		}
+	}
+	for _, segment := range segments {
+		segmentLen := len([]rune(segment))
+		if segmentLen > chunkSize {
+			flush()
+			result = append(result, SplitTextToChunks(segment, chunkSize, chunkOverlap)...)
+			continue
+		}
+		if chunkLen+segmentLen > chunkSize {
+			flush()
 		}
-		sourceRunes = sourceRunes[skip:]
+		chunk.WriteString(segment)
+		chunkLen += segmentLen
 	}
-	//sourceRunes slice now contains full chunk, add it and return
-	result = append(result, string(sourceRunes))
+	flush()
 	return result
 }
+
+var keywordTokenRx = regexp.MustCompile(`[\p{L}\p{N}_]+`)
+
+// SplitIdentifier splits snake_case and camelCase identifiers into parts
+func SplitIdentifier(token string) []string {
+	var parts []string
+	for _, word := range strings.Split(token, "_") {
+		runes := []rune(word)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsUpper(runes[i]) && !unicode.IsUpper(runes[i-1])
+			// Last upper-case letter of an acronym starts the next part: HTTPServer -> HTTP, Server
+			acronymEnd := unicode.IsUpper(runes[i]) && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			letterToDigit := unicode.IsDigit(runes[i]) != unicode.IsDigit(runes[i-1])
+			if lowerToUpper || acronymEnd || letterToDigit {
+				parts = append(parts, string(runes[start:i]))
+				start = i
+			}
+		}
+		if start < len(runes) {
+			parts = append(parts, string(runes[start:]))
+		}
+	}
+	return parts
+}
+
+func isKeywordTerm(term string) bool {
+	if len([]rune(term)) < 2 {
+		return false
+	}
+	for _, r := range term {
+		if !unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenizeKeywords returns lower-case terms of the text: whole identifiers and their snake_case/camelCase parts
+func TokenizeKeywords(text string) []string {
+	var terms []string
+	for _, token := range keywordTokenRx.FindAllString(text, -1) {
+		whole := strings.ToLower(token)
+		if isKeywordTerm(whole) {
+			terms = append(terms, whole)
+		}
+		parts := SplitIdentifier(token)
+		if len(parts) < 2 {
+			continue
+		}
+		for _, part := range parts {
+			if part = strings.ToLower(part); isKeywordTerm(part) {
+				terms = append(terms, part)
+			}
+		}
+	}
+	return terms
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"reflect"
 	"regexp"
 	"testing"
 )
@@ -1120,3 +1121,16 @@ func equalStringSlices(a, b []string) bool {
 	}
 	return true
 }
+
+func TestTokenizeKeywords(t *testing.T) {
+	terms := TokenizeKeywords(`GetProjectFileList("x", HTTPServer) // project_files_whitelist: 42 v2`)
+	expected := []string{
+		"getprojectfilelist", "get", "project", "file", "list",
+		"httpserver", "http", "server",
+		"project_files_whitelist", "project", "files", "whitelist",
+		"v2",
+	}
+	if !reflect.DeepEqual(terms, expected) {
+		t.Errorf("TokenizeKeywords() = %v, want %v", terms, expected)
+	}
+}
@@ -14,6 +14,8 @@ import (
 const DotEnvSuffixName = ".env"
 const AnnotationsFileName = ".annotations.json"
 const EmbeddingsFileName = ".embeddings.msgpack"
+const EmbeddingsIndexFileName = ".embeddings_index.msgpack"
+const KeywordsIndexFileName = ".keywords_index.msgpack"
 const StashesDirName = ".stash"
 const LockFileName = ".perpetual.lock"
 
@@ -50,25 +52,17 @@ func FindProjectRoot(logger logging.ILogger, isInternalCall bool) (string, strin
 			return projectRootDir, perpetualDir, fmt.Errorf("project directory is a symlink or reparse point: %s", projectRootDir)
 		}
 
-		// Handle lockfile
-		lockfilePath := filepath.Join(perpetualDir, LockFileName)
+		// Resources inside perpetualDir are protected with advisory locks (see LockProjectResource),
+		// locks held by the process are released on cleanup when top-level operation completes
 		if isInternalCall {
-			logger.Traceln("Checking lockfile:", lockfilePath)
-			// When called internally, only check that lockfile is present
-			if _, statErr := os.Stat(lockfilePath); statErr != nil {
-				logger.Errorf("Error requesting lockfile %s: %v", LockFileName, statErr)
-			}
+			logger.Traceln("Using project locks of the top-level operation")
 		} else {
-			logger.Traceln("Creating lockfile:", lockfilePath)
-			f, err := os.OpenFile(lockfilePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+			lockDir, err := prepareLockDir(perpetualDir)
 			if err != nil {
-				logger.Panicln("Failed to create lockfile, another instance might be running:", err)
+				return projectRootDir, perpetualDir, err
 			}
-			f.Close()
-			DeferGlobalCleanup(func() {
-				logger.Traceln("Removing lockfile:", lockfilePath)
-				os.Remove(lockfilePath)
-			})
+			logger.Traceln("Project lock directory:", lockDir)
+			DeferGlobalCleanup(releaseAllProjectLocks)
 		}
 	}
 	return projectRootDir, perpetualDir, err